@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	API_DEFAULT_PER_PAGE = 20
+	API_MAX_PER_PAGE     = 100
+)
+
+// /api/v1的错误响应，格式为{"error": {"status": 404, "message": "..."}}
+func APIError(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": gin.H{
+			"status":  status,
+			"message": message,
+		},
+	})
+}
+
+// 根据仓库返回的错误输出404或500
+func apiStoreError(c *gin.Context, err error) {
+	if err == models.ErrNotFound {
+		APIError(c, http.StatusNotFound, "resource not found")
+		return
+	}
+	APIError(c, http.StatusInternalServerError, err.Error())
+}
+
+// 保存文章或页面时的错误，slug重复输出409，slug不合法输出422
+func apiSaveError(c *gin.Context, err error) {
+	switch err {
+	case errSlugExists:
+		APIError(c, http.StatusConflict, err.Error())
+	case errInvalidSlug:
+		APIError(c, http.StatusUnprocessableEntity, err.Error())
+	default:
+		apiStoreError(c, err)
+	}
+}
+
+func apiData(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, gin.H{"data": data})
+}
+
+// 解析路径中的id，不合法时输出404
+func apiId(c *gin.Context) (uint, bool) {
+	id, err := parseId(c.Param("id"))
+	if err != nil {
+		APIError(c, http.StatusNotFound, "resource not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// 解析json请求体，不合法时输出400
+func apiBind(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		APIError(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func apiUser(c *gin.Context) *models.User {
+	user, _ := c.Get(CONTEXT_USER_KEY)
+	u, _ := user.(*models.User)
+	return u
+}
+
+// 分页信息
+type apiMeta struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+// 按查询参数page和per_page计算分页，返回当前页在列表中的起止位置
+func apiPaginate(c *gin.Context, total int) (start, end int, meta *apiMeta, ok bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		APIError(c, http.StatusBadRequest, "invalid page")
+		return
+	}
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(API_DEFAULT_PER_PAGE)))
+	if err != nil || perPage < 1 || perPage > API_MAX_PER_PAGE {
+		APIError(c, http.StatusBadRequest, "per_page must be between 1 and "+strconv.Itoa(API_MAX_PER_PAGE))
+		return
+	}
+	meta = &apiMeta{
+		Page:       page,
+		PerPage:    perPage,
+		Total:      total,
+		TotalPages: (total + perPage - 1) / perPage,
+	}
+	start = (page - 1) * perPage
+	if start > total {
+		start = total
+	}
+	end = start + perPage
+	if end > total {
+		end = total
+	}
+	return start, end, meta, true
+}
+
+func apiList(c *gin.Context, data interface{}, meta *apiMeta) {
+	c.JSON(http.StatusOK, gin.H{"data": data, "meta": meta})
+}
+
+// 解析布尔查询参数，参数为空时返回nil
+func apiQueryBool(c *gin.Context, key string) (*bool, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, true
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		APIError(c, http.StatusBadRequest, "invalid "+key)
+		return nil, false
+	}
+	return &b, true
+}
+
+type apiTag struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newAPITag(tag *models.Tag) *apiTag {
+	return &apiTag{
+		ID:        tag.ID,
+		Name:      tag.Name,
+		CreatedAt: tag.CreatedAt,
+		UpdatedAt: tag.UpdatedAt,
+	}
+}
+
+type apiPost struct {
+	ID          uint       `json:"id"`
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	Url         string     `json:"url"` // 固定链接
+	Body        string     `json:"body"`
+	View        int        `json:"view"`
+	IsPublished bool       `json:"is_published"`
+	State       string     `json:"state"`      // draft、scheduled或published
+	PublishAt   *time.Time `json:"publish_at"` // 发布时间，草稿为null
+	UserID      uint       `json:"user_id"`
+	Tags        []*apiTag  `json:"tags"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (ctl *Controller) newAPIPost(post *models.Post) *apiPost {
+	tags := make([]*apiTag, 0, len(post.Tags))
+	for _, tag := range post.Tags {
+		tags = append(tags, newAPITag(tag))
+	}
+	return &apiPost{
+		ID:          post.ID,
+		Title:       post.Title,
+		Slug:        post.Slug,
+		Url:         absoluteURL(ctl.permalinks.Post(post)),
+		Body:        post.Body,
+		View:        post.View,
+		IsPublished: post.IsPublished,
+		State:       post.State(),
+		PublishAt:   post.PublishAt,
+		UserID:      post.UserID,
+		Tags:        tags,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+	}
+}
+
+type apiPage struct {
+	ID          uint       `json:"id"`
+	Title       string     `json:"title"`
+	Slug        string     `json:"slug"`
+	Url         string     `json:"url"` // 固定链接
+	Body        string     `json:"body"`
+	View        int        `json:"view"`
+	IsPublished bool       `json:"is_published"`
+	State       string     `json:"state"`      // draft、scheduled或published
+	PublishAt   *time.Time `json:"publish_at"` // 发布时间，草稿为null
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (ctl *Controller) newAPIPage(page *models.Page) *apiPage {
+	return &apiPage{
+		ID:          page.ID,
+		Title:       page.Title,
+		Slug:        page.Slug,
+		Url:         absoluteURL(ctl.permalinks.Page(page)),
+		Body:        page.Body,
+		View:        page.View,
+		IsPublished: page.IsPublished,
+		State:       page.State(),
+		PublishAt:   page.PublishAt,
+		CreatedAt:   page.CreatedAt,
+		UpdatedAt:   page.UpdatedAt,
+	}
+}
+
+type apiLink struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Url       string    `json:"url"`
+	Sort      int       `json:"sort"`
+	View      int       `json:"view"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newAPILink(link *models.Link) *apiLink {
+	return &apiLink{
+		ID:        link.ID,
+		Name:      link.Name,
+		Url:       link.Url,
+		Sort:      link.Sort,
+		View:      link.View,
+		CreatedAt: link.CreatedAt,
+		UpdatedAt: link.UpdatedAt,
+	}
+}
+
+type apiComment struct {
+	ID         uint      `json:"id"`
+	PostID     uint      `json:"post_id"`
+	UserID     uint      `json:"user_id"`
+	ParentID   uint      `json:"parent_id"` //回复的评论id，0表示直接评论文章
+	Content    string    `json:"content"`
+	ReadState  bool      `json:"read_state"`
+	Deleted    bool      `json:"deleted"`
+	Status     string    `json:"status"`               //审核状态：pending, approved, spam, trash
+	GuestName  string    `json:"guest_name,omitempty"` //游客评论的昵称、邮箱和网站，user_id为0
+	GuestEmail string    `json:"guest_email,omitempty"`
+	GuestUrl   string    `json:"guest_url,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newAPIComment(comment *models.Comment) *apiComment {
+	return &apiComment{
+		ID:         comment.ID,
+		PostID:     comment.PostID,
+		UserID:     comment.UserID,
+		ParentID:   comment.ParentID,
+		Content:    comment.Content,
+		ReadState:  comment.ReadState,
+		Deleted:    comment.Deleted,
+		Status:     comment.Status,
+		GuestName:  comment.GuestName,
+		GuestEmail: comment.GuestEmail,
+		GuestUrl:   comment.GuestUrl,
+		CreatedAt:  comment.CreatedAt,
+	}
+}
+
+// 不返回订阅者的密钥和签名
+type apiSubscriber struct {
+	ID             uint      `json:"id"`
+	Email          string    `json:"email"`
+	VerifyState    bool      `json:"verify_state"`
+	SubscribeState bool      `json:"subscribe_state"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func newAPISubscriber(s *models.Subscriber) *apiSubscriber {
+	return &apiSubscriber{
+		ID:             s.ID,
+		Email:          s.Email,
+		VerifyState:    s.VerifyState,
+		SubscribeState: s.SubscribeState,
+		CreatedAt:      s.CreatedAt,
+		UpdatedAt:      s.UpdatedAt,
+	}
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"net/http"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+type apiCommentRequest struct {
+	ReadState *bool   `json:"read_state"`
+	Status    *string `json:"status"`
+}
+
+// 评论列表，按时间倒序，支持按post_id、read和status过滤
+func (ctl *Controller) APICommentList(c *gin.Context) {
+	var (
+		postId uint
+		err    error
+	)
+	if c.Query("post_id") != "" {
+		if postId, err = parseId(c.Query("post_id")); err != nil {
+			APIError(c, http.StatusBadRequest, "invalid post_id")
+			return
+		}
+	}
+	read, ok := apiQueryBool(c, "read")
+	if !ok {
+		return
+	}
+	status := c.Query("status")
+	if status != "" && !models.IsCommentStatus(status) {
+		APIError(c, http.StatusBadRequest, "invalid status")
+		return
+	}
+	comments, err := ctl.store.Comments().List()
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	filtered := make([]*models.Comment, 0, len(comments))
+	for _, comment := range comments {
+		if postId > 0 && comment.PostID != postId {
+			continue
+		}
+		if read != nil && comment.ReadState != *read {
+			continue
+		}
+		if status != "" && comment.Status != status {
+			continue
+		}
+		filtered = append(filtered, comment)
+	}
+	start, end, meta, ok := apiPaginate(c, len(filtered))
+	if !ok {
+		return
+	}
+	data := make([]*apiComment, 0, end-start)
+	for _, comment := range filtered[start:end] {
+		data = append(data, newAPIComment(comment))
+	}
+	apiList(c, data, meta)
+}
+
+func (ctl *Controller) apiGetComment(c *gin.Context) (*models.Comment, bool) {
+	id, ok := apiId(c)
+	if !ok {
+		return nil, false
+	}
+	comment, err := ctl.store.Comments().Get(id)
+	if err != nil {
+		apiStoreError(c, err)
+		return nil, false
+	}
+	return comment, true
+}
+
+func (ctl *Controller) APICommentGet(c *gin.Context) {
+	comment, ok := ctl.apiGetComment(c)
+	if !ok {
+		return
+	}
+	apiData(c, http.StatusOK, newAPIComment(comment))
+}
+
+// 评论只能标记为已读和修改审核状态，修改审核状态时同时标记为已读
+func (ctl *Controller) APICommentUpdate(c *gin.Context) {
+	comment, ok := ctl.apiGetComment(c)
+	if !ok {
+		return
+	}
+	var req apiCommentRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if req.Status != nil && !models.IsCommentStatus(*req.Status) {
+		APIError(c, http.StatusUnprocessableEntity, "invalid status")
+		return
+	}
+	if req.ReadState != nil {
+		if !*req.ReadState {
+			APIError(c, http.StatusUnprocessableEntity, "read_state can only be set to true")
+			return
+		}
+		if err := ctl.store.Comments().SetRead(comment.ID); err != nil {
+			apiStoreError(c, err)
+			return
+		}
+		comment.ReadState = true
+	}
+	if req.Status != nil {
+		if err := ctl.store.Comments().SetStatus(comment.ID, *req.Status); err != nil {
+			apiStoreError(c, err)
+			return
+		}
+		if *req.Status == models.COMMENT_STATUS_APPROVED && comment.Status == models.COMMENT_STATUS_PENDING {
+			ctl.notifyApprovedComment(comment)
+		}
+		comment.Status, comment.ReadState = *req.Status, true
+	}
+	apiData(c, http.StatusOK, newAPIComment(comment))
+}
+
+func (ctl *Controller) APICommentDelete(c *gin.Context) {
+	comment, ok := ctl.apiGetComment(c)
+	if !ok {
+		return
+	}
+	if err := ctl.store.Comments().Delete(comment.ID); err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"net/http"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+type apiLinkRequest struct {
+	Name *string `json:"name"`
+	Url  *string `json:"url"`
+	Sort *int    `json:"sort"`
+}
+
+func (ctl *Controller) APILinkList(c *gin.Context) {
+	links, err := ctl.store.Links().List()
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	start, end, meta, ok := apiPaginate(c, len(links))
+	if !ok {
+		return
+	}
+	data := make([]*apiLink, 0, end-start)
+	for _, link := range links[start:end] {
+		data = append(data, newAPILink(link))
+	}
+	apiList(c, data, meta)
+}
+
+func (ctl *Controller) apiGetLink(c *gin.Context) (*models.Link, bool) {
+	id, ok := apiId(c)
+	if !ok {
+		return nil, false
+	}
+	link, err := ctl.store.Links().Get(id)
+	if err != nil {
+		apiStoreError(c, err)
+		return nil, false
+	}
+	return link, true
+}
+
+// 校验链接，名称和地址不能为空，地址不能与其他链接重复
+func (ctl *Controller) apiCheckLink(c *gin.Context, link *models.Link) bool {
+	if link.Name == "" || link.Url == "" {
+		APIError(c, http.StatusUnprocessableEntity, "name and url cannot be empty")
+		return false
+	}
+	links, err := ctl.store.Links().List()
+	if err != nil {
+		apiStoreError(c, err)
+		return false
+	}
+	for _, item := range links {
+		if item.Url == link.Url && item.ID != link.ID {
+			APIError(c, http.StatusConflict, "link already exists")
+			return false
+		}
+	}
+	return true
+}
+
+func (ctl *Controller) APILinkGet(c *gin.Context) {
+	link, ok := ctl.apiGetLink(c)
+	if !ok {
+		return
+	}
+	apiData(c, http.StatusOK, newAPILink(link))
+}
+
+func (ctl *Controller) APILinkCreate(c *gin.Context) {
+	var req apiLinkRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	link := &models.Link{}
+	if req.Name != nil {
+		link.Name = *req.Name
+	}
+	if req.Url != nil {
+		link.Url = *req.Url
+	}
+	if req.Sort != nil {
+		link.Sort = *req.Sort
+	}
+	if !ctl.apiCheckLink(c, link) {
+		return
+	}
+	if err := ctl.store.Links().Create(link); err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	apiData(c, http.StatusCreated, newAPILink(link))
+}
+
+// 只修改请求中出现的字段
+func (ctl *Controller) APILinkUpdate(c *gin.Context) {
+	link, ok := ctl.apiGetLink(c)
+	if !ok {
+		return
+	}
+	var req apiLinkRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if req.Name != nil {
+		link.Name = *req.Name
+	}
+	if req.Url != nil {
+		link.Url = *req.Url
+	}
+	if req.Sort != nil {
+		link.Sort = *req.Sort
+	}
+	if !ctl.apiCheckLink(c, link) {
+		return
+	}
+	if err := ctl.store.Links().Update(link); err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	apiData(c, http.StatusOK, newAPILink(link))
+}
+
+func (ctl *Controller) APILinkDelete(c *gin.Context) {
+	link, ok := ctl.apiGetLink(c)
+	if !ok {
+		return
+	}
+	if err := ctl.store.Links().Delete(link.ID); err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
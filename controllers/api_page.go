@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+type apiPageRequest struct {
+	Title       *string    `json:"title"`
+	Slug        *string    `json:"slug"` //为空字符串时根据标题生成，修改后旧链接跳转到新地址
+	Body        *string    `json:"body"`
+	IsPublished *bool      `json:"is_published"`
+	State       *string    `json:"state"`      //draft、scheduled或published，优先于is_published
+	PublishAt   *time.Time `json:"publish_at"` //发布时间，定时发布时必须晚于当前时间
+}
+
+// 页面列表，支持按published和state过滤
+func (ctl *Controller) APIPageList(c *gin.Context) {
+	published, ok := apiQueryBool(c, "published")
+	if !ok {
+		return
+	}
+	state := c.Query("state")
+	pages, err := ctl.store.Pages().List(false)
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	filtered := make([]*models.Page, 0, len(pages))
+	for _, page := range pages {
+		if published != nil && page.IsPublished != *published {
+			continue
+		}
+		if state != "" && page.State() != state {
+			continue
+		}
+		filtered = append(filtered, page)
+	}
+	start, end, meta, ok := apiPaginate(c, len(filtered))
+	if !ok {
+		return
+	}
+	data := make([]*apiPage, 0, end-start)
+	for _, page := range filtered[start:end] {
+		data = append(data, ctl.newAPIPage(page))
+	}
+	apiList(c, data, meta)
+}
+
+func (ctl *Controller) apiGetPage(c *gin.Context) (*models.Page, bool) {
+	id, ok := apiId(c)
+	if !ok {
+		return nil, false
+	}
+	page, err := ctl.store.Pages().Get(id)
+	if err != nil {
+		apiStoreError(c, err)
+		return nil, false
+	}
+	return page, true
+}
+
+func (ctl *Controller) APIPageGet(c *gin.Context) {
+	page, ok := ctl.apiGetPage(c)
+	if !ok {
+		return
+	}
+	apiData(c, http.StatusOK, ctl.newAPIPage(page))
+}
+
+func (ctl *Controller) APIPageCreate(c *gin.Context) {
+	var req apiPageRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if req.Title == nil || *req.Title == "" {
+		APIError(c, http.StatusUnprocessableEntity, "title cannot be empty")
+		return
+	}
+	page := &models.Page{Title: *req.Title}
+	if req.Body != nil {
+		page.Body = *req.Body
+	}
+	if !apiSetPublishState(c, req.State, req.IsPublished, req.PublishAt, page.SetState) {
+		return
+	}
+	var slug string
+	if req.Slug != nil {
+		slug = *req.Slug
+	}
+	err := ctl.store.Transaction(func(tx models.Store) error {
+		if err := setPageSlug(tx, page, slug); err != nil {
+			return err
+		}
+		if err := tx.Pages().Create(page); err != nil {
+			return err
+		}
+		if err := saveSlugHistory(tx, models.SLUG_KIND_PAGE, page.ID, "", page.Slug); err != nil {
+			return err
+		}
+		return savePageRevision(tx, page, apiUser(c).ID)
+	})
+	if err != nil {
+		apiSaveError(c, err)
+		return
+	}
+	ctl.indexPage(page.ID)
+	apiData(c, http.StatusCreated, ctl.newAPIPage(page))
+}
+
+// 只修改请求中出现的字段
+func (ctl *Controller) APIPageUpdate(c *gin.Context) {
+	page, ok := ctl.apiGetPage(c)
+	if !ok {
+		return
+	}
+	var req apiPageRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if req.Title != nil {
+		if *req.Title == "" {
+			APIError(c, http.StatusUnprocessableEntity, "title cannot be empty")
+			return
+		}
+		page.Title = *req.Title
+	}
+	if req.Body != nil {
+		page.Body = *req.Body
+	}
+	if !apiSetPublishState(c, req.State, req.IsPublished, req.PublishAt, page.SetState) {
+		return
+	}
+	oldSlug := page.Slug
+	err := ctl.store.Transaction(func(tx models.Store) error {
+		if req.Slug != nil {
+			if err := setPageSlug(tx, page, *req.Slug); err != nil {
+				return err
+			}
+		}
+		if err := tx.Pages().Update(page); err != nil {
+			return err
+		}
+		if err := saveSlugHistory(tx, models.SLUG_KIND_PAGE, page.ID, oldSlug, page.Slug); err != nil {
+			return err
+		}
+		return savePageRevision(tx, page, apiUser(c).ID)
+	})
+	if err != nil {
+		apiSaveError(c, err)
+		return
+	}
+	ctl.indexPage(page.ID)
+	page, err = ctl.store.Pages().Get(page.ID)
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	apiData(c, http.StatusOK, ctl.newAPIPage(page))
+}
+
+func (ctl *Controller) APIPageDelete(c *gin.Context) {
+	page, ok := ctl.apiGetPage(c)
+	if !ok {
+		return
+	}
+	err := ctl.store.Transaction(func(tx models.Store) error {
+		if err := tx.Pages().Delete(page.ID); err != nil {
+			return err
+		}
+		if err := tx.SlugHistories().DeleteByTarget(models.SLUG_KIND_PAGE, page.ID); err != nil {
+			return err
+		}
+		if err := tx.Revisions().DeleteByTarget(models.SLUG_KIND_PAGE, page.ID); err != nil {
+			return err
+		}
+		return tx.Drafts().DeleteByTarget(models.SLUG_KIND_PAGE, page.ID)
+	})
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	ctl.indexPage(page.ID)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+type apiPostRequest struct {
+	Title       *string    `json:"title"`
+	Slug        *string    `json:"slug"` //为空字符串时根据标题生成，修改后旧链接跳转到新地址
+	Body        *string    `json:"body"`
+	IsPublished *bool      `json:"is_published"`
+	State       *string    `json:"state"`      //draft、scheduled或published，优先于is_published
+	PublishAt   *time.Time `json:"publish_at"` //发布时间，定时发布时必须晚于当前时间
+	TagIds      *[]uint    `json:"tag_ids"`    //为空时不修改标签
+}
+
+// 检查标签是否都存在
+func (ctl *Controller) checkTagIds(tagIds []uint) error {
+	for _, id := range tagIds {
+		if _, err := ctl.store.Tags().Get(id); err != nil {
+			return fmt.Errorf("tag %d not found", id)
+		}
+	}
+	return nil
+}
+
+func setPostTags(tx models.Store, postId uint, tagIds []uint) error {
+	if err := tx.PostTags().DeleteByPostId(postId); err != nil {
+		return err
+	}
+	for _, id := range tagIds {
+		if err := tx.PostTags().Create(&models.PostTag{PostId: postId, TagId: id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 获取有权编辑的文章并输出错误
+func (ctl *Controller) apiEditablePost(c *gin.Context) (*models.Post, bool) {
+	id, ok := apiId(c)
+	if !ok {
+		return nil, false
+	}
+	post, err := ctl.getEditablePost(c, id)
+	if err == errForbidden {
+		APIError(c, http.StatusForbidden, "you can only access your own posts")
+		return nil, false
+	}
+	if err != nil {
+		apiStoreError(c, err)
+		return nil, false
+	}
+	post.Tags, _ = ctl.store.Tags().ListByPostId(post.ID)
+	return post, true
+}
+
+// 文章列表，作者只能看到自己的文章，支持按tag_id、published和state过滤
+func (ctl *Controller) APIPostList(c *gin.Context) {
+	var (
+		posts []*models.Post
+		tagId uint
+		err   error
+	)
+	if c.Query("tag_id") != "" {
+		if tagId, err = parseId(c.Query("tag_id")); err != nil {
+			APIError(c, http.StatusBadRequest, "invalid tag_id")
+			return
+		}
+	}
+	published, ok := apiQueryBool(c, "published")
+	if !ok {
+		return
+	}
+	state := c.Query("state")
+	user := apiUser(c)
+	if user.HasPermission(models.PERM_POST_OTHERS) {
+		posts, err = ctl.store.Posts().ListAll(tagId)
+	} else {
+		posts, err = ctl.store.Posts().ListByUserId(user.ID)
+	}
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	filtered := make([]*models.Post, 0, len(posts))
+	for _, post := range posts {
+		if published != nil && post.IsPublished != *published {
+			continue
+		}
+		if state != "" && post.State() != state {
+			continue
+		}
+		post.Tags, _ = ctl.store.Tags().ListByPostId(post.ID)
+		if tagId > 0 && !hasTag(post.Tags, tagId) {
+			continue
+		}
+		filtered = append(filtered, post)
+	}
+	start, end, meta, ok := apiPaginate(c, len(filtered))
+	if !ok {
+		return
+	}
+	data := make([]*apiPost, 0, end-start)
+	for _, post := range filtered[start:end] {
+		data = append(data, ctl.newAPIPost(post))
+	}
+	apiList(c, data, meta)
+}
+
+func hasTag(tags []*models.Tag, tagId uint) bool {
+	for _, tag := range tags {
+		if tag.ID == tagId {
+			return true
+		}
+	}
+	return false
+}
+
+func (ctl *Controller) APIPostGet(c *gin.Context) {
+	post, ok := ctl.apiEditablePost(c)
+	if !ok {
+		return
+	}
+	apiData(c, http.StatusOK, ctl.newAPIPost(post))
+}
+
+func (ctl *Controller) APIPostCreate(c *gin.Context) {
+	var req apiPostRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if req.Title == nil || *req.Title == "" {
+		APIError(c, http.StatusUnprocessableEntity, "title cannot be empty")
+		return
+	}
+	post := &models.Post{Title: *req.Title, UserID: apiUser(c).ID}
+	if req.Body != nil {
+		post.Body = *req.Body
+	}
+	if !apiSetPublishState(c, req.State, req.IsPublished, req.PublishAt, post.SetState) {
+		return
+	}
+	var tagIds []uint
+	if req.TagIds != nil {
+		tagIds = *req.TagIds
+	}
+	if err := ctl.checkTagIds(tagIds); err != nil {
+		APIError(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	var slug string
+	if req.Slug != nil {
+		slug = *req.Slug
+	}
+	err := ctl.store.Transaction(func(tx models.Store) error {
+		if err := setPostSlug(tx, post, slug); err != nil {
+			return err
+		}
+		if err := tx.Posts().Create(post); err != nil {
+			return err
+		}
+		if err := saveSlugHistory(tx, models.SLUG_KIND_POST, post.ID, "", post.Slug); err != nil {
+			return err
+		}
+		if err := setPostTags(tx, post.ID, tagIds); err != nil {
+			return err
+		}
+		return savePostRevision(tx, post, apiUser(c).ID)
+	})
+	if err != nil {
+		apiSaveError(c, err)
+		return
+	}
+	ctl.indexPost(post.ID)
+	post.Tags, _ = ctl.store.Tags().ListByPostId(post.ID)
+	apiData(c, http.StatusCreated, ctl.newAPIPost(post))
+}
+
+// 只修改请求中出现的字段
+func (ctl *Controller) APIPostUpdate(c *gin.Context) {
+	post, ok := ctl.apiEditablePost(c)
+	if !ok {
+		return
+	}
+	var req apiPostRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if req.Title != nil {
+		if *req.Title == "" {
+			APIError(c, http.StatusUnprocessableEntity, "title cannot be empty")
+			return
+		}
+		post.Title = *req.Title
+	}
+	if req.Body != nil {
+		post.Body = *req.Body
+	}
+	if !apiSetPublishState(c, req.State, req.IsPublished, req.PublishAt, post.SetState) {
+		return
+	}
+	if req.TagIds != nil {
+		if err := ctl.checkTagIds(*req.TagIds); err != nil {
+			APIError(c, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+	}
+	oldSlug := post.Slug
+	err := ctl.store.Transaction(func(tx models.Store) error {
+		if req.Slug != nil {
+			if err := setPostSlug(tx, post, *req.Slug); err != nil {
+				return err
+			}
+		}
+		if err := tx.Posts().Update(post); err != nil {
+			return err
+		}
+		if err := saveSlugHistory(tx, models.SLUG_KIND_POST, post.ID, oldSlug, post.Slug); err != nil {
+			return err
+		}
+		if req.TagIds != nil {
+			if err := setPostTags(tx, post.ID, *req.TagIds); err != nil {
+				return err
+			}
+		}
+		return savePostRevision(tx, post, apiUser(c).ID)
+	})
+	if err != nil {
+		apiSaveError(c, err)
+		return
+	}
+	ctl.indexPost(post.ID)
+	post, err = ctl.store.Posts().Get(post.ID)
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	post.Tags, _ = ctl.store.Tags().ListByPostId(post.ID)
+	apiData(c, http.StatusOK, ctl.newAPIPost(post))
+}
+
+func (ctl *Controller) APIPostDelete(c *gin.Context) {
+	post, ok := ctl.apiEditablePost(c)
+	if !ok {
+		return
+	}
+	err := ctl.store.Transaction(func(tx models.Store) error {
+		if err := tx.Posts().Delete(post.ID); err != nil {
+			return err
+		}
+		if err := tx.SlugHistories().DeleteByTarget(models.SLUG_KIND_POST, post.ID); err != nil {
+			return err
+		}
+		if err := tx.Revisions().DeleteByTarget(models.SLUG_KIND_POST, post.ID); err != nil {
+			return err
+		}
+		if err := tx.Drafts().DeleteByTarget(models.SLUG_KIND_POST, post.ID); err != nil {
+			return err
+		}
+		return tx.PostTags().DeleteByPostId(post.ID)
+	})
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	ctl.indexPost(post.ID)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"gingorm/models"
+	"github.com/cihub/seelog"
+	"github.com/gin-gonic/gin"
+)
+
+type apiSubscriberRequest struct {
+	Email          *string `json:"email"`
+	SubscribeState *bool   `json:"subscribe_state"`
+}
+
+// 订阅者列表，active为true时只列出已验证且订阅中的订阅者
+func (ctl *Controller) APISubscriberList(c *gin.Context) {
+	active, ok := apiQueryBool(c, "active")
+	if !ok {
+		return
+	}
+	subscribers, err := ctl.store.Subscribers().List(active != nil && *active)
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	if active != nil && !*active {
+		filtered := make([]*models.Subscriber, 0, len(subscribers))
+		for _, s := range subscribers {
+			if !s.VerifyState || !s.SubscribeState {
+				filtered = append(filtered, s)
+			}
+		}
+		subscribers = filtered
+	}
+	start, end, meta, ok := apiPaginate(c, len(subscribers))
+	if !ok {
+		return
+	}
+	data := make([]*apiSubscriber, 0, end-start)
+	for _, s := range subscribers[start:end] {
+		data = append(data, newAPISubscriber(s))
+	}
+	apiList(c, data, meta)
+}
+
+func (ctl *Controller) apiGetSubscriber(c *gin.Context) (*models.Subscriber, bool) {
+	id, ok := apiId(c)
+	if !ok {
+		return nil, false
+	}
+	subscriber, err := ctl.store.Subscribers().Get(id)
+	if err != nil {
+		apiStoreError(c, err)
+		return nil, false
+	}
+	return subscriber, true
+}
+
+func (ctl *Controller) APISubscriberGet(c *gin.Context) {
+	subscriber, ok := ctl.apiGetSubscriber(c)
+	if !ok {
+		return
+	}
+	apiData(c, http.StatusOK, newAPISubscriber(subscriber))
+}
+
+// 添加订阅者并发送激活邮件，激活后才会收到邮件
+func (ctl *Controller) APISubscriberCreate(c *gin.Context) {
+	var req apiSubscriberRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	var email string
+	if req.Email != nil {
+		email = strings.TrimSpace(*req.Email)
+	}
+	if !strings.Contains(email, "@") {
+		APIError(c, http.StatusUnprocessableEntity, "invalid email")
+		return
+	}
+	if _, err := ctl.store.Subscribers().GetByEmail(email); err == nil {
+		APIError(c, http.StatusConflict, "subscriber already exists")
+		return
+	} else if err != models.ErrNotFound {
+		apiStoreError(c, err)
+		return
+	}
+	subscriber := &models.Subscriber{Email: email}
+	if err := ctl.store.Subscribers().Create(subscriber); err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	if err := ctl.sendActiveEmail(subscriber); err != nil {
+		seelog.Error(err)
+	}
+	apiData(c, http.StatusCreated, newAPISubscriber(subscriber))
+}
+
+// 只能修改订阅状态
+func (ctl *Controller) APISubscriberUpdate(c *gin.Context) {
+	subscriber, ok := ctl.apiGetSubscriber(c)
+	if !ok {
+		return
+	}
+	var req apiSubscriberRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if req.Email != nil && *req.Email != subscriber.Email {
+		APIError(c, http.StatusUnprocessableEntity, "email cannot be changed")
+		return
+	}
+	if req.SubscribeState != nil {
+		subscriber.SubscribeState = *req.SubscribeState
+		if err := ctl.store.Subscribers().Update(subscriber); err != nil {
+			apiStoreError(c, err)
+			return
+		}
+	}
+	apiData(c, http.StatusOK, newAPISubscriber(subscriber))
+}
+
+func (ctl *Controller) APISubscriberDelete(c *gin.Context) {
+	subscriber, ok := ctl.apiGetSubscriber(c)
+	if !ok {
+		return
+	}
+	if err := ctl.store.Subscribers().Delete(subscriber.ID); err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+type apiTagRequest struct {
+	Name *string `json:"name"`
+}
+
+func (ctl *Controller) APITagList(c *gin.Context) {
+	tags, err := ctl.store.Tags().ListAll()
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	start, end, meta, ok := apiPaginate(c, len(tags))
+	if !ok {
+		return
+	}
+	data := make([]*apiTag, 0, end-start)
+	for _, tag := range tags[start:end] {
+		data = append(data, newAPITag(tag))
+	}
+	apiList(c, data, meta)
+}
+
+func (ctl *Controller) apiGetTag(c *gin.Context) (*models.Tag, bool) {
+	id, ok := apiId(c)
+	if !ok {
+		return nil, false
+	}
+	tag, err := ctl.store.Tags().Get(id)
+	if err != nil {
+		apiStoreError(c, err)
+		return nil, false
+	}
+	return tag, true
+}
+
+// 校验标签名称，不能为空也不能与其他标签重名
+func (ctl *Controller) apiCheckTagName(c *gin.Context, name *string, id uint) bool {
+	if name == nil || strings.TrimSpace(*name) == "" {
+		APIError(c, http.StatusUnprocessableEntity, "name cannot be empty")
+		return false
+	}
+	*name = strings.TrimSpace(*name)
+	tags, err := ctl.store.Tags().ListAll()
+	if err != nil {
+		apiStoreError(c, err)
+		return false
+	}
+	for _, tag := range tags {
+		if tag.Name == *name && tag.ID != id {
+			APIError(c, http.StatusConflict, "tag already exists")
+			return false
+		}
+	}
+	return true
+}
+
+func (ctl *Controller) APITagGet(c *gin.Context) {
+	tag, ok := ctl.apiGetTag(c)
+	if !ok {
+		return
+	}
+	apiData(c, http.StatusOK, newAPITag(tag))
+}
+
+func (ctl *Controller) APITagCreate(c *gin.Context) {
+	var req apiTagRequest
+	if !apiBind(c, &req) || !ctl.apiCheckTagName(c, req.Name, 0) {
+		return
+	}
+	tag := &models.Tag{Name: *req.Name}
+	if err := ctl.store.Tags().Create(tag); err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	apiData(c, http.StatusCreated, newAPITag(tag))
+}
+
+func (ctl *Controller) APITagUpdate(c *gin.Context) {
+	tag, ok := ctl.apiGetTag(c)
+	if !ok {
+		return
+	}
+	var req apiTagRequest
+	if !apiBind(c, &req) {
+		return
+	}
+	if req.Name != nil {
+		if !ctl.apiCheckTagName(c, req.Name, tag.ID) {
+			return
+		}
+		tag.Name = *req.Name
+		if err := ctl.store.Tags().Update(tag); err != nil {
+			apiStoreError(c, err)
+			return
+		}
+		//搜索索引中保存的是标签名称
+		posts, _ := ctl.store.Posts().ListAll(tag.ID)
+		ctl.indexTagPosts(posts)
+	}
+	tag, err := ctl.store.Tags().Get(tag.ID)
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	apiData(c, http.StatusOK, newAPITag(tag))
+}
+
+// 删除标签，同时移除文章上的该标签
+func (ctl *Controller) APITagDelete(c *gin.Context) {
+	tag, ok := ctl.apiGetTag(c)
+	if !ok {
+		return
+	}
+	posts, _ := ctl.store.Posts().ListAll(tag.ID)
+	err := ctl.store.Transaction(func(tx models.Store) error {
+		if err := tx.PostTags().DeleteByTagId(tag.ID); err != nil {
+			return err
+		}
+		return tx.Tags().Delete(tag.ID)
+	})
+	if err != nil {
+		apiStoreError(c, err)
+		return
+	}
+	ctl.indexTagPosts(posts)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+// 发送json请求，返回状态码和解析后的响应
+func apiRequest(t *testing.T, r http.Handler, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	res := map[string]interface{}{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s %s: %s: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w.Code, res
+}
+
+func newAPITestRouter(ctl *Controller, user *models.User) *gin.Engine {
+	r := newTestRouter(user)
+	r.GET("/tags", ctl.APITagList)
+	r.POST("/tags", ctl.APITagCreate)
+	r.GET("/tags/:id", ctl.APITagGet)
+	r.PUT("/tags/:id", ctl.APITagUpdate)
+	r.DELETE("/tags/:id", ctl.APITagDelete)
+	r.GET("/posts", ctl.APIPostList)
+	r.POST("/posts", ctl.APIPostCreate)
+	r.GET("/posts/:id", ctl.APIPostGet)
+	r.PUT("/posts/:id", ctl.APIPostUpdate)
+	r.DELETE("/posts/:id", ctl.APIPostDelete)
+	return r
+}
+
+func TestAPITag(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	r := newAPITestRouter(ctl, createTestUser(t, store, "editor", models.ROLE_EDITOR))
+
+	code, res := apiRequest(t, r, http.MethodPost, "/tags", `{"name": " go "}`)
+	if code != http.StatusCreated {
+		t.Fatalf("create tag: %d %v", code, res)
+	}
+	data := res["data"].(map[string]interface{})
+	if data["name"] != "go" {
+		t.Errorf("tag name = %v", data["name"])
+	}
+	path := fmt.Sprintf("/tags/%v", data["id"])
+
+	if code, _ = apiRequest(t, r, http.MethodPost, "/tags", `{"name": "go"}`); code != http.StatusConflict {
+		t.Errorf("duplicate tag: status = %d", code)
+	}
+	if code, _ = apiRequest(t, r, http.MethodPost, "/tags", `{}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("empty tag name: status = %d", code)
+	}
+	if code, res = apiRequest(t, r, http.MethodPost, "/tags", `{"name":`); code != http.StatusBadRequest || res["error"] == nil {
+		t.Errorf("invalid body: %d %v", code, res)
+	}
+	if code, res = apiRequest(t, r, http.MethodPut, path, `{"name": "golang"}`); code != http.StatusOK || res["data"].(map[string]interface{})["name"] != "golang" {
+		t.Errorf("update tag: %d %v", code, res)
+	}
+	if code, _ = apiRequest(t, r, http.MethodDelete, path, ""); code != http.StatusNoContent {
+		t.Errorf("delete tag: status = %d", code)
+	}
+	if code, res = apiRequest(t, r, http.MethodGet, path, ""); code != http.StatusNotFound {
+		t.Errorf("deleted tag: %d %v", code, res)
+	}
+	if code, _ = apiRequest(t, r, http.MethodGet, "/tags/abc", ""); code != http.StatusNotFound {
+		t.Errorf("invalid id: status = %d", code)
+	}
+}
+
+func TestAPIPaginate(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	r := newAPITestRouter(ctl, createTestUser(t, store, "editor", models.ROLE_EDITOR))
+	for i := 0; i < 5; i++ {
+		if err := store.Tags().Create(&models.Tag{Name: fmt.Sprintf("tag%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, res := apiRequest(t, r, http.MethodGet, "/tags?page=2&per_page=2", "")
+	if code != http.StatusOK {
+		t.Fatalf("list tags: %d %v", code, res)
+	}
+	meta := res["meta"].(map[string]interface{})
+	if len(res["data"].([]interface{})) != 2 || meta["total"] != float64(5) || meta["total_pages"] != float64(3) {
+		t.Errorf("page 2: %v", res)
+	}
+	//超出范围的页返回空列表
+	if _, res = apiRequest(t, r, http.MethodGet, "/tags?page=9", ""); len(res["data"].([]interface{})) != 0 {
+		t.Errorf("page 9: %v", res)
+	}
+	for _, query := range []string{"page=0", "page=a", "per_page=0", "per_page=101"} {
+		if code, _ = apiRequest(t, r, http.MethodGet, "/tags?"+query, ""); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d", query, code)
+		}
+	}
+}
+
+// 作者只能通过api访问自己的文章
+func TestAPIPostOwnership(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	author := createTestUser(t, store, "author", models.ROLE_AUTHOR)
+	editor := createTestUser(t, store, "editor", models.ROLE_EDITOR)
+	r := newAPITestRouter(ctl, author)
+	tag := &models.Tag{Name: "go"}
+	if err := store.Tags().Create(tag); err != nil {
+		t.Fatal(err)
+	}
+	other := &models.Post{Title: "other", UserID: editor.ID}
+	if err := store.Posts().Create(other); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _ := apiRequest(t, r, http.MethodPost, "/posts", `{"title": "post", "tag_ids": [99]}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown tag: status = %d", code)
+	}
+	code, res := apiRequest(t, r, http.MethodPost, "/posts", fmt.Sprintf(`{"title": "post", "is_published": true, "tag_ids": [%d]}`, tag.ID))
+	if code != http.StatusCreated {
+		t.Fatalf("create post: %d %v", code, res)
+	}
+	data := res["data"].(map[string]interface{})
+	if data["user_id"] != float64(author.ID) || len(data["tags"].([]interface{})) != 1 {
+		t.Errorf("created post = %v", data)
+	}
+
+	_, res = apiRequest(t, r, http.MethodGet, "/posts", "")
+	if posts := res["data"].([]interface{}); len(posts) != 1 || posts[0].(map[string]interface{})["title"] != "post" {
+		t.Errorf("author's posts = %v", res["data"])
+	}
+	path := fmt.Sprintf("/posts/%d", other.ID)
+	if code, _ = apiRequest(t, r, http.MethodGet, path, ""); code != http.StatusForbidden {
+		t.Errorf("get other's post: status = %d", code)
+	}
+	if code, _ = apiRequest(t, r, http.MethodPut, path, `{"title": "hacked"}`); code != http.StatusForbidden {
+		t.Errorf("update other's post: status = %d", code)
+	}
+	if code, _ = apiRequest(t, r, http.MethodDelete, path, ""); code != http.StatusForbidden {
+		t.Errorf("delete other's post: status = %d", code)
+	}
+
+	//编辑可以看到所有文章
+	_, res = apiRequest(t, newAPITestRouter(ctl, editor), http.MethodGet, "/posts?published=false", "")
+	if posts := res["data"].([]interface{}); len(posts) != 1 || posts[0].(map[string]interface{})["title"] != "other" {
+		t.Errorf("editor's unpublished posts = %v", res["data"])
+	}
+}
+
+func TestAPICommentStatus(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	r := newTestRouter(createTestUser(t, store, "editor", models.ROLE_EDITOR))
+	r.GET("/comments", ctl.APICommentList)
+	r.PUT("/comments/:id", ctl.APICommentUpdate)
+	for _, status := range []string{models.COMMENT_STATUS_PENDING, models.COMMENT_STATUS_SPAM} {
+		if err := store.Comments().Create(&models.Comment{Content: status, Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	spam, _ := store.Comments().Search(&models.CommentFilter{Status: models.COMMENT_STATUS_SPAM})
+
+	if code, _ := apiRequest(t, r, http.MethodGet, "/comments?status=bogus", ""); code != http.StatusBadRequest {
+		t.Errorf("invalid status filter: %d", code)
+	}
+	code, res := apiRequest(t, r, http.MethodGet, "/comments?status=spam", "")
+	if items, _ := res["data"].([]interface{}); code != http.StatusOK || len(items) != 1 {
+		t.Fatalf("list spam: %d %v", code, res)
+	}
+	path := fmt.Sprintf("/comments/%d", spam[0].ID)
+	if code, _ := apiRequest(t, r, http.MethodPut, path, `{"status": "bogus"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("invalid status: %d", code)
+	}
+	code, res = apiRequest(t, r, http.MethodPut, path, `{"status": "approved"}`)
+	if code != http.StatusOK {
+		t.Fatalf("approve: %d %v", code, res)
+	}
+	if comment, _ := store.Comments().Get(spam[0].ID); comment.Status != models.COMMENT_STATUS_APPROVED || !comment.ReadState {
+		t.Errorf("comment = %+v", comment)
+	}
+}
@@ -11,10 +11,10 @@ import (
 	"gingorm/system"
 )
 
-func ArchiveGet(c *gin.Context) {
+func (ctl *Controller) ArchiveGet(c *gin.Context) {
 	var (
-		year      string
-		month     string
+		year      int
+		month     int
 		page      string
 		pageIndex int
 		pageSize  = system.GetConfiguration().PageSize //获取configuration结构体中的pageSize，默认是10
@@ -23,38 +23,46 @@ func ArchiveGet(c *gin.Context) {
 		posts     []*models.Post
 		policy    *bluemonday.Policy //声明bluemonday中policy结构体
 	)
-	year = c.Param("year")
-	month = c.Param("month")
+	year, err = strconv.Atoi(c.Param("year"))
+	if err != nil {
+		Handle404(c)
+		return
+	}
+	month, err = strconv.Atoi(c.Param("month"))
+	if err != nil {
+		Handle404(c)
+		return
+	}
 	page = c.Query("page")
 	pageIndex, _ = strconv.Atoi(page)
 	if pageIndex <= 0 {
 		pageIndex = 1
 	}
 	//根据归档年份查询所有文档
-	posts, err = models.ListPostByArchive(year, month, pageIndex, pageSize)
+	posts, err = ctl.store.Posts().ListByArchive(year, month, pageIndex, pageSize)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	total, err = models.CountPostByArchive(year, month)
+	total, err = ctl.store.Posts().CountByArchive(year, month)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 	policy = bluemonday.StrictPolicy() //采用的是严格策略，剥离所有html元素和属性，适用于博客标题
 	for _, post := range posts {
-		post.Tags, _ = models.ListTagByPostId(strconv.FormatUint(uint64(post.ID), 10))
+		post.Tags, _ = ctl.store.Tags().ListByPostId(post.ID)
 		post.Body = policy.Sanitize(string(blackfriday.Run([]byte(post.Body))))  //blackfriday在v2中更换为run
 	}
 	c.HTML(http.StatusOK, "index/index.html", gin.H{
 		"posts":           posts,
-		"tags":            models.MustListTag(),
-		"archives":        models.MustListPostArchives(),
-		"links":           models.MustListLinks(),
+		"tags":            ctl.mustListTag(),
+		"archives":        ctl.mustListPostArchives(),
+		"links":           ctl.mustListLinks(),
 		"pageIndex":       pageIndex,
 		"totalPage":       int(math.Ceil(float64(total) / float64(pageSize))),
-		"maxReadPosts":    models.MustListMaxReadPost(),
-		"maxCommentPosts": models.MustListMaxCommentPost(),
+		"maxReadPosts":    ctl.mustListMaxReadPost(),
+		"maxCommentPosts": ctl.mustListMaxCommentPost(),
 	})
 
 }
@@ -1,35 +1,274 @@
 package controllers
 
 import (
-	"fmt"
 	"net/http"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"github.com/cihub/seelog"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"gingorm/helpers"
-	"gingorm/system"
+	"github.com/pkg/errors"
 )
 
-
 //认证写入seession并认证跳转
-func AuthGet(c *gin.Context) {
-	authType := c.Param("authType") //获取authType字段
-	//设置session_id
-	session := sessions.Default(c)
-	//生成随机的uuid
+func (ctl *Controller) AuthGet(c *gin.Context) {
+	provider, ok := ctl.oauth.Get(c.Param("authType")) //获取authType字段
+	if !ok {
+		Handle404(c)
+		return
+	}
+	//生成随机的uuid作为state，回调时校验
 	uuid := helpers.UUID()
-	session.Delete(SESSION_GITHUB_STATE)
-	session.Set(SESSION_GITHUB_STATE, uuid)
+	authurl := provider.AuthCodeURL(uuid)
+	if authurl == "" {
+		HandleMessage(c, "第三方登录暂时不可用，请稍后再试。")
+		return
+	}
+	session := sessions.Default(c)
+	session.Set(SESSION_OAUTH_STATE, uuid)
+	session.Set(SESSION_OAUTH_PROVIDER, provider.Name())
+	session.Save()
+	c.Redirect(http.StatusFound, authurl)
+}
+
+//第三方登录回调，已登录时绑定到当前用户，否则登录或注册
+//旧的github回调地址/oauth2callback不带提供方名称，从session中取
+func (ctl *Controller) Oauth2Callback(c *gin.Context) {
+	session := sessions.Default(c)
+	state, _ := session.Get(SESSION_OAUTH_STATE).(string)
+	name, _ := session.Get(SESSION_OAUTH_PROVIDER).(string)
+	session.Delete(SESSION_OAUTH_STATE)
+	session.Delete(SESSION_OAUTH_PROVIDER)
 	session.Save()
 
-	authurl := "/signin"
-	switch authType {
-	case "github":
-		authurl = fmt.Sprintf(system.GetConfiguration().GithubAuthUrl, system.GetConfiguration().GithubClientId, uuid)
-	case "weibo":
-	case "qq":
-	case "wechat":
-	case "oschina":
-	default:
+	// validate state
+	provider, ok := ctl.oauth.Get(name)
+	if state == "" || c.Query("state") != state || !ok || (c.Param("provider") != "" && c.Param("provider") != name) {
+		c.Redirect(http.StatusMovedPermanently, "/signin")
+		return
 	}
-	c.Redirect(http.StatusFound, authurl)
+	// 用户拒绝授权
+	if c.Query("error") != "" {
+		c.Redirect(http.StatusMovedPermanently, "/signin")
+		return
+	}
+	token, err := provider.Exchange(c.Query("code"))
+	if err != nil {
+		seelog.Error(err)
+		c.Redirect(http.StatusMovedPermanently, "/signin")
+		return
+	}
+	identity, err := provider.Identity(token)
+	if err != nil {
+		seelog.Error(err)
+		c.Redirect(http.StatusMovedPermanently, "/signin")
+		return
+	}
+
+	sessionUser, exists := c.Get(CONTEXT_USER_KEY)
+	if exists { // 已登录
+		user, _ := sessionUser.(*models.User)
+		if err = ctl.bindIdentity(user, provider, identity); err != nil {
+			HandleMessage(c, err.Error())
+			return
+		}
+		c.Redirect(http.StatusMovedPermanently, "/admin/profile")
+		return
+	}
+	user, err := ctl.identityUser(provider, identity)
+	if err == errLegacyGithubLogin {
+		HandleMessage(c, err.Error())
+		return
+	}
+	if err != nil {
+		seelog.Error(err)
+		HandleMessage(c, "第三方登录失败，请稍后再试。")
+		return
+	}
+	if user.LockState {
+		HandleMessage(c, "Your account have been locked.")
+		return
+	}
+	ctl.beginSignin(c, user)
+}
+
+var errLegacyGithubLogin = errors.New("this github login is used by an existing account, please sign in to that account and bind github from your profile.")
+
+//查找第三方账号绑定的用户，按提供方的用户唯一标识查找，未绑定时注册新用户
+func (ctl *Controller) identityUser(provider OAuthProvider, identity *models.UserIdentity) (user *models.User, err error) {
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		existing, err := tx.Identities().Get(identity.Provider, identity.Subject)
+		if err == nil {
+			identity.ID = existing.ID
+			identity.UserID = existing.UserID
+			if err = tx.Identities().Update(identity); err != nil {
+				return err
+			}
+			user, err = tx.Users().Get(existing.UserID)
+			return err
+		}
+		if err != models.ErrNotFound {
+			return err
+		}
+		//登录名可以被改名后的其他人使用，不能据此关联旧账号，需要旧账号登录后手动绑定
+		if legacyGithubUser(tx.Users(), provider, identity) != nil {
+			return errLegacyGithubLogin
+		}
+		user = &models.User{
+			NickName:    identity.Login,
+			AvatarUrl:   identity.AvatarUrl,
+			VerifyState: models.VERIFY_STATE_VERIFIED,
+		}
+		if user.NickName == "" {
+			user.NickName = identity.Name
+		}
+		if isGithubProvider(provider) {
+			user.GithubLoginId = identity.Login
+			user.GithubUrl = identity.ProfileUrl
+		}
+		if err = assignInitialRole(tx.Users(), user); err != nil {
+			return err
+		}
+		if err = tx.Users().Create(user); err != nil {
+			return err
+		}
+		if err = prefillEmail(tx.Users(), user, identity); err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Identities().Create(identity)
+	})
+	return
+}
+
+//将第三方账号绑定到已登录的用户
+func (ctl *Controller) bindIdentity(user *models.User, provider OAuthProvider, identity *models.UserIdentity) error {
+	return ctl.store.Transaction(func(tx models.Store) error {
+		existing, err := tx.Identities().Get(identity.Provider, identity.Subject)
+		if err == nil {
+			if existing.UserID != user.ID {
+				return errors.New("this account has bound another user.")
+			}
+			identity.ID = existing.ID
+			identity.UserID = user.ID
+			return tx.Identities().Update(identity)
+		}
+		if err != models.ErrNotFound {
+			return err
+		}
+		if legacy := legacyGithubUser(tx.Users(), provider, identity); legacy != nil && legacy.ID != user.ID {
+			return errors.New("this account has bound another user.")
+		}
+		identities, err := tx.Identities().ListByUserId(user.ID)
+		if err != nil {
+			return err
+		}
+		for _, item := range identities {
+			if item.Provider == identity.Provider {
+				return errors.Errorf("another %s account has been bound, please unbind it first.", provider.DisplayName())
+			}
+		}
+		identity.UserID = user.ID
+		if err = tx.Identities().Create(identity); err != nil {
+			return err
+		}
+		if isGithubProvider(provider) {
+			user.GithubLoginId = identity.Login
+			user.GithubUrl = identity.ProfileUrl
+		}
+		if user.AvatarUrl == "" {
+			user.AvatarUrl = identity.AvatarUrl
+		}
+		if err = prefillEmail(tx.Users(), user, identity); err != nil {
+			return err
+		}
+		return tx.Users().UpdateGithubUserInfo(user)
+	})
+}
+
+//用户没有邮箱时使用提供方已验证的邮箱，该邮箱已被其他用户使用时跳过，不按邮箱合并账号
+func prefillEmail(users models.UserRepository, user *models.User, identity *models.UserIdentity) error {
+	if user.Email != "" || identity.Email == "" || !identity.EmailVerified {
+		return nil
+	}
+	if _, err := users.GetByUsername(identity.Email); err != models.ErrNotFound {
+		return nil
+	}
+	if err := users.UpdateEmail(user, identity.Email); err != nil {
+		return err
+	}
+	user.VerifyState = models.VERIFY_STATE_VERIFIED
+	return users.UpdateVerifyState(user)
+}
+
+//users表中的github_login_id是旧版本保存github账号的方式，只有登录名，没有github的数字id
+//返回github_login_id与登录名相同的用户，只用于冲突检查，不作为已绑定的用户
+func legacyGithubUser(users models.UserRepository, provider OAuthProvider, identity *models.UserIdentity) *models.User {
+	if !isGithubProvider(provider) || identity.Login == "" {
+		return nil
+	}
+	user, err := users.IsGithubIdExists(identity.Login, 0)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+func isGithubProvider(provider OAuthProvider) bool {
+	_, ok := provider.(*githubProvider)
+	return ok
+}
+
+//解绑第三方账号，没有密码时至少保留一个第三方账号用于登录
+func (ctl *Controller) IdentityUnbind(c *gin.Context) {
+	var (
+		err error
+		res = gin.H{}
+	)
+	defer writeJSON(c, res)
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		res["message"] = "server interval error"
+		return
+	}
+	provider, ok := ctl.oauth.Get(c.Param("provider"))
+	if !ok {
+		res["message"] = "unknown provider"
+		return
+	}
+	identities, err := ctl.store.Identities().ListByUserId(user.ID)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	bound := false
+	for _, item := range identities {
+		bound = bound || item.Provider == provider.Name()
+	}
+	if !bound {
+		res["message"] = provider.DisplayName() + " haven't bound"
+		return
+	}
+	if user.Password == "" && len(identities) == 1 {
+		res["message"] = "this is the only way to sign in, please bind another account first"
+		return
+	}
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		if err := tx.Identities().Delete(user.ID, provider.Name()); err != nil {
+			return err
+		}
+		if !isGithubProvider(provider) {
+			return nil
+		}
+		user.GithubLoginId = ""
+		user.GithubUrl = ""
+		return tx.Users().UpdateGithubUserInfo(user)
+	})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
 }
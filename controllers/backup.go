@@ -15,6 +15,7 @@ import (
 	"github.com/qiniu/api.v7/auth/qbox"
 	"github.com/qiniu/api.v7/storage"
 	"gingorm/helpers"
+	"gingorm/models"
 	"gingorm/system"
 )
 
@@ -81,7 +82,12 @@ func Backup() (err error) {
 		bodyBytes   []byte
 		encryptData []byte
 	)
-	//此处，我使用的是mysql，感觉backup没生效，后期看下怎么更改。
+	//只有sqlite是文件数据库，mysql和postgres请使用各自的备份工具
+	if d, _ := models.GetDialect(system.GetConfiguration().Driver); d == nil || d.Name() != models.DRIVER_SQLITE {
+		err = errors.New("backup only supports sqlite3 database.")
+		seelog.Debug("backup only supports sqlite3 database.")
+		return
+	}
 	u, err = url.Parse(system.GetConfiguration().DSN)
 	if err != nil {
 		seelog.Debug("parse dsn error:%v", err)
@@ -16,3 +16,12 @@ func CaptchaGet(c *gin.Context) {
 	session.Save()
 	captcha.WriteImage(c.Writer, captchaId, 100, 40)
 }
+
+//校验表单中的验证码，验证码只能使用一次
+func verifyCaptcha(c *gin.Context) bool {
+	s := sessions.Default(c)
+	captchaId, _ := s.Get(SESSION_CAPTCHA).(string)
+	s.Delete(SESSION_CAPTCHA)
+	s.Save()
+	return captcha.VerifyString(captchaId, c.PostForm("verifyCode"))
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 可信的反向代理，只有连接来自这些地址时才使用X-Forwarded-For和X-Real-Ip中的客户端ip
+var trustedProxies []*net.IPNet
+
+// 设置可信的反向代理，proxies为ip或CIDR，为空时不信任任何代理，直接使用连接的对端地址
+func SetTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy: %s", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy: %s", proxy)
+		}
+		nets = append(nets, ipNet)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 请求的客户端ip，登录限制和session记录使用
+// 连接来自可信代理时，从右向左跳过X-Forwarded-For中的可信代理，第一个不可信的地址为客户端ip
+func requestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		return ""
+	}
+	client := net.ParseIP(host)
+	if client == nil || !isTrustedProxy(client) {
+		return host
+	}
+	if forwarded := strings.Join(r.Header["X-Forwarded-For"], ","); forwarded != "" {
+		ips := strings.Split(forwarded, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(ips[i]))
+			if ip == nil {
+				break
+			}
+			client = ip
+			if !isTrustedProxy(ip) {
+				break
+			}
+		}
+	} else if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-Ip"))); ip != nil {
+		client = ip
+	}
+	return client.String()
+}
+
+func clientIP(c *gin.Context) string {
+	return requestIP(c.Request)
+}
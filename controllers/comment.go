@@ -1,18 +1,44 @@
 package controllers
 
 import (
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/mail"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 	"fmt"
-	"github.com/dchest/captcha"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"gingorm/helpers"
 	"gingorm/models"
 	"gingorm/system"
+	"github.com/cihub/seelog"
+)
+
+const (
+	TOKEN_REPLY_UNSUBSCRIBE = "reply_unsubscribe"
+
+	COOKIE_COMMENT_GUEST     = "comment_guest" //记住的游客信息
+	COMMENT_GUEST_COOKIE_AGE = 365 * 24 * time.Hour
+	COMMENT_GUEST_NAME_SIZE  = 64
+	COMMENT_GUEST_EMAIL_SIZE = 128
+	COMMENT_GUEST_URL_SIZE   = 255
+)
+
+var (
+	errReplyDeleted       = errors.New("the comment has been deleted.")
+	errCommentEditExpired = errors.New("the comment can no longer be deleted.")
 )
 
 
 //
-func CommentPost(c *gin.Context) {
+func (ctl *Controller) CommentPost(c *gin.Context) {
 	var (
 		err  error
 		res  = gin.H{}
@@ -26,47 +52,368 @@ func CommentPost(c *gin.Context) {
 	userId, _ := sessionUserID.(uint)
 
 	// 验证二维码是否正确
-	verifyCode := c.PostForm("verifyCode")
-	captchaId := s.Get(SESSION_CAPTCHA)
-	s.Delete(SESSION_CAPTCHA)
-	_captchaId, _ := captchaId.(string)
-	if !captcha.VerifyString(_captchaId, verifyCode) {
+	if !verifyCaptcha(c) {
 		res["message"] = "error verifycode"
 		return
 	}
 
-	postId := c.PostForm("postId")
-	content := c.PostForm("content")
-	if len(content) == 0 {
-		res["message"] = "content cannot be empty."
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok || !user.IsVerified() {
+		res["message"] = "please verify your email before commenting."
 		return
 	}
 
-	post, err = models.GetPostById(postId)
+	post, comment, parent, err := ctl.bindComment(c)
+	if err != nil {
+		commentBindFailed(c, res, err)
+		return
+	}
+	comment.UserID = userId
+	comment.Status = ctl.commentStatus(comment, user)
+	//垃圾评论不需要再提醒管理员
+	comment.ReadState = comment.Status == models.COMMENT_STATUS_SPAM
+	err = ctl.store.Comments().Create(comment)
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
-	pid, err := strconv.ParseUint(postId, 10, 64)
+	ctl.notifyComment(post, comment)
+	if comment.Status == models.COMMENT_STATUS_APPROVED {
+		ctl.notifyParticipants(post, comment, parent, user)
+	}
+	res["data"] = gin.H{"status": comment.Status}
+	res["succeed"] = true
+}
+
+// 游客评论，需要开启guest_comments，填写昵称和邮箱，评论总是需要审核
+// 填写的信息保存在cookie中，下次评论时自动填写
+func (ctl *Controller) GuestCommentPost(c *gin.Context) {
+	var (
+		err error
+		res = gin.H{}
+	)
+	defer writeJSON(c, res)
+	if !system.GetConfiguration().GuestComments {
+		res["message"] = "guest comments are disabled."
+		return
+	}
+	if !verifyCaptcha(c) {
+		res["message"] = "error verifycode"
+		return
+	}
+	guest, err := bindCommentGuest(c)
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
-	comment := &models.Comment{
-		PostID:  uint(pid),
-		Content: content,
-		UserID:  userId,
+	post, comment, _, err := ctl.bindComment(c)
+	if err != nil {
+		commentBindFailed(c, res, err)
+		return
 	}
-	err = comment.Insert()
+	comment.GuestName, comment.GuestEmail, comment.GuestUrl = guest.Name, guest.Email, guest.Url
+	comment.Status = models.COMMENT_STATUS_PENDING
+	if reason, err := ctl.spam.Check(comment); err != nil {
+		seelog.Error(err)
+	} else if reason != "" {
+		seelog.Infof("spam comment from guest %s on post %d: %s", guest.Email, comment.PostID, reason)
+		comment.Status, comment.ReadState = models.COMMENT_STATUS_SPAM, true
+	}
+	err = ctl.store.Comments().Create(comment)
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
-	NotifyEmail("[wblog]您有一条新评论", fmt.Sprintf("<a href=\"%s/post/%d\" target=\"_blank\">%s</a>:%s", system.GetConfiguration().Domain, post.ID, post.Title, content))
+	ctl.notifyComment(post, comment)
+	setCommentGuestCookie(c, guest)
+	res["data"] = gin.H{"status": comment.Status}
 	res["succeed"] = true
 }
 
-func CommentDelete(c *gin.Context) {
+// 读取评论表单中的文章、内容和回复的评论，回复的上级评论必须属于同一篇文章
+func (ctl *Controller) bindComment(c *gin.Context) (post *models.Post, comment *models.Comment, parent *models.Comment, err error) {
+	content := c.PostForm("content")
+	if len(content) == 0 {
+		return nil, nil, nil, errors.New("content cannot be empty.")
+	}
+	pid, err := parseId(c.PostForm("postId"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	post, err = ctl.store.Posts().Get(pid)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	//未发布或定时发布的文章不能评论
+	if !post.IsVisible() {
+		return nil, nil, nil, models.ErrNotFound
+	}
+	comment = &models.Comment{
+		PostID:  pid,
+		Content: content,
+	}
+	if parentId := c.PostForm("parentId"); parentId != "" && parentId != "0" {
+		parent, err = ctl.getReplyParent(parentId, pid)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		comment.ParentID = parent.ID
+	}
+	return post, comment, parent, nil
+}
+
+// 文章或回复的评论不存在、文章不可见时返回404
+func commentBindFailed(c *gin.Context, res gin.H, err error) {
+	if err == models.ErrNotFound {
+		c.Status(http.StatusNotFound)
+	}
+	res["message"] = err.Error()
+}
+
+// 游客填写的评论者信息
+type commentGuest struct {
+	Name  string
+	Email string
+	Url   string
+}
+
+// 读取并校验游客的昵称、邮箱和网站
+func bindCommentGuest(c *gin.Context) (*commentGuest, error) {
+	guest := &commentGuest{
+		Name:  strings.TrimSpace(c.PostForm("name")),
+		Email: strings.TrimSpace(c.PostForm("email")),
+		Url:   strings.TrimSpace(c.PostForm("url")),
+	}
+	if guest.Name == "" || utf8.RuneCountInString(guest.Name) > COMMENT_GUEST_NAME_SIZE {
+		return nil, fmt.Errorf("name is required and at most %d characters.", COMMENT_GUEST_NAME_SIZE)
+	}
+	if addr, err := mail.ParseAddress(guest.Email); err != nil || addr.Address != guest.Email || len(guest.Email) > COMMENT_GUEST_EMAIL_SIZE {
+		return nil, errors.New("invalid email.")
+	}
+	if guest.Url != "" {
+		u, err := url.Parse(guest.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(guest.Url) > COMMENT_GUEST_URL_SIZE {
+			return nil, errors.New("invalid website url.")
+		}
+	}
+	return guest, nil
+}
+
+// 记住游客信息一年，只用于填写评论表单
+func setCommentGuestCookie(c *gin.Context, guest *commentGuest) {
+	value := url.Values{"name": {guest.Name}, "email": {guest.Email}, "url": {guest.Url}}
+	c.SetCookie(COOKIE_COMMENT_GUEST, value.Encode(), int(COMMENT_GUEST_COOKIE_AGE/time.Second), "/", "", false, true)
+}
+
+func commentGuestFromCookie(c *gin.Context) *commentGuest {
+	cookie, err := c.Cookie(COOKIE_COMMENT_GUEST)
+	if err != nil {
+		return nil
+	}
+	value, err := url.ParseQuery(cookie)
+	if err != nil {
+		return nil
+	}
+	return &commentGuest{Name: value.Get("name"), Email: value.Get("email"), Url: value.Get("url")}
+}
+
+// 通知管理员有新评论，垃圾评论不通知
+func (ctl *Controller) notifyComment(post *models.Post, comment *models.Comment) {
+	if subject, body := ctl.commentNotice(post, comment); subject != "" {
+		NotifyEmail(subject, body)
+	}
+}
+
+// 新评论通知的标题和内容，评论内容和文章标题需要转义，不需要通知时标题为空
+func (ctl *Controller) commentNotice(post *models.Post, comment *models.Comment) (subject, body string) {
+	var link string
+	switch comment.Status {
+	case models.COMMENT_STATUS_APPROVED:
+		subject, link = "[wblog]您有一条新评论", absoluteURL(ctl.permalinks.Post(post))
+	case models.COMMENT_STATUS_PENDING:
+		subject, link = "[wblog]您有一条新评论等待审核", absoluteURL("/admin/comments")
+	default:
+		return "", ""
+	}
+	body = fmt.Sprintf(`<a href="%s" target="_blank">%s</a>:%s`,
+		template.HTMLEscapeString(link), template.HTMLEscapeString(post.Title), template.HTMLEscapeString(comment.Content))
+	return subject, body
+}
+
+// 新评论的审核状态：有评论管理权限或者以前有评论通过审核的用户直接通过，垃圾评论进入垃圾箱，其余等待审核
+func (ctl *Controller) commentStatus(comment *models.Comment, user *models.User) string {
+	if user.HasPermission(models.PERM_COMMENT) {
+		return models.COMMENT_STATUS_APPROVED
+	}
+	reason, err := ctl.spam.Check(comment)
+	if err != nil {
+		seelog.Error(err)
+		return models.COMMENT_STATUS_PENDING
+	}
+	if reason != "" {
+		seelog.Infof("spam comment from user %d on post %d: %s", user.ID, comment.PostID, reason)
+		return models.COMMENT_STATUS_SPAM
+	}
+	approved, err := ctl.store.Comments().CountApprovedByUserId(user.ID)
+	if err != nil {
+		seelog.Error(err)
+		return models.COMMENT_STATUS_PENDING
+	}
+	if approved > 0 {
+		return models.COMMENT_STATUS_APPROVED
+	}
+	return models.COMMENT_STATUS_PENDING
+}
+
+func (ctl *Controller) getReplyParent(id string, postId uint) (*models.Comment, error) {
+	cid, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := ctl.store.Comments().Get(cid)
+	if err != nil {
+		return nil, err
+	}
+	if parent.PostID != postId || parent.Status != models.COMMENT_STATUS_APPROVED {
+		return nil, models.ErrNotFound
+	}
+	if parent.Deleted {
+		return nil, errReplyDeleted
+	}
+	return parent, nil
+}
+
+// 邮件通知上级评论的作者有新回复，回复自己、邮箱未验证或已退订时不通知
+func (ctl *Controller) notifyReply(post *models.Post, parent, reply *models.Comment, replier *models.User) {
+	if parent.UserID == replier.ID {
+		return
+	}
+	ctl.sendCommentNotice(parent.UserID, "[wblog]您的评论有新回复", "回复了你在%s的评论", post, reply, replier)
+}
+
+// 通知上级评论的作者和评论中@提到的用户
+func (ctl *Controller) notifyParticipants(post *models.Post, comment, parent *models.Comment, replier *models.User) {
+	if parent != nil {
+		ctl.notifyReply(post, parent, comment, replier)
+	}
+	ctl.notifyMentions(post, comment, parent, replier)
+}
+
+// 通知评论中@提到的、之前在同一篇文章下评论过的用户，游客没有验证过的邮箱，不通知
+// 上级评论的作者已经收到回复通知，不再重复通知
+func (ctl *Controller) notifyMentions(post *models.Post, comment, parent *models.Comment, replier *models.User) {
+	if !strings.Contains(comment.Content, "@") {
+		return
+	}
+	comments, err := ctl.store.Comments().ListByPostId(post.ID)
+	if err != nil {
+		seelog.Error(err)
+		return
+	}
+	notified := map[uint]bool{replier.ID: true}
+	if parent != nil {
+		notified[parent.UserID] = true
+	}
+	for _, earlier := range comments {
+		if earlier.ID >= comment.ID || earlier.IsGuest() || earlier.Deleted || notified[earlier.UserID] {
+			continue
+		}
+		if !mentions(comment.Content, earlier.NickName) {
+			continue
+		}
+		notified[earlier.UserID] = true
+		ctl.sendCommentNotice(earlier.UserID, "[wblog]有人在评论中提到了您", "在%s的评论中提到了你", post, comment, replier)
+	}
+}
+
+// content中是否有@name，name后面不能紧跟字母或数字，不区分大小写
+func mentions(content, name string) bool {
+	if name == "" {
+		return false
+	}
+	content, target := strings.ToLower(content), "@"+strings.ToLower(name)
+	for offset := 0; ; {
+		i := strings.Index(content[offset:], target)
+		if i < 0 {
+			return false
+		}
+		end := offset + i + len(target)
+		r, _ := utf8.DecodeRuneInString(content[end:])
+		if end == len(content) || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-') {
+			return true
+		}
+		offset = end
+	}
+}
+
+// 给评论的相关用户发送邮件，邮箱未验证或已退订时不发送，action为动作描述，%s为文章标题的链接
+func (ctl *Controller) sendCommentNotice(userId uint, subject, action string, post *models.Post, comment *models.Comment, replier *models.User) {
+	user, err := ctl.store.Users().Get(userId)
+	if err != nil || user.Email == "" || !user.IsVerified() || user.MuteReplies {
+		return
+	}
+	link := fmt.Sprintf("%s#comment-%d", absoluteURL(ctl.permalinks.Post(post)), comment.ID)
+	body := fmt.Sprintf(`%s %s：<p>%s</p><p><a href="%s">不再接收评论通知</a></p>`,
+		template.HTMLEscapeString(commentAuthorName(replier)),
+		fmt.Sprintf(action, fmt.Sprintf(`<a href="%s" target="_blank">%s</a>`, template.HTMLEscapeString(link), template.HTMLEscapeString(post.Title))),
+		template.HTMLEscapeString(comment.Content), template.HTMLEscapeString(replyUnsubscribeURL(user)))
+	if err = sendMail(user.Email, subject, body); err != nil {
+		seelog.Error(err)
+	}
+}
+
+// 评论预览，和发表后的显示方式相同
+func CommentPreview(c *gin.Context) {
+	res := gin.H{}
+	defer writeJSON(c, res)
+	res["data"] = gin.H{"html": helpers.CommentMarkdown(c.PostForm("content"))}
+	res["succeed"] = true
+}
+
+// 和评论列表中显示的昵称一致，没有昵称时使用github登录名
+func commentAuthorName(user *models.User) string {
+	if user.NickName != "" {
+		return user.NickName
+	}
+	return user.GithubLoginId
+}
+
+// 退订链接token形如 <用户id>.<签名>，长期有效
+func signReplyUnsubscribe(userId uint) string {
+	return helpers.HmacSha256(system.GetConfiguration().SessionSecret, fmt.Sprintf("%s|%d", TOKEN_REPLY_UNSUBSCRIBE, userId))
+}
+
+func replyUnsubscribeURL(user *models.User) string {
+	return fmt.Sprintf("%s/comment/unsubscribe?token=%d.%s", strings.TrimRight(system.GetConfiguration().Domain, "/"), user.ID, signReplyUnsubscribe(user.ID))
+}
+
+// 退订评论回复通知
+func (ctl *Controller) CommentUnsubscribe(c *gin.Context) {
+	parts := strings.Split(c.Query("token"), ".")
+	if len(parts) != 2 {
+		HandleMessage(c, "退订链接有误！")
+		return
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || subtle.ConstantTimeCompare([]byte(parts[1]), []byte(signReplyUnsubscribe(uint(id)))) != 1 {
+		HandleMessage(c, "退订链接有误！")
+		return
+	}
+	user, err := ctl.store.Users().Get(uint(id))
+	if err != nil {
+		HandleMessage(c, "退订链接有误！")
+		return
+	}
+	user.MuteReplies = true
+	if err = ctl.store.Users().UpdateMuteReplies(user); err != nil {
+		HandleMessage(c, fmt.Sprintf("退订失败！%s", err.Error()))
+		return
+	}
+	HandleMessage(c, "已退订评论回复和@提及通知！")
+}
+
+func (ctl *Controller) CommentDelete(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -84,11 +431,21 @@ func CommentDelete(c *gin.Context) {
 		res["message"] = err.Error()
 		return
 	}
-	comment := &models.Comment{
-		UserID: uint(userId),
+	comment, err := ctl.store.Comments().Get(uint(cid))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	//只能删除自己在comment_edit_window内发表的评论，其他评论由管理员在后台处理
+	if comment.IsGuest() || comment.UserID != userId {
+		res["message"] = errForbidden.Error()
+		return
 	}
-	comment.ID = uint(cid)
-	err = comment.Delete()
+	if time.Since(comment.CreatedAt) > system.GetConfiguration().CommentEditWindow {
+		res["message"] = errCommentEditExpired.Error()
+		return
+	}
+	err = ctl.store.Comments().Delete(comment.ID)
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -96,7 +453,7 @@ func CommentDelete(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func CommentRead(c *gin.Context) {
+func (ctl *Controller) CommentRead(c *gin.Context) {
 	var (
 		id  string
 		_id uint64
@@ -110,9 +467,7 @@ func CommentRead(c *gin.Context) {
 		res["message"] = err.Error()
 		return
 	}
-	comment := new(models.Comment)
-	comment.ID = uint(_id)
-	err = comment.Update()
+	err = ctl.store.Comments().SetRead(uint(_id))
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -120,16 +475,277 @@ func CommentRead(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func CommentReadAll(c *gin.Context) {
+func (ctl *Controller) CommentReadAll(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
 	)
 	defer writeJSON(c, res)
-	err = models.SetAllCommentRead()
+	err = ctl.store.Comments().SetAllRead()
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
 	res["succeed"] = true
 }
+
+// 后台评论管理页面中列出所有状态的评论
+const COMMENT_STATUS_ALL = "all"
+
+// 后台审核页面中审核状态的名称和修改为该状态的按钮文字
+var (
+	commentStatusTabs  = append(append([]string{}, models.CommentStatuses...), COMMENT_STATUS_ALL)
+	commentStatusNames = map[string]string{
+		models.COMMENT_STATUS_PENDING:  "待审核",
+		models.COMMENT_STATUS_APPROVED: "已通过",
+		models.COMMENT_STATUS_SPAM:     "垃圾评论",
+		models.COMMENT_STATUS_TRASH:    "回收站",
+		COMMENT_STATUS_ALL:             "全部",
+	}
+	commentStatusActions = map[string]string{
+		models.COMMENT_STATUS_PENDING:  "待审核",
+		models.COMMENT_STATUS_APPROVED: "通过",
+		models.COMMENT_STATUS_SPAM:     "垃圾评论",
+		models.COMMENT_STATUS_TRASH:    "删除",
+	}
+)
+
+// 后台审核列表中的评论，附带评论者和文章
+type moderationComment struct {
+	*models.Comment
+	Author    string
+	PostTitle string
+	PostURL   string
+}
+
+// 按审核状态列出评论，默认列出等待审核的评论，status为all时列出所有评论
+// 可以按文章id、用户id和内容搜索
+func (ctl *Controller) CommentIndex(c *gin.Context) {
+	status := c.DefaultQuery("status", models.COMMENT_STATUS_PENDING)
+	filter := &models.CommentFilter{Query: strings.TrimSpace(c.Query("q"))}
+	if status != COMMENT_STATUS_ALL {
+		if !models.IsCommentStatus(status) {
+			Handle404(c)
+			return
+		}
+		filter.Status = status
+	}
+	if id, err := parseId(c.Query("post_id")); err == nil {
+		filter.PostID = id
+	}
+	if id, err := parseId(c.Query("user_id")); err == nil {
+		filter.UserID = id
+	}
+	comments, err := ctl.store.Comments().Search(filter)
+	if err != nil {
+		HandleMessage(c, err.Error())
+		return
+	}
+	counts, _ := ctl.store.Comments().CountByStatus()
+	items := make([]*moderationComment, 0, len(comments))
+	for _, comment := range comments {
+		item := &moderationComment{Comment: comment}
+		if comment.IsGuest() {
+			item.Author = comment.GuestName
+		} else if author, err := ctl.store.Users().Get(comment.UserID); err == nil {
+			item.Author = commentAuthorName(author)
+		}
+		if post, err := ctl.store.Posts().Get(comment.PostID); err == nil {
+			item.PostTitle, item.PostURL = post.Title, ctl.permalinks.Post(post)
+		}
+		items = append(items, item)
+	}
+	user, _ := c.Get(CONTEXT_USER_KEY)
+	c.HTML(http.StatusOK, "admin/comment.html", gin.H{
+		"csrf":     csrfToken(c),
+		"items":    items,
+		"status":   status,
+		"statuses": commentStatusTabs,
+		"names":    commentStatusNames,
+		"actions":  commentStatusActions,
+		"counts":   counts,
+		"postId":   c.Query("post_id"),
+		"userId":   c.Query("user_id"),
+		"q":        filter.Query,
+		"user":     user,
+		"comments": ctl.mustListUnreadComment(),
+	})
+}
+
+// 修改评论内容，已删除的评论不能修改
+func (ctl *Controller) CommentEdit(c *gin.Context) {
+	var (
+		err error
+		res = gin.H{}
+	)
+	defer writeJSON(c, res)
+	id, err := parseId(c.PostForm("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	content := strings.TrimSpace(c.PostForm("content"))
+	if content == "" {
+		res["message"] = "content cannot be empty."
+		return
+	}
+	comment, err := ctl.store.Comments().Get(id)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	if comment.Deleted {
+		res["message"] = errReplyDeleted.Error()
+		return
+	}
+	if err = ctl.store.Comments().UpdateContent(comment.ID, content); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+}
+
+// 永久删除回收站和垃圾评论中的评论，有回复的评论显示为[deleted]
+func (ctl *Controller) CommentPurge(c *gin.Context) {
+	var (
+		err error
+		res = gin.H{}
+	)
+	defer writeJSON(c, res)
+	comments, err := ctl.commentsFromIds(c.PostForm("ids"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	for _, comment := range comments {
+		if comment.Status != models.COMMENT_STATUS_TRASH && comment.Status != models.COMMENT_STATUS_SPAM {
+			res["message"] = "only comments in trash or spam can be deleted permanently."
+			return
+		}
+	}
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		for _, comment := range comments {
+			if err := tx.Comments().Delete(comment.ID); err != nil && err != models.ErrNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["data"] = gin.H{"count": len(comments)}
+	res["succeed"] = true
+}
+
+// 把用户的所有评论移到回收站，用于处理恶意用户，可以在回收站中恢复
+func (ctl *Controller) CommentTrashUser(c *gin.Context) {
+	var (
+		err error
+		res = gin.H{}
+	)
+	defer writeJSON(c, res)
+	userId, err := parseId(c.PostForm("user_id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	if _, err = ctl.store.Users().Get(userId); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	count, err := ctl.store.Comments().SetStatusByUserId(userId, models.COMMENT_STATUS_TRASH)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["data"] = gin.H{"count": count}
+	res["succeed"] = true
+}
+
+// 读取以逗号分隔的评论id对应的评论
+func (ctl *Controller) commentsFromIds(ids string) ([]*models.Comment, error) {
+	comments := make([]*models.Comment, 0)
+	for _, id := range strings.Split(ids, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		cid, err := parseId(id)
+		if err != nil {
+			return nil, err
+		}
+		comment, err := ctl.store.Comments().Get(cid)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if len(comments) == 0 {
+		return nil, errors.New("ids cannot be empty.")
+	}
+	return comments, nil
+}
+
+// 批量修改评论的审核状态，ids以逗号分隔，等待审核的回复通过后通知上级评论的作者
+func (ctl *Controller) CommentModerate(c *gin.Context) {
+	var (
+		err      error
+		res      = gin.H{}
+		comments []*models.Comment
+	)
+	defer writeJSON(c, res)
+	status := c.PostForm("status")
+	if !models.IsCommentStatus(status) {
+		res["message"] = "invalid status."
+		return
+	}
+	comments, err = ctl.commentsFromIds(c.PostForm("ids"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		for _, comment := range comments {
+			if err := tx.Comments().SetStatus(comment.ID, status); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	if status == models.COMMENT_STATUS_APPROVED {
+		for _, comment := range comments {
+			if comment.Status == models.COMMENT_STATUS_PENDING {
+				ctl.notifyApprovedComment(comment)
+			}
+		}
+	}
+	res["data"] = gin.H{"count": len(comments)}
+	res["succeed"] = true
+}
+
+// 等待审核的评论通过后通知上级评论的作者和提到的用户
+func (ctl *Controller) notifyApprovedComment(comment *models.Comment) {
+	post, err := ctl.store.Posts().Get(comment.PostID)
+	if err != nil {
+		return
+	}
+	var parent *models.Comment
+	if comment.ParentID != 0 {
+		if parent, err = ctl.store.Comments().Get(comment.ParentID); err != nil || parent.Deleted {
+			parent = nil
+		}
+	}
+	//游客没有用户记录，只需要显示昵称
+	replier := &models.User{NickName: comment.GuestName}
+	if !comment.IsGuest() {
+		if replier, err = ctl.store.Users().Get(comment.UserID); err != nil {
+			return
+		}
+	}
+	ctl.notifyParticipants(post, comment, parent, replier)
+}
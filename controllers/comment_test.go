@@ -0,0 +1,538 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gingorm/models"
+	"github.com/dchest/captcha"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// 任意验证码id的答案都是1234
+type fixedCaptchaStore struct{}
+
+func (fixedCaptchaStore) Set(id string, digits []byte) {}
+
+func (fixedCaptchaStore) Get(id string, clear bool) []byte {
+	return []byte{1, 2, 3, 4}
+}
+
+func newCommentTestRouter(ctl *Controller, user *models.User) *gin.Engine {
+	captcha.SetCustomStore(fixedCaptchaStore{})
+	r := newTestRouter(user)
+	r.Use(sessions.Sessions(SESSION_NAME, ctl.sessions), func(c *gin.Context) {
+		//评论者id取自session
+		if user != nil {
+			sessions.Default(c).Set(SESSION_KEY, user.ID)
+		}
+	})
+	r.POST("/visitor/new_comment", ctl.CommentPost)
+	r.POST("/comment/guest", ctl.GuestCommentPost)
+	return r
+}
+
+func TestCommentReply(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	r := newCommentTestRouter(ctl, user)
+	now := time.Now()
+	post := &models.Post{Title: "post", Slug: "post", IsPublished: true, PublishAt: &now}
+	other := &models.Post{Title: "other", Slug: "other", IsPublished: true, PublishAt: &now}
+	for _, p := range []*models.Post{post, other} {
+		if err := store.Posts().Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	approved := models.COMMENT_STATUS_APPROVED
+	parent := &models.Comment{PostID: post.ID, UserID: user.ID, Content: "parent", Status: approved}
+	otherComment := &models.Comment{PostID: other.ID, UserID: user.ID, Content: "other", Status: approved}
+	deleted := &models.Comment{PostID: post.ID, UserID: user.ID, Content: "", Deleted: true, Status: approved}
+	pending := &models.Comment{PostID: post.ID, UserID: user.ID, Content: "pending", Status: models.COMMENT_STATUS_PENDING}
+	for _, comment := range []*models.Comment{parent, otherComment, deleted, pending} {
+		if err := store.Comments().Create(comment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reply := func(parentId uint) string {
+		return postForm(r, "/visitor/new_comment", url.Values{"postId": {fmt.Sprint(post.ID)}, "content": {"reply"},
+			"verifyCode": {"1234"}, "parentId": {fmt.Sprint(parentId)}}).Body.String()
+	}
+	if body := reply(parent.ID); !strings.Contains(body, `"succeed":true`) {
+		t.Fatalf("reply: %s", body)
+	}
+	comments, _ := store.Comments().List()
+	found := false
+	for _, comment := range comments {
+		if comment.Content == "reply" && comment.ParentID == parent.ID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("reply not saved: %+v", comments)
+	}
+	//上级评论必须属于同一篇文章
+	if body := reply(otherComment.ID); strings.Contains(body, `"succeed":true`) {
+		t.Error("replied to a comment of another post")
+	}
+	if body := reply(deleted.ID); !strings.Contains(body, errReplyDeleted.Error()) {
+		t.Errorf("reply to deleted comment: %s", body)
+	}
+	//不能回复未通过审核的评论
+	if body := reply(pending.ID); strings.Contains(body, `"succeed":true`) {
+		t.Error("replied to a pending comment")
+	}
+	if body := reply(999); strings.Contains(body, `"succeed":true`) {
+		t.Error("replied to a missing comment")
+	}
+}
+
+func TestCommentUnsubscribe(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	r := newTestRouter(nil)
+	r.GET("/comment/unsubscribe", ctl.CommentUnsubscribe)
+
+	link := replyUnsubscribeURL(user)
+	if !strings.HasPrefix(link, "http://blog.test/comment/unsubscribe?token=") {
+		t.Fatalf("link = %s", link)
+	}
+	token := link[strings.Index(link, "token=")+len("token="):]
+	other := createTestUser(t, store, "other", models.ROLE_COMMENTER)
+	//签名和用户id不匹配时无效
+	forged := fmt.Sprintf("%d.%s", other.ID, strings.SplitN(token, ".", 2)[1])
+	for _, bad := range []string{"", "abc", forged, token + "0"} {
+		getRequest(r, "/comment/unsubscribe?token="+url.QueryEscape(bad))
+	}
+	for _, u := range []*models.User{user, other} {
+		if u, _ := store.Users().Get(u.ID); u.MuteReplies {
+			t.Fatalf("user %s muted by an invalid token", u.NickName)
+		}
+	}
+	if w := getRequest(r, "/comment/unsubscribe?token="+token); !strings.Contains(w.Body.String(), "已退订") {
+		t.Errorf("unsubscribe: %s", w.Body.String())
+	}
+	if u, _ := store.Users().Get(user.ID); !u.MuteReplies {
+		t.Error("replies not muted")
+	}
+}
+
+func TestCommentModeration(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	now := time.Now()
+	post := &models.Post{Title: "post", Slug: "post", IsPublished: true, PublishAt: &now}
+	if err := store.Posts().Create(post); err != nil {
+		t.Fatal(err)
+	}
+	comment := func(user *models.User, content string) string {
+		r := newCommentTestRouter(ctl, user)
+		return postForm(r, "/visitor/new_comment", url.Values{"postId": {fmt.Sprint(post.ID)}, "content": {content},
+			"verifyCode": {"1234"}}).Body.String()
+	}
+	editor := createTestUser(t, store, "editor", models.ROLE_EDITOR)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	cases := []struct {
+		user    *models.User
+		content string
+		status  string
+	}{
+		{editor, "by editor", models.COMMENT_STATUS_APPROVED},
+		//第一次评论需要审核
+		{user, "first", models.COMMENT_STATUS_PENDING},
+		{user, "see http://a.test http://b.test http://c.test", models.COMMENT_STATUS_SPAM},
+	}
+	for _, c := range cases {
+		if body := comment(c.user, c.content); !strings.Contains(body, `"status":"`+c.status+`"`) {
+			t.Errorf("comment %q: %s", c.content, body)
+		}
+	}
+	if comments, _ := store.Comments().ListByPostId(post.ID); len(comments) != 1 {
+		t.Errorf("visible comments = %d, want 1", len(comments))
+	}
+
+	pending, _ := store.Comments().Search(&models.CommentFilter{Status: models.COMMENT_STATUS_PENDING})
+	if len(pending) != 1 {
+		t.Fatalf("pending = %d, want 1", len(pending))
+	}
+	r := newTestRouter(editor)
+	r.POST("/admin/comments/moderate", ctl.CommentModerate)
+	for _, form := range []url.Values{
+		{"status": {"bogus"}, "ids": {fmt.Sprint(pending[0].ID)}},
+		{"status": {models.COMMENT_STATUS_APPROVED}, "ids": {""}},
+		{"status": {models.COMMENT_STATUS_APPROVED}, "ids": {"999"}},
+	} {
+		if body := postForm(r, "/admin/comments/moderate", form).Body.String(); strings.Contains(body, `"succeed":true`) {
+			t.Errorf("moderate %v: %s", form, body)
+		}
+	}
+	body := postForm(r, "/admin/comments/moderate", url.Values{"status": {models.COMMENT_STATUS_APPROVED}, "ids": {fmt.Sprint(pending[0].ID)}}).Body.String()
+	if !strings.Contains(body, `"count":1`) {
+		t.Fatalf("moderate: %s", body)
+	}
+	//通过审核后的用户不需要再审核
+	if body := comment(user, "second"); !strings.Contains(body, `"status":"approved"`) {
+		t.Errorf("second comment: %s", body)
+	}
+	if comments, _ := store.Comments().ListByPostId(post.ID); len(comments) != 3 {
+		t.Errorf("visible comments = %d, want 3", len(comments))
+	}
+}
+
+// 按内容判断垃圾评论的测试用检查器
+type keywordSpamChecker string
+
+func (k keywordSpamChecker) Check(comment *models.Comment) (string, error) {
+	if strings.Contains(comment.Content, string(k)) {
+		return "keyword", nil
+	}
+	return "", nil
+}
+
+func TestCommentSpamCheckerInjected(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	ctl.spam = keywordSpamChecker("lottery")
+	now := time.Now()
+	post := &models.Post{Title: "post", Slug: "post", IsPublished: true, PublishAt: &now}
+	if err := store.Posts().Create(post); err != nil {
+		t.Fatal(err)
+	}
+	r := newCommentTestRouter(ctl, createTestUser(t, store, "user", models.ROLE_COMMENTER))
+	for content, status := range map[string]string{
+		"win the lottery": models.COMMENT_STATUS_SPAM,
+		//默认检查器会判为垃圾评论的内容不受影响
+		"see http://a.test http://b.test http://c.test": models.COMMENT_STATUS_PENDING,
+	} {
+		body := postForm(r, "/visitor/new_comment", url.Values{"postId": {fmt.Sprint(post.ID)}, "content": {content},
+			"verifyCode": {"1234"}}).Body.String()
+		if !strings.Contains(body, `"status":"`+status+`"`) {
+			t.Errorf("comment %q: %s", content, body)
+		}
+	}
+}
+
+func TestGuestComment(t *testing.T) {
+	store := models.NewMemoryStore()
+	loadTestConfig(t, "")
+	ctl := newTestController(t, store)
+	r := newCommentTestRouter(ctl, nil)
+	now := time.Now()
+	post := &models.Post{Title: "post", Slug: "post", IsPublished: true, PublishAt: &now}
+	if err := store.Posts().Create(post); err != nil {
+		t.Fatal(err)
+	}
+	guest := func(name, email, website string) *httptest.ResponseRecorder {
+		return postForm(r, "/comment/guest", url.Values{"postId": {fmt.Sprint(post.ID)}, "content": {"hello"},
+			"verifyCode": {"1234"}, "name": {name}, "email": {email}, "url": {website}})
+	}
+	if body := guest("guest", "guest@example.com", "").Body.String(); !strings.Contains(body, "disabled") {
+		t.Errorf("guest comments enabled by default: %s", body)
+	}
+
+	loadTestConfig(t, "guest_comments: true\n")
+	for _, form := range [][3]string{
+		{"", "guest@example.com", ""},
+		{strings.Repeat("名", COMMENT_GUEST_NAME_SIZE+1), "guest@example.com", ""},
+		{"guest", "guest", ""},
+		{"guest", "Guest <guest@example.com>", ""},
+		{"guest", "guest@example.com", "javascript:alert(1)"},
+		{"guest", "guest@example.com", "http://"},
+	} {
+		if body := guest(form[0], form[1], form[2]).Body.String(); strings.Contains(body, `"succeed":true`) {
+			t.Errorf("guest %q: %s", form, body)
+		}
+	}
+	w := guest(" guest ", "guest@example.com", "https://guest.test")
+	//游客评论总是需要审核
+	if !strings.Contains(w.Body.String(), `"status":"pending"`) {
+		t.Fatalf("guest comment: %s", w.Body.String())
+	}
+	cookie := ""
+	for _, c := range w.Header()["Set-Cookie"] {
+		if strings.HasPrefix(c, COOKIE_COMMENT_GUEST+"=") {
+			cookie = c
+		}
+	}
+	if !strings.Contains(cookie, "HttpOnly") {
+		t.Errorf("guest cookie = %q", cookie)
+	}
+	comments, _ := store.Comments().Search(&models.CommentFilter{Status: models.COMMENT_STATUS_PENDING})
+	if len(comments) != 1 || comments[0].UserID != 0 || comments[0].GuestName != "guest" || comments[0].GuestUrl != "https://guest.test" {
+		t.Fatalf("comments = %+v", comments)
+	}
+	//同一游客重复发表相同内容是垃圾评论
+	if body := guest("guest", "GUEST@example.com", "").Body.String(); !strings.Contains(body, `"status":"spam"`) {
+		t.Errorf("duplicate guest comment: %s", body)
+	}
+}
+
+func TestCommentGuestFromCookie(t *testing.T) {
+	r := gin.New()
+	var guest *commentGuest
+	r.GET("/set", func(c *gin.Context) {
+		setCommentGuestCookie(c, &commentGuest{Name: "游客 a&b", Email: "guest@example.com", Url: "https://guest.test/?a=1"})
+	})
+	r.GET("/get", func(c *gin.Context) {
+		guest = commentGuestFromCookie(c)
+	})
+	if getRequest(r, "/get"); guest != nil {
+		t.Errorf("guest without cookie = %+v", guest)
+	}
+	w := getRequest(r, "/set")
+	req := httptest.NewRequest(http.MethodGet, "/get", nil)
+	req.Header.Set("Cookie", strings.SplitN(w.Header().Get("Set-Cookie"), ";", 2)[0])
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if guest == nil || guest.Name != "游客 a&b" || guest.Email != "guest@example.com" || guest.Url != "https://guest.test/?a=1" {
+		t.Errorf("guest = %+v", guest)
+	}
+}
+
+func TestMentions(t *testing.T) {
+	cases := []struct {
+		content, name string
+		want          bool
+	}{
+		{"@alice hi", "alice", true},
+		{"hi @Alice!", "alice", true},
+		{"hi @alice", "alice", true},
+		{"hi @alice2", "alice", false},
+		{"hi @alice_b @alice-c", "alice", false},
+		{"@alice_b and @alice,", "alice", true},
+		{"@小明你好", "小明", false},
+		{"@小明 你好", "小明", true},
+		{"alice", "alice", false},
+		{"@", "", false},
+	}
+	for _, c := range cases {
+		if got := mentions(c.content, c.name); got != c.want {
+			t.Errorf("mentions(%q, %q) = %v", c.content, c.name, got)
+		}
+	}
+}
+
+func TestCommentAuthorName(t *testing.T) {
+	for _, c := range []struct {
+		user *models.User
+		name string
+	}{
+		{&models.User{NickName: "Alice", GithubLoginId: "alice-gh"}, "Alice"},
+		{&models.User{GithubLoginId: "bob-gh"}, "bob-gh"},
+		{&models.User{NickName: "Carol"}, "Carol"},
+	} {
+		if name := commentAuthorName(c.user); name != c.name {
+			t.Errorf("commentAuthorName(%+v) = %q, want %q", c.user, name, c.name)
+		}
+	}
+}
+
+func TestCommentPreview(t *testing.T) {
+	r := gin.New()
+	r.POST("/comment/preview", CommentPreview)
+	var res struct {
+		Data struct{ Html string }
+	}
+	w := postForm(r, "/comment/preview", url.Values{"content": {"**hi** <script>x</script>"}})
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(res.Data.Html, "<strong>hi</strong>") || strings.Contains(res.Data.Html, "script") {
+		t.Errorf("preview: %s", w.Body.String())
+	}
+}
+
+func TestCommentDeleteOwnership(t *testing.T) {
+	loadTestConfig(t, "comment_edit_window: 50ms\n")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	other := createTestUser(t, store, "other", models.ROLE_COMMENTER)
+	r := newCommentTestRouter(ctl, user)
+	r.POST("/visitor/comment/:id/delete", ctl.CommentDelete)
+	own := &models.Comment{PostID: 1, UserID: user.ID, Content: "own"}
+	others := &models.Comment{PostID: 1, UserID: other.ID, Content: "others"}
+	guest := &models.Comment{PostID: 1, Content: "guest", GuestEmail: "guest@example.com"}
+	old := &models.Comment{PostID: 1, UserID: user.ID, Content: "old"}
+	for _, comment := range []*models.Comment{old, own, others, guest} {
+		if err := store.Comments().Create(comment); err != nil {
+			t.Fatal(err)
+		}
+		if comment == old {
+			time.Sleep(60 * time.Millisecond)
+		}
+	}
+	del := func(id uint) string {
+		return postForm(r, fmt.Sprintf("/visitor/comment/%d/delete", id), nil).Body.String()
+	}
+	//不能删除其他用户和游客的评论
+	for _, comment := range []*models.Comment{others, guest} {
+		if body := del(comment.ID); !strings.Contains(body, errForbidden.Error()) {
+			t.Errorf("delete %s: %s", comment.Content, body)
+		}
+	}
+	if body := del(old.ID); !strings.Contains(body, errCommentEditExpired.Error()) {
+		t.Errorf("delete expired comment: %s", body)
+	}
+	if body := del(999); strings.Contains(body, `"succeed":true`) {
+		t.Errorf("delete missing comment: %s", body)
+	}
+	if body := del(own.ID); !strings.Contains(body, `"succeed":true`) {
+		t.Errorf("delete own comment: %s", body)
+	}
+	for _, comment := range []*models.Comment{old, others, guest} {
+		if _, err := store.Comments().Get(comment.ID); err != nil {
+			t.Errorf("comment %s deleted", comment.Content)
+		}
+	}
+	if _, err := store.Comments().Get(own.ID); err != models.ErrNotFound {
+		t.Errorf("own comment not deleted: %v", err)
+	}
+}
+
+func TestCommentAdmin(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	editor := createTestUser(t, store, "editor", models.ROLE_EDITOR)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	r := newTestRouter(editor, "admin/comment.html")
+	r.GET("/admin/comments", ctl.CommentIndex)
+	r.POST("/admin/comments/edit", ctl.CommentEdit)
+	r.POST("/admin/comments/purge", ctl.CommentPurge)
+	r.POST("/admin/comments/trash_user", ctl.CommentTrashUser)
+	approved := &models.Comment{PostID: 1, UserID: user.ID, Content: "approved", Status: models.COMMENT_STATUS_APPROVED}
+	spam := &models.Comment{PostID: 1, UserID: editor.ID, Content: "spam", Status: models.COMMENT_STATUS_SPAM}
+	deleted := &models.Comment{PostID: 1, UserID: editor.ID, Deleted: true, Status: models.COMMENT_STATUS_APPROVED}
+	for _, comment := range []*models.Comment{approved, spam, deleted} {
+		if err := store.Comments().Create(comment); err != nil {
+			t.Fatal(err)
+		}
+	}
+	succeed := func(path string, form url.Values) bool {
+		return strings.Contains(postForm(r, path, form).Body.String(), `"succeed":true`)
+	}
+
+	for _, query := range []string{"", "?status=spam", "?status=all&post_id=1&q=spam"} {
+		if w := getRequest(r, "/admin/comments"+query); w.Code != http.StatusOK {
+			t.Errorf("list %q: %d", query, w.Code)
+		}
+	}
+	if w := getRequest(r, "/admin/comments?status=bogus"); w.Code != http.StatusNotFound {
+		t.Errorf("list invalid status: %d", w.Code)
+	}
+
+	if succeed("/admin/comments/edit", url.Values{"id": {fmt.Sprint(approved.ID)}, "content": {" "}}) ||
+		succeed("/admin/comments/edit", url.Values{"id": {fmt.Sprint(deleted.ID)}, "content": {"x"}}) {
+		t.Error("edited with empty content or a deleted comment")
+	}
+	if !succeed("/admin/comments/edit", url.Values{"id": {fmt.Sprint(approved.ID)}, "content": {" edited "}}) {
+		t.Error("edit failed")
+	}
+	if c, _ := store.Comments().Get(approved.ID); c.Content != "edited" {
+		t.Errorf("content = %q", c.Content)
+	}
+
+	//只能永久删除回收站和垃圾评论中的评论
+	if succeed("/admin/comments/purge", url.Values{"ids": {fmt.Sprintf("%d,%d", spam.ID, approved.ID)}}) {
+		t.Error("purged an approved comment")
+	}
+	if _, err := store.Comments().Get(spam.ID); err != nil {
+		t.Fatalf("spam purged with an approved comment: %v", err)
+	}
+	if !succeed("/admin/comments/purge", url.Values{"ids": {fmt.Sprint(spam.ID)}}) {
+		t.Error("purge failed")
+	}
+	if _, err := store.Comments().Get(spam.ID); err != models.ErrNotFound {
+		t.Errorf("spam not purged: %v", err)
+	}
+
+	if succeed("/admin/comments/trash_user", url.Values{"user_id": {"999"}}) {
+		t.Error("trashed comments of a missing user")
+	}
+	if body := postForm(r, "/admin/comments/trash_user", url.Values{"user_id": {fmt.Sprint(user.ID)}}).Body.String(); !strings.Contains(body, `"count":1`) {
+		t.Errorf("trash user: %s", body)
+	}
+	if c, _ := store.Comments().Get(approved.ID); c.Status != models.COMMENT_STATUS_TRASH {
+		t.Errorf("status = %s", c.Status)
+	}
+}
+
+// 未发布、定时发布和不存在的文章不能评论
+func TestCommentOnInvisiblePost(t *testing.T) {
+	loadTestConfig(t, "guest_comments: true\n")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	r := newCommentTestRouter(ctl, user)
+
+	now := time.Now()
+	future := now.Add(time.Hour)
+	visible := &models.Post{Title: "visible", Slug: "visible", Body: "body", IsPublished: true, PublishAt: &now}
+	draft := &models.Post{Title: "draft", Slug: "draft", Body: "body"}
+	scheduled := &models.Post{Title: "scheduled", Slug: "scheduled", Body: "body", PublishAt: &future}
+	for _, post := range []*models.Post{visible, draft, scheduled} {
+		if err := store.Posts().Create(post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		path   string
+		postId string
+		status int
+	}{
+		{"/comment/guest", "99", http.StatusNotFound},
+		{"/comment/guest", fmt.Sprint(draft.ID), http.StatusNotFound},
+		{"/comment/guest", fmt.Sprint(scheduled.ID), http.StatusNotFound},
+		{"/visitor/new_comment", fmt.Sprint(draft.ID), http.StatusNotFound},
+		{"/visitor/new_comment", fmt.Sprint(scheduled.ID), http.StatusNotFound},
+		{"/comment/guest", fmt.Sprint(visible.ID), http.StatusOK},
+		{"/visitor/new_comment", fmt.Sprint(visible.ID), http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := postForm(r, tt.path, url.Values{"postId": {tt.postId}, "content": {"hello"}, "verifyCode": {"1234"},
+			"name": {"guest"}, "email": {"guest@example.com"}})
+		succeed := strings.Contains(w.Body.String(), `"succeed":true`)
+		if w.Code != tt.status || succeed != (tt.status == http.StatusOK) {
+			t.Errorf("%s post %s: status = %d, body = %s", tt.path, tt.postId, w.Code, w.Body.String())
+		}
+	}
+	comments, _ := store.Comments().ListUnread()
+	for _, comment := range comments {
+		if comment.PostID != visible.ID {
+			t.Errorf("comment created on post %d", comment.PostID)
+		}
+	}
+}
+
+// 通知邮件中的评论内容和文章标题需要转义
+func TestCommentNoticeEscapesContent(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	post := &models.Post{Title: "<b>title</b>", Slug: "title"}
+	post.ID = 1
+	comment := &models.Comment{Content: `<script>alert("x")</script>`, Status: models.COMMENT_STATUS_PENDING}
+	subject, body := ctl.commentNotice(post, comment)
+	if subject == "" || strings.Contains(body, "<script>") || strings.Contains(body, "<b>") ||
+		!strings.Contains(body, "&lt;script&gt;") || !strings.Contains(body, "&lt;b&gt;title") {
+		t.Errorf("subject = %q, body = %q", subject, body)
+	}
+	comment.Status = models.COMMENT_STATUS_SPAM
+	if subject, _ = ctl.commentNotice(post, comment); subject != "" {
+		t.Errorf("spam comment notice = %q", subject)
+	}
+}
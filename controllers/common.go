@@ -1,29 +1,62 @@
 package controllers
 
 import (
-	"fmt"
 	"net/http"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"github.com/denisbakhtin/sitemap"
 	"github.com/gin-gonic/gin"
 	"gingorm/helpers"
 	"gingorm/models"
+	"gingorm/search"
 	"gingorm/system"
 )
 
 const (
-	SESSION_KEY          = "UserID"       // session key
-	CONTEXT_USER_KEY     = "User"         // context user key
-	SESSION_GITHUB_STATE = "GITHUB_STATE" // github state session key
-	SESSION_CAPTCHA      = "GIN_CAPTCHA"  // captcha session key
+	SESSION_KEY            = "UserID"         // session key
+	CONTEXT_USER_KEY       = "User"           // context user key
+	SESSION_OAUTH_STATE    = "OAUTH_STATE"    // oauth state session key
+	SESSION_OAUTH_PROVIDER = "OAUTH_PROVIDER" // oauth provider session key
+	SESSION_CAPTCHA        = "GIN_CAPTCHA"    // captcha session key
+	SESSION_CSRF           = "CSRF_TOKEN"     // csrf token session key
+	CSRF_COOKIE_NAME       = "csrf_token"     // csrf token cookie of visitors not signed in
+	CONTEXT_CSRF_KEY       = "CSRF"           // context csrf token key
+	CONTEXT_TOKEN_KEY      = "AccessToken"    // context access token key
 )
 
+//控制器，所有需要读写数据的handler都挂在Controller上，仓库、session存储、第三方登录提供方、固定链接和垃圾评论检查通过NewController注入
+//搜索索引保存在内存中，启动后由RebuildSearchIndex建立
+type Controller struct {
+	store       models.Store
+	sessions    *SessionStore
+	oauth       *OAuthProviders
+	permalinks  *Permalinks
+	searchIndex *search.Index
+	spam        SpamChecker
+}
+
+func NewController(store models.Store, sessions *SessionStore, oauth *OAuthProviders, permalinks *Permalinks, spam SpamChecker) *Controller {
+	return &Controller{store: store, sessions: sessions, oauth: oauth, permalinks: permalinks, searchIndex: search.NewIndex(), spam: spam}
+}
+
 //错误页面
 func Handle404(c *gin.Context) {
 	HandleMessage(c, "Sorry,I lost myself!")
 }
+
+//当前session的csrf token，由csrf中间件写入context，渲染含表单的页面时传给模板
+func csrfToken(c *gin.Context) string {
+	return c.GetString(CONTEXT_CSRF_KEY)
+}
+
+//没有权限
+func Handle403(c *gin.Context) {
+	c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
+		"message": "Forbidden!",
+	})
+}
 //错误页面
 func HandleMessage(c *gin.Context, message string) {
 	c.HTML(http.StatusNotFound, "errors/error.html", gin.H{
@@ -56,7 +89,7 @@ func NotifyEmail(subject, body string) error {
 }
 
 //创建xml
-func CreateXMLSitemap() {
+func (ctl *Controller) CreateXMLSitemap() {
 	configuration := system.GetConfiguration()
 	folder := path.Join(configuration.Public, "sitemap")
 	os.MkdirAll(folder, os.ModePerm)
@@ -71,11 +104,11 @@ func CreateXMLSitemap() {
 		Priority:   1,
 	})
 
-	posts, err := models.ListPublishedPost("", 0, 0)
+	posts, err := ctl.store.Posts().ListPublished(0, 0, 0)
 	if err == nil {
 		for _, post := range posts {
 			items = append(items, sitemap.Item{
-				Loc:        fmt.Sprintf("%s/post/%d", domain, post.ID),
+				Loc:        absoluteURL(ctl.permalinks.Post(post)),
 				LastMod:    post.UpdatedAt,
 				Changefreq: "weekly",
 				Priority:   0.9,
@@ -83,11 +116,11 @@ func CreateXMLSitemap() {
 		}
 	}
 
-	pages, err := models.ListPublishedPage()
+	pages, err := ctl.store.Pages().List(true)
 	if err == nil {
 		for _, page := range pages {
 			items = append(items, sitemap.Item{
-				Loc:        fmt.Sprintf("%s/page/%d", domain, page.ID),
+				Loc:        absoluteURL(ctl.permalinks.Page(page)),
 				LastMod:    page.UpdatedAt,
 				Changefreq: "monthly",
 				Priority:   0.8,
@@ -107,5 +140,42 @@ func writeJSON(c *gin.Context, h gin.H) {
 	if _, ok := h["succeed"]; !ok {
 		h["succeed"] = false
 	}
-	c.JSON(http.StatusOK, h)
+	//状态码默认为200，处理函数可以先用c.Status设置
+	c.JSON(c.Writer.Status(), h)
+}
+
+//解析路径或表单中的id
+func parseId(id string) (uint, error) {
+	_id, err := strconv.ParseUint(id, 10, 64)
+	return uint(_id), err
+}
+
+func (ctl *Controller) mustListUnreadComment() []*models.Comment {
+	comments, _ := ctl.store.Comments().ListUnread()
+	return comments
+}
+
+func (ctl *Controller) mustListTag() []*models.Tag {
+	tags, _ := ctl.store.Tags().ListPublished()
+	return tags
+}
+
+func (ctl *Controller) mustListPostArchives() []*models.QrArchive {
+	archives, _ := ctl.store.Posts().ListArchives()
+	return archives
+}
+
+func (ctl *Controller) mustListLinks() []*models.Link {
+	links, _ := ctl.store.Links().List()
+	return links
+}
+
+func (ctl *Controller) mustListMaxReadPost() []*models.Post {
+	posts, _ := ctl.store.Posts().ListMaxRead()
+	return posts
+}
+
+func (ctl *Controller) mustListMaxCommentPost() []*models.Post {
+	posts, _ := ctl.store.Posts().ListMaxComment()
+	return posts
 }
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gingorm/models"
+	"gingorm/system"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// 加载测试配置，没有设置的项使用默认值
+func loadTestConfig(t *testing.T, conf string) {
+	t.Helper()
+	f, err := ioutil.TempFile("", "conf*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString("session_secret: secret\ndomain: http://blog.test\n" + conf); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err = system.LoadConfiguration(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 使用内存仓库的controller，不需要数据库
+func newTestController(t *testing.T, store models.Store) *Controller {
+	t.Helper()
+	permalinks, err := NewPermalinks(system.DEFAULT_POST_PERMALINK, system.DEFAULT_PAGE_PERMALINK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewSessionStore(store.Sessions(), time.Hour, 2*time.Hour)
+	return NewController(store, sessions, nil, permalinks, NewHeuristicSpamChecker(store.Comments()))
+}
+
+// 测试用的router，模板只输出message，user不为空时作为已登录用户
+func newTestRouter(user *models.User, pages ...string) *gin.Engine {
+	r := gin.New()
+	tmpl := template.New("")
+	for _, name := range append(pages, "errors/error.html") {
+		template.Must(tmpl.New(name).Parse("{{.message}}"))
+	}
+	r.SetHTMLTemplate(tmpl)
+	r.Use(func(c *gin.Context) {
+		if user != nil {
+			c.Set(CONTEXT_USER_KEY, user)
+		}
+	})
+	return r
+}
+
+func createTestUser(t *testing.T, store models.Store, name, role string) *models.User {
+	t.Helper()
+	user := &models.User{Email: name + "@example.com", NickName: name, Role: role, VerifyState: models.VERIFY_STATE_VERIFIED}
+	if err := store.Users().Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func postForm(r http.Handler, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+// 草稿中保存的标签id转为标签，已删除的标签忽略
+func (ctl *Controller) draftTags(draft *models.Draft) []*models.Tag {
+	tags := make([]*models.Tag, 0)
+	for _, id := range strings.Split(draft.Tags, ",") {
+		tagId, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		if tag, err := ctl.store.Tags().Get(uint(tagId)); err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// 其他用户正在编辑的草稿，附带编辑者
+func (ctl *Controller) otherDrafts(kind string, targetId, userId uint) []*models.Draft {
+	drafts, _ := ctl.store.Drafts().ListByTarget(kind, targetId)
+	others := make([]*models.Draft, 0, len(drafts))
+	for _, draft := range drafts {
+		if draft.UserID == userId {
+			continue
+		}
+		if user, err := ctl.store.Users().Get(draft.UserID); err == nil {
+			draft.User = user
+			others = append(others, draft)
+		}
+	}
+	return others
+}
+
+// 自动保存的结果，others为同时编辑的其他用户
+func (ctl *Controller) draftResult(draft *models.Draft) gin.H {
+	others := make([]gin.H, 0)
+	for _, other := range ctl.otherDrafts(draft.Kind, draft.TargetID, draft.UserID) {
+		name := other.User.NickName
+		if name == "" {
+			name = other.User.Email
+		}
+		others = append(others, gin.H{"name": name, "updatedAt": other.UpdatedAt.Format(time.RFC3339)})
+	}
+	return gin.H{"updatedAt": draft.UpdatedAt.Format(time.RFC3339), "others": others}
+}
+
+// 编辑器定时提交标题、内容和标签，保存为当前用户的草稿，不影响已发布的内容
+func (ctl *Controller) PostDraftSave(c *gin.Context) {
+	var (
+		err  error
+		res  = gin.H{}
+		id   uint
+		post *models.Post
+	)
+	defer writeJSON(c, res)
+	id, err = parseId(c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	post, err = ctl.getEditablePost(c, id)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	draft := &models.Draft{
+		Kind:     models.SLUG_KIND_POST,
+		TargetID: post.ID,
+		UserID:   contextUserId(c),
+		Title:    c.PostForm("title"),
+		Body:     c.PostForm("body"),
+		Tags:     c.PostForm("tags"),
+	}
+	if err = ctl.store.Drafts().Save(draft); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+	res["data"] = ctl.draftResult(draft)
+}
+
+// 发布修改，用草稿覆盖文章的标题、内容和标签，slug和发布状态不变
+func (ctl *Controller) PostDraftPublish(c *gin.Context) {
+	var (
+		err   error
+		res   = gin.H{}
+		id    uint
+		post  *models.Post
+		draft *models.Draft
+	)
+	defer writeJSON(c, res)
+	id, err = parseId(c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	post, err = ctl.getEditablePost(c, id)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	userId := contextUserId(c)
+	draft, err = ctl.store.Drafts().Get(models.SLUG_KIND_POST, post.ID, userId)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	post.Title, post.Body = draft.Title, draft.Body
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		if err := tx.Posts().Update(post); err != nil {
+			return err
+		}
+		if err := tx.PostTags().DeleteByPostId(post.ID); err != nil {
+			return err
+		}
+		if err := addPostTags(tx, post.ID, draft.Tags); err != nil {
+			return err
+		}
+		if err := savePostRevision(tx, post, userId); err != nil {
+			return err
+		}
+		return tx.Drafts().Delete(models.SLUG_KIND_POST, post.ID, userId)
+	})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	ctl.indexPost(post.ID)
+	res["succeed"] = true
+}
+
+// 放弃当前用户的草稿
+func (ctl *Controller) PostDraftDiscard(c *gin.Context) {
+	var (
+		err  error
+		res  = gin.H{}
+		id   uint
+		post *models.Post
+	)
+	defer writeJSON(c, res)
+	id, err = parseId(c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	post, err = ctl.getEditablePost(c, id)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	if err = ctl.store.Drafts().Delete(models.SLUG_KIND_POST, post.ID, contextUserId(c)); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+}
+
+func (ctl *Controller) PageDraftSave(c *gin.Context) {
+	var (
+		err  error
+		res  = gin.H{}
+		id   uint
+		page *models.Page
+	)
+	defer writeJSON(c, res)
+	id, err = parseId(c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	page, err = ctl.store.Pages().Get(id)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	draft := &models.Draft{
+		Kind:     models.SLUG_KIND_PAGE,
+		TargetID: page.ID,
+		UserID:   contextUserId(c),
+		Title:    c.PostForm("title"),
+		Body:     c.PostForm("body"),
+	}
+	if err = ctl.store.Drafts().Save(draft); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+	res["data"] = ctl.draftResult(draft)
+}
+
+func (ctl *Controller) PageDraftPublish(c *gin.Context) {
+	var (
+		err   error
+		res   = gin.H{}
+		id    uint
+		page  *models.Page
+		draft *models.Draft
+	)
+	defer writeJSON(c, res)
+	id, err = parseId(c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	page, err = ctl.store.Pages().Get(id)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	userId := contextUserId(c)
+	draft, err = ctl.store.Drafts().Get(models.SLUG_KIND_PAGE, page.ID, userId)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	page.Title, page.Body = draft.Title, draft.Body
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		if err := tx.Pages().Update(page); err != nil {
+			return err
+		}
+		if err := savePageRevision(tx, page, userId); err != nil {
+			return err
+		}
+		return tx.Drafts().Delete(models.SLUG_KIND_PAGE, page.ID, userId)
+	})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	ctl.indexPage(page.ID)
+	res["succeed"] = true
+}
+
+func (ctl *Controller) PageDraftDiscard(c *gin.Context) {
+	var (
+		err error
+		res = gin.H{}
+		id  uint
+	)
+	defer writeJSON(c, res)
+	id, err = parseId(c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	if _, err = ctl.store.Pages().Get(id); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	if err = ctl.store.Drafts().Delete(models.SLUG_KIND_PAGE, id, contextUserId(c)); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+}
+
+// 编辑页面使用的草稿，没有草稿时返回nil
+func (ctl *Controller) userDraft(c *gin.Context, kind string, targetId uint) *models.Draft {
+	draft, err := ctl.store.Drafts().Get(kind, targetId, contextUserId(c))
+	if err != nil {
+		return nil
+	}
+	return draft
+}
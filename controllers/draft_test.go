@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+func postJSON(t *testing.T, r *gin.Engine, path string, form url.Values) map[string]interface{} {
+	t.Helper()
+	res := map[string]interface{}{}
+	w := postForm(r, path, form)
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("%s: %s: %v", path, w.Body.String(), err)
+	}
+	return res
+}
+
+func TestPostDraft(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	author := createTestUser(t, store, "author", models.ROLE_AUTHOR)
+	editor := createTestUser(t, store, "editor", models.ROLE_EDITOR)
+	tags := createTestTags(t, store, "go", "gin")
+	post := &models.Post{Title: "Hello", Body: "body", Slug: "hello", UserID: author.ID}
+	if err := store.Posts().Create(post); err != nil {
+		t.Fatal(err)
+	}
+	routers := make(map[uint]*gin.Engine)
+	for _, user := range []*models.User{author, editor} {
+		r := newTestRouter(user)
+		r.POST("/admin/post/:id/draft", ctl.PostDraftSave)
+		r.POST("/admin/post/:id/draft/publish", ctl.PostDraftPublish)
+		r.POST("/admin/post/:id/draft/discard", ctl.PostDraftDiscard)
+		routers[user.ID] = r
+	}
+	base := fmt.Sprintf("/admin/post/%d/draft", post.ID)
+
+	res := postJSON(t, routers[author.ID], base, url.Values{"title": {"Hello draft"}, "body": {"draft"}, "tags": {tags}})
+	if res["succeed"] != true {
+		t.Fatalf("save draft: %v", res)
+	}
+	//自动保存不影响文章
+	if p, _ := store.Posts().Get(post.ID); p.Title != "Hello" {
+		t.Errorf("post changed by autosave: %+v", p)
+	}
+	//其他用户同时编辑时返回提示
+	res = postJSON(t, routers[editor.ID], base, url.Values{"title": {"Editor"}, "body": {"edit"}})
+	others := res["data"].(map[string]interface{})["others"].([]interface{})
+	if len(others) != 1 || others[0].(map[string]interface{})["name"] != "author" {
+		t.Errorf("others = %v", others)
+	}
+	if res = postJSON(t, routers[editor.ID], base+"/discard", nil); res["succeed"] != true {
+		t.Fatalf("discard: %v", res)
+	}
+	if _, err := store.Drafts().Get(models.SLUG_KIND_POST, post.ID, editor.ID); err != models.ErrNotFound {
+		t.Errorf("discarded draft = %v", err)
+	}
+
+	if res = postJSON(t, routers[author.ID], base+"/publish", nil); res["succeed"] != true {
+		t.Fatalf("publish: %v", res)
+	}
+	p, _ := store.Posts().Get(post.ID)
+	postTags, _ := store.Tags().ListByPostId(post.ID)
+	if p.Title != "Hello draft" || p.Body != "draft" || p.Slug != "hello" || len(postTags) != 2 {
+		t.Errorf("published post = %+v, tags = %d", p, len(postTags))
+	}
+	if _, err := store.Revisions().Latest(models.SLUG_KIND_POST, post.ID); err != nil {
+		t.Errorf("revision not saved: %v", err)
+	}
+	if _, err := store.Drafts().Get(models.SLUG_KIND_POST, post.ID, author.ID); err != models.ErrNotFound {
+		t.Errorf("published draft = %v", err)
+	}
+	//没有草稿时不能发布
+	if res = postJSON(t, routers[author.ID], base+"/publish", nil); res["succeed"] == true {
+		t.Error("published without a draft")
+	}
+
+	//作者不能保存他人文章的草稿
+	other := &models.Post{Title: "Other", Slug: "other", UserID: editor.ID}
+	store.Posts().Create(other)
+	if res = postJSON(t, routers[author.ID], fmt.Sprintf("/admin/post/%d/draft", other.ID), url.Values{"title": {"x"}}); res["succeed"] == true {
+		t.Error("author saved a draft of another author's post")
+	}
+}
+
+func TestPageDraft(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	editor := createTestUser(t, store, "editor", models.ROLE_EDITOR)
+	page := &models.Page{Title: "About", Body: "body", Slug: "about"}
+	if err := store.Pages().Create(page); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(editor)
+	r.POST("/admin/page/:id/draft", ctl.PageDraftSave)
+	r.POST("/admin/page/:id/draft/publish", ctl.PageDraftPublish)
+	r.POST("/admin/page/:id/draft/discard", ctl.PageDraftDiscard)
+	base := fmt.Sprintf("/admin/page/%d/draft", page.ID)
+
+	postJSON(t, r, base, url.Values{"title": {"About me"}, "body": {"draft"}})
+	if res := postJSON(t, r, base+"/publish", nil); res["succeed"] != true {
+		t.Fatalf("publish: %v", res)
+	}
+	if p, _ := store.Pages().Get(page.ID); p.Title != "About me" || p.Body != "draft" {
+		t.Errorf("published page = %+v", p)
+	}
+	postJSON(t, r, base, url.Values{"title": {"discard"}})
+	if res := postJSON(t, r, base+"/discard", nil); res["succeed"] != true {
+		t.Fatalf("discard: %v", res)
+	}
+	if p, _ := store.Pages().Get(page.ID); p.Title != "About me" {
+		t.Errorf("discarded draft changed the page: %+v", p)
+	}
+	if res := postJSON(t, r, "/admin/page/999/draft", url.Values{"title": {"x"}}); res["succeed"] == true {
+		t.Error("saved a draft of a missing page")
+	}
+}
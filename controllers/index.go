@@ -13,7 +13,7 @@ import (
 	"gingorm/system"
 )
 
-func IndexGet(c *gin.Context) {
+func (ctl *Controller) IndexGet(c *gin.Context) {
 	var (
 		pageIndex int
 		pageSize  =  system.GetConfiguration().PageSize  //最终调用的是PageSize = DEFAULT_PAGESIZE=10
@@ -29,15 +29,15 @@ func IndexGet(c *gin.Context) {
 	if pageIndex <= 0 {
 		pageIndex = 1
 	}
-	//posts, err = models.ListPublishedPost("", 1, 10)
+	//posts, err = ctl.store.Posts().ListPublished(0, 1, 10)
 	//查询所有满足条件的post页面
-	posts, err = models.ListPublishedPost("", pageIndex, pageSize)
+	posts, err = ctl.store.Posts().ListPublished(0, pageIndex, pageSize)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 	//查询所有发布页面标签数量
-	total, err = models.CountPostByTag("")
+	total, err = ctl.store.Posts().CountByTag(0)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
@@ -46,32 +46,33 @@ func IndexGet(c *gin.Context) {
 	policy = bluemonday.StrictPolicy()
 	//标签和文章内容
 	for _, post := range posts {
-		post.Tags, _ = models.ListTagByPostId(strconv.FormatUint(uint64(post.ID), 10))
+		post.Tags, _ = ctl.store.Tags().ListByPostId(post.ID)
 		post.Body = policy.Sanitize(string(blackfriday.Run([]byte(post.Body))))
 	}
 	user, _ := c.Get(CONTEXT_USER_KEY)
 	c.HTML(http.StatusOK, "index/index.html", gin.H{
 		"posts":           posts,
-		"tags":            models.MustListTag(),
-		"archives":        models.MustListPostArchives(),
-		"links":           models.MustListLinks(),
+		"tags":            ctl.mustListTag(),
+		"archives":        ctl.mustListPostArchives(),
+		"links":           ctl.mustListLinks(),
 		"user":            user,
 		"pageIndex":       pageIndex,
 		"totalPage":       int(math.Ceil(float64(total) / float64(pageSize))),
 		"path":            c.Request.URL.Path,
-		"maxReadPosts":    models.MustListMaxReadPost(),
-		"maxCommentPosts": models.MustListMaxCommentPost(),
+		"maxReadPosts":    ctl.mustListMaxReadPost(),
+		"maxCommentPosts": ctl.mustListMaxCommentPost(),
 	})
 }
 
-func AdminIndex(c *gin.Context) {
+func (ctl *Controller) AdminIndex(c *gin.Context) {
 	user, _ := c.Get(CONTEXT_USER_KEY)
 	c.HTML(http.StatusOK, "admin/index.html", gin.H{
-		"pageCount":    models.CountPage(),
-		"postCount":    models.CountPost(),
-		"tagCount":     models.CountTag(),
-		"commentCount": models.CountComment(),
+		"csrf":         csrfToken(c),
+		"pageCount":    ctl.store.Pages().Count(),
+		"postCount":    ctl.store.Posts().Count(),
+		"tagCount":     ctl.store.Tags().Count(),
+		"commentCount": ctl.store.Comments().Count(),
 		"user":         user,
-		"comments":     models.MustListUnreadComment(),
+		"comments":     ctl.mustListUnreadComment(),
 	})
 }
@@ -9,19 +9,20 @@ import (
 )
 
 //链接索引
-func LinkIndex(c *gin.Context) {
-	links, _ := models.ListLinks()
+func (ctl *Controller) LinkIndex(c *gin.Context) {
+	links, _ := ctl.store.Links().List()
 	user, _ := c.Get(CONTEXT_USER_KEY)
 	c.HTML(http.StatusOK, "admin/link.html", gin.H{
+		"csrf":     csrfToken(c),
 		"links":    links,
 		"user":     user,
-		"comments": models.MustListUnreadComment(),
+		"comments": ctl.mustListUnreadComment(),
 	})
 }
 
 
 //创建链接
-func LinkCreate(c *gin.Context) {
+func (ctl *Controller) LinkCreate(c *gin.Context) {
 	var (
 		err   error
 		res   = gin.H{}
@@ -45,7 +46,7 @@ func LinkCreate(c *gin.Context) {
 		Url:  url,
 		Sort: int(_sort),
 	}
-	err = link.Insert()
+	err = ctl.store.Links().Create(link)
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -53,7 +54,7 @@ func LinkCreate(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func LinkUpdate(c *gin.Context) {
+func (ctl *Controller) LinkUpdate(c *gin.Context) {
 	var (
 		_id   uint64
 		_sort int64
@@ -85,7 +86,7 @@ func LinkUpdate(c *gin.Context) {
 		Sort: int(_sort),
 	}
 	link.ID = uint(_id)
-	err = link.Update()
+	err = ctl.store.Links().Update(link)
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -93,20 +94,20 @@ func LinkUpdate(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func LinkGet(c *gin.Context) {
+func (ctl *Controller) LinkGet(c *gin.Context) {
 	id := c.Param("id")
 	_id, _ := strconv.ParseInt(id, 10, 64)
-	link, err := models.GetLinkById(uint(_id))
+	link, err := ctl.store.Links().Get(uint(_id))
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 	link.View++
-	link.Update()
+	ctl.store.Links().Update(link)
 	c.Redirect(http.StatusFound, link.Url)
 }
 
-func LinkDelete(c *gin.Context) {
+func (ctl *Controller) LinkDelete(c *gin.Context) {
 	var (
 		err error
 		_id uint64
@@ -120,9 +121,7 @@ func LinkDelete(c *gin.Context) {
 		return
 	}
 
-	link := new(models.Link)
-	link.ID = uint(_id)
-	err = link.Delete()
+	err = ctl.store.Links().Delete(uint(_id))
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"gingorm/system"
+	"github.com/cihub/seelog"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	LOGIN_MAX_BACKOFF       = time.Minute         // 退避时间上限
+	LOGIN_ATTEMPT_RETENTION = 30 * 24 * time.Hour // 登录记录保留时间
+	LOGIN_RECENT_ATTEMPTS   = 50                  // 用户管理页面显示的登录记录条数
+)
+
+// 登录失败统计，账号按连续失败次数，ip按login_lock_duration内的失败次数，账号不存在时只按ip统计
+type loginGuard struct {
+	user         *models.User
+	ipFailures   int
+	ipLastFailed time.Time
+}
+
+func (ctl *Controller) newLoginGuard(user *models.User, ip string) *loginGuard {
+	guard := &loginGuard{user: user}
+	since := helpers.GetCurrentTime().Add(-system.GetConfiguration().LoginLockDuration)
+	failures, err := ctl.store.LoginAttempts().ListFailuresByIP(ip, since)
+	if err != nil {
+		seelog.Error(err)
+	}
+	guard.ipFailures = len(failures)
+	if len(failures) > 0 {
+		guard.ipLastFailed = failures[0].CreatedAt
+	}
+	return guard
+}
+
+// 指数退避，失败n次后需要等待2^(n-1)秒才能再次尝试
+func loginBackoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	if failures > 7 {
+		return LOGIN_MAX_BACKOFF
+	}
+	if d := time.Second << uint(failures-1); d < LOGIN_MAX_BACKOFF {
+		return d
+	}
+	return LOGIN_MAX_BACKOFF
+}
+
+// 距离允许再次尝试还需要等待的时间，小于等于0时可以尝试
+func (g *loginGuard) retryAfter(now time.Time) time.Duration {
+	wait := g.ipLastFailed.Add(loginBackoff(g.ipFailures)).Sub(now)
+	if g.user != nil && g.user.LastFailedAt != nil {
+		if w := g.user.LastFailedAt.Add(loginBackoff(g.user.FailedLogins)).Sub(now); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// 账号或ip失败次数达到阈值后需要输入验证码
+func (g *loginGuard) captchaRequired() bool {
+	n := system.GetConfiguration().LoginCaptchaAfter
+	return g.ipFailures >= n || (g.user != nil && g.user.FailedLogins >= n)
+}
+
+// 保存登录记录
+func (ctl *Controller) recordLogin(user *models.User, username, ip, result string) {
+	attempt := &models.LoginAttempt{
+		CreatedAt: helpers.GetCurrentTime(),
+		Username:  username,
+		IP:        ip,
+		Result:    result,
+	}
+	if user != nil {
+		attempt.UserID = user.ID
+	}
+	if err := ctl.store.LoginAttempts().Create(attempt); err != nil {
+		seelog.Error(err)
+	}
+}
+
+// 登录失败，累计失败次数，达到login_max_failures后临时锁定账号并发送通知邮件
+func (ctl *Controller) loginFailed(guard *loginGuard, username, ip string) {
+	now := helpers.GetCurrentTime()
+	ctl.recordLogin(guard.user, username, ip, models.LOGIN_RESULT_FAILURE)
+	guard.ipFailures++
+	guard.ipLastFailed = now
+	user := guard.user
+	if user == nil {
+		return
+	}
+	config := system.GetConfiguration()
+	//并发的登录请求各自加一，不会少计失败次数
+	if err := ctl.store.Users().AddFailedLogin(user, now); err != nil {
+		seelog.Error(err)
+		return
+	}
+	if user.FailedLogins < config.LoginMaxFailures {
+		return
+	}
+	until := now.Add(config.LoginLockDuration)
+	user.LockedUntil = &until
+	user.FailedLogins = 0
+	if err := ctl.store.Users().UpdateLoginState(user); err != nil {
+		seelog.Error(err)
+		return
+	}
+	ctl.recordLogin(user, username, ip, models.LOGIN_RESULT_LOCKED)
+	seelog.Warnf("user %d locked until %s after %d failed sign in attempts", user.ID, user.LockedUntil.Format("2006-01-02 15:04:05"), config.LoginMaxFailures)
+	err := NotifyEmail("[Wblog]账号已被临时锁定", fmt.Sprintf("账号%s连续%d次登录失败，已被锁定至%s，最后一次尝试来自%s。",
+		user.Email, config.LoginMaxFailures, user.LockedUntil.Format("2006-01-02 15:04:05"), ip))
+	if err != nil {
+		seelog.Error(err)
+	}
+}
+
+// 登录成功，清空失败次数
+func (ctl *Controller) loginSucceeded(user *models.User, username, ip string) {
+	ctl.recordLogin(user, username, ip, models.LOGIN_RESULT_SUCCESS)
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	if err := ctl.store.Users().UpdateLoginState(user); err != nil {
+		seelog.Error(err)
+	}
+}
+
+// 清理过期的登录记录，由定时任务调用
+func (ctl *Controller) CleanLoginAttempts() {
+	if err := ctl.store.LoginAttempts().DeleteBefore(helpers.GetCurrentTime().Add(-LOGIN_ATTEMPT_RETENTION)); err != nil {
+		seelog.Error(err)
+	}
+}
+
+// 渲染登录页面，captcha为true时需要输入验证码
+func signinPage(c *gin.Context, message string, captcha bool) {
+	c.HTML(http.StatusOK, "auth/signin.html", gin.H{
+		"csrf":    csrfToken(c),
+		"message": message,
+		"captcha": captcha,
+	})
+}
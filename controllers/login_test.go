@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+func signinRequest(r http.Handler, remoteAddr, forwardedFor, username, password string) string {
+	form := url.Values{"username": {username}, "password": {password}}
+	req := httptest.NewRequest(http.MethodPost, "/signin", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func newSigninTestRouter(ctl *Controller) *gin.Engine {
+	r := newTestRouter(nil, "auth/signin.html")
+	r.Use(sessions.Sessions(SESSION_NAME, ctl.sessions))
+	r.POST("/signin", ctl.SigninPost)
+	return r
+}
+
+func createSigninUser(t *testing.T, store models.Store, password string) *models.User {
+	t.Helper()
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	hash, _ := helpers.HashPassword(password)
+	if err := store.Users().UpdatePassword(user, hash); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestLoginBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		0:  0,
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		7:  LOGIN_MAX_BACKOFF,
+		50: LOGIN_MAX_BACKOFF,
+	}
+	for failures, want := range tests {
+		if got := loginBackoff(failures); got != want {
+			t.Errorf("loginBackoff(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func TestSigninBackoff(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	r := newSigninTestRouter(ctl)
+
+	if body := signinRequest(r, "203.0.113.9:1000", "", "nobody@example.com", "x"); body != "invalid username or password" {
+		t.Fatalf("body = %q", body)
+	}
+	//同一ip在退避时间内不再校验密码
+	if body := signinRequest(r, "203.0.113.9:1001", "", "nobody@example.com", "x"); !strings.HasPrefix(body, "Too many failed attempts") {
+		t.Errorf("body = %q", body)
+	}
+	if body := signinRequest(r, "203.0.113.10:1000", "", "nobody@example.com", "x"); body != "invalid username or password" {
+		t.Errorf("other ip: body = %q", body)
+	}
+}
+
+func TestSigninCaptchaRequired(t *testing.T) {
+	loadTestConfig(t, "login_captcha_after: 3\n")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	createSigninUser(t, store, "right")
+	r := newSigninTestRouter(ctl)
+
+	//退避时间已过，但失败次数达到阈值
+	for i := 0; i < 3; i++ {
+		attempt := &models.LoginAttempt{CreatedAt: time.Now().Add(-time.Minute), IP: "203.0.113.9", Result: models.LOGIN_RESULT_FAILURE}
+		if err := store.LoginAttempts().Create(attempt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if body := signinRequest(r, "203.0.113.9:1000", "", "user@example.com", "right"); body != "error verifycode" {
+		t.Errorf("body = %q", body)
+	}
+	if body := signinRequest(r, "203.0.113.10:1000", "", "user@example.com", "right"); body != "" {
+		t.Errorf("other ip: body = %q", body)
+	}
+}
+
+func TestSigninLockout(t *testing.T) {
+	loadTestConfig(t, "login_max_failures: 3\nlogin_captcha_after: 100\n")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createSigninUser(t, store, "right")
+	r := newSigninTestRouter(ctl)
+
+	lastFailed := time.Now().Add(-time.Hour)
+	user.FailedLogins = 2
+	user.LastFailedAt = &lastFailed
+	if err := store.Users().UpdateLoginState(user); err != nil {
+		t.Fatal(err)
+	}
+	signinRequest(r, "203.0.113.9:1000", "", user.Email, "wrong")
+	user, _ = store.Users().Get(user.ID)
+	if !user.IsTemporarilyLocked() {
+		t.Fatalf("account not locked, failed logins = %d", user.FailedLogins)
+	}
+	//锁定期间正确的密码也不能登录
+	if body := signinRequest(r, "203.0.113.10:1000", "", user.Email, "right"); !strings.Contains(body, "temporarily locked") {
+		t.Errorf("body = %q", body)
+	}
+
+	attempts, _ := store.LoginAttempts().ListRecent(10)
+	results := make([]string, 0)
+	for _, attempt := range attempts {
+		results = append(results, attempt.Result)
+	}
+	if strings.Join(results, ",") != "blocked,locked,failure" {
+		t.Errorf("login attempts = %v", results)
+	}
+}
+
+func TestSigninResetsFailures(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createSigninUser(t, store, "right")
+	r := newSigninTestRouter(ctl)
+
+	lastFailed := time.Now().Add(-time.Hour)
+	user.FailedLogins = 2
+	user.LastFailedAt = &lastFailed
+	store.Users().UpdateLoginState(user)
+	if body := signinRequest(r, "203.0.113.9:1000", "", user.Email, "right"); body != "" {
+		t.Fatalf("body = %q", body)
+	}
+	if user, _ = store.Users().Get(user.ID); user.FailedLogins != 0 {
+		t.Errorf("failed logins = %d, want 0", user.FailedLogins)
+	}
+}
+
+func TestRequestIP(t *testing.T) {
+	defer SetTrustedProxies(nil)
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		remote, forwarded, realIP, want string
+	}{
+		{"203.0.113.9:1234", "198.51.100.1", "", "203.0.113.9"},
+		{"127.0.0.1:1234", "", "", "127.0.0.1"},
+		{"127.0.0.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"127.0.0.1:1234", "", "198.51.100.2", "198.51.100.2"},
+		{"127.0.0.1:1234", "1.1.1.1, 198.51.100.1, 10.0.0.2", "", "198.51.100.1"},
+		{"127.0.0.1:1234", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"127.0.0.1:1234", "bogus, 10.0.0.2", "", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-Ip", tt.realIP)
+		}
+		if got := requestIP(r); got != tt.want {
+			t.Errorf("requestIP(%q, %q, %q) = %q, want %q", tt.remote, tt.forwarded, tt.realIP, got, tt.want)
+		}
+	}
+	if err := SetTrustedProxies([]string{"not an ip"}); err == nil {
+		t.Error("invalid proxy accepted")
+	}
+}
+
+// 没有配置可信代理时，更换X-Forwarded-For不能绕过按ip的退避
+func TestSigninIgnoresForwardedForByDefault(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	r := newSigninTestRouter(ctl)
+
+	if body := signinRequest(r, "203.0.113.9:1000", "198.51.100.1", "nobody@example.com", "x"); body != "invalid username or password" {
+		t.Fatalf("body = %q", body)
+	}
+	body := signinRequest(r, "203.0.113.9:1001", "198.51.100.2", "nobody@example.com", "x")
+	if !strings.HasPrefix(body, "Too many failed attempts") {
+		t.Errorf("backoff bypassed with a new X-Forwarded-For: %q", body)
+	}
+	attempts, _ := store.LoginAttempts().ListRecent(10)
+	for _, attempt := range attempts {
+		if attempt.IP != "203.0.113.9" {
+			t.Errorf("attempt recorded from %q", attempt.IP)
+		}
+	}
+
+	//来自可信代理时按X-Forwarded-For中的客户端统计
+	defer SetTrustedProxies(nil)
+	SetTrustedProxies([]string{"127.0.0.1"})
+	if body = signinRequest(r, "127.0.0.1:1002", "198.51.100.3", "nobody@example.com", "x"); body != "invalid username or password" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+// 并发的失败登录都要计入失败次数，达到上限后锁定账号
+func TestSigninConcurrentFailuresLockAccount(t *testing.T) {
+	loadTestConfig(t, "login_max_failures: 5\nlogin_captcha_after: 100\n")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createSigninUser(t, store, "right")
+	r := newSigninTestRouter(ctl)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			signinRequest(r, fmt.Sprintf("203.0.113.%d:1000", i+1), "", user.Email, "wrong")
+		}(i)
+	}
+	wg.Wait()
+	user, _ = store.Users().Get(user.ID)
+	if !user.IsTemporarilyLocked() {
+		t.Errorf("account not locked, failed logins = %d", user.FailedLogins)
+	}
+}
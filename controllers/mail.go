@@ -7,7 +7,7 @@ import (
 	"gingorm/models"
 )
 
-func SendMail(c *gin.Context) {
+func (ctl *Controller) SendMail(c *gin.Context) {
 	var (
 		err        error
 		res        = gin.H{}
@@ -28,7 +28,7 @@ func SendMail(c *gin.Context) {
 		res["message"] = err.Error()
 		return
 	}
-	subscriber, err = models.GetSubscriberById(uint(uid))
+	subscriber, err = ctl.store.Subscribers().Get(uint(uid))
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -41,7 +41,7 @@ func SendMail(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func SendBatchMail(c *gin.Context) {
+func (ctl *Controller) SendBatchMail(c *gin.Context) {
 	var (
 		err         error
 		res         = gin.H{}
@@ -55,7 +55,7 @@ func SendBatchMail(c *gin.Context) {
 		res["message"] = "error parameter"
 		return
 	}
-	subscribers, err = models.ListSubscriber(true)
+	subscribers, err = ctl.store.Subscribers().List(true)
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -0,0 +1,521 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gingorm/models"
+	"gingorm/system"
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	OAUTH_HTTP_TIMEOUT  = 10 * time.Second
+	OAUTH_MAX_BODY_SIZE = 1 << 20
+)
+
+// 第三方登录提供方，Identity返回的UserIdentity只填充资料字段，UserID由调用方关联
+type OAuthProvider interface {
+	Name() string
+	DisplayName() string
+	AuthCodeURL(state string) string
+	Exchange(code string) (*OAuthToken, error)
+	Identity(token *OAuthToken) (*models.UserIdentity, error)
+}
+
+// 授权码换取的token，只在回调中使用，不做保存
+type OAuthToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope"`
+}
+
+// 按配置顺序保存的提供方列表
+type OAuthProviders struct {
+	list   []OAuthProvider
+	byName map[string]OAuthProvider
+}
+
+// 根据oauth_providers配置创建提供方
+func NewOAuthProviders(configs []system.OAuthProviderConfig) (*OAuthProviders, error) {
+	providers := &OAuthProviders{byName: make(map[string]OAuthProvider)}
+	client := &http.Client{Timeout: OAUTH_HTTP_TIMEOUT}
+	for _, config := range configs {
+		if config.Name == "" {
+			config.Name = config.Type
+		}
+		if _, ok := providers.byName[config.Name]; ok {
+			return nil, errors.Errorf("duplicate oauth provider %q", config.Name)
+		}
+		if config.ClientId == "" {
+			return nil, errors.Errorf("oauth provider %q: client_id is required", config.Name)
+		}
+		if config.RedirectURL == "" {
+			config.RedirectURL = fmt.Sprintf("%s/oauth2callback/%s", strings.TrimRight(system.GetConfiguration().Domain, "/"), config.Name)
+		}
+		var (
+			provider OAuthProvider
+			err      error
+		)
+		switch config.Type {
+		case system.OAUTH_PROVIDER_GITHUB:
+			provider = newGithubProvider(config, client)
+		case system.OAUTH_PROVIDER_GITLAB:
+			provider = newGitlabProvider(config, client)
+		case system.OAUTH_PROVIDER_GITEA:
+			provider, err = newGiteaProvider(config, client)
+		case system.OAUTH_PROVIDER_OIDC:
+			provider, err = newOIDCProvider(config, client)
+		default:
+			err = errors.Errorf("unsupported oauth provider type %q", config.Type)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "oauth provider %q", config.Name)
+		}
+		providers.list = append(providers.list, provider)
+		providers.byName[config.Name] = provider
+	}
+	return providers, nil
+}
+
+func (p *OAuthProviders) Get(name string) (OAuthProvider, bool) {
+	provider, ok := p.byName[name]
+	return provider, ok
+}
+
+// 供模板渲染登录按钮
+func (p *OAuthProviders) List() []OAuthProvider {
+	return p.list
+}
+
+// 标准授权码流程，各提供方只需要实现Identity
+type oauthClient struct {
+	name         string
+	displayName  string
+	clientId     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	authURL      string
+	tokenURL     string
+	client       *http.Client
+}
+
+func newOAuthClient(config system.OAuthProviderConfig, client *http.Client, displayName string, scopes []string) oauthClient {
+	if config.DisplayName != "" {
+		displayName = config.DisplayName
+	}
+	if len(config.Scopes) > 0 {
+		scopes = config.Scopes
+	}
+	return oauthClient{
+		name:         config.Name,
+		displayName:  displayName,
+		clientId:     config.ClientId,
+		clientSecret: config.ClientSecret,
+		redirectURL:  config.RedirectURL,
+		scopes:       scopes,
+		authURL:      config.AuthURL,
+		tokenURL:     config.TokenURL,
+		client:       client,
+	}
+}
+
+func (o *oauthClient) Name() string {
+	return o.name
+}
+
+func (o *oauthClient) DisplayName() string {
+	return o.displayName
+}
+
+func (o *oauthClient) AuthCodeURL(state string) string {
+	return o.authCodeURL(o.authURL, state)
+}
+
+func (o *oauthClient) authCodeURL(endpoint, state string) string {
+	v := url.Values{
+		"response_type": {"code"},
+		"client_id":     {o.clientId},
+		"redirect_uri":  {o.redirectURL},
+		"state":         {state},
+	}
+	if len(o.scopes) > 0 {
+		v.Set("scope", strings.Join(o.scopes, " "))
+	}
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + v.Encode()
+	}
+	return endpoint + "?" + v.Encode()
+}
+
+func (o *oauthClient) Exchange(code string) (*OAuthToken, error) {
+	return o.exchange(o.tokenURL, code)
+}
+
+// 用授权码换取access token，github在出错时也返回200，需要检查error字段
+func (o *oauthClient) exchange(endpoint, code string) (*OAuthToken, error) {
+	if code == "" {
+		return nil, errors.New("authorization code is empty")
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.redirectURL},
+		"client_id":     {o.clientId},
+		"client_secret": {o.clientSecret},
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	var result struct {
+		OAuthToken
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = o.do(req, &result); err != nil && result.Error == "" {
+		return nil, errors.Wrap(err, "exchange token")
+	}
+	if result.Error != "" {
+		return nil, errors.Errorf("exchange token: %s %s", result.Error, result.ErrorDescription)
+	}
+	if result.AccessToken == "" {
+		return nil, errors.New("exchange token: empty access token")
+	}
+	return &result.OAuthToken, nil
+}
+
+// 带上access token请求json接口
+func (o *oauthClient) getJSON(endpoint string, token *OAuthToken, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	return o.do(req, v)
+}
+
+// 发送请求并解析json响应，响应状态码不是2xx时返回错误，但仍会尝试解析响应
+func (o *oauthClient) do(req *http.Request, v interface{}) error {
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, OAUTH_MAX_BODY_SIZE))
+	if err != nil {
+		return err
+	}
+	jsonErr := json.Unmarshal(body, v)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return jsonErr
+}
+
+// github，base_url为github enterprise的地址
+type githubProvider struct {
+	oauthClient
+	userURL   string
+	emailsURL string
+}
+
+func newGithubProvider(config system.OAuthProviderConfig, client *http.Client) *githubProvider {
+	baseURL, apiURL := "https://github.com", "https://api.github.com"
+	if config.BaseURL != "" {
+		baseURL = strings.TrimRight(config.BaseURL, "/")
+		apiURL = baseURL + "/api/v3"
+	}
+	p := &githubProvider{oauthClient: newOAuthClient(config, client, "GitHub", []string{"user:email"})}
+	if p.authURL == "" {
+		p.authURL = baseURL + "/login/oauth/authorize"
+	}
+	if p.tokenURL == "" {
+		p.tokenURL = baseURL + "/login/oauth/access_token"
+	}
+	p.userURL = config.UserInfoURL
+	if p.userURL == "" {
+		p.userURL = apiURL + "/user"
+	}
+	p.emailsURL = apiURL + "/user/emails"
+	return p
+}
+
+func (p *githubProvider) Identity(token *OAuthToken) (*models.UserIdentity, error) {
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+		HTMLURL   string `json:"html_url"`
+	}
+	if err := p.getJSON(p.userURL, token, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, errors.New("github user id is empty")
+	}
+	identity := &models.UserIdentity{
+		Provider:   p.name,
+		Subject:    strconv.FormatInt(user.ID, 10),
+		Login:      user.Login,
+		Name:       user.Name,
+		Email:      user.Email,
+		AvatarUrl:  user.AvatarURL,
+		ProfileUrl: user.HTMLURL,
+	}
+	//公开邮箱未经验证，优先使用主邮箱，需要user:email权限，没有权限时忽略
+	email, err := p.primaryEmail(token)
+	if err != nil {
+		seelog.Warnf("github user %d: %v", user.ID, err)
+	} else if email != "" {
+		identity.Email = email
+		identity.EmailVerified = true
+	}
+	return identity, nil
+}
+
+// github账号已验证的主邮箱，没有时返回空字符串
+func (p *githubProvider) primaryEmail(token *OAuthToken) (string, error) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.getJSON(p.emailsURL, token, &emails); err != nil {
+		return "", err
+	}
+	for _, item := range emails {
+		if item.Primary && item.Verified {
+			return item.Email, nil
+		}
+	}
+	return "", nil
+}
+
+// gitlab，base_url默认为https://gitlab.com
+type gitlabProvider struct {
+	oauthClient
+	userURL string
+}
+
+func newGitlabProvider(config system.OAuthProviderConfig, client *http.Client) *gitlabProvider {
+	baseURL := "https://gitlab.com"
+	if config.BaseURL != "" {
+		baseURL = strings.TrimRight(config.BaseURL, "/")
+	}
+	p := &gitlabProvider{oauthClient: newOAuthClient(config, client, "GitLab", []string{"read_user"})}
+	if p.authURL == "" {
+		p.authURL = baseURL + "/oauth/authorize"
+	}
+	if p.tokenURL == "" {
+		p.tokenURL = baseURL + "/oauth/token"
+	}
+	p.userURL = config.UserInfoURL
+	if p.userURL == "" {
+		p.userURL = baseURL + "/api/v4/user"
+	}
+	return p
+}
+
+func (p *gitlabProvider) Identity(token *OAuthToken) (*models.UserIdentity, error) {
+	var user struct {
+		ID          int64  `json:"id"`
+		Username    string `json:"username"`
+		Name        string `json:"name"`
+		Email       string `json:"email"`
+		ConfirmedAt string `json:"confirmed_at"`
+		AvatarURL   string `json:"avatar_url"`
+		WebURL      string `json:"web_url"`
+	}
+	if err := p.getJSON(p.userURL, token, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, errors.New("gitlab user id is empty")
+	}
+	return &models.UserIdentity{
+		Provider:      p.name,
+		Subject:       strconv.FormatInt(user.ID, 10),
+		Login:         user.Username,
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.Email != "" && user.ConfirmedAt != "",
+		AvatarUrl:     user.AvatarURL,
+		ProfileUrl:    user.WebURL,
+	}, nil
+}
+
+// gitea，自建服务没有默认地址，必须配置base_url
+type giteaProvider struct {
+	oauthClient
+	baseURL string
+	userURL string
+}
+
+func newGiteaProvider(config system.OAuthProviderConfig, client *http.Client) (*giteaProvider, error) {
+	if config.BaseURL == "" {
+		return nil, errors.New("base_url is required")
+	}
+	baseURL := strings.TrimRight(config.BaseURL, "/")
+	p := &giteaProvider{oauthClient: newOAuthClient(config, client, "Gitea", nil), baseURL: baseURL}
+	if p.authURL == "" {
+		p.authURL = baseURL + "/login/oauth/authorize"
+	}
+	if p.tokenURL == "" {
+		p.tokenURL = baseURL + "/login/oauth/access_token"
+	}
+	p.userURL = config.UserInfoURL
+	if p.userURL == "" {
+		p.userURL = baseURL + "/api/v1/user"
+	}
+	return p, nil
+}
+
+func (p *giteaProvider) Identity(token *OAuthToken) (*models.UserIdentity, error) {
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		FullName  string `json:"full_name"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := p.getJSON(p.userURL, token, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, errors.New("gitea user id is empty")
+	}
+	return &models.UserIdentity{
+		Provider:   p.name,
+		Subject:    strconv.FormatInt(user.ID, 10),
+		Login:      user.Login,
+		Name:       user.FullName,
+		Email:      user.Email,
+		AvatarUrl:  user.AvatarURL,
+		ProfileUrl: p.baseURL + "/" + url.PathEscape(user.Login),
+	}, nil
+}
+
+// 通用OpenID Connect，未配置的接口地址在首次使用时从issuer的discovery文档获取
+// 用户资料取自userinfo接口，请求直接发往issuer，因此不需要校验id_token的签名
+type oidcProvider struct {
+	oauthClient
+	issuer string
+
+	mu          sync.Mutex
+	userInfoURL string
+}
+
+func newOIDCProvider(config system.OAuthProviderConfig, client *http.Client) (*oidcProvider, error) {
+	if config.Issuer == "" {
+		return nil, errors.New("issuer is required")
+	}
+	p := &oidcProvider{
+		oauthClient: newOAuthClient(config, client, "OpenID Connect", []string{"openid", "profile", "email"}),
+		issuer:      strings.TrimRight(config.Issuer, "/"),
+		userInfoURL: config.UserInfoURL,
+	}
+	return p, nil
+}
+
+// 获取接口地址，discovery失败时下次请求重试
+func (p *oidcProvider) endpoints() (authURL, tokenURL, userInfoURL string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.authURL == "" || p.tokenURL == "" || p.userInfoURL == "" {
+		var doc struct {
+			Issuer                string `json:"issuer"`
+			AuthorizationEndpoint string `json:"authorization_endpoint"`
+			TokenEndpoint         string `json:"token_endpoint"`
+			UserInfoEndpoint      string `json:"userinfo_endpoint"`
+		}
+		req, err := http.NewRequest(http.MethodGet, p.issuer+"/.well-known/openid-configuration", nil)
+		if err != nil {
+			return "", "", "", err
+		}
+		if err = p.do(req, &doc); err != nil {
+			return "", "", "", errors.Wrap(err, "openid discovery")
+		}
+		if strings.TrimRight(doc.Issuer, "/") != p.issuer {
+			return "", "", "", errors.Errorf("openid discovery: issuer mismatch %q", doc.Issuer)
+		}
+		if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.UserInfoEndpoint == "" {
+			return "", "", "", errors.New("openid discovery: missing endpoints")
+		}
+		if p.authURL == "" {
+			p.authURL = doc.AuthorizationEndpoint
+		}
+		if p.tokenURL == "" {
+			p.tokenURL = doc.TokenEndpoint
+		}
+		if p.userInfoURL == "" {
+			p.userInfoURL = doc.UserInfoEndpoint
+		}
+	}
+	return p.authURL, p.tokenURL, p.userInfoURL, nil
+}
+
+// discovery失败时返回空字符串
+func (p *oidcProvider) AuthCodeURL(state string) string {
+	authURL, _, _, err := p.endpoints()
+	if err != nil {
+		return ""
+	}
+	return p.authCodeURL(authURL, state)
+}
+
+func (p *oidcProvider) Exchange(code string) (*OAuthToken, error) {
+	_, tokenURL, _, err := p.endpoints()
+	if err != nil {
+		return nil, err
+	}
+	return p.exchange(tokenURL, code)
+}
+
+func (p *oidcProvider) Identity(token *OAuthToken) (*models.UserIdentity, error) {
+	_, _, userInfoURL, err := p.endpoints()
+	if err != nil {
+		return nil, err
+	}
+	var claims struct {
+		Subject           string      `json:"sub"`
+		PreferredUsername string      `json:"preferred_username"`
+		Name              string      `json:"name"`
+		Email             string      `json:"email"`
+		EmailVerified     interface{} `json:"email_verified"` //部分提供方返回字符串"true"
+		Picture           string      `json:"picture"`
+		Profile           string      `json:"profile"`
+	}
+	if err = p.getJSON(userInfoURL, token, &claims); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("openid userinfo: sub is empty")
+	}
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+	return &models.UserIdentity{
+		Provider:      p.name,
+		Subject:       claims.Subject,
+		Login:         claims.PreferredUsername,
+		Name:          claims.Name,
+		Email:         claims.Email,
+		EmailVerified: claims.Email != "" && verified,
+		AvatarUrl:     claims.Picture,
+		ProfileUrl:    claims.Profile,
+	}, nil
+}
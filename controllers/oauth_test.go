@@ -0,0 +1,467 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gingorm/models"
+	"gingorm/system"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	fakeOAuthCode  = "good-code"
+	fakeOAuthToken = "good-token"
+)
+
+// 本地的第三方登录服务，github使用enterprise的地址，gitlab、gitea和oidc分别挂在/gitlab、/gitea和/oidc下
+type fakeOAuthServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	discoveries  int             // oidc discovery文档的请求次数
+	githubEmails []gin.H         // github /user/emails的响应，为nil时返回404
+	apiRequests  []*http.Request // 资料接口收到的请求
+}
+
+func newFakeOAuthServer() *fakeOAuthServer {
+	s := &fakeOAuthServer{githubEmails: []gin.H{
+		{"email": "secondary@example.com", "primary": false, "verified": true},
+		{"email": "primary@example.com", "primary": true, "verified": true},
+	}}
+	mux := http.NewServeMux()
+	for _, path := range []string{"/login/oauth/access_token", "/gitlab/oauth/token", "/gitea/login/oauth/access_token", "/oidc/token"} {
+		mux.HandleFunc(path, s.token)
+	}
+	mux.HandleFunc("/api/v3/user", s.api(func() interface{} {
+		return gin.H{"id": 1, "login": "octocat", "name": "The Octocat", "email": "public@example.com",
+			"avatar_url": "http://avatars.test/1", "html_url": "https://github.test/octocat"}
+	}))
+	emails := s.api(func() interface{} {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.githubEmails
+	})
+	mux.HandleFunc("/api/v3/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		//token没有user:email权限
+		s.mu.Lock()
+		denied := s.githubEmails == nil
+		s.mu.Unlock()
+		if denied {
+			writeFakeJSON(w, http.StatusNotFound, gin.H{"message": "Not Found"})
+			return
+		}
+		emails(w, r)
+	})
+	mux.HandleFunc("/gitlab/api/v4/user", s.api(func() interface{} {
+		return gin.H{"id": 2, "username": "gitlab-user", "name": "GitLab User", "email": "gitlab@example.com",
+			"confirmed_at": "2020-01-01T00:00:00Z", "avatar_url": "http://avatars.test/2", "web_url": "https://gitlab.test/gitlab-user"}
+	}))
+	mux.HandleFunc("/gitea/api/v1/user", s.api(func() interface{} {
+		return gin.H{"id": 3, "login": "gitea-user", "full_name": "Gitea User", "email": "gitea@example.com",
+			"avatar_url": "http://avatars.test/3"}
+	}))
+	mux.HandleFunc("/oidc/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.discoveries++
+		s.mu.Unlock()
+		writeFakeJSON(w, http.StatusOK, gin.H{
+			"issuer":                 s.URL + "/oidc",
+			"authorization_endpoint": s.URL + "/oidc/authorize",
+			"token_endpoint":         s.URL + "/oidc/token",
+			"userinfo_endpoint":      s.URL + "/oidc/userinfo",
+		})
+	})
+	mux.HandleFunc("/mismatch/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeFakeJSON(w, http.StatusOK, gin.H{
+			"issuer":                 "https://issuer.test",
+			"authorization_endpoint": s.URL + "/oidc/authorize",
+			"token_endpoint":         s.URL + "/oidc/token",
+			"userinfo_endpoint":      s.URL + "/oidc/userinfo",
+		})
+	})
+	mux.HandleFunc("/oidc/userinfo", s.api(func() interface{} {
+		return gin.H{"sub": "sub-4", "preferred_username": "oidc-user", "name": "OIDC User", "email": "oidc@example.com",
+			"email_verified": "true", "picture": "http://avatars.test/4", "profile": "https://oidc.test/oidc-user"}
+	}))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// 授权码错误时和github一样返回200和error字段
+func (s *fakeOAuthServer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeFakeJSON(w, http.StatusMethodNotAllowed, gin.H{"error": "invalid_request"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("client_id") != "client" ||
+		r.PostFormValue("client_secret") != "secret" || !strings.HasPrefix(r.PostFormValue("redirect_uri"), "http://blog.test/oauth2callback/") {
+		writeFakeJSON(w, http.StatusBadRequest, gin.H{"error": "invalid_client"})
+		return
+	}
+	if r.PostFormValue("code") != fakeOAuthCode {
+		writeFakeJSON(w, http.StatusOK, gin.H{"error": "bad_verification_code", "error_description": "The code passed is incorrect or expired."})
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, gin.H{"access_token": fakeOAuthToken, "token_type": "bearer", "scope": "user:email"})
+}
+
+// 资料接口只接受Authorization头中的token
+func (s *fakeOAuthServer) api(body func() interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.apiRequests = append(s.apiRequests, r)
+		s.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+fakeOAuthToken || r.URL.Query().Get("access_token") != "" {
+			writeFakeJSON(w, http.StatusUnauthorized, gin.H{"message": "Bad credentials"})
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, body())
+	}
+}
+
+func (s *fakeOAuthServer) providers(t *testing.T) *OAuthProviders {
+	t.Helper()
+	providers, err := NewOAuthProviders([]system.OAuthProviderConfig{
+		{Type: system.OAUTH_PROVIDER_GITHUB, ClientId: "client", ClientSecret: "secret", BaseURL: s.URL},
+		{Type: system.OAUTH_PROVIDER_GITLAB, ClientId: "client", ClientSecret: "secret", BaseURL: s.URL + "/gitlab"},
+		{Type: system.OAUTH_PROVIDER_GITEA, ClientId: "client", ClientSecret: "secret", BaseURL: s.URL + "/gitea/"},
+		{Type: system.OAUTH_PROVIDER_OIDC, ClientId: "client", ClientSecret: "secret", Issuer: s.URL + "/oidc"},
+		{Name: "mismatch", Type: system.OAUTH_PROVIDER_OIDC, ClientId: "client", ClientSecret: "secret", Issuer: s.URL + "/mismatch"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return providers
+}
+
+// 用授权码换取token并获取资料
+func fakeIdentity(t *testing.T, providers *OAuthProviders, name string) (OAuthProvider, *models.UserIdentity) {
+	t.Helper()
+	provider, ok := providers.Get(name)
+	if !ok {
+		t.Fatalf("provider %q not found", name)
+	}
+	token, err := provider.Exchange(fakeOAuthCode)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	identity, err := provider.Identity(token)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return provider, identity
+}
+
+func TestOAuthProviders(t *testing.T) {
+	loadTestConfig(t, "")
+	server := newFakeOAuthServer()
+	defer server.Close()
+	providers := server.providers(t)
+
+	tests := []struct {
+		name    string
+		authURL string
+		want    models.UserIdentity
+	}{
+		{"github", server.URL + "/login/oauth/authorize?", models.UserIdentity{
+			Provider: "github", Subject: "1", Login: "octocat", Name: "The Octocat", Email: "primary@example.com", EmailVerified: true,
+			AvatarUrl: "http://avatars.test/1", ProfileUrl: "https://github.test/octocat"}},
+		{"gitlab", server.URL + "/gitlab/oauth/authorize?", models.UserIdentity{
+			Provider: "gitlab", Subject: "2", Login: "gitlab-user", Name: "GitLab User", Email: "gitlab@example.com", EmailVerified: true,
+			AvatarUrl: "http://avatars.test/2", ProfileUrl: "https://gitlab.test/gitlab-user"}},
+		{"gitea", server.URL + "/gitea/login/oauth/authorize?", models.UserIdentity{
+			Provider: "gitea", Subject: "3", Login: "gitea-user", Name: "Gitea User", Email: "gitea@example.com",
+			AvatarUrl: "http://avatars.test/3", ProfileUrl: server.URL + "/gitea/gitea-user"}},
+		{"oidc", server.URL + "/oidc/authorize?", models.UserIdentity{
+			Provider: "oidc", Subject: "sub-4", Login: "oidc-user", Name: "OIDC User", Email: "oidc@example.com", EmailVerified: true,
+			AvatarUrl: "http://avatars.test/4", ProfileUrl: "https://oidc.test/oidc-user"}},
+	}
+	for _, tt := range tests {
+		provider, _ := providers.Get(tt.name)
+		authURL := provider.AuthCodeURL("state")
+		if !strings.HasPrefix(authURL, tt.authURL) || !strings.Contains(authURL, "state=state") || !strings.Contains(authURL, "client_id=client") {
+			t.Errorf("%s: auth url = %q", tt.name, authURL)
+		}
+		if _, err := provider.Exchange("bad-code"); err == nil || !strings.Contains(err.Error(), "bad_verification_code") {
+			t.Errorf("%s: exchange with a bad code: %v", tt.name, err)
+		}
+		if _, err := provider.Identity(&OAuthToken{AccessToken: "bad-token"}); err == nil {
+			t.Errorf("%s: identity with a bad token succeeded", tt.name)
+		}
+		_, identity := fakeIdentity(t, providers, tt.name)
+		if !reflect.DeepEqual(*identity, tt.want) {
+			t.Errorf("%s: identity = %+v, want %+v", tt.name, *identity, tt.want)
+		}
+	}
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	loadTestConfig(t, "")
+	server := newFakeOAuthServer()
+	defer server.Close()
+	providers := server.providers(t)
+
+	//discovery文档只请求一次
+	fakeIdentity(t, providers, "oidc")
+	provider, _ := providers.Get("oidc")
+	provider.AuthCodeURL("state")
+	server.mu.Lock()
+	if server.discoveries != 1 {
+		t.Errorf("discovery requested %d times", server.discoveries)
+	}
+	server.mu.Unlock()
+
+	//discovery文档中的issuer与配置不一致时拒绝使用
+	mismatch, _ := providers.Get("mismatch")
+	if authURL := mismatch.AuthCodeURL("state"); authURL != "" {
+		t.Errorf("auth url with a mismatched issuer = %q", authURL)
+	}
+	if _, err := mismatch.Exchange(fakeOAuthCode); err == nil || !strings.Contains(err.Error(), "issuer mismatch") {
+		t.Errorf("exchange with a mismatched issuer: %v", err)
+	}
+
+	if _, err := NewOAuthProviders([]system.OAuthProviderConfig{{Type: system.OAUTH_PROVIDER_OIDC, ClientId: "client"}}); err == nil {
+		t.Error("oidc provider without issuer accepted")
+	}
+}
+
+func TestIdentityUser(t *testing.T) {
+	loadTestConfig(t, "")
+	server := newFakeOAuthServer()
+	defer server.Close()
+	providers := server.providers(t)
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+
+	//第一次登录时注册新用户并绑定，使用提供方已验证的邮箱
+	github, identity := fakeIdentity(t, providers, "github")
+	user, err := ctl.identityUser(github, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.NickName != "octocat" || user.Email != "primary@example.com" || !user.IsVerified() ||
+		user.GithubLoginId != "octocat" || user.Role != models.ROLE_OWNER {
+		t.Errorf("new user = %+v", user)
+	}
+	linked, err := store.Identities().Get("github", "1")
+	if err != nil || linked.UserID != user.ID {
+		t.Fatalf("identity = %+v, %v", linked, err)
+	}
+
+	//再次登录时返回同一用户并更新资料
+	_, identity = fakeIdentity(t, providers, "github")
+	identity.Name = "Renamed"
+	again, err := ctl.identityUser(github, identity)
+	if err != nil || again.ID != user.ID {
+		t.Fatalf("second sign in = %+v, %v", again, err)
+	}
+	if linked, _ = store.Identities().Get("github", "1"); linked.Name != "Renamed" {
+		t.Errorf("identity name = %q", linked.Name)
+	}
+
+	//其他提供方的账号注册为新用户，不按邮箱合并
+	gitlab, identity := fakeIdentity(t, providers, "gitlab")
+	identity.Email = "primary@example.com"
+	other, err := ctl.identityUser(gitlab, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == user.ID || other.Email != "" || other.Role != models.ROLE_COMMENTER {
+		t.Errorf("gitlab user = %+v", other)
+	}
+
+	//旧版本只按github登录名绑定，登录名相同时不自动关联，也不注册新用户
+	legacy := createTestUser(t, store, "legacy", models.ROLE_COMMENTER)
+	legacy.GithubLoginId = "legacy"
+	store.Users().UpdateGithubUserInfo(legacy)
+	users := store.Users().Count()
+	_, identity = fakeIdentity(t, providers, "github")
+	identity.Subject, identity.Login = "99", "legacy"
+	if found, err := ctl.identityUser(github, identity); err != errLegacyGithubLogin {
+		t.Fatalf("legacy user = %+v, %v", found, err)
+	}
+	if _, err = store.Identities().Get("github", "99"); err != models.ErrNotFound {
+		t.Errorf("legacy identity linked automatically: %v", err)
+	}
+	if n := store.Users().Count(); n != users {
+		t.Errorf("users = %d, want %d", n, users)
+	}
+
+	//旧账号登录后手动绑定，之后按github的数字id登录
+	_, identity = fakeIdentity(t, providers, "github")
+	identity.Subject, identity.Login = "99", "legacy"
+	if err = ctl.bindIdentity(legacy, github, identity); err != nil {
+		t.Fatal(err)
+	}
+	_, identity = fakeIdentity(t, providers, "github")
+	identity.Subject, identity.Login = "99", "legacy"
+	if found, err := ctl.identityUser(github, identity); err != nil || found.ID != legacy.ID {
+		t.Errorf("legacy user after binding = %+v, %v", found, err)
+	}
+	//登录名改变后仍然是同一用户
+	_, identity = fakeIdentity(t, providers, "github")
+	identity.Subject, identity.Login = "99", "renamed"
+	if found, err := ctl.identityUser(github, identity); err != nil || found.ID != legacy.ID {
+		t.Errorf("renamed legacy user = %+v, %v", found, err)
+	}
+}
+
+func TestBindIdentity(t *testing.T) {
+	loadTestConfig(t, "")
+	server := newFakeOAuthServer()
+	defer server.Close()
+	providers := server.providers(t)
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	alice := createTestUser(t, store, "alice", models.ROLE_AUTHOR)
+	bob := createTestUser(t, store, "bob", models.ROLE_AUTHOR)
+
+	gitea, identity := fakeIdentity(t, providers, "gitea")
+	if err := ctl.bindIdentity(alice, gitea, identity); err != nil {
+		t.Fatal(err)
+	}
+	//重复绑定同一账号时只更新资料
+	_, identity = fakeIdentity(t, providers, "gitea")
+	if err := ctl.bindIdentity(alice, gitea, identity); err != nil {
+		t.Errorf("rebind: %v", err)
+	}
+	if identities, _ := store.Identities().ListByUserId(alice.ID); len(identities) != 1 || identities[0].Subject != "3" {
+		t.Errorf("alice identities = %+v", identities)
+	}
+
+	//已绑定其他用户的账号不能再绑定
+	_, identity = fakeIdentity(t, providers, "gitea")
+	if err := ctl.bindIdentity(bob, gitea, identity); err == nil || !strings.Contains(err.Error(), "bound another user") {
+		t.Errorf("bind identity of another user: %v", err)
+	}
+	if linked, _ := store.Identities().Get("gitea", "3"); linked.UserID != alice.ID {
+		t.Errorf("identity moved to user %d", linked.UserID)
+	}
+	if identities, _ := store.Identities().ListByUserId(bob.ID); len(identities) != 0 {
+		t.Errorf("bob identities = %+v", identities)
+	}
+
+	//同一提供方只能绑定一个账号
+	_, identity = fakeIdentity(t, providers, "gitea")
+	identity.Subject = "33"
+	if err := ctl.bindIdentity(alice, gitea, identity); err == nil || !strings.Contains(err.Error(), "unbind it first") {
+		t.Errorf("bind a second gitea account: %v", err)
+	}
+
+	//绑定github时保存github_login_id，已有邮箱时不覆盖
+	github, identity := fakeIdentity(t, providers, "github")
+	if err := ctl.bindIdentity(bob, github, identity); err != nil {
+		t.Fatal(err)
+	}
+	bob, _ = store.Users().Get(bob.ID)
+	if bob.GithubLoginId != "octocat" || bob.Email != "bob@example.com" || bob.AvatarUrl != "http://avatars.test/1" {
+		t.Errorf("bob = %+v", bob)
+	}
+
+	//github_login_id已属于其他用户的旧账号不能绑定
+	legacy := createTestUser(t, store, "legacy", models.ROLE_COMMENTER)
+	legacy.GithubLoginId = "legacy"
+	store.Users().UpdateGithubUserInfo(legacy)
+	_, identity = fakeIdentity(t, providers, "github")
+	identity.Subject, identity.Login = "99", "legacy"
+	if err := ctl.bindIdentity(alice, github, identity); err == nil || !strings.Contains(err.Error(), "bound another user") {
+		t.Errorf("bind legacy github account of another user: %v", err)
+	}
+	//旧账号本人可以绑定，绑定的是github的数字id
+	_, identity = fakeIdentity(t, providers, "github")
+	identity.Subject, identity.Login = "99", "legacy"
+	if err := ctl.bindIdentity(legacy, github, identity); err != nil {
+		t.Fatal(err)
+	}
+	if linked, err := store.Identities().Get("github", "99"); err != nil || linked.UserID != legacy.ID {
+		t.Errorf("legacy identity = %+v, %v", linked, err)
+	}
+}
+
+// github的token只放在Authorization头中，只使用已验证的主邮箱，token不写入文件
+func TestGithubProvider(t *testing.T) {
+	loadTestConfig(t, "")
+	server := newFakeOAuthServer()
+	defer server.Close()
+	providers := server.providers(t)
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "oauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	github, identity := fakeIdentity(t, providers, "github")
+	server.mu.Lock()
+	if len(server.apiRequests) != 2 {
+		t.Errorf("github api requested %d times", len(server.apiRequests))
+	}
+	for _, r := range server.apiRequests {
+		if r.Header.Get("Authorization") != "Bearer "+fakeOAuthToken || r.URL.RawQuery != "" {
+			t.Errorf("%s: authorization = %q, query = %q", r.URL.Path, r.Header.Get("Authorization"), r.URL.RawQuery)
+		}
+	}
+	server.mu.Unlock()
+	if identity.Email != "primary@example.com" || !identity.EmailVerified {
+		t.Errorf("email = %q, verified = %v", identity.Email, identity.EmailVerified)
+	}
+
+	//主邮箱未验证或已验证的邮箱不是主邮箱时，使用未验证的公开邮箱，注册时不预填
+	server.mu.Lock()
+	server.githubEmails = []gin.H{
+		{"email": "unverified@example.com", "primary": true, "verified": false},
+		{"email": "secondary@example.com", "primary": false, "verified": true},
+	}
+	server.mu.Unlock()
+	_, identity = fakeIdentity(t, providers, "github")
+	if identity.Email != "public@example.com" || identity.EmailVerified {
+		t.Errorf("email = %q, verified = %v", identity.Email, identity.EmailVerified)
+	}
+	user, err := ctl.identityUser(github, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "" {
+		t.Errorf("user email = %q", user.Email)
+	}
+
+	//token没有user:email权限时忽略邮箱
+	server.mu.Lock()
+	server.githubEmails = nil
+	server.mu.Unlock()
+	if _, identity = fakeIdentity(t, providers, "github"); identity.Email != "public@example.com" || identity.EmailVerified {
+		t.Errorf("email = %q, verified = %v", identity.Email, identity.EmailVerified)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		t.Errorf("file %s written", f.Name())
+	}
+}
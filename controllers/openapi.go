@@ -0,0 +1,456 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+const OPENAPI_VERSION = "3.0.3"
+
+// /api/v1的接口定义，openapi文档和请求校验都由这里生成，新增路由时必须同时在这里登记
+var apiOperations = []*apiOperation{
+	{Method: "GET", Path: "/api/v1/posts", Summary: "List posts, authors only see their own posts", Scope: models.SCOPE_POSTS_READ,
+		Query: withPagination(queryParam("tag_id", "integer", "filter by tag id"), queryParam("published", "boolean", "filter by published state"),
+			queryParam("state", "string", "filter by state: draft, scheduled or published")), Response: apiPost{}, List: true},
+	{Method: "POST", Path: "/api/v1/posts", Summary: "Create a post", Scope: models.SCOPE_POSTS_WRITE,
+		Request: apiPostRequest{}, Required: []string{"title"}, Response: apiPost{}, Status: http.StatusCreated, Conflict: true},
+	{Method: "GET", Path: "/api/v1/posts/:id", Summary: "Get a post", Scope: models.SCOPE_POSTS_READ, Response: apiPost{}},
+	{Method: "PUT", Path: "/api/v1/posts/:id", Summary: "Update a post, only the fields present are changed", Scope: models.SCOPE_POSTS_WRITE,
+		Request: apiPostRequest{}, Response: apiPost{}, Conflict: true},
+	{Method: "DELETE", Path: "/api/v1/posts/:id", Summary: "Delete a post", Scope: models.SCOPE_POSTS_WRITE},
+
+	{Method: "GET", Path: "/api/v1/pages", Summary: "List pages", Scope: models.SCOPE_PAGES_READ,
+		Query: withPagination(queryParam("published", "boolean", "filter by published state"),
+			queryParam("state", "string", "filter by state: draft, scheduled or published")), Response: apiPage{}, List: true},
+	{Method: "POST", Path: "/api/v1/pages", Summary: "Create a page", Scope: models.SCOPE_PAGES_WRITE,
+		Request: apiPageRequest{}, Required: []string{"title"}, Response: apiPage{}, Status: http.StatusCreated, Conflict: true},
+	{Method: "GET", Path: "/api/v1/pages/:id", Summary: "Get a page", Scope: models.SCOPE_PAGES_READ, Response: apiPage{}},
+	{Method: "PUT", Path: "/api/v1/pages/:id", Summary: "Update a page, only the fields present are changed", Scope: models.SCOPE_PAGES_WRITE,
+		Request: apiPageRequest{}, Response: apiPage{}, Conflict: true},
+	{Method: "DELETE", Path: "/api/v1/pages/:id", Summary: "Delete a page", Scope: models.SCOPE_PAGES_WRITE},
+
+	{Method: "GET", Path: "/api/v1/tags", Summary: "List tags", Scope: models.SCOPE_TAGS_READ, Query: withPagination(), Response: apiTag{}, List: true},
+	{Method: "POST", Path: "/api/v1/tags", Summary: "Create a tag", Scope: models.SCOPE_TAGS_WRITE,
+		Request: apiTagRequest{}, Required: []string{"name"}, Response: apiTag{}, Status: http.StatusCreated, Conflict: true},
+	{Method: "GET", Path: "/api/v1/tags/:id", Summary: "Get a tag", Scope: models.SCOPE_TAGS_READ, Response: apiTag{}},
+	{Method: "PUT", Path: "/api/v1/tags/:id", Summary: "Rename a tag", Scope: models.SCOPE_TAGS_WRITE,
+		Request: apiTagRequest{}, Response: apiTag{}, Conflict: true},
+	{Method: "DELETE", Path: "/api/v1/tags/:id", Summary: "Delete a tag and remove it from posts", Scope: models.SCOPE_TAGS_WRITE},
+
+	{Method: "GET", Path: "/api/v1/links", Summary: "List links", Scope: models.SCOPE_LINKS_READ, Query: withPagination(), Response: apiLink{}, List: true},
+	{Method: "POST", Path: "/api/v1/links", Summary: "Create a link", Scope: models.SCOPE_LINKS_WRITE,
+		Request: apiLinkRequest{}, Required: []string{"name", "url"}, Response: apiLink{}, Status: http.StatusCreated, Conflict: true},
+	{Method: "GET", Path: "/api/v1/links/:id", Summary: "Get a link", Scope: models.SCOPE_LINKS_READ, Response: apiLink{}},
+	{Method: "PUT", Path: "/api/v1/links/:id", Summary: "Update a link, only the fields present are changed", Scope: models.SCOPE_LINKS_WRITE,
+		Request: apiLinkRequest{}, Response: apiLink{}, Conflict: true},
+	{Method: "DELETE", Path: "/api/v1/links/:id", Summary: "Delete a link", Scope: models.SCOPE_LINKS_WRITE},
+
+	{Method: "GET", Path: "/api/v1/comments", Summary: "List comments, newest first", Scope: models.SCOPE_COMMENTS_READ,
+		Query: withPagination(queryParam("post_id", "integer", "filter by post id"), queryParam("read", "boolean", "filter by read state"),
+			queryParam("status", "string", "filter by moderation status: pending, approved, spam, trash")), Response: apiComment{}, List: true},
+	{Method: "GET", Path: "/api/v1/comments/:id", Summary: "Get a comment", Scope: models.SCOPE_COMMENTS_READ, Response: apiComment{}},
+	{Method: "PUT", Path: "/api/v1/comments/:id", Summary: "Mark a comment as read or change its moderation status", Scope: models.SCOPE_COMMENTS_WRITE,
+		Request: apiCommentRequest{}, Response: apiComment{}},
+	{Method: "DELETE", Path: "/api/v1/comments/:id", Summary: "Delete a comment", Scope: models.SCOPE_COMMENTS_WRITE},
+
+	{Method: "GET", Path: "/api/v1/subscribers", Summary: "List subscribers", Scope: models.SCOPE_SUBSCRIBERS_READ,
+		Query: withPagination(queryParam("active", "boolean", "true lists verified and subscribed subscribers, false lists the others")), Response: apiSubscriber{}, List: true},
+	{Method: "POST", Path: "/api/v1/subscribers", Summary: "Add a subscriber and send the activation email", Scope: models.SCOPE_SUBSCRIBERS_WRITE,
+		Request: apiSubscriberRequest{}, Required: []string{"email"}, Response: apiSubscriber{}, Status: http.StatusCreated, Conflict: true},
+	{Method: "GET", Path: "/api/v1/subscribers/:id", Summary: "Get a subscriber", Scope: models.SCOPE_SUBSCRIBERS_READ, Response: apiSubscriber{}},
+	{Method: "PUT", Path: "/api/v1/subscribers/:id", Summary: "Change the subscribe state", Scope: models.SCOPE_SUBSCRIBERS_WRITE,
+		Request: apiSubscriberRequest{}, Response: apiSubscriber{}},
+	{Method: "DELETE", Path: "/api/v1/subscribers/:id", Summary: "Delete a subscriber", Scope: models.SCOPE_SUBSCRIBERS_WRITE},
+}
+
+// 响应中引用的结构，在文档的components中按去掉api前缀的类型名定义
+var apiComponents = []interface{}{apiPost{}, apiPage{}, apiTag{}, apiLink{}, apiComment{}, apiSubscriber{}, apiMeta{}}
+
+// 接口定义
+type apiOperation struct {
+	Method   string
+	Path     string // gin路由格式，如/api/v1/posts/:id
+	Summary  string
+	Scope    models.Scope
+	Query    []*openAPIParameter
+	Request  interface{} // 请求体类型，为空时没有请求体
+	Required []string    // 请求体中的必填字段
+	Response interface{} // 响应中data的类型，为空时返回204
+	List     bool        // 响应是否为分页列表
+	Status   int         // 成功时的状态码，默认200
+	Conflict bool        // 是否可能返回409
+
+	request *openAPISchema
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Servers    []openAPIServer                         `json:"servers"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type openAPIServer struct {
+	Url string `json:"url"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema         `json:"schemas"`
+	SecuritySchemes map[string]*openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationId string                      `json:"operationId"`
+	Summary     string                      `json:"summary"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security"`
+}
+
+type openAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+// openapi 3.0的schema，只包含本项目用到的部分，请求校验也基于这些字段
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	AdditionalProperties *bool                     `json:"additionalProperties,omitempty"`
+}
+
+func queryParam(name, typ, description string) *openAPIParameter {
+	schema := &openAPISchema{Type: typ}
+	if typ == "integer" {
+		schema.Minimum = floatPtr(1)
+	}
+	return &openAPIParameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// 列表接口的分页参数
+func withPagination(params ...*openAPIParameter) []*openAPIParameter {
+	perPage := queryParam("per_page", "integer", "items per page, default "+strconv.Itoa(API_DEFAULT_PER_PAGE))
+	perPage.Schema.Maximum = floatPtr(API_MAX_PER_PAGE)
+	return append([]*openAPIParameter{queryParam("page", "integer", "page number, starting from 1"), perPage}, params...)
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func componentName(t reflect.Type) string {
+	name := strings.TrimPrefix(t.Name(), "api")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func componentRef(t reflect.Type) *openAPISchema {
+	return &openAPISchema{Ref: "#/components/schemas/" + componentName(t)}
+}
+
+// 根据go类型生成schema，字段名取json tag，指针字段可以为null，components中的结构使用引用
+func schemaOf(t reflect.Type, root bool) *openAPISchema {
+	if t.Kind() == reflect.Ptr {
+		schema := schemaOf(t.Elem(), root)
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &openAPISchema{Type: "integer", Minimum: floatPtr(0)}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Slice:
+		return &openAPISchema{Type: "array", Items: schemaOf(t.Elem(), false)}
+	case reflect.Struct:
+		if !root && isComponent(t) {
+			return componentRef(t)
+		}
+		schema := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if field.PkgPath != "" || name == "" || name == "-" {
+				continue
+			}
+			schema.Properties[name] = schemaOf(field.Type, false)
+			if field.Type.Kind() != reflect.Ptr {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	}
+	panic(fmt.Sprintf("openapi: unsupported type %s", t))
+}
+
+func isComponent(t reflect.Type) bool {
+	for _, c := range apiComponents {
+		if reflect.TypeOf(c) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// 请求体的schema，不允许出现未定义的字段
+func requestSchema(op *apiOperation) *openAPISchema {
+	schema := schemaOf(reflect.TypeOf(op.Request), true)
+	schema.Required = op.Required
+	schema.AdditionalProperties = boolPtr(false)
+	return schema
+}
+
+func errorResponse(description string) *openAPIResponse {
+	return &openAPIResponse{
+		Description: description,
+		Content: map[string]*openAPIMediaType{
+			gin.MIMEJSON: {Schema: &openAPISchema{Ref: "#/components/schemas/Error"}},
+		},
+	}
+}
+
+func jsonResponse(description string, schema *openAPISchema) *openAPIResponse {
+	return &openAPIResponse{
+		Description: description,
+		Content:     map[string]*openAPIMediaType{gin.MIMEJSON: {Schema: schema}},
+	}
+}
+
+// gin路由/api/v1/posts/:id转换为openapi路径/api/v1/posts/{id}
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func operationId(op *apiOperation) string {
+	id := strings.ToLower(op.Method)
+	for _, part := range strings.Split(strings.TrimPrefix(op.Path, "/api/v1/"), "/") {
+		if strings.HasPrefix(part, ":") {
+			part = "by_" + part[1:]
+		}
+		id += "_" + part
+	}
+	return id
+}
+
+func (op *apiOperation) document() *openAPIOperation {
+	doc := &openAPIOperation{
+		OperationId: operationId(op),
+		Summary:     op.Summary,
+		Parameters:  op.Query,
+		Responses:   make(map[string]*openAPIResponse),
+		Security:    []map[string][]string{{"bearerAuth": {string(op.Scope)}}},
+	}
+	if strings.Contains(op.Path, "/:id") {
+		doc.Parameters = append([]*openAPIParameter{{
+			Name:     "id",
+			In:       "path",
+			Required: true,
+			Schema:   &openAPISchema{Type: "integer", Minimum: floatPtr(1)},
+		}}, doc.Parameters...)
+		doc.Responses["404"] = errorResponse("Resource not found")
+	}
+	if op.request != nil {
+		doc.RequestBody = &openAPIRequestBody{
+			Required: true,
+			Content:  map[string]*openAPIMediaType{gin.MIMEJSON: {Schema: op.request}},
+		}
+		doc.Responses["415"] = errorResponse("Request body is not json")
+		doc.Responses["422"] = errorResponse("Request body is invalid")
+	}
+	if op.request != nil || len(op.Query) > 0 {
+		doc.Responses["400"] = errorResponse("Request does not match the specification")
+	}
+	if op.Conflict {
+		doc.Responses["409"] = errorResponse("Resource already exists")
+	}
+	doc.Responses["401"] = errorResponse("Missing, invalid or expired token")
+	doc.Responses["403"] = errorResponse("Token scope or user role does not allow the operation")
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	switch {
+	case op.Response == nil:
+		doc.Responses["204"] = &openAPIResponse{Description: "Deleted"}
+	case op.List:
+		doc.Responses[strconv.Itoa(status)] = jsonResponse("Paginated list", &openAPISchema{
+			Type: "object",
+			Properties: map[string]*openAPISchema{
+				"data": {Type: "array", Items: componentRef(reflect.TypeOf(op.Response))},
+				"meta": componentRef(reflect.TypeOf(apiMeta{})),
+			},
+			Required: []string{"data", "meta"},
+		})
+	default:
+		doc.Responses[strconv.Itoa(status)] = jsonResponse(http.StatusText(status), &openAPISchema{
+			Type:       "object",
+			Properties: map[string]*openAPISchema{"data": componentRef(reflect.TypeOf(op.Response))},
+			Required:   []string{"data"},
+		})
+	}
+	return doc
+}
+
+// openapi文档和按路由索引的接口定义
+type OpenAPI struct {
+	document   *openAPIDocument
+	operations map[string]*apiOperation
+}
+
+func operationKey(method, path string) string {
+	return method + " " + path
+}
+
+// 根据apiOperations生成openapi文档，domain为站点地址
+func NewOpenAPI(domain string) *OpenAPI {
+	if domain == "" {
+		domain = "/"
+	}
+	spec := &OpenAPI{
+		document: &openAPIDocument{
+			OpenAPI: OPENAPI_VERSION,
+			Info: openAPIInfo{
+				Title:       "Wblog API",
+				Description: "Authenticate with a personal access token created on /admin/profile: Authorization: Bearer <token>",
+				Version:     "1.0.0",
+			},
+			Servers: []openAPIServer{{Url: domain}},
+			Paths:   make(map[string]map[string]*openAPIOperation),
+			Components: openAPIComponents{
+				Schemas: map[string]*openAPISchema{
+					"Error": {
+						Type: "object",
+						Properties: map[string]*openAPISchema{
+							"error": {
+								Type: "object",
+								Properties: map[string]*openAPISchema{
+									"status":  {Type: "integer"},
+									"message": {Type: "string"},
+								},
+								Required: []string{"status", "message"},
+							},
+						},
+						Required: []string{"error"},
+					},
+				},
+				SecuritySchemes: map[string]*openAPISecurityScheme{
+					"bearerAuth": {Type: "http", Scheme: "bearer", Description: "Personal access token, scopes are listed per operation"},
+				},
+			},
+		},
+		operations: make(map[string]*apiOperation),
+	}
+	for _, c := range apiComponents {
+		t := reflect.TypeOf(c)
+		spec.document.Components.Schemas[componentName(t)] = schemaOf(t, true)
+	}
+	for _, op := range apiOperations {
+		if op.Request != nil {
+			op.request = requestSchema(op)
+		}
+		path := openAPIPath(op.Path)
+		if spec.document.Paths[path] == nil {
+			spec.document.Paths[path] = make(map[string]*openAPIOperation)
+		}
+		spec.document.Paths[path][strings.ToLower(op.Method)] = op.document()
+		spec.operations[operationKey(op.Method, op.Path)] = op
+	}
+	return spec
+}
+
+// 输出openapi文档
+func (spec *OpenAPI) Get(c *gin.Context) {
+	c.JSON(http.StatusOK, spec.document)
+}
+
+// 检查/api/v1下的路由和接口定义是否一一对应，由测试调用，避免新增路由后忘记补充文档和校验
+func (spec *OpenAPI) CheckRoutes(routes gin.RoutesInfo) error {
+	var missing, unused []string
+	registered := make(map[string]bool)
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, "/api/v1/") {
+			continue
+		}
+		key := operationKey(route.Method, route.Path)
+		registered[key] = true
+		if spec.operations[key] == nil {
+			missing = append(missing, key)
+		}
+	}
+	for key := range spec.operations {
+		if !registered[key] {
+			unused = append(unused, key)
+		}
+	}
+	if len(missing) == 0 && len(unused) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	sort.Strings(unused)
+	return fmt.Errorf("openapi specification does not match the routes, routes without specification: %v, specification without routes: %v", missing, unused)
+}
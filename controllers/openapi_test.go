@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	spec := NewOpenAPI("http://blog.test")
+	r := gin.New()
+	r.GET("/api/openapi.json", spec.Get)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["openapi"] != OPENAPI_VERSION {
+		t.Errorf("openapi = %v", doc["openapi"])
+	}
+	paths := doc["paths"].(map[string]interface{})
+	post, ok := paths["/api/v1/posts/{id}"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("paths = %v", paths)
+	}
+	put := post["put"].(map[string]interface{})
+	if put["operationId"] != "put_posts_by_id" {
+		t.Errorf("operationId = %v", put["operationId"])
+	}
+	security := put["security"].([]interface{})[0].(map[string]interface{})
+	if scopes := security["bearerAuth"].([]interface{}); len(scopes) != 1 || scopes[0] != string(models.SCOPE_POSTS_WRITE) {
+		t.Errorf("security = %v", security)
+	}
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, name := range []string{"Post", "Page", "Tag", "Link", "Comment", "Subscriber", "Meta", "Error"} {
+		if schemas[name] == nil {
+			t.Errorf("component %s missing", name)
+		}
+	}
+}
+
+func TestOpenAPIValidateRequest(t *testing.T) {
+	spec := NewOpenAPI("")
+	user := &models.User{Role: models.ROLE_AUTHOR}
+	token := &models.AccessToken{Scopes: "posts:read,posts:write"}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(CONTEXT_USER_KEY, user)
+		c.Set(CONTEXT_TOKEN_KEY, token)
+	}, spec.ValidateRequest())
+	ok := func(c *gin.Context) {
+		var body map[string]interface{}
+		c.ShouldBindJSON(&body)
+		c.JSON(http.StatusOK, body)
+	}
+	r.GET("/api/v1/posts", ok)
+	r.POST("/api/v1/posts", ok)
+	r.POST("/api/v1/pages", ok)
+
+	cases := []struct {
+		path        string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"/api/v1/posts?page=2&published=true", "", "", http.StatusOK},
+		{"/api/v1/posts?page=0", "", "", http.StatusBadRequest},
+		{"/api/v1/posts?per_page=101", "", "", http.StatusBadRequest},
+		{"/api/v1/posts?published=maybe", "", "", http.StatusBadRequest},
+		{"/api/v1/posts", gin.MIMEJSON, `{"title": "post", "tag_ids": [1, 2]}`, http.StatusOK},
+		{"/api/v1/posts", gin.MIMEPOSTForm, `title=post`, http.StatusUnsupportedMediaType},
+		{"/api/v1/posts", gin.MIMEJSON, `{"body": "no title"}`, http.StatusBadRequest},
+		{"/api/v1/posts", gin.MIMEJSON, `{"title": null}`, http.StatusBadRequest},
+		{"/api/v1/posts", gin.MIMEJSON, `{"title": 1}`, http.StatusBadRequest},
+		{"/api/v1/posts", gin.MIMEJSON, `{"title": "post", "tag_ids": ["1"]}`, http.StatusBadRequest},
+		{"/api/v1/posts", gin.MIMEJSON, `{"title": "post", "view": 1}`, http.StatusBadRequest},
+		{"/api/v1/posts", gin.MIMEJSON, `{"title": "post"} {}`, http.StatusBadRequest},
+		{"/api/v1/posts", gin.MIMEJSON, `[]`, http.StatusBadRequest},
+		//令牌没有权限时不校验，交给ScopeRequired返回403
+		{"/api/v1/pages", gin.MIMEJSON, `{}`, http.StatusOK},
+	}
+	for _, tc := range cases {
+		method := http.MethodPost
+		if tc.body == "" {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, tc.path, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s %s %s: status = %d, want %d: %s", method, tc.path, tc.body, w.Code, tc.code, w.Body.String())
+		}
+	}
+
+	//校验后handler仍能读取请求体
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/posts", strings.NewReader(`{"title": "post"}`))
+	req.Header.Set("Content-Type", gin.MIMEJSON)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"title":"post"`) {
+		t.Errorf("handler body = %s", w.Body.String())
+	}
+}
+
+func TestOpenAPICheckRoutes(t *testing.T) {
+	spec := NewOpenAPI("")
+	var routes gin.RoutesInfo
+	for _, op := range apiOperations {
+		routes = append(routes, gin.RouteInfo{Method: op.Method, Path: op.Path})
+	}
+	if err := spec.CheckRoutes(append(routes, gin.RouteInfo{Method: "GET", Path: "/admin/post"})); err != nil {
+		t.Errorf("CheckRoutes: %v", err)
+	}
+	if err := spec.CheckRoutes(append(routes, gin.RouteInfo{Method: "GET", Path: "/api/v1/users"})); err == nil || !strings.Contains(err.Error(), "GET /api/v1/users") {
+		t.Errorf("route without specification: %v", err)
+	}
+	if err := spec.CheckRoutes(routes[1:]); err == nil || !strings.Contains(err.Error(), "GET /api/v1/posts") {
+		t.Errorf("specification without route: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const OPENAPI_MAX_BODY_SIZE = 10 << 20 // 请求体最大10M
+
+// 按openapi文档校验查询参数和请求体，不符合时返回400
+// 未登记的路由和令牌没有权限的请求不校验，交给后面的handler返回404或403
+func (spec *OpenAPI) ValidateRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op := spec.operations[operationKey(c.Request.Method, c.FullPath())]
+		if op == nil || !TokenAllows(c, op.Scope) {
+			c.Next()
+			return
+		}
+		for _, param := range op.Query {
+			value, ok := c.GetQuery(param.Name)
+			if !ok {
+				continue
+			}
+			if err := param.Schema.validateQuery(param.Name, value); err != nil {
+				APIError(c, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if op.request == nil {
+			c.Next()
+			return
+		}
+		if c.ContentType() != gin.MIMEJSON {
+			APIError(c, http.StatusUnsupportedMediaType, "content type must be "+gin.MIMEJSON)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, OPENAPI_MAX_BODY_SIZE))
+		if err != nil {
+			APIError(c, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err = decoder.Decode(&value); err != nil {
+			APIError(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if _, err = decoder.Token(); err != io.EOF {
+			APIError(c, http.StatusBadRequest, "invalid request body: unexpected data after json value")
+			return
+		}
+		if err = op.request.validate("", value); err != nil {
+			APIError(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		//校验时已读取请求体，重新放回供handler解析
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+func fieldName(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// 校验json值，name为字段路径，根对象为空
+func (s *openAPISchema) validate(name string, value interface{}) error {
+	subject := name
+	if subject == "" {
+		subject = "request body"
+	}
+	if value == nil {
+		if s.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s cannot be null", subject)
+	}
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an object", subject)
+		}
+		for _, key := range s.Required {
+			if v, ok := obj[key]; !ok || v == nil {
+				return fmt.Errorf("%s is required", fieldName(name, key))
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			prop, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s is not allowed", fieldName(name, key))
+				}
+				continue
+			}
+			if err := prop.validate(fieldName(name, key), obj[key]); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an array", subject)
+		}
+		for i, item := range arr {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", name, i), item); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s must be a string", subject)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", subject)
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s must be an integer", subject)
+		}
+		n, err := number.Int64()
+		if err != nil {
+			return fmt.Errorf("%s must be an integer", subject)
+		}
+		return s.checkRange(subject, n)
+	}
+	return nil
+}
+
+// 校验查询参数
+func (s *openAPISchema) validateQuery(name, value string) error {
+	switch s.Type {
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("query parameter %s must be an integer", name)
+		}
+		return s.checkRange("query parameter "+name, n)
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("query parameter %s must be a boolean", name)
+		}
+	}
+	return nil
+}
+
+func (s *openAPISchema) checkRange(subject string, n int64) error {
+	if s.Minimum != nil && float64(n) < *s.Minimum {
+		return fmt.Errorf("%s must be greater than or equal to %v", subject, *s.Minimum)
+	}
+	if s.Maximum != nil && float64(n) > *s.Maximum {
+		return fmt.Errorf("%s must be less than or equal to %v", subject, *s.Maximum)
+	}
+	return nil
+}
@@ -2,140 +2,234 @@ package controllers
 
 import (
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gingorm/models"
 )
 
-func PageGet(c *gin.Context) {
-	id := c.Param("id")
-	page, err := models.GetPageById(id)
-	if err != nil || !page.IsPublished {
-		Handle404(c)
+//旧的/page/:id链接跳转到固定链接，固定链接格式以/page/开头时也由这里处理
+func (ctl *Controller) PageGet(c *gin.Context) {
+	if id, err := parseId(c.Param("id")); err == nil {
+		if page, err := ctl.store.Pages().Get(id); err == nil && page.IsVisible() {
+			ctl.showPage(c, page)
+			return
+		}
+	}
+	ctl.PermalinkGet(c)
+}
+
+//当前地址不是页面的固定链接时301跳转
+func (ctl *Controller) showPage(c *gin.Context, page *models.Page) {
+	link := ctl.permalinks.Page(page)
+	if link != c.Request.URL.Path {
+		redirectPermanent(c, link)
 		return
 	}
 	page.View++
 	//数据库中更新文章浏览量
-	page.UpdateView()
+	ctl.store.Pages().UpdateView(page)
 	c.HTML(http.StatusOK, "page/display.html", gin.H{
-		"page": page,
+		"page":      page,
+		"canonical": absoluteURL(link),
 	})
 }
 //创建文章
 func PageNew(c *gin.Context) {
-	c.HTML(http.StatusOK, "page/new.html", nil)
+	c.HTML(http.StatusOK, "page/new.html", gin.H{
+		"csrf": csrfToken(c),
+	})
 }
 
 //创建文章内容
-func PageCreate(c *gin.Context) {
+func (ctl *Controller) PageCreate(c *gin.Context) {
 	title := c.PostForm("title")
+	slug := c.PostForm("slug")
 	body := c.PostForm("body")
-	isPublished := c.PostForm("isPublished")
-	published := "on" == isPublished
 	page := &models.Page{
-		Title:       title,
-		Body:        body,
-		IsPublished: published,
+		Title: title,
+		Body:  body,
 	}
-	err := page.Insert()
+	err := ctl.store.Transaction(func(tx models.Store) error {
+		if err := setFormPublishState(c, nil, page.SetState); err != nil {
+			return err
+		}
+		if err := setPageSlug(tx, page, slug); err != nil {
+			return err
+		}
+		if err := tx.Pages().Create(page); err != nil {
+			return err
+		}
+		if err := saveSlugHistory(tx, models.SLUG_KIND_PAGE, page.ID, "", page.Slug); err != nil {
+			return err
+		}
+		return savePageRevision(tx, page, contextUserId(c))
+	})
 	if err != nil {
 		c.HTML(http.StatusOK, "page/new.html", gin.H{
+			"csrf":    csrfToken(c),
 			"message": err.Error(),
 			"page":    page,
 		})
 		return
 	}
+	ctl.indexPage(page.ID)
 	c.Redirect(http.StatusMovedPermanently, "/admin/page")
 }
 
 //文章编辑
-func PageEdit(c *gin.Context) {
-	id := c.Param("id")
-	page, err := models.GetPageById(id)
+func (ctl *Controller) PageEdit(c *gin.Context) {
+	id, err := parseId(c.Param("id"))
+	if err != nil {
+		Handle404(c)
+		return
+	}
+	page, err := ctl.store.Pages().Get(id)
 	if err != nil {
 		Handle404(c)
+		return
+	}
+	//有自动保存的草稿时编辑草稿
+	draft := ctl.userDraft(c, models.SLUG_KIND_PAGE, page.ID)
+	if draft != nil {
+		page.Title, page.Body = draft.Title, draft.Body
 	}
 	c.HTML(http.StatusOK, "page/modify.html", gin.H{
-		"page": page,
+		"csrf":        csrfToken(c),
+		"page":        page,
+		"draft":       draft,
+		"otherDrafts": ctl.otherDrafts(models.SLUG_KIND_PAGE, page.ID, contextUserId(c)),
 	})
 }
 
 //文章更新
-func PageUpdate(c *gin.Context) {
-	id := c.Param("id")
+func (ctl *Controller) PageUpdate(c *gin.Context) {
 	title := c.PostForm("title")
+	slug := c.PostForm("slug")
 	body := c.PostForm("body")
-	isPublished := c.PostForm("isPublished")
-	published := "on" == isPublished
-	pid, err := strconv.ParseUint(id, 10, 64)
+	pid, err := parseId(c.Param("id"))
 	if err != nil {
 		c.AbortWithError(http.StatusInternalServerError, err)
 		return
 	}
-	page := &models.Page{Title: title, Body: body, IsPublished: published}
-	page.ID = uint(pid)
-	err = page.Update()
+	old, err := ctl.store.Pages().Get(pid)
 	if err != nil {
-		c.AbortWithError(http.StatusInternalServerError, err)
+		Handle404(c)
 		return
 	}
+	page := &models.Page{Title: title, Body: body, IsPublished: old.IsPublished, PublishAt: old.PublishAt}
+	page.ID = pid
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		if err := setFormPublishState(c, old.PublishAt, page.SetState); err != nil {
+			return err
+		}
+		//slug留空时根据标题重新生成
+		if err := setPageSlug(tx, page, slug); err != nil {
+			return err
+		}
+		if err := tx.Pages().Update(page); err != nil {
+			return err
+		}
+		if err := saveSlugHistory(tx, models.SLUG_KIND_PAGE, page.ID, old.Slug, page.Slug); err != nil {
+			return err
+		}
+		if err := savePageRevision(tx, page, contextUserId(c)); err != nil {
+			return err
+		}
+		//直接保存后不再需要草稿
+		return tx.Drafts().Delete(models.SLUG_KIND_PAGE, page.ID, contextUserId(c))
+	})
+	if err != nil {
+		page.Slug = slug
+		c.HTML(http.StatusOK, "page/modify.html", gin.H{
+			"csrf":    csrfToken(c),
+			"page":    page,
+			"message": err.Error(),
+		})
+		return
+	}
+	ctl.indexPage(page.ID)
 	c.Redirect(http.StatusMovedPermanently, "/admin/page")
 }
 
 //文章发布
-func PagePublish(c *gin.Context) {
+func (ctl *Controller) PagePublish(c *gin.Context) {
 	var (
-		err error
-		res = gin.H{}
+		err  error
+		res  = gin.H{}
+		id   uint
+		page *models.Page
 	)
 	defer writeJSON(c, res)
-	id := c.Param("id")
-	page, err := models.GetPageById(id)
-	if err == nil {
+	id, err = parseId(c.Param("id"))
+	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
-	page.IsPublished = !page.IsPublished
-	err = page.Update()
-	if err == nil {
+	page, err = ctl.store.Pages().Get(id)
+	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
+	//已发布的页面改为草稿，草稿和定时发布的页面立即发布
+	if page.State() == models.PUBLISH_STATE_PUBLISHED {
+		err = page.SetState(models.PUBLISH_STATE_DRAFT, nil)
+	} else {
+		err = page.SetState(models.PUBLISH_STATE_PUBLISHED, nil)
+	}
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = ctl.store.Pages().Update(page)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	ctl.indexPage(page.ID)
 	res["succeed"] = true
 }
 
 //文章删除
-func PageDelete(c *gin.Context) {
+func (ctl *Controller) PageDelete(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
 	)
 	defer writeJSON(c, res)
-	id := c.Param("id")
-	pid, err := strconv.ParseUint(id, 10, 64)
+	pid, err := parseId(c.Param("id"))
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
-	page := &models.Page{}
-	page.ID = uint(pid)
-	err = page.Delete()
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		if err := tx.Pages().Delete(pid); err != nil {
+			return err
+		}
+		if err := tx.SlugHistories().DeleteByTarget(models.SLUG_KIND_PAGE, pid); err != nil {
+			return err
+		}
+		if err := tx.Revisions().DeleteByTarget(models.SLUG_KIND_PAGE, pid); err != nil {
+			return err
+		}
+		return tx.Drafts().DeleteByTarget(models.SLUG_KIND_PAGE, pid)
+	})
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
+	ctl.indexPage(pid)
 	res["succeed"] = true
 }
 
 
 //文章索引
-func PageIndex(c *gin.Context) {
-	pages, _ := models.ListAllPage()
+func (ctl *Controller) PageIndex(c *gin.Context) {
+	pages, _ := ctl.store.Pages().List(false)
 	user, _ := c.Get(CONTEXT_USER_KEY)
 	c.HTML(http.StatusOK, "admin/page.html", gin.H{
+		"csrf":     csrfToken(c),
 		"pages":    pages,
 		"user":     user,
-		"comments": models.MustListUnreadComment(),
+		"comments": ctl.mustListUnreadComment(),
 	})
 }
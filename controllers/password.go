@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"gingorm/system"
+	"github.com/cihub/seelog"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+const (
+	TOKEN_PASSWORD_RESET = "password_reset"
+
+	PASSWORD_RESET_DURATION = 30 * time.Minute
+)
+
+var errInvalidToken = errors.New("链接无效或已被使用，请重新获取！")
+
+// 为用户签发一次性的token，token形如 <用户id>.<签名>
+// 每种用途单独保存密钥，签发新token只会使同一用途的旧token失效
+// 签名使用session_secret对用途、用户id、密钥和过期时间做hmac，密钥被删除后token即失效
+func (ctl *Controller) issueUserToken(user *models.User, purpose string, duration time.Duration) (string, error) {
+	secret := &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		SecretKey: helpers.UUID(),
+		ExpiresAt: helpers.GetCurrentTime().Add(duration),
+	}
+	if err := ctl.store.UserTokens().Save(secret); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%s", user.ID, signUserToken(secret)), nil
+}
+
+func signUserToken(secret *models.UserToken) string {
+	return helpers.HmacSha256(system.GetConfiguration().SessionSecret,
+		fmt.Sprintf("%s|%d|%s|%d", secret.Purpose, secret.UserID, secret.SecretKey, secret.ExpiresAt.Unix()))
+}
+
+// 校验token，返回token对应的用户
+func (ctl *Controller) verifyUserToken(token, purpose string) (*models.User, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, errInvalidToken
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	secret, err := ctl.store.UserTokens().Get(uint(id), purpose)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	if subtle.ConstantTimeCompare([]byte(parts[1]), []byte(signUserToken(secret))) != 1 {
+		return nil, errInvalidToken
+	}
+	if !helpers.GetCurrentTime().Before(secret.ExpiresAt) {
+		return nil, errors.New("链接已过期，请重新获取！")
+	}
+	user, err := ctl.store.Users().Get(secret.UserID)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	return user, nil
+}
+
+// 校验两次输入的新密码
+func checkNewPassword(password, confirm string) error {
+	if len(password) == 0 {
+		return errors.New("password cannot be null")
+	}
+	if password != confirm {
+		return errors.New("passwords do not match")
+	}
+	return nil
+}
+
+func ForgotPasswordGet(c *gin.Context) {
+	c.HTML(http.StatusOK, "auth/forgot.html", gin.H{
+		"csrf": csrfToken(c),
+	})
+}
+
+func (ctl *Controller) ForgotPasswordPost(c *gin.Context) {
+	email := c.PostForm("email")
+	if email == "" {
+		c.HTML(http.StatusOK, "auth/forgot.html", gin.H{
+			"csrf":    csrfToken(c),
+			"message": "email cannot be null",
+		})
+		return
+	}
+	// 无论邮箱是否存在都返回相同的提示，避免泄露已注册的邮箱
+	user, err := ctl.store.Users().GetByUsername(email)
+	if err == nil && !user.LockState {
+		var token string
+		token, err = ctl.issueUserToken(user, TOKEN_PASSWORD_RESET, PASSWORD_RESET_DURATION)
+		if err == nil {
+			err = sendMail(user.Email, "[Wblog]重置密码", fmt.Sprintf("%s/password/reset?token=%s", system.GetConfiguration().Domain, token))
+		}
+		if err != nil {
+			seelog.Error(err)
+		}
+	}
+	c.HTML(http.StatusOK, "auth/forgot.html", gin.H{
+		"csrf":    csrfToken(c),
+		"succeed": true,
+		"message": "如果该邮箱已注册，重置密码的链接已发送到该邮箱，30分钟内有效。",
+	})
+}
+
+func (ctl *Controller) ResetPasswordGet(c *gin.Context) {
+	token := c.Query("token")
+	if _, err := ctl.verifyUserToken(token, TOKEN_PASSWORD_RESET); err != nil {
+		HandleMessage(c, err.Error())
+		return
+	}
+	c.HTML(http.StatusOK, "auth/reset.html", gin.H{
+		"csrf":  csrfToken(c),
+		"token": token,
+	})
+}
+
+func (ctl *Controller) ResetPasswordPost(c *gin.Context) {
+	token := c.PostForm("token")
+	user, err := ctl.verifyUserToken(token, TOKEN_PASSWORD_RESET)
+	if err != nil {
+		HandleMessage(c, err.Error())
+		return
+	}
+	password := c.PostForm("password")
+	if err = checkNewPassword(password, c.PostForm("confirm")); err != nil {
+		c.HTML(http.StatusOK, "auth/reset.html", gin.H{
+			"csrf":    csrfToken(c),
+			"token":   token,
+			"message": err.Error(),
+		})
+		return
+	}
+	hash, err := helpers.HashPassword(password)
+	if err == nil {
+		err = ctl.store.Transaction(func(tx models.Store) error {
+			if err := tx.Users().UpdatePassword(user, hash); err != nil {
+				return err
+			}
+			//使token失效
+			return tx.UserTokens().Delete(user.ID, TOKEN_PASSWORD_RESET)
+		})
+	}
+	if err != nil {
+		HandleMessage(c, fmt.Sprintf("重置密码失败！%s", err.Error()))
+		return
+	}
+	//重置密码后所有已登录的session失效，session可能不在同一个数据库中，失败时密码已经修改，只记录日志
+	if err = ctl.sessions.RevokeAll(user.ID, ""); err != nil {
+		seelog.Error(err)
+	}
+	c.HTML(http.StatusOK, "auth/signin.html", gin.H{
+		"csrf":    csrfToken(c),
+		"message": "password has been reset, please sign in",
+	})
+}
+
+// 已登录用户修改密码，需要验证当前密码
+func (ctl *Controller) PasswordUpdate(c *gin.Context) {
+	var (
+		err error
+		res = gin.H{}
+	)
+	defer writeJSON(c, res)
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		res["message"] = "server interval error"
+		return
+	}
+	if ok, _ := helpers.VerifyPassword(user.Password, c.PostForm("current"), user.Email); !ok {
+		res["message"] = "current password is incorrect"
+		return
+	}
+	password := c.PostForm("password")
+	if err = checkNewPassword(password, c.PostForm("confirm")); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	hash, err := helpers.HashPassword(password)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = ctl.store.Users().UpdatePassword(user, hash)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	//修改密码后其他设备上的session失效，保留当前session，失败时密码已经修改，只记录日志
+	if err = ctl.sessions.RevokeAll(user.ID, ctl.sessions.CurrentID(c)); err != nil {
+		seelog.Error(err)
+	}
+	res["succeed"] = true
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gingorm/helpers"
+	"gingorm/models"
+)
+
+func createPasswordUser(t *testing.T, store models.Store, email, password string) *models.User {
+	t.Helper()
+	hash, err := helpers.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Email: email, Password: hash}
+	if err = store.Users().Create(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestResetPassword(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createPasswordUser(t, store, "user@example.com", "old password")
+
+	token, err := ctl.issueUserToken(user, TOKEN_PASSWORD_RESET, PASSWORD_RESET_DURATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ctl.verifyUserToken(token+"x", TOKEN_PASSWORD_RESET); err != errInvalidToken {
+		t.Errorf("tampered token: %v", err)
+	}
+	if _, err = ctl.verifyUserToken(token, "other"); err != errInvalidToken {
+		t.Errorf("token of another purpose: %v", err)
+	}
+
+	r := newTestRouter(nil, "auth/signin.html", "auth/reset.html")
+	r.POST("/password/reset", ctl.ResetPasswordPost)
+	w := postForm(r, "/password/reset", url.Values{"token": {token}, "password": {"new password"}, "confirm": {"mismatch"}})
+	if !strings.Contains(w.Body.String(), "passwords do not match") {
+		t.Fatalf("body = %q", w.Body.String())
+	}
+	w = postForm(r, "/password/reset", url.Values{"token": {token}, "password": {"new password"}, "confirm": {"new password"}})
+	if !strings.Contains(w.Body.String(), "password has been reset") {
+		t.Fatalf("body = %q", w.Body.String())
+	}
+	user, _ = store.Users().Get(user.ID)
+	if ok, _ := helpers.VerifyPassword(user.Password, "new password", user.Email); !ok {
+		t.Error("password not updated")
+	}
+	//token只能使用一次
+	w = postForm(r, "/password/reset", url.Values{"token": {token}, "password": {"again"}, "confirm": {"again"}})
+	if w.Body.String() != errInvalidToken.Error() {
+		t.Errorf("token reused: %q", w.Body.String())
+	}
+
+	expired, _ := ctl.issueUserToken(user, TOKEN_PASSWORD_RESET, -PASSWORD_RESET_DURATION)
+	if _, err = ctl.verifyUserToken(expired, TOKEN_PASSWORD_RESET); err == nil || err == errInvalidToken {
+		t.Errorf("expired token: %v", err)
+	}
+}
+
+func TestPasswordUpdate(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createPasswordUser(t, store, "user@example.com", "old password")
+	r := newTestRouter(user)
+	r.POST("/admin/password", ctl.PasswordUpdate)
+
+	var res struct {
+		Succeed bool
+		Message string
+	}
+	w := postForm(r, "/admin/password", url.Values{"current": {"wrong"}, "password": {"new password"}, "confirm": {"new password"}})
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res.Succeed || res.Message != "current password is incorrect" {
+		t.Errorf("wrong current password: %s", w.Body.String())
+	}
+	w = postForm(r, "/admin/password", url.Values{"current": {"old password"}, "password": {"new password"}, "confirm": {"new password"}})
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if !res.Succeed {
+		t.Fatalf("body = %s", w.Body.String())
+	}
+	saved, _ := store.Users().Get(user.ID)
+	if ok, _ := helpers.VerifyPassword(saved.Password, "new password", saved.Email); !ok {
+		t.Error("password not updated")
+	}
+}
+
+func TestUserTokenPurposes(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+
+	reset, err := ctl.issueUserToken(user, TOKEN_PASSWORD_RESET, PASSWORD_RESET_DURATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//签发其他用途的token不影响尚未使用的重置密码token
+	other, err := ctl.issueUserToken(user, "other", PASSWORD_RESET_DURATION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ctl.verifyUserToken(reset, TOKEN_PASSWORD_RESET); err != nil {
+		t.Errorf("reset token: %v", err)
+	}
+	if _, err = ctl.verifyUserToken(other, TOKEN_PASSWORD_RESET); err != errInvalidToken {
+		t.Errorf("token of another purpose accepted: %v", err)
+	}
+	//同一用途重新签发后旧token失效
+	latest, _ := ctl.issueUserToken(user, TOKEN_PASSWORD_RESET, PASSWORD_RESET_DURATION)
+	if _, err = ctl.verifyUserToken(reset, TOKEN_PASSWORD_RESET); err != errInvalidToken {
+		t.Errorf("replaced token accepted: %v", err)
+	}
+
+	r := newTestRouter(nil, "auth/signin.html", "auth/reset.html")
+	r.POST("/password/reset", ctl.ResetPasswordPost)
+	w := postForm(r, "/password/reset", url.Values{"token": {latest}, "password": {"new password"}, "confirm": {"new password"}})
+	if !strings.Contains(w.Body.String(), "password has been reset") {
+		t.Fatalf("body = %q", w.Body.String())
+	}
+	user, _ = store.Users().Get(user.ID)
+	if ok, _ := helpers.VerifyPassword(user.Password, "new password", user.Email); !ok {
+		t.Error("password not updated")
+	}
+	w = postForm(r, "/password/reset", url.Values{"token": {latest}, "password": {"again"}, "confirm": {"again"}})
+	if w.Body.String() != errInvalidToken.Error() {
+		t.Errorf("token reused: %q", w.Body.String())
+	}
+	if _, err = ctl.verifyUserToken(other, "other"); err != nil {
+		t.Errorf("other token: %v", err)
+	}
+}
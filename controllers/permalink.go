@@ -0,0 +1,315 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gingorm/models"
+	"gingorm/system"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// 固定链接中可用的变量
+const (
+	PERMALINK_YEAR  = ":year"
+	PERMALINK_MONTH = ":month"
+	PERMALINK_DAY   = ":day"
+	PERMALINK_SLUG  = ":slug"
+	PERMALINK_ID    = ":id"
+)
+
+var (
+	errSlugExists  = errors.New("slug already exists")
+	errInvalidSlug = errors.New("slug must contain letters, digits or chinese characters")
+)
+
+// 固定链接格式，如/:year/:month/:slug，由/分隔的固定文字和变量组成
+type Permalink struct {
+	segments []string
+}
+
+func ParsePermalink(pattern string) (*Permalink, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, errors.Errorf("permalink %q must start with /", pattern)
+	}
+	p := &Permalink{segments: strings.Split(strings.Trim(pattern, "/"), "/")}
+	hasKey := false
+	for _, segment := range p.segments {
+		switch segment {
+		case PERMALINK_SLUG, PERMALINK_ID:
+			hasKey = true
+		case PERMALINK_YEAR, PERMALINK_MONTH, PERMALINK_DAY:
+		case "":
+			return nil, errors.Errorf("permalink %q contains an empty segment", pattern)
+		default:
+			if strings.HasPrefix(segment, ":") {
+				return nil, errors.Errorf("permalink %q: unknown variable %s", pattern, segment)
+			}
+		}
+	}
+	if !hasKey {
+		return nil, errors.Errorf("permalink %q must contain %s or %s", pattern, PERMALINK_SLUG, PERMALINK_ID)
+	}
+	return p, nil
+}
+
+// 生成链接路径
+func (p *Permalink) Build(slug string, id uint, date time.Time) string {
+	segments := make([]string, len(p.segments))
+	for i, segment := range p.segments {
+		switch segment {
+		case PERMALINK_YEAR:
+			segments[i] = fmt.Sprintf("%04d", date.Year())
+		case PERMALINK_MONTH:
+			segments[i] = fmt.Sprintf("%02d", date.Month())
+		case PERMALINK_DAY:
+			segments[i] = fmt.Sprintf("%02d", date.Day())
+		case PERMALINK_SLUG:
+			segments[i] = slug
+		case PERMALINK_ID:
+			segments[i] = strconv.FormatUint(uint64(id), 10)
+		default:
+			segments[i] = segment
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// 按格式解析路径，返回各变量的值
+func (p *Permalink) Match(path string) (map[string]string, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != len(p.segments) {
+		return nil, false
+	}
+	vars := make(map[string]string)
+	for i, segment := range p.segments {
+		part := parts[i]
+		switch segment {
+		case PERMALINK_YEAR:
+			if len(part) != 4 || !models.IsNumericSlug(part) {
+				return nil, false
+			}
+		case PERMALINK_MONTH, PERMALINK_DAY:
+			if len(part) != 2 || !models.IsNumericSlug(part) {
+				return nil, false
+			}
+		case PERMALINK_ID:
+			if !models.IsNumericSlug(part) {
+				return nil, false
+			}
+		case PERMALINK_SLUG:
+			if part == "" {
+				return nil, false
+			}
+		default:
+			if part != segment {
+				return nil, false
+			}
+			continue
+		}
+		vars[segment] = part
+	}
+	return vars, true
+}
+
+// 两个格式都能匹配同一个路径时无法区分文章和页面
+func (p *Permalink) overlaps(other *Permalink) bool {
+	if len(p.segments) != len(other.segments) {
+		return false
+	}
+	for i, segment := range p.segments {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(other.segments[i], ":") && segment != other.segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 文章和页面的固定链接，见配置post_permalink和page_permalink
+type Permalinks struct {
+	post *Permalink
+	page *Permalink
+}
+
+func NewPermalinks(postPattern, pagePattern string) (*Permalinks, error) {
+	post, err := ParsePermalink(postPattern)
+	if err != nil {
+		return nil, err
+	}
+	page, err := ParsePermalink(pagePattern)
+	if err != nil {
+		return nil, err
+	}
+	if post.overlaps(page) {
+		return nil, errors.Errorf("post permalink %q and page permalink %q must differ in a fixed segment", postPattern, pagePattern)
+	}
+	return &Permalinks{post: post, page: page}, nil
+}
+
+// 文章的固定链接路径，模板中通过postURL调用
+func (p *Permalinks) Post(post *models.Post) string {
+	return p.post.Build(post.Slug, post.ID, post.Date())
+}
+
+// 页面的固定链接路径，模板中通过pageURL调用
+func (p *Permalinks) Page(page *models.Page) string {
+	return p.page.Build(page.Slug, page.ID, page.Date())
+}
+
+// 带域名的完整地址，用于sitemap、rss和canonical链接
+func absoluteURL(path string) string {
+	return strings.TrimRight(system.GetConfiguration().Domain, "/") + path
+}
+
+// 生成唯一的slug，input为空时根据标题生成，生成的slug重复时追加序号，手动填写的slug重复时返回errSlugExists
+// owner返回使用该slug的记录id，没有时返回0
+func uniqueSlug(kind, title, input string, id uint, owner func(slug string) uint) (string, error) {
+	manual := strings.TrimSpace(input) != ""
+	base := models.Slugify(title)
+	if manual {
+		if base = models.Slugify(input); base == "" {
+			return "", errInvalidSlug
+		}
+	}
+	if base == "" {
+		base = kind
+	}
+	//纯数字会被当作id
+	if models.IsNumericSlug(base) {
+		base = truncateSlug(kind+"-"+base, models.SLUG_MAX_LENGTH)
+	}
+	slug := base
+	for n := 2; ; n++ {
+		if o := owner(slug); o == 0 || o == id {
+			return slug, nil
+		}
+		if manual {
+			return "", errSlugExists
+		}
+		suffix := fmt.Sprintf("-%d", n)
+		slug = truncateSlug(base, models.SLUG_MAX_LENGTH-len(suffix)) + suffix
+	}
+}
+
+// slug只包含ascii字符，可以按字节截断
+func truncateSlug(slug string, length int) string {
+	if len(slug) > length {
+		slug = slug[:length]
+	}
+	return strings.TrimRight(slug, "-")
+}
+
+// 为文章设置slug，需要在保存文章之前调用
+func setPostSlug(tx models.Store, post *models.Post, input string) (err error) {
+	post.Slug, err = uniqueSlug(models.SLUG_KIND_POST, post.Title, input, post.ID, func(slug string) uint {
+		if p, err := tx.Posts().GetBySlug(slug); err == nil {
+			return p.ID
+		}
+		return 0
+	})
+	return
+}
+
+// 为页面设置slug，需要在保存页面之前调用
+func setPageSlug(tx models.Store, page *models.Page, input string) (err error) {
+	page.Slug, err = uniqueSlug(models.SLUG_KIND_PAGE, page.Title, input, page.ID, func(slug string) uint {
+		if p, err := tx.Pages().GetBySlug(slug); err == nil {
+			return p.ID
+		}
+		return 0
+	})
+	return
+}
+
+// 保存后记录slug的变化，旧slug指向当前记录，新slug不再跳转到其他记录
+func saveSlugHistory(tx models.Store, kind string, id uint, oldSlug, newSlug string) error {
+	if err := tx.SlugHistories().Delete(kind, newSlug); err != nil {
+		return err
+	}
+	if oldSlug == "" || oldSlug == newSlug {
+		return nil
+	}
+	return tx.SlugHistories().Create(&models.SlugHistory{Kind: kind, TargetID: id, Slug: oldSlug})
+}
+
+// 301跳转，保留查询参数
+func redirectPermanent(c *gin.Context, location string) {
+	if c.Request.URL.RawQuery != "" {
+		location += "?" + c.Request.URL.RawQuery
+	}
+	c.Redirect(http.StatusMovedPermanently, location)
+}
+
+// 按固定链接中的变量查找已发布的文章，slug不存在时按旧slug查找
+func (ctl *Controller) findPost(vars map[string]string) *models.Post {
+	var (
+		post *models.Post
+		err  error
+	)
+	if id, ok := vars[PERMALINK_ID]; ok {
+		pid, _ := parseId(id)
+		post, err = ctl.store.Posts().Get(pid)
+	} else {
+		slug := vars[PERMALINK_SLUG]
+		post, err = ctl.store.Posts().GetBySlug(slug)
+		if err == models.ErrNotFound {
+			var history *models.SlugHistory
+			if history, err = ctl.store.SlugHistories().Get(models.SLUG_KIND_POST, slug); err == nil {
+				post, err = ctl.store.Posts().Get(history.TargetID)
+			}
+		}
+	}
+	if err != nil || !post.IsVisible() {
+		return nil
+	}
+	return post
+}
+
+// 按固定链接中的变量查找已发布的页面，slug不存在时按旧slug查找
+func (ctl *Controller) findPage(vars map[string]string) *models.Page {
+	var (
+		page *models.Page
+		err  error
+	)
+	if id, ok := vars[PERMALINK_ID]; ok {
+		pid, _ := parseId(id)
+		page, err = ctl.store.Pages().Get(pid)
+	} else {
+		slug := vars[PERMALINK_SLUG]
+		page, err = ctl.store.Pages().GetBySlug(slug)
+		if err == models.ErrNotFound {
+			var history *models.SlugHistory
+			if history, err = ctl.store.SlugHistories().Get(models.SLUG_KIND_PAGE, slug); err == nil {
+				page, err = ctl.store.Pages().Get(history.TargetID)
+			}
+		}
+	}
+	if err != nil || !page.IsVisible() {
+		return nil
+	}
+	return page
+}
+
+// 没有匹配路由的请求按固定链接格式查找文章和页面，都不存在时返回404
+func (ctl *Controller) PermalinkGet(c *gin.Context) {
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		path := c.Request.URL.Path
+		if vars, ok := ctl.permalinks.post.Match(path); ok {
+			if post := ctl.findPost(vars); post != nil {
+				ctl.showPost(c, post)
+				return
+			}
+		}
+		if vars, ok := ctl.permalinks.page.Match(path); ok {
+			if page := ctl.findPage(vars); page != nil {
+				ctl.showPage(c, page)
+				return
+			}
+		}
+	}
+	Handle404(c)
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gingorm/models"
+)
+
+func TestParsePermalink(t *testing.T) {
+	for _, pattern := range []string{"/post/:slug", "/:year/:month/:day/:slug", "/p/:id", "/archive/:id"} {
+		if _, err := ParsePermalink(pattern); err != nil {
+			t.Errorf("ParsePermalink(%q): %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"post/:slug", "/post//:slug", "/post/:title", "/:year/:month"} {
+		if _, err := ParsePermalink(pattern); err == nil {
+			t.Errorf("ParsePermalink(%q) should fail", pattern)
+		}
+	}
+}
+
+func TestPermalinkBuildMatch(t *testing.T) {
+	p, err := ParsePermalink("/:year/:month/:day/:slug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC)
+	path := p.Build("hello", 7, date)
+	if path != "/2020/03/05/hello" {
+		t.Fatalf("Build = %q", path)
+	}
+	vars, ok := p.Match(path)
+	if !ok || vars[PERMALINK_SLUG] != "hello" || vars[PERMALINK_YEAR] != "2020" {
+		t.Errorf("Match(%q) = %v, %v", path, vars, ok)
+	}
+	for _, path := range []string{"/2020/3/05/hello", "/2020/03/05", "/year/03/05/hello", "/2020/03/05/hello/x"} {
+		if _, ok := p.Match(path); ok {
+			t.Errorf("Match(%q) should fail", path)
+		}
+	}
+
+	p, _ = ParsePermalink("/p/:id")
+	if path = p.Build("hello", 7, date); path != "/p/7" {
+		t.Errorf("Build = %q", path)
+	}
+	if _, ok := p.Match("/p/hello"); ok {
+		t.Error("id must be numeric")
+	}
+}
+
+func TestNewPermalinks(t *testing.T) {
+	if _, err := NewPermalinks("/post/:slug", "/page/:slug"); err != nil {
+		t.Error(err)
+	}
+	//文章和页面的格式必须能区分
+	if _, err := NewPermalinks("/:slug", "/:slug"); err == nil {
+		t.Error("overlapping permalinks accepted")
+	}
+	if _, err := NewPermalinks("/:year/:slug", "/page/:slug"); err == nil {
+		t.Error("overlapping permalinks accepted")
+	}
+	if _, err := NewPermalinks("/:year/:month/:slug", "/:slug"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUniqueSlug(t *testing.T) {
+	used := map[string]uint{"hello": 1, "hello-2": 2, "post": 3}
+	owner := func(slug string) uint { return used[slug] }
+	cases := []struct {
+		title, input string
+		id           uint
+		slug         string
+		err          error
+	}{
+		{"Hello", "", 0, "hello-3", nil},
+		{"Hello", "", 1, "hello", nil}, //自己的slug不算重复
+		{"Hello", "world", 0, "world", nil},
+		{"Hello", "Hello", 0, "", errSlugExists},
+		{"Hello", "!!!", 0, "", errInvalidSlug},
+		{"!!!", "", 0, "post-2", nil},
+		{"2020", "", 0, "post-2020", nil},
+	}
+	for _, tc := range cases {
+		slug, err := uniqueSlug(models.SLUG_KIND_POST, tc.title, tc.input, tc.id, owner)
+		if slug != tc.slug || err != tc.err {
+			t.Errorf("uniqueSlug(%q, %q, %d) = %q, %v, want %q, %v", tc.title, tc.input, tc.id, slug, err, tc.slug, tc.err)
+		}
+	}
+}
+
+func getRequest(r http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+// 数字id和旧slug都301跳转到当前的固定链接
+func TestPermalinkRedirects(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	author := createTestUser(t, store, "author", models.ROLE_AUTHOR)
+	r := newTestRouter(author, "post/display.html", "post/modify.html", "page/display.html")
+	r.NoRoute(ctl.PermalinkGet)
+	r.GET("/post/:id", ctl.PostGet)
+	r.GET("/page/:id", ctl.PageGet)
+	r.POST("/admin/post/:id/edit", ctl.PostUpdate)
+
+	published := time.Now().Add(-time.Hour)
+	post := &models.Post{Title: "Hello", Slug: "hello", IsPublished: true, PublishAt: &published, UserID: author.ID}
+	draft := &models.Post{Title: "Draft", Slug: "draft", UserID: author.ID}
+	for _, p := range []*models.Post{post, draft} {
+		if err := store.Posts().Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page := &models.Page{Title: "About", Slug: "about", IsPublished: true, PublishAt: &published}
+	if err := store.Pages().Create(page); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := getRequest(r, "/post/hello"); w.Code != http.StatusOK {
+		t.Errorf("GET /post/hello: status = %d", w.Code)
+	}
+	w := getRequest(r, fmt.Sprintf("/post/%d?from=rss", post.ID))
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/post/hello?from=rss" {
+		t.Errorf("GET by id: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if w = getRequest(r, fmt.Sprintf("/page/%d", page.ID)); w.Header().Get("Location") != "/page/about" {
+		t.Errorf("GET page by id: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if w = getRequest(r, "/page/about"); w.Code != http.StatusOK {
+		t.Errorf("GET /page/about: status = %d", w.Code)
+	}
+	//未发布的文章不可访问
+	if w = getRequest(r, "/post/draft"); w.Code != http.StatusNotFound {
+		t.Errorf("GET draft: status = %d", w.Code)
+	}
+	if w = getRequest(r, "/post/missing"); w.Code != http.StatusNotFound {
+		t.Errorf("GET missing: status = %d", w.Code)
+	}
+
+	//修改slug后旧链接跳转到新链接
+	w = postForm(r, fmt.Sprintf("/admin/post/%d/edit", post.ID), url.Values{"title": {"Hello"}, "slug": {"hello-gin"}, "body": {"body"}, "isPublished": {"on"}})
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("update post: %d %s", w.Code, w.Body.String())
+	}
+	if w = getRequest(r, "/post/hello"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/post/hello-gin" {
+		t.Errorf("GET old slug: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	//手动填写的slug不能与其他文章重复
+	w = postForm(r, fmt.Sprintf("/admin/post/%d/edit", post.ID), url.Values{"title": {"Hello"}, "slug": {"draft"}, "body": {"body"}, "isPublished": {"on"}})
+	if !strings.Contains(w.Body.String(), errSlugExists.Error()) {
+		t.Errorf("duplicate slug: %d %s", w.Code, w.Body.String())
+	}
+	//改回旧slug后不再跳转
+	postForm(r, fmt.Sprintf("/admin/post/%d/edit", post.ID), url.Values{"title": {"Hello"}, "slug": {"hello"}, "body": {"body"}, "isPublished": {"on"}})
+	if w = getRequest(r, "/post/hello"); w.Code != http.StatusOK {
+		t.Errorf("GET restored slug: status = %d", w.Code)
+	}
+	if w = getRequest(r, "/post/hello-gin"); w.Header().Get("Location") != "/post/hello" {
+		t.Errorf("GET previous slug: %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
+
+// 自定义格式
+func TestCustomPermalink(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	var err error
+	if ctl.permalinks, err = NewPermalinks("/:year/:month/:slug", "/:slug"); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(nil, "post/display.html", "page/display.html")
+	r.NoRoute(ctl.PermalinkGet)
+	published := time.Date(2020, 3, 5, 0, 0, 0, 0, time.UTC)
+	post := &models.Post{Title: "Hello", Slug: "hello", IsPublished: true, PublishAt: &published}
+	page := &models.Page{Title: "About", Slug: "about", IsPublished: true, PublishAt: &published}
+	if err = store.Posts().Create(post); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Pages().Create(page); err != nil {
+		t.Fatal(err)
+	}
+	link := ctl.permalinks.Post(post)
+	if w := getRequest(r, link); w.Code != http.StatusOK {
+		t.Errorf("GET %s: status = %d", link, w.Code)
+	}
+	if w := getRequest(r, "/about"); w.Code != http.StatusOK {
+		t.Errorf("GET /about: status = %d", w.Code)
+	}
+	//日期不对时跳转到正确的链接
+	if w := getRequest(r, "/1999/01/hello"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != link {
+		t.Errorf("GET wrong date: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if w := getRequest(r, "/hello"); w.Code != http.StatusNotFound {
+		t.Errorf("post matched the page permalink: status = %d", w.Code)
+	}
+}
@@ -4,186 +4,327 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
 	"gingorm/models"
+	"gingorm/system"
 )
 
-func PostGet(c *gin.Context) {
-	id := c.Param("id")
-	post, err := models.GetPostById(id)
-	if err != nil || !post.IsPublished {
-		Handle404(c)
+var errForbidden = errors.New("Forbidden!")
+
+//旧的/post/:id链接跳转到固定链接，固定链接格式以/post/开头时也由这里处理
+func (ctl *Controller) PostGet(c *gin.Context) {
+	if id, err := parseId(c.Param("id")); err == nil {
+		if post, err := ctl.store.Posts().Get(id); err == nil && post.IsVisible() {
+			ctl.showPost(c, post)
+			return
+		}
+	}
+	ctl.PermalinkGet(c)
+}
+
+//当前地址不是文章的固定链接时301跳转
+func (ctl *Controller) showPost(c *gin.Context, post *models.Post) {
+	link := ctl.permalinks.Post(post)
+	if link != c.Request.URL.Path {
+		redirectPermanent(c, link)
 		return
 	}
 	post.View++
-	post.UpdateView()
-	post.Tags, _ = models.ListTagByPostId(id)
-	post.Comments, _ = models.ListCommentByPostID(id)
+	ctl.store.Posts().UpdateView(post)
+	post.Tags, _ = ctl.store.Tags().ListByPostId(post.ID)
+	comments, _ := ctl.store.Comments().ListByPostId(post.ID)
+	//按回复关系展开，模板按Depth缩进
+	post.Comments = models.FlattenComments(models.ThreadComments(comments, system.GetConfiguration().CommentMaxDepth))
 	user, _ := c.Get(CONTEXT_USER_KEY)
 	c.HTML(http.StatusOK, "post/display.html", gin.H{
-		"post": post,
-		"user": user,
+		"csrf":          csrfToken(c),
+		"post":          post,
+		"user":          user,
+		"canonical":     absoluteURL(link),
+		"guestComments": system.GetConfiguration().GuestComments,
+		"guest":         commentGuestFromCookie(c),
+		"deleteAfter":   time.Now().Add(-system.GetConfiguration().CommentEditWindow), //在这之后发表的评论，作者可以删除
 	})
 }
 
+//获取当前用户有权编辑的文章，作者只能编辑自己的文章
+func (ctl *Controller) getEditablePost(c *gin.Context, id uint) (*models.Post, error) {
+	post, err := ctl.store.Posts().Get(id)
+	if err != nil {
+		return nil, err
+	}
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	if user, ok := sessionUser.(*models.User); !ok || !user.CanEditPost(post) {
+		return nil, errForbidden
+	}
+	return post, nil
+}
+
 func PostNew(c *gin.Context) {
-	c.HTML(http.StatusOK, "post/new.html", nil)
+	c.HTML(http.StatusOK, "post/new.html", gin.H{
+		"csrf": csrfToken(c),
+	})
 }
 
-//创建post
-func PostCreate(c *gin.Context) {
+//给博客添加tag，tags为逗号分隔的tag id
+func addPostTags(tx models.Store, postId uint, tags string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	tagArr := strings.Split(tags, ",")
+	for _, tag := range tagArr {
+		//这样写有很大疑问。我测试的例子为什么转换的成数字的结果都是0
+		tagId, err := strconv.ParseUint(tag, 10, 64)
+		if err != nil {
+			continue
+		}
+		pt := &models.PostTag{
+			PostId: postId,
+			TagId:  uint(tagId),
+		}
+		if err = tx.PostTags().Create(pt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//创建post，文章和标签在同一个事务中写入
+func (ctl *Controller) PostCreate(c *gin.Context) {
 	tags := c.PostForm("tags")
 	title := c.PostForm("title")
+	slug := c.PostForm("slug")
 	body := c.PostForm("body")
-	isPublished := c.PostForm("isPublished")
-	published := "on" == isPublished
 
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		Handle403(c)
+		return
+	}
 	post := &models.Post{
-		Title:       title,
-		Body:        body,
-		IsPublished: published,
+		Title:  title,
+		Body:   body,
+		UserID: user.ID,
 	}
-	err := post.Insert()
+	err := ctl.store.Transaction(func(tx models.Store) error {
+		if err := setFormPublishState(c, nil, post.SetState); err != nil {
+			return err
+		}
+		if err := setPostSlug(tx, post, slug); err != nil {
+			return err
+		}
+		if err := tx.Posts().Create(post); err != nil {
+			return err
+		}
+		if err := saveSlugHistory(tx, models.SLUG_KIND_POST, post.ID, "", post.Slug); err != nil {
+			return err
+		}
+		if err := addPostTags(tx, post.ID, tags); err != nil {
+			return err
+		}
+		return savePostRevision(tx, post, user.ID)
+	})
 	if err != nil {
 		c.HTML(http.StatusOK, "post/new.html", gin.H{
+			"csrf":    csrfToken(c),
 			"post":    post,
 			"message": err.Error(),
 		})
 		return
 	}
-	//给博客添加tag
-	// add tag for post
-	if len(tags) > 0 {
-		tagArr := strings.Split(tags, ",")
-		for _, tag := range tagArr {
-			//这样写有很大疑问。我测试的例子为什么转换的成数字的结果都是0
-			tagId, err := strconv.ParseUint(tag, 10, 64)
-			if err != nil {
-				continue
-			}
-			pt := &models.PostTag{
-				PostId: post.ID,
-				TagId:  uint(tagId),
-			}
-			pt.Insert()
-		}
-	}
+	ctl.indexPost(post.ID)
 	c.Redirect(http.StatusMovedPermanently, "/admin/post")
 }
 
-func PostEdit(c *gin.Context) {
-	id := c.Param("id")
-	post, err := models.GetPostById(id)
+func (ctl *Controller) PostEdit(c *gin.Context) {
+	id, err := parseId(c.Param("id"))
+	if err != nil {
+		Handle404(c)
+		return
+	}
+	post, err := ctl.getEditablePost(c, id)
+	if err == errForbidden {
+		Handle403(c)
+		return
+	}
 	if err != nil {
 		Handle404(c)
 		return
 	}
-	post.Tags, _ = models.ListTagByPostId(id)
+	post.Tags, _ = ctl.store.Tags().ListByPostId(id)
+	//有自动保存的草稿时编辑草稿
+	draft := ctl.userDraft(c, models.SLUG_KIND_POST, post.ID)
+	if draft != nil {
+		post.Title, post.Body, post.Tags = draft.Title, draft.Body, ctl.draftTags(draft)
+	}
 	c.HTML(http.StatusOK, "post/modify.html", gin.H{
-		"post": post,
+		"csrf":        csrfToken(c),
+		"post":        post,
+		"draft":       draft,
+		"otherDrafts": ctl.otherDrafts(models.SLUG_KIND_POST, post.ID, contextUserId(c)),
 	})
 }
 
-func PostUpdate(c *gin.Context) {
-	id := c.Param("id")
+func (ctl *Controller) PostUpdate(c *gin.Context) {
 	tags := c.PostForm("tags")
 	title := c.PostForm("title")
+	slug := c.PostForm("slug")
 	body := c.PostForm("body")
-	isPublished := c.PostForm("isPublished")
-	published := "on" == isPublished
 
-	pid, err := strconv.ParseUint(id, 10, 64)
+	pid, err := parseId(c.Param("id"))
 	if err != nil {
 		Handle404(c)
 		return
 	}
+	old, err := ctl.getEditablePost(c, pid)
+	if err == errForbidden {
+		Handle403(c)
+		return
+	} else if err != nil {
+		Handle404(c)
+		return
+	}
 
 	post := &models.Post{
 		Title:       title,
 		Body:        body,
-		IsPublished: published,
+		IsPublished: old.IsPublished,
+		PublishAt:   old.PublishAt,
 	}
-	post.ID = uint(pid)
-	err = post.Update()
+	post.ID = pid
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		if err := setFormPublishState(c, old.PublishAt, post.SetState); err != nil {
+			return err
+		}
+		//slug留空时根据标题重新生成
+		if err := setPostSlug(tx, post, slug); err != nil {
+			return err
+		}
+		if err := tx.Posts().Update(post); err != nil {
+			return err
+		}
+		if err := saveSlugHistory(tx, models.SLUG_KIND_POST, post.ID, old.Slug, post.Slug); err != nil {
+			return err
+		}
+		// 删除tag
+		if err := tx.PostTags().DeleteByPostId(post.ID); err != nil {
+			return err
+		}
+		// 添加tag
+		if err := addPostTags(tx, post.ID, tags); err != nil {
+			return err
+		}
+		if err := savePostRevision(tx, post, contextUserId(c)); err != nil {
+			return err
+		}
+		//直接保存后不再需要草稿
+		return tx.Drafts().Delete(models.SLUG_KIND_POST, post.ID, contextUserId(c))
+	})
 	if err != nil {
+		post.Slug = slug
 		c.HTML(http.StatusOK, "post/modify.html", gin.H{
+			"csrf":    csrfToken(c),
 			"post":    post,
 			"message": err.Error(),
 		})
 		return
 	}
-	// 删除tag
-	models.DeletePostTagByPostId(post.ID)
-	// 添加tag
-	if len(tags) > 0 {
-		tagArr := strings.Split(tags, ",")
-		for _, tag := range tagArr {
-			tagId, err := strconv.ParseUint(tag, 10, 64)
-			if err != nil {
-				continue
-			}
-			pt := &models.PostTag{
-				PostId: post.ID,
-				TagId:  uint(tagId),
-			}
-			pt.Insert()
-		}
-	}
+	ctl.indexPost(post.ID)
 	c.Redirect(http.StatusMovedPermanently, "/admin/post")
 }
 
-func PostPublish(c *gin.Context) {
+func (ctl *Controller) PostPublish(c *gin.Context) {
 	var (
 		err  error
 		res  = gin.H{}
+		id   uint
 		post *models.Post
 	)
 	defer writeJSON(c, res)
-	id := c.Param("id")
-	post, err = models.GetPostById(id)
+	id, err = parseId(c.Param("id"))
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
-	post.IsPublished = !post.IsPublished
-	err = post.Update()
+	post, err = ctl.getEditablePost(c, id)
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
+	//已发布的文章改为草稿，草稿和定时发布的文章立即发布
+	if post.State() == models.PUBLISH_STATE_PUBLISHED {
+		err = post.SetState(models.PUBLISH_STATE_DRAFT, nil)
+	} else {
+		err = post.SetState(models.PUBLISH_STATE_PUBLISHED, nil)
+	}
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = ctl.store.Posts().Update(post)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	ctl.indexPost(post.ID)
 	res["succeed"] = true
 }
 
-func PostDelete(c *gin.Context) {
+func (ctl *Controller) PostDelete(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
 	)
 	defer writeJSON(c, res)
-	id := c.Param("id")
-	pid, err := strconv.ParseUint(id, 10, 64)
+	pid, err := parseId(c.Param("id"))
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
-	post := &models.Post{}
-	post.ID = uint(pid)
-	err = post.Delete()
+	if _, err = ctl.getEditablePost(c, pid); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		if err := tx.Posts().Delete(pid); err != nil {
+			return err
+		}
+		if err := tx.SlugHistories().DeleteByTarget(models.SLUG_KIND_POST, pid); err != nil {
+			return err
+		}
+		if err := tx.Revisions().DeleteByTarget(models.SLUG_KIND_POST, pid); err != nil {
+			return err
+		}
+		if err := tx.Drafts().DeleteByTarget(models.SLUG_KIND_POST, pid); err != nil {
+			return err
+		}
+		return tx.PostTags().DeleteByPostId(pid)
+	})
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
-	models.DeletePostTagByPostId(uint(pid))
+	ctl.indexPost(pid)
 	res["succeed"] = true
 }
 
-func PostIndex(c *gin.Context) {
-	posts, _ := models.ListAllPost("")
+//作者只能看到自己的文章
+func (ctl *Controller) PostIndex(c *gin.Context) {
+	var posts []*models.Post
 	user, _ := c.Get(CONTEXT_USER_KEY)
+	if u, ok := user.(*models.User); ok && !u.HasPermission(models.PERM_POST_OTHERS) {
+		posts, _ = ctl.store.Posts().ListByUserId(u.ID)
+	} else {
+		posts, _ = ctl.store.Posts().ListAll(0)
+	}
 	c.HTML(http.StatusOK, "admin/post.html", gin.H{
+		"csrf":     csrfToken(c),
 		"posts":    posts,
 		"Active":   "posts",
 		"user":     user,
-		"comments": models.MustListUnreadComment(),
+		"comments": ctl.mustListUnreadComment(),
 	})
 }
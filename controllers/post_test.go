@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gingorm/models"
+)
+
+var errTestInsert = errors.New("insert failed")
+
+// 第failAt次添加文章标签时返回错误
+type failingPostTagStore struct {
+	models.Store
+	failAt int
+	count  *int
+	postId *uint //最后一次添加标签的文章
+}
+
+func (s *failingPostTagStore) PostTags() models.PostTagRepository {
+	return &failingPostTagRepository{PostTagRepository: s.Store.PostTags(), store: s}
+}
+
+func (s *failingPostTagStore) Transaction(fn func(tx models.Store) error) error {
+	return s.Store.Transaction(func(tx models.Store) error {
+		return fn(&failingPostTagStore{Store: tx, failAt: s.failAt, count: s.count, postId: s.postId})
+	})
+}
+
+type failingPostTagRepository struct {
+	models.PostTagRepository
+	store *failingPostTagStore
+}
+
+func (r *failingPostTagRepository) Create(pt *models.PostTag) error {
+	*r.store.count++
+	*r.store.postId = pt.PostId
+	if *r.store.count == r.store.failAt {
+		return errTestInsert
+	}
+	return r.PostTagRepository.Create(pt)
+}
+
+func createTestTags(t *testing.T, store models.Store, names ...string) string {
+	t.Helper()
+	ids := make([]string, 0)
+	for _, name := range names {
+		tag := &models.Tag{Name: name}
+		if err := store.Tags().Create(tag); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, fmt.Sprint(tag.ID))
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestPostCreate(t *testing.T) {
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	author := createTestUser(t, store, "author", models.ROLE_AUTHOR)
+	tags := createTestTags(t, store, "go", "gin")
+	r := newTestRouter(author, "post/new.html")
+	r.POST("/admin/new_post", ctl.PostCreate)
+
+	w := postForm(r, "/admin/new_post", url.Values{"title": {"Hello World"}, "body": {"body"}, "tags": {tags}, "isPublished": {"on"}})
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body.String())
+	}
+	posts, _ := store.Posts().ListAll(0)
+	if len(posts) != 1 {
+		t.Fatalf("got %d posts, want 1", len(posts))
+	}
+	post := posts[0]
+	if post.UserID != author.ID || post.Slug != "hello-world" || !post.IsVisible() {
+		t.Errorf("post = %+v", post)
+	}
+	if postTags, _ := store.Tags().ListByPostId(post.ID); len(postTags) != 2 {
+		t.Errorf("got %d tags, want 2", len(postTags))
+	}
+	if _, err := store.Revisions().Latest(models.SLUG_KIND_POST, post.ID); err != nil {
+		t.Errorf("revision not saved: %v", err)
+	}
+}
+
+func TestPostCreateRollback(t *testing.T) {
+	memory := models.NewMemoryStore()
+	author := createTestUser(t, memory, "author", models.ROLE_AUTHOR)
+	tags := createTestTags(t, memory, "go", "gin")
+	count, postId := 0, uint(0)
+	store := &failingPostTagStore{Store: memory, failAt: 2, count: &count, postId: &postId}
+	ctl := newTestController(t, store)
+	r := newTestRouter(author, "post/new.html")
+	r.POST("/admin/new_post", ctl.PostCreate)
+
+	w := postForm(r, "/admin/new_post", url.Values{"title": {"Hello"}, "body": {"body"}, "tags": {tags}})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), errTestInsert.Error()) {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body.String())
+	}
+	if count != 2 {
+		t.Fatalf("tag inserts = %d, want 2", count)
+	}
+	if _, err := memory.Posts().Get(postId); err != models.ErrNotFound {
+		t.Errorf("post not rolled back: %v", err)
+	}
+	//第一个标签已写入，回滚后也不应保留
+	if postTags, _ := memory.Tags().ListByPostId(postId); len(postTags) != 0 {
+		t.Errorf("got %d tags after rollback, want 0", len(postTags))
+	}
+	if _, err := memory.SlugHistories().Get(models.SLUG_KIND_POST, "hello"); err != models.ErrNotFound {
+		t.Errorf("slug history not rolled back: %v", err)
+	}
+
+	//回滚后仓库仍然可用
+	count = -10
+	w = postForm(r, "/admin/new_post", url.Values{"title": {"Hello"}, "body": {"body"}, "tags": {tags}})
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body.String())
+	}
+	posts, _ := memory.Posts().ListAll(0)
+	if len(posts) != 1 || posts[0].Slug != "hello" {
+		t.Fatalf("posts = %+v", posts)
+	}
+	if postTags, _ := memory.Tags().ListByPostId(posts[0].ID); len(postTags) != 2 {
+		t.Errorf("got %d tags, want 2", len(postTags))
+	}
+}
+
+func TestPostUpdateOtherAuthor(t *testing.T) {
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	owner := createTestUser(t, store, "owner", models.ROLE_AUTHOR)
+	other := createTestUser(t, store, "other", models.ROLE_AUTHOR)
+	post := &models.Post{Title: "Mine", Body: "body", Slug: "mine", UserID: owner.ID}
+	if err := store.Posts().Create(post); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(other, "post/modify.html")
+	r.POST("/admin/post/:id/edit", ctl.PostUpdate)
+
+	w := postForm(r, fmt.Sprintf("/admin/post/%d/edit", post.ID), url.Values{"title": {"Stolen"}, "body": {"x"}})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+	if got, _ := store.Posts().Get(post.ID); got.Title != "Mine" {
+		t.Errorf("title = %q, want unchanged", got.Title)
+	}
+}
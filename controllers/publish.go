@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"github.com/cihub/seelog"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+var errInvalidPublishAt = errors.New("invalid publish time")
+
+// 根据表单设置发布状态，未勾选发布时为草稿，current为原发布时间
+// 勾选发布时publishAt为空则立即发布，晚于当前时间则定时发布，早于当前时间则按该时间发布
+// publishAt和原发布时间相同时保留原时间，避免编辑时秒数被截断
+func setFormPublishState(c *gin.Context, current *time.Time, setState func(state string, at *time.Time) error) error {
+	if c.PostForm("isPublished") != "on" {
+		return setState(models.PUBLISH_STATE_DRAFT, nil)
+	}
+	value := strings.TrimSpace(c.PostForm("publishAt"))
+	if value == "" {
+		return setState(models.PUBLISH_STATE_PUBLISHED, nil)
+	}
+	at := current
+	if value != helpers.DatetimeLocal(current) {
+		t, err := time.ParseInLocation(helpers.DATETIME_LOCAL_LAYOUT, value, time.Local)
+		if err != nil {
+			return errInvalidPublishAt
+		}
+		at = &t
+	}
+	if at.After(time.Now()) {
+		return setState(models.PUBLISH_STATE_SCHEDULED, at)
+	}
+	return setState(models.PUBLISH_STATE_PUBLISHED, at)
+}
+
+// 根据接口请求设置发布状态，不合法时输出422
+// state优先于is_published，只有publish_at时根据时间判断是否定时发布，都没有出现时保持原状态
+func apiSetPublishState(c *gin.Context, state *string, isPublished *bool, publishAt *time.Time, setState func(state string, at *time.Time) error) bool {
+	var s string
+	switch {
+	case state != nil:
+		s = *state
+	case isPublished != nil && !*isPublished:
+		s = models.PUBLISH_STATE_DRAFT
+	case isPublished != nil || publishAt != nil:
+		s = models.PUBLISH_STATE_PUBLISHED
+		if publishAt != nil && publishAt.After(time.Now()) {
+			s = models.PUBLISH_STATE_SCHEDULED
+		}
+	default:
+		return true
+	}
+	if err := setState(s, publishAt); err != nil {
+		APIError(c, http.StatusUnprocessableEntity, err.Error())
+		return false
+	}
+	return true
+}
+
+// 发布到达发布时间的定时文章和页面，由定时任务每分钟执行，发布文章后通知订阅者
+func (ctl *Controller) PublishScheduled() {
+	posts, err := ctl.store.Posts().ListDue()
+	if err != nil {
+		seelog.Error(err)
+	}
+	for _, post := range posts {
+		published, err := ctl.store.Posts().PublishDue(post.ID)
+		if err != nil {
+			seelog.Error(err)
+			continue
+		}
+		if published {
+			post.IsPublished = true
+			ctl.indexPost(post.ID)
+			ctl.notifyNewPost(post)
+		}
+	}
+	pages, err := ctl.store.Pages().ListDue()
+	if err != nil {
+		seelog.Error(err)
+	}
+	for _, page := range pages {
+		published, err := ctl.store.Pages().PublishDue(page.ID)
+		if err != nil {
+			seelog.Error(err)
+			continue
+		}
+		if published {
+			ctl.indexPage(page.ID)
+		}
+	}
+}
+
+// 通知订阅者有新文章发布
+func (ctl *Controller) notifyNewPost(post *models.Post) {
+	if count, err := ctl.store.Subscribers().Count(); err != nil || count == 0 {
+		return
+	}
+	link := absoluteURL(ctl.permalinks.Post(post))
+	title := template.HTMLEscapeString(post.Title)
+	body := fmt.Sprintf(`新文章发布：<a href="%s">%s</a>`, template.HTMLEscapeString(link), title)
+	if err := ctl.sendEmailToSubscribers("[Wblog]"+post.Title, body); err != nil {
+		seelog.Error(err)
+	}
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gingorm/helpers"
+	"gingorm/models"
+)
+
+func TestPostCreatePublishState(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	author := createTestUser(t, store, "author", models.ROLE_AUTHOR)
+	r := newTestRouter(author, "post/new.html")
+	r.POST("/admin/new_post", ctl.PostCreate)
+
+	future := time.Now().Add(24 * time.Hour)
+	past := time.Date(2019, 5, 1, 8, 0, 0, 0, time.Local)
+	cases := []struct {
+		title     string
+		published string
+		publishAt string
+		state     string
+	}{
+		{"draft", "", "", models.PUBLISH_STATE_DRAFT},
+		{"now", "on", "", models.PUBLISH_STATE_PUBLISHED},
+		{"scheduled", "on", helpers.DatetimeLocal(&future), models.PUBLISH_STATE_SCHEDULED},
+		{"backdated", "on", helpers.DatetimeLocal(&past), models.PUBLISH_STATE_PUBLISHED},
+	}
+	for _, tc := range cases {
+		w := postForm(r, "/admin/new_post", url.Values{"title": {tc.title}, "isPublished": {tc.published}, "publishAt": {tc.publishAt}})
+		if w.Code != http.StatusMovedPermanently {
+			t.Fatalf("%s: status = %d, body = %q", tc.title, w.Code, w.Body.String())
+		}
+		post, err := store.Posts().GetBySlug(tc.title)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post.State() != tc.state {
+			t.Errorf("%s: state = %s, want %s", tc.title, post.State(), tc.state)
+		}
+	}
+	if post, _ := store.Posts().GetBySlug("backdated"); !post.PublishAt.Equal(past) {
+		t.Errorf("backdated publish time = %v", post.PublishAt)
+	}
+
+	w := postForm(r, "/admin/new_post", url.Values{"title": {"invalid"}, "isPublished": {"on"}, "publishAt": {"tomorrow"}})
+	if !strings.Contains(w.Body.String(), errInvalidPublishAt.Error()) {
+		t.Errorf("invalid publish time: %q", w.Body.String())
+	}
+}
+
+func TestPublishScheduled(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	due := &models.Post{Title: "due", Slug: "due", PublishAt: &past}
+	later := &models.Post{Title: "later", Slug: "later", PublishAt: &future}
+	page := &models.Page{Title: "about", Slug: "about", PublishAt: &past}
+	for _, post := range []*models.Post{due, later} {
+		if err := store.Posts().Create(post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Pages().Create(page); err != nil {
+		t.Fatal(err)
+	}
+
+	ctl.PublishScheduled()
+	if post, _ := store.Posts().Get(due.ID); !post.IsVisible() {
+		t.Errorf("due post not published: %+v", post)
+	}
+	if post, _ := store.Posts().Get(later.ID); post.State() != models.PUBLISH_STATE_SCHEDULED {
+		t.Errorf("future post state = %s", post.State())
+	}
+	if p, _ := store.Pages().Get(page.ID); !p.IsVisible() {
+		t.Errorf("due page not published: %+v", p)
+	}
+}
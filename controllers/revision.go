@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"gingorm/system"
+	"github.com/gin-gonic/gin"
+)
+
+// 比较两个版本时修改处前后显示的未修改行数
+const REVISION_DIFF_CONTEXT = 3
+
+// 当前登录用户的id，未登录时为0
+func contextUserId(c *gin.Context) uint {
+	user, _ := c.Get(CONTEXT_USER_KEY)
+	if u, ok := user.(*models.User); ok {
+		return u.ID
+	}
+	return 0
+}
+
+// 保存文章的新版本，在保存文章和标签的事务中调用
+func savePostRevision(tx models.Store, post *models.Post, userId uint) error {
+	tags, err := tx.Tags().ListByPostId(post.ID)
+	if err != nil {
+		return err
+	}
+	return saveRevision(tx, &models.Revision{
+		Kind:     models.SLUG_KIND_POST,
+		TargetID: post.ID,
+		UserID:   userId,
+		Title:    post.Title,
+		Body:     post.Body,
+		Tags:     models.JoinTagNames(tags),
+	})
+}
+
+func savePageRevision(tx models.Store, page *models.Page, userId uint) error {
+	return saveRevision(tx, &models.Revision{
+		Kind:     models.SLUG_KIND_PAGE,
+		TargetID: page.ID,
+		UserID:   userId,
+		Title:    page.Title,
+		Body:     page.Body,
+	})
+}
+
+// 和上一个版本相同时不保存，超过revision_limit时删除最早的版本
+func saveRevision(tx models.Store, revision *models.Revision) error {
+	latest, err := tx.Revisions().Latest(revision.Kind, revision.TargetID)
+	if err == nil && latest.SameContent(revision) {
+		return nil
+	}
+	if err != nil && err != models.ErrNotFound {
+		return err
+	}
+	if err = tx.Revisions().Create(revision); err != nil {
+		return err
+	}
+	limit := system.GetConfiguration().RevisionLimit
+	if limit < 0 {
+		return nil
+	}
+	return tx.Revisions().Prune(revision.Kind, revision.TargetID, limit)
+}
+
+// 按版本中的标签名称恢复文章标签，已删除的标签会重新创建
+func restorePostTags(tx models.Store, postId uint, revision *models.Revision) error {
+	tagIds := make([]uint, 0)
+	for _, name := range revision.TagNames() {
+		tag := &models.Tag{Name: name}
+		if err := tx.Tags().Create(tag); err != nil {
+			return err
+		}
+		tagIds = append(tagIds, tag.ID)
+	}
+	return setPostTags(tx, postId, tagIds)
+}
+
+// 文章的历史版本
+func (ctl *Controller) PostRevisions(c *gin.Context) {
+	id, err := parseId(c.Param("id"))
+	if err != nil {
+		Handle404(c)
+		return
+	}
+	post, err := ctl.getEditablePost(c, id)
+	if err == errForbidden {
+		Handle403(c)
+		return
+	}
+	if err != nil {
+		Handle404(c)
+		return
+	}
+	ctl.showRevisions(c, models.SLUG_KIND_POST, post.ID, post.Title, ctl.permalinks.Post(post))
+}
+
+func (ctl *Controller) PageRevisions(c *gin.Context) {
+	id, err := parseId(c.Param("id"))
+	if err != nil {
+		Handle404(c)
+		return
+	}
+	page, err := ctl.store.Pages().Get(id)
+	if err != nil {
+		Handle404(c)
+		return
+	}
+	ctl.showRevisions(c, models.SLUG_KIND_PAGE, page.ID, page.Title, ctl.permalinks.Page(page))
+}
+
+// 列出版本并比较from和to两个版本，默认比较最新的两个版本
+func (ctl *Controller) showRevisions(c *gin.Context, kind string, id uint, title, link string) {
+	revisions, err := ctl.store.Revisions().List(kind, id)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	users := make(map[uint]*models.User)
+	for _, revision := range revisions {
+		if _, ok := users[revision.UserID]; !ok {
+			users[revision.UserID] = nil
+			if user, err := ctl.store.Users().Get(revision.UserID); err == nil {
+				users[revision.UserID] = user
+			}
+		}
+		revision.User = users[revision.UserID]
+	}
+	var from, to *models.Revision
+	if len(revisions) > 0 {
+		to = revisions[0]
+	}
+	if len(revisions) > 1 {
+		from = revisions[1]
+	}
+	if c.Query("from") != "" || c.Query("to") != "" {
+		if from, err = findRevision(revisions, c.Query("from")); err == nil {
+			to, err = findRevision(revisions, c.Query("to"))
+		}
+		if err != nil {
+			Handle404(c)
+			return
+		}
+	}
+	user, _ := c.Get(CONTEXT_USER_KEY)
+	h := gin.H{
+		"csrf":      csrfToken(c),
+		"user":      user,
+		"comments":  ctl.mustListUnreadComment(),
+		"kind":      kind,
+		"base":      fmt.Sprintf("/admin/%s/%d", kind, id),
+		"title":     title,
+		"link":      link,
+		"revisions": revisions,
+		"from":      from,
+		"to":        to,
+	}
+	if from != nil && to != nil {
+		h["diff"] = helpers.CollapseDiff(helpers.DiffLines(from.Body, to.Body), REVISION_DIFF_CONTEXT)
+		h["tagsRemoved"], h["tagsAdded"] = diffTags(from.TagNames(), to.TagNames())
+	}
+	c.HTML(http.StatusOK, "admin/revision.html", h)
+}
+
+func findRevision(revisions []*models.Revision, id string) (*models.Revision, error) {
+	rid, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, revision := range revisions {
+		if revision.ID == rid {
+			return revision, nil
+		}
+	}
+	return nil, models.ErrNotFound
+}
+
+// 返回只在from中和只在to中的标签
+func diffTags(from, to []string) (removed, added []string) {
+	inFrom := make(map[string]bool)
+	for _, name := range from {
+		inFrom[name] = true
+	}
+	inTo := make(map[string]bool)
+	for _, name := range to {
+		inTo[name] = true
+		if !inFrom[name] {
+			added = append(added, name)
+		}
+	}
+	for _, name := range from {
+		if !inTo[name] {
+			removed = append(removed, name)
+		}
+	}
+	return
+}
+
+// 获取文章或页面的某个版本
+func (ctl *Controller) getRevision(c *gin.Context, kind string, targetId uint) (*models.Revision, error) {
+	rid, err := parseId(c.Param("rid"))
+	if err != nil {
+		return nil, err
+	}
+	revision, err := ctl.store.Revisions().Get(rid)
+	if err != nil {
+		return nil, err
+	}
+	if revision.Kind != kind || revision.TargetID != targetId {
+		return nil, models.ErrNotFound
+	}
+	return revision, nil
+}
+
+// 恢复文章的标题、内容和标签，slug和发布状态不变，恢复后保存为新版本
+func (ctl *Controller) PostRevisionRestore(c *gin.Context) {
+	var (
+		err      error
+		res      = gin.H{}
+		id       uint
+		post     *models.Post
+		revision *models.Revision
+	)
+	defer writeJSON(c, res)
+	id, err = parseId(c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	post, err = ctl.getEditablePost(c, id)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	revision, err = ctl.getRevision(c, models.SLUG_KIND_POST, post.ID)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	post.Title, post.Body = revision.Title, revision.Body
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		if err := tx.Posts().Update(post); err != nil {
+			return err
+		}
+		if err := restorePostTags(tx, post.ID, revision); err != nil {
+			return err
+		}
+		return savePostRevision(tx, post, contextUserId(c))
+	})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	ctl.indexPost(post.ID)
+	res["succeed"] = true
+}
+
+// 恢复页面的标题和内容
+func (ctl *Controller) PageRevisionRestore(c *gin.Context) {
+	var (
+		err      error
+		res      = gin.H{}
+		id       uint
+		page     *models.Page
+		revision *models.Revision
+	)
+	defer writeJSON(c, res)
+	id, err = parseId(c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	page, err = ctl.store.Pages().Get(id)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	revision, err = ctl.getRevision(c, models.SLUG_KIND_PAGE, page.ID)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	page.Title, page.Body = revision.Title, revision.Body
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		if err := tx.Pages().Update(page); err != nil {
+			return err
+		}
+		return savePageRevision(tx, page, contextUserId(c))
+	})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	ctl.indexPage(page.ID)
+	res["succeed"] = true
+}
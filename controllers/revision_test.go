@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"gingorm/models"
+)
+
+func TestPostRevisions(t *testing.T) {
+	loadTestConfig(t, "revision_limit: 3\n")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	author := createTestUser(t, store, "author", models.ROLE_AUTHOR)
+	r := newTestRouter(author, "post/new.html", "post/modify.html")
+	r.SetHTMLTemplate(template.Must(template.New("admin/revision.html").Parse(
+		`{{range .diff}}{{.Op}}{{.Text}} {{end}}|{{range .tagsRemoved}}-{{.}}{{end}}{{range .tagsAdded}}+{{.}}{{end}}`)))
+	r.POST("/admin/new_post", ctl.PostCreate)
+	r.POST("/admin/post/:id/edit", ctl.PostUpdate)
+	r.GET("/admin/post/:id/revisions", ctl.PostRevisions)
+	r.POST("/admin/post/:id/revisions/:rid/restore", ctl.PostRevisionRestore)
+	tags := createTestTags(t, store, "go", "gin")
+
+	postForm(r, "/admin/new_post", url.Values{"title": {"Hello"}, "body": {"a\nb"}, "tags": {tags}})
+	post, err := store.Posts().GetBySlug("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edit := fmt.Sprintf("/admin/post/%d/edit", post.ID)
+	postForm(r, edit, url.Values{"title": {"Hello"}, "body": {"a\nc"}})
+	//没有修改时不保存新版本
+	postForm(r, edit, url.Values{"title": {"Hello"}, "body": {"a\nc"}})
+	revisions, _ := store.Revisions().List(models.SLUG_KIND_POST, post.ID)
+	if len(revisions) != 2 || revisions[0].UserID != author.ID || revisions[1].Tags != "gin,go" {
+		t.Fatalf("revisions = %+v", revisions)
+	}
+
+	w := getRequest(r, fmt.Sprintf("/admin/post/%d/revisions", post.ID))
+	if want := "=a -b +c |-gin-go"; html.UnescapeString(w.Body.String()) != want {
+		t.Errorf("diff = %q, want %q", w.Body.String(), want)
+	}
+	w = getRequest(r, fmt.Sprintf("/admin/post/%d/revisions?from=%d&to=%d", post.ID, revisions[0].ID, revisions[1].ID))
+	if want := "=a -c +b |+gin+go"; html.UnescapeString(w.Body.String()) != want {
+		t.Errorf("reversed diff = %q, want %q", w.Body.String(), want)
+	}
+	if w = getRequest(r, fmt.Sprintf("/admin/post/%d/revisions?from=999", post.ID)); w.Code != http.StatusNotFound {
+		t.Errorf("unknown revision: status = %d", w.Code)
+	}
+
+	//恢复第一个版本的内容和标签，已删除的标签重新创建
+	tagList, _ := store.Tags().ListAll()
+	for _, tag := range tagList {
+		if tag.Name == "gin" {
+			store.Tags().Delete(tag.ID)
+		}
+	}
+	res := map[string]interface{}{}
+	w = postForm(r, fmt.Sprintf("/admin/post/%d/revisions/%d/restore", post.ID, revisions[1].ID), nil)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res["succeed"] != true {
+		t.Fatalf("restore: %s", w.Body.String())
+	}
+	post, _ = store.Posts().Get(post.ID)
+	postTags, _ := store.Tags().ListByPostId(post.ID)
+	if post.Body != "a\nb" || models.JoinTagNames(postTags) != "gin,go" {
+		t.Errorf("restored post = %+v, tags = %s", post, models.JoinTagNames(postTags))
+	}
+	revisions, _ = store.Revisions().List(models.SLUG_KIND_POST, post.ID)
+	if len(revisions) != 3 || revisions[0].Body != "a\nb" {
+		t.Fatalf("revisions after restore = %+v", revisions)
+	}
+
+	//超过revision_limit时删除最早的版本
+	postForm(r, edit, url.Values{"title": {"Hello"}, "body": {"d"}})
+	revisions, _ = store.Revisions().List(models.SLUG_KIND_POST, post.ID)
+	if len(revisions) != 3 || revisions[2].Body != "a\nc" {
+		t.Errorf("revisions after prune = %+v", revisions)
+	}
+
+	//不能恢复其他文章的版本
+	other := &models.Post{Title: "Other", Slug: "other", UserID: author.ID}
+	store.Posts().Create(other)
+	res = map[string]interface{}{}
+	w = postForm(r, fmt.Sprintf("/admin/post/%d/revisions/%d/restore", other.ID, revisions[0].ID), nil)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res["succeed"] == true {
+		t.Error("restored a revision of another post")
+	}
+}
@@ -1,17 +1,14 @@
 package controllers
 
 import (
-	"fmt"
-
 	"github.com/cihub/seelog"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/feeds"
 	"gingorm/helpers"
-	"gingorm/models"
 	"gingorm/system"
 )
 
-func RssGet(c *gin.Context) {
+func (ctl *Controller) RssGet(c *gin.Context) {
 	//获取当前时间
 	now := helpers.GetCurrentTime()
 	//初始化没有赋值，默认为“”
@@ -25,19 +22,20 @@ func RssGet(c *gin.Context) {
 	}
 
 	feed.Items = make([]*feeds.Item, 0)
-	posts, err := models.ListPublishedPost("", 0, 0)
+	posts, err := ctl.store.Posts().ListPublished(0, 0, 0)
 	if err != nil {
 		seelog.Error(err)
 		return
 	}
 
 	for _, post := range posts {
+		link := absoluteURL(ctl.permalinks.Post(post))
 		item := &feeds.Item{
-			Id:          fmt.Sprintf("%s/post/%d", domain, post.ID),
+			Id:          link,
 			Title:       post.Title,
-			Link:        &feeds.Link{Href: fmt.Sprintf("%s/post/%d", domain, post.ID)},
+			Link:        &feeds.Link{Href: link},
 			Description: string(post.Excerpt()),
-			Created:     now,
+			Created:     post.Date(),
 		}
 		feed.Items = append(feed.Items, item)
 	}
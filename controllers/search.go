@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gingorm/models"
+	"gingorm/search"
+	"gingorm/system"
+	"github.com/cihub/seelog"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SEARCH_SNIPPET_SIZE   = 120 //搜索结果摘要的字数
+	SEARCH_MAX_QUERY_SIZE = 100 //超过的部分忽略
+)
+
+// 搜索结果，文章和页面共用
+type searchResult struct {
+	Kind    string        `json:"kind"`
+	ID      uint          `json:"id"`
+	Title   string        `json:"title"`
+	URL     string        `json:"url"`
+	Snippet template.HTML `json:"snippet"`
+	Tags    []*apiTag     `json:"tags,omitempty"`
+	Date    time.Time     `json:"date"`
+	Score   float64       `json:"score"`
+}
+
+func postDocument(post *models.Post, tags []*models.Tag) *search.Document {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	return &search.Document{
+		Kind:  models.SLUG_KIND_POST,
+		ID:    post.ID,
+		Title: post.Title,
+		Body:  models.PlainText(post.Body),
+		Tags:  names,
+	}
+}
+
+func pageDocument(page *models.Page) *search.Document {
+	return &search.Document{
+		Kind:  models.SLUG_KIND_PAGE,
+		ID:    page.ID,
+		Title: page.Title,
+		Body:  models.PlainText(page.Body),
+	}
+}
+
+// 重建搜索索引，只在启动时执行，之后由各修改路径调用indexPost和indexPage增量更新
+func (ctl *Controller) RebuildSearchIndex() {
+	docs := make([]*search.Document, 0)
+	posts, err := ctl.store.Posts().ListPublished(0, 0, 0)
+	if err != nil {
+		seelog.Error(err)
+		return
+	}
+	for _, post := range posts {
+		tags, err := ctl.store.Tags().ListByPostId(post.ID)
+		if err != nil {
+			seelog.Error(err)
+			return
+		}
+		docs = append(docs, postDocument(post, tags))
+	}
+	pages, err := ctl.store.Pages().List(true)
+	if err != nil {
+		seelog.Error(err)
+		return
+	}
+	for _, page := range pages {
+		docs = append(docs, pageDocument(page))
+	}
+	ctl.searchIndex.Reset(docs)
+}
+
+// 文章保存后更新索引，只索引前台可见的文章，删除或取消发布后从索引中移除
+func (ctl *Controller) indexPost(id uint) {
+	post, err := ctl.store.Posts().Get(id)
+	if err != nil || !post.IsVisible() {
+		ctl.searchIndex.Remove(models.SLUG_KIND_POST, id)
+		return
+	}
+	tags, err := ctl.store.Tags().ListByPostId(post.ID)
+	if err != nil {
+		seelog.Error(err)
+		return
+	}
+	ctl.searchIndex.Add(postDocument(post, tags))
+}
+
+func (ctl *Controller) indexPage(id uint) {
+	page, err := ctl.store.Pages().Get(id)
+	if err != nil || !page.IsVisible() {
+		ctl.searchIndex.Remove(models.SLUG_KIND_PAGE, id)
+		return
+	}
+	ctl.searchIndex.Add(pageDocument(page))
+}
+
+// 重新索引使用该标签的文章，标签改名或删除前后调用
+func (ctl *Controller) indexTagPosts(posts []*models.Post) {
+	for _, post := range posts {
+		ctl.indexPost(post.ID)
+	}
+}
+
+func searchQuery(c *gin.Context) string {
+	q := []rune(strings.TrimSpace(c.Query("q")))
+	if len(q) > SEARCH_MAX_QUERY_SIZE {
+		q = q[:SEARCH_MAX_QUERY_SIZE]
+	}
+	return string(q)
+}
+
+// 加载命中的文章和页面，索引过期导致不存在或不可见的结果跳过
+func (ctl *Controller) searchResults(hits []search.Hit, q string) []*searchResult {
+	results := make([]*searchResult, 0, len(hits))
+	for _, hit := range hits {
+		result := &searchResult{Kind: hit.Kind, ID: hit.ID, Score: hit.Score}
+		switch hit.Kind {
+		case models.SLUG_KIND_POST:
+			post, err := ctl.store.Posts().Get(hit.ID)
+			if err != nil || !post.IsVisible() {
+				continue
+			}
+			result.Title, result.URL, result.Date = post.Title, ctl.permalinks.Post(post), post.Date()
+			result.Snippet = search.Highlight(models.PlainText(post.Body), q, SEARCH_SNIPPET_SIZE)
+			tags, _ := ctl.store.Tags().ListByPostId(post.ID)
+			for _, tag := range tags {
+				result.Tags = append(result.Tags, newAPITag(tag))
+			}
+		case models.SLUG_KIND_PAGE:
+			page, err := ctl.store.Pages().Get(hit.ID)
+			if err != nil || !page.IsVisible() {
+				continue
+			}
+			result.Title, result.URL, result.Date = page.Title, ctl.permalinks.Page(page), page.Date()
+			result.Snippet = search.Highlight(models.PlainText(page.Body), q, SEARCH_SNIPPET_SIZE)
+		default:
+			continue
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// 搜索已发布的文章和页面，按标题、标签和正文的相关度排序
+func (ctl *Controller) SearchGet(c *gin.Context) {
+	var (
+		q         = searchQuery(c)
+		pageSize  = system.GetConfiguration().PageSize
+		pageIndex int
+		hits      []search.Hit
+	)
+	pageIndex, _ = strconv.Atoi(c.Query("page"))
+	if pageIndex <= 0 {
+		pageIndex = 1
+	}
+	if q != "" {
+		hits = ctl.searchIndex.Search(q)
+	}
+	start := (pageIndex - 1) * pageSize
+	if start > len(hits) {
+		start = len(hits)
+	}
+	end := start + pageSize
+	if end > len(hits) {
+		end = len(hits)
+	}
+	c.HTML(http.StatusOK, "index/search.html", gin.H{
+		"q":         q,
+		"results":   ctl.searchResults(hits[start:end], q),
+		"total":     len(hits),
+		"pageIndex": pageIndex,
+		"totalPage": int(math.Ceil(float64(len(hits)) / float64(pageSize))),
+	})
+}
+
+// 搜索接口，分页参数同/api/v1
+func (ctl *Controller) SearchJSON(c *gin.Context) {
+	q := searchQuery(c)
+	if q == "" {
+		APIError(c, http.StatusBadRequest, "q is required")
+		return
+	}
+	hits := ctl.searchIndex.Search(q)
+	start, end, meta, ok := apiPaginate(c, len(hits))
+	if !ok {
+		return
+	}
+	apiList(c, ctl.searchResults(hits[start:end], q), meta)
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gingorm/models"
+)
+
+// 搜索索引中指定类型的结果
+func searchHits(ctl *Controller, kind, q string) []uint {
+	ids := make([]uint, 0)
+	for _, hit := range ctl.searchIndex.Search(q) {
+		if hit.Kind == kind {
+			ids = append(ids, hit.ID)
+		}
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	published := time.Now().Add(-time.Hour)
+	posts := []*models.Post{
+		{Title: "Gin 中间件", Slug: "gin", Body: "编写**中间件**", IsPublished: true, PublishAt: &published},
+		{Title: "Notes", Slug: "notes", Body: "using gin with gorm", IsPublished: true, PublishAt: &published},
+		{Title: "Draft gin", Slug: "draft", Body: "unpublished"},
+	}
+	for _, post := range posts {
+		if err := store.Posts().Create(post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page := &models.Page{Title: "About", Slug: "about", Body: "我用gin写博客", IsPublished: true, PublishAt: &published}
+	if err := store.Pages().Create(page); err != nil {
+		t.Fatal(err)
+	}
+	ctl.RebuildSearchIndex()
+	if n := ctl.searchIndex.Len(); n != 3 {
+		t.Fatalf("indexed %d documents, want 3", n)
+	}
+
+	r := newTestRouter(nil)
+	r.GET("/search.json", ctl.SearchJSON)
+	code, res := apiRequest(t, r, http.MethodGet, "/search.json?q=gin", "")
+	if code != http.StatusOK {
+		t.Fatalf("search: %d %v", code, res)
+	}
+	results := res["data"].([]interface{})
+	if len(results) != 3 {
+		t.Fatalf("results = %v", results)
+	}
+	first := results[0].(map[string]interface{})
+	if first["url"] != "/post/gin" || first["kind"] != models.SLUG_KIND_POST {
+		t.Errorf("first result = %v", first)
+	}
+	//摘要为去掉markdown标记的纯文本
+	_, res = apiRequest(t, r, http.MethodGet, "/search.json?q="+"中间件", "")
+	results = res["data"].([]interface{})
+	if len(results) != 1 || results[0].(map[string]interface{})["snippet"] != "编写<mark>中间件</mark>" {
+		t.Errorf("cjk results = %v", results)
+	}
+	if _, res = apiRequest(t, r, http.MethodGet, "/search.json?q=gin&per_page=1&page=2", ""); len(res["data"].([]interface{})) != 1 {
+		t.Errorf("page 2 = %v", res)
+	}
+	if code, _ = apiRequest(t, r, http.MethodGet, "/search.json?q=+", ""); code != http.StatusBadRequest {
+		t.Errorf("empty query: status = %d", code)
+	}
+
+	//取消发布后从索引中移除
+	posts[1].IsPublished, posts[1].PublishAt = false, nil
+	store.Posts().Update(posts[1])
+	ctl.indexPost(posts[1].ID)
+	if ids := searchHits(ctl, models.SLUG_KIND_POST, "gorm"); len(ids) != 0 {
+		t.Errorf("unpublished post still indexed: %v", ids)
+	}
+}
+
+// 标签改名后按新名称搜索
+func TestSearchTagRename(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	published := time.Now().Add(-time.Hour)
+	tag := &models.Tag{Name: "golang"}
+	if err := store.Tags().Create(tag); err != nil {
+		t.Fatal(err)
+	}
+	post := &models.Post{Title: "Hello", Slug: "hello", IsPublished: true, PublishAt: &published}
+	if err := store.Posts().Create(post); err != nil {
+		t.Fatal(err)
+	}
+	store.PostTags().Create(&models.PostTag{PostId: post.ID, TagId: tag.ID})
+	ctl.RebuildSearchIndex()
+	if ids := searchHits(ctl, models.SLUG_KIND_POST, "golang"); len(ids) != 1 {
+		t.Fatalf("hits = %v", ids)
+	}
+
+	r := newAPITestRouter(ctl, createTestUser(t, store, "editor", models.ROLE_EDITOR))
+	path := fmt.Sprintf("/tags/%d", tag.ID)
+	if code, res := apiRequest(t, r, http.MethodPut, path, `{"name": "rust"}`); code != http.StatusOK {
+		t.Fatalf("rename tag: %d %v", code, res)
+	}
+	if ids := searchHits(ctl, models.SLUG_KIND_POST, "rust"); len(ids) != 1 {
+		t.Errorf("hits for the new name = %v", ids)
+	}
+	if ids := searchHits(ctl, models.SLUG_KIND_POST, "golang"); len(ids) != 0 {
+		t.Errorf("hits for the old name = %v", ids)
+	}
+	apiRequest(t, r, http.MethodDelete, path, "")
+	if ids := searchHits(ctl, models.SLUG_KIND_POST, "rust"); len(ids) != 0 {
+		t.Errorf("hits for a deleted tag = %v", ids)
+	}
+}
+
+// 各修改路径直接更新搜索索引，不依赖重建
+func TestSearchIndexFollowsMutations(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	editor := createTestUser(t, store, "editor", models.ROLE_EDITOR)
+	r := newTestRouter(editor, "post/new.html", "page/new.html")
+	r.POST("/admin/new_post", ctl.PostCreate)
+	r.POST("/admin/post/:id/draft", ctl.PostDraftSave)
+	r.POST("/admin/post/:id/draft/publish", ctl.PostDraftPublish)
+	r.POST("/admin/post/:id/revisions/:rid/restore", ctl.PostRevisionRestore)
+	r.POST("/admin/post/:id/delete", ctl.PostDelete)
+	r.POST("/admin/new_page", ctl.PageCreate)
+	r.POST("/admin/page/:id/draft", ctl.PageDraftSave)
+	r.POST("/admin/page/:id/draft/publish", ctl.PageDraftPublish)
+	r.POST("/admin/page/:id/revisions/:rid/restore", ctl.PageRevisionRestore)
+	r.POST("/admin/page/:id/delete", ctl.PageDelete)
+
+	for _, kind := range []string{models.SLUG_KIND_POST, models.SLUG_KIND_PAGE} {
+		postForm(r, "/admin/new_"+kind, url.Values{"title": {"Fruit"}, "body": {"apple"}, "isPublished": {"on"}})
+		ids := searchHits(ctl, kind, "apple")
+		if len(ids) != 1 {
+			t.Fatalf("%s: created, hits = %v", kind, ids)
+		}
+		prefix := fmt.Sprintf("/admin/%s/%d", kind, ids[0])
+		expect := func(step, present, absent string) {
+			t.Helper()
+			if hits := searchHits(ctl, kind, present); len(hits) != 1 {
+				t.Errorf("%s: %s, hits for %q = %v", kind, step, present, hits)
+			}
+			if hits := searchHits(ctl, kind, absent); len(hits) != 0 {
+				t.Errorf("%s: %s, hits for %q = %v", kind, step, absent, hits)
+			}
+		}
+		mustSucceed := func(path string, form url.Values) {
+			t.Helper()
+			if body := postForm(r, path, form).Body.String(); !strings.Contains(body, `"succeed":true`) {
+				t.Fatalf("%s: %s", path, body)
+			}
+		}
+
+		mustSucceed(prefix+"/draft", url.Values{"title": {"Fruit"}, "body": {"banana"}})
+		mustSucceed(prefix+"/draft/publish", nil)
+		expect("draft published", "banana", "apple")
+
+		revisions, _ := store.Revisions().List(kind, ids[0])
+		first := revisions[len(revisions)-1]
+		mustSucceed(fmt.Sprintf("%s/revisions/%d/restore", prefix, first.ID), nil)
+		expect("revision restored", "apple", "banana")
+
+		mustSucceed(prefix+"/delete", nil)
+		if hits := searchHits(ctl, kind, "apple"); len(hits) != 0 {
+			t.Errorf("%s: deleted, hits = %v", kind, hits)
+		}
+	}
+
+	//定时任务发布到期的文章和页面
+	past := time.Now().Add(-time.Minute)
+	post := &models.Post{Title: "Scheduled", Body: "cherry", UserID: editor.ID, PublishAt: &past}
+	if err := store.Posts().Create(post); err != nil {
+		t.Fatal(err)
+	}
+	page := &models.Page{Title: "Scheduled", Body: "cherry", PublishAt: &past}
+	if err := store.Pages().Create(page); err != nil {
+		t.Fatal(err)
+	}
+	if hits := ctl.searchIndex.Search("cherry"); len(hits) != 0 {
+		t.Fatalf("scheduled hits = %v", hits)
+	}
+	ctl.PublishScheduled()
+	if hits := ctl.searchIndex.Search("cherry"); len(hits) != 2 {
+		t.Errorf("published scheduled hits = %v", hits)
+	}
+}
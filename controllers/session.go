@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"github.com/cihub/seelog"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	gsessions "github.com/gorilla/sessions"
+	"github.com/pkg/errors"
+)
+
+const (
+	SESSION_NAME = "gin-session" // session cookie name
+
+	// 最后访问时间的更新间隔，避免每个请求都写一次数据库
+	SESSION_TOUCH_INTERVAL = time.Minute
+)
+
+var errSessionExpired = errors.New("session expired")
+
+// 服务端session存储，实现gin-contrib/sessions的Store接口
+// cookie中只保存随机生成的session id，数据保存在SessionRepository中，删除记录即可使session失效
+type SessionStore struct {
+	repo            models.SessionRepository
+	options         *gsessions.Options
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+}
+
+func NewSessionStore(repo models.SessionRepository, idleTimeout, absoluteTimeout time.Duration) *SessionStore {
+	return &SessionStore{
+		repo:            repo,
+		options:         &gsessions.Options{Path: "/", MaxAge: int(absoluteTimeout.Seconds()), HttpOnly: true},
+		idleTimeout:     idleTimeout,
+		absoluteTimeout: absoluteTimeout,
+	}
+}
+
+func (s *SessionStore) Options(options sessions.Options) {
+	s.options = &gsessions.Options{
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   options.MaxAge,
+		Secure:   options.Secure,
+		HttpOnly: options.HttpOnly,
+	}
+}
+
+func (s *SessionStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+// 根据cookie中的session id加载session，不存在或已过期时返回新的空session
+func (s *SessionStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	options := *s.options
+	session.Options = &options
+	session.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	record, err := s.load(cookie.Value)
+	if err != nil {
+		return session, nil
+	}
+	if err = gob.NewDecoder(bytes.NewReader(record.Data)).Decode(&session.Values); err != nil {
+		seelog.Error(err)
+		return session, nil
+	}
+	session.ID = record.ID
+	session.IsNew = false
+	now := helpers.GetCurrentTime()
+	ip := requestIP(r)
+	if now.Sub(record.LastSeenAt) >= SESSION_TOUCH_INTERVAL || record.IP != ip {
+		record.LastSeenAt = now
+		record.IP = ip
+		if err = s.repo.Update(record); err != nil {
+			seelog.Error(err)
+		}
+	}
+	return session, nil
+}
+
+// 保存session数据，登录用户变化时(登录、退出)更换session id，防止session固定攻击
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.repo.Delete(session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session.Values); err != nil {
+		return err
+	}
+	userId, _ := session.Values[SESSION_KEY].(uint)
+	now := helpers.GetCurrentTime()
+	if session.ID != "" {
+		record, err := s.repo.Get(session.ID)
+		if err == nil && record.UserID == userId {
+			record.Data = buf.Bytes()
+			record.IP = requestIP(r)
+			record.LastSeenAt = now
+			return s.repo.Update(record)
+		}
+		if err == nil {
+			if err = s.repo.Delete(session.ID); err != nil {
+				return err
+			}
+		} else if userId != 0 {
+			//session在请求过程中被注销，不能再以该用户重新创建
+			return errSessionExpired
+		}
+	}
+	record := &models.Session{
+		ID:         newSessionId(),
+		UserID:     userId,
+		Data:       buf.Bytes(),
+		UserAgent:  r.UserAgent(),
+		IP:         requestIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.absoluteTimeout),
+	}
+	if err := s.repo.Create(record); err != nil {
+		return err
+	}
+	session.ID = record.ID
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), session.ID, session.Options))
+	return nil
+}
+
+func (s *SessionStore) load(id string) (*models.Session, error) {
+	record, err := s.repo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if s.isExpired(record, helpers.GetCurrentTime()) {
+		if err = s.repo.Delete(id); err != nil {
+			seelog.Error(err)
+		}
+		return nil, errSessionExpired
+	}
+	return record, nil
+}
+
+func (s *SessionStore) isExpired(record *models.Session, now time.Time) bool {
+	return !now.Before(record.ExpiresAt) || now.Sub(record.LastSeenAt) > s.idleTimeout
+}
+
+// 当前请求的session id，session尚未保存时为空
+func (s *SessionStore) CurrentID(c *gin.Context) string {
+	session, err := s.Get(c.Request, SESSION_NAME)
+	if err != nil {
+		return ""
+	}
+	return session.ID
+}
+
+// 用户所有未过期的session
+func (s *SessionStore) List(userId uint) ([]*models.Session, error) {
+	records, err := s.repo.ListByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+	now := helpers.GetCurrentTime()
+	result := make([]*models.Session, 0, len(records))
+	for _, record := range records {
+		if !s.isExpired(record, now) {
+			result = append(result, record)
+		}
+	}
+	return result, nil
+}
+
+// 注销用户的某个session
+func (s *SessionStore) Revoke(userId uint, id string) error {
+	record, err := s.repo.Get(id)
+	if err != nil || record.UserID != userId {
+		return models.ErrNotFound
+	}
+	return s.repo.Delete(id)
+}
+
+// 注销用户的所有session，exceptId不为空时保留该session
+func (s *SessionStore) RevokeAll(userId uint, exceptId string) error {
+	return s.repo.DeleteByUserId(userId, exceptId)
+}
+
+// 清理过期的session，由定时任务调用
+func (s *SessionStore) DeleteExpired() {
+	now := helpers.GetCurrentTime()
+	if err := s.repo.DeleteExpired(now.Add(-s.idleTimeout), now); err != nil {
+		seelog.Error(err)
+	}
+}
+
+func newSessionId() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("generate session id: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// 注销当前用户的某个session
+func (ctl *Controller) SessionRevoke(c *gin.Context) {
+	var (
+		err error
+		res = gin.H{}
+	)
+	defer writeJSON(c, res)
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		res["message"] = "server interval error"
+		return
+	}
+	err = ctl.sessions.Revoke(user.ID, c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+}
+
+// 退出所有设备，包括当前session
+func (ctl *Controller) SessionRevokeAll(c *gin.Context) {
+	var (
+		err error
+		res = gin.H{}
+	)
+	defer writeJSON(c, res)
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		res["message"] = "server interval error"
+		return
+	}
+	err = ctl.sessions.RevokeAll(user.ID, "")
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gingorm/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// 保存cookie的测试客户端
+type sessionClient struct {
+	router http.Handler
+	cookie *http.Cookie
+}
+
+func (sc *sessionClient) get(path string) string {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if sc.cookie != nil {
+		req.AddCookie(sc.cookie)
+	}
+	w := httptest.NewRecorder()
+	sc.router.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == SESSION_NAME {
+			sc.cookie = cookie
+		}
+	}
+	return w.Body.String()
+}
+
+func newSessionTestRouter(store *SessionStore) *gin.Engine {
+	r := gin.New()
+	r.Use(sessions.Sessions(SESSION_NAME, store))
+	r.GET("/signin/:id", func(c *gin.Context) {
+		id, _ := parseId(c.Param("id"))
+		s := sessions.Default(c)
+		s.Set(SESSION_KEY, id)
+		s.Save()
+	})
+	r.GET("/whoami", func(c *gin.Context) {
+		id, _ := sessions.Default(c).Get(SESSION_KEY).(uint)
+		c.String(http.StatusOK, fmt.Sprint(id))
+	})
+	return r
+}
+
+func TestSessionStoreTimeouts(t *testing.T) {
+	repo := models.NewMemoryStore().Sessions()
+	store := NewSessionStore(repo, time.Hour, 24*time.Hour)
+	client := &sessionClient{router: newSessionTestRouter(store)}
+
+	client.get("/signin/1")
+	if id := client.get("/whoami"); id != "1" {
+		t.Fatalf("whoami = %s, want 1", id)
+	}
+	record, err := repo.Get(client.cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//空闲超时
+	record.LastSeenAt = time.Now().Add(-2 * time.Hour)
+	repo.Update(record)
+	if id := client.get("/whoami"); id != "0" {
+		t.Errorf("idle session still signed in as %s", id)
+	}
+	if _, err = repo.Get(record.ID); err != models.ErrNotFound {
+		t.Errorf("idle session not deleted: %v", err)
+	}
+
+	//绝对过期时间，即使一直在访问
+	client = &sessionClient{router: newSessionTestRouter(NewSessionStore(repo, time.Hour, time.Nanosecond))}
+	client.get("/signin/1")
+	if id := client.get("/whoami"); id != "0" {
+		t.Errorf("expired session still signed in as %s", id)
+	}
+}
+
+func TestSessionRotateAndRevoke(t *testing.T) {
+	repo := models.NewMemoryStore().Sessions()
+	store := NewSessionStore(repo, time.Hour, 24*time.Hour)
+	router := newSessionTestRouter(store)
+
+	//登录后更换session id，防止session固定攻击
+	client := &sessionClient{router: router}
+	client.get("/whoami")
+	client.get("/signin/1")
+	anonymous := client.cookie.Value
+	client.get("/signin/2")
+	if client.cookie.Value == anonymous {
+		t.Error("session id not rotated after the signed in user changed")
+	}
+	if _, err := repo.Get(anonymous); err != models.ErrNotFound {
+		t.Errorf("old session kept: %v", err)
+	}
+
+	other := &sessionClient{router: router}
+	other.get("/signin/2")
+	list, err := store.List(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("got %d sessions, want 2", len(list))
+	}
+	//不能注销其他用户的session
+	if err = store.Revoke(1, other.cookie.Value); err != models.ErrNotFound {
+		t.Errorf("revoked another user's session: %v", err)
+	}
+	if err = store.Revoke(2, other.cookie.Value); err != nil {
+		t.Fatal(err)
+	}
+	if id := other.get("/whoami"); id != "0" {
+		t.Errorf("revoked session still signed in as %s", id)
+	}
+	if id := client.get("/whoami"); id != "2" {
+		t.Errorf("whoami = %s, want 2", id)
+	}
+	if err = store.RevokeAll(2, ""); err != nil {
+		t.Fatal(err)
+	}
+	if id := client.get("/whoami"); id != "0" {
+		t.Errorf("session still signed in as %s after revoking all", id)
+	}
+}
+
+func TestUserLockRevokesSessions(t *testing.T) {
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	owner := createTestUser(t, store, "owner", models.ROLE_OWNER)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	client := &sessionClient{router: newSessionTestRouter(ctl.sessions)}
+	client.get(fmt.Sprintf("/signin/%d", user.ID))
+
+	r := newTestRouter(owner)
+	r.POST("/admin/user/:id/lock", ctl.UserLock)
+	postForm(r, fmt.Sprintf("/admin/user/%d/lock", user.ID), nil)
+	if saved, _ := store.Users().Get(user.ID); !saved.LockState {
+		t.Fatal("user not locked")
+	}
+	if list, _ := ctl.sessions.List(user.ID); len(list) != 0 {
+		t.Errorf("locked user still has %d sessions", len(list))
+	}
+}
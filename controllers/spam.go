@@ -0,0 +1,8 @@
+package controllers
+
+import "gingorm/models"
+
+// 垃圾评论检查接口，返回非空的reason表示是垃圾评论，通过NewController注入
+type SpamChecker interface {
+	Check(comment *models.Comment) (reason string, err error)
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gingorm/models"
+	"gingorm/system"
+)
+
+var spamLinkRegexp = regexp.MustCompile(`(?i)https?://|www\.`)
+
+// 根据链接数、屏蔽词、重复内容和评论频率判断垃圾评论，规则见配置文件中的spam
+type HeuristicSpamChecker struct {
+	comments models.CommentRepository
+}
+
+func NewHeuristicSpamChecker(comments models.CommentRepository) HeuristicSpamChecker {
+	return HeuristicSpamChecker{comments: comments}
+}
+
+func (h HeuristicSpamChecker) Check(comment *models.Comment) (string, error) {
+	conf := system.GetConfiguration().Spam
+	links := len(spamLinkRegexp.FindAllStringIndex(comment.Content, -1))
+	if conf.MaxLinks >= 0 && links > conf.MaxLinks {
+		return fmt.Sprintf("too many links: %d", links), nil
+	}
+	content := strings.ToLower(comment.Content)
+	for _, word := range conf.Blocklist {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" && strings.Contains(content, word) {
+			return fmt.Sprintf("blocked word: %s", word), nil
+		}
+	}
+	now := time.Now()
+	since := now.Add(-conf.DuplicateWindow)
+	if conf.RateLimit > 0 && now.Add(-conf.RateWindow).Before(since) {
+		since = now.Add(-conf.RateWindow)
+	}
+	recent, err := h.comments.ListSince(since)
+	if err != nil {
+		return "", err
+	}
+	normalized := normalizeSpamContent(comment.Content)
+	count := 0
+	for _, item := range recent {
+		if item.ID == comment.ID {
+			continue
+		}
+		//同一用户重复发表，或者不同用户发表相同的带链接内容
+		if (item.SameAuthor(comment) || links > 0) && !item.CreatedAt.Before(now.Add(-conf.DuplicateWindow)) &&
+			normalizeSpamContent(item.Content) == normalized {
+			return "duplicate content", nil
+		}
+		if item.SameAuthor(comment) && !item.CreatedAt.Before(now.Add(-conf.RateWindow)) {
+			count++
+		}
+	}
+	if conf.RateLimit > 0 && count >= conf.RateLimit {
+		return fmt.Sprintf("too many comments: %d in %s", count, conf.RateWindow), nil
+	}
+	return "", nil
+}
+
+// 忽略大小写和空白的差异
+func normalizeSpamContent(content string) string {
+	return strings.Join(strings.Fields(strings.ToLower(content)), " ")
+}
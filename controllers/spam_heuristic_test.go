@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gingorm/models"
+)
+
+func TestHeuristicSpamChecker(t *testing.T) {
+	loadTestConfig(t, "spam:\n  max_links: 1\n  blocklist: [Casino, ' ']\n  rate_limit: 2\n")
+	store := models.NewMemoryStore()
+	checker := NewHeuristicSpamChecker(store.Comments())
+	check := func(userId uint, content string) string {
+		reason, err := checker.Check(&models.Comment{UserID: userId, Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reason
+	}
+	save := func(userId uint, content string) {
+		if err := store.Comments().Create(&models.Comment{UserID: userId, Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if reason := check(1, "see http://a.test"); reason != "" {
+		t.Errorf("one link: %q", reason)
+	}
+	if reason := check(1, "see http://a.test and www.b.test"); !strings.HasPrefix(reason, "too many links") {
+		t.Errorf("two links: %q", reason)
+	}
+	//屏蔽词不区分大小写，空白的屏蔽词被忽略
+	if reason := check(1, "best CASINO online"); reason != "blocked word: casino" {
+		t.Errorf("blocked word: %q", reason)
+	}
+	if reason := check(1, "hello world"); reason != "" {
+		t.Errorf("plain comment: %q", reason)
+	}
+
+	//同一用户的重复内容忽略大小写和空白
+	save(1, "Hello   World")
+	if reason := check(1, "hello world"); reason != "duplicate content" {
+		t.Errorf("duplicate: %q", reason)
+	}
+	//不同用户只有带链接的相同内容是垃圾评论
+	if reason := check(2, "hello world"); reason != "" {
+		t.Errorf("same content by another user: %q", reason)
+	}
+	save(1, "see http://a.test")
+	if reason := check(2, "see http://a.test"); reason != "duplicate content" {
+		t.Errorf("duplicate link: %q", reason)
+	}
+
+	//同一用户rate_window内评论数达到rate_limit
+	if reason := check(1, "third"); reason != "too many comments: 2 in "+(10*time.Minute).String() {
+		t.Errorf("rate limit: %q", reason)
+	}
+	if reason := check(2, "third"); reason != "" {
+		t.Errorf("another user: %q", reason)
+	}
+}
+
+func TestHeuristicSpamCheckerDisabled(t *testing.T) {
+	loadTestConfig(t, "spam:\n  max_links: -1\n  rate_limit: -1\n  duplicate_window: 1ns\n")
+	store := models.NewMemoryStore()
+	checker := NewHeuristicSpamChecker(store.Comments())
+	for i := 0; i < 3; i++ {
+		if err := store.Comments().Create(&models.Comment{UserID: 1, Content: "http://a.test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(time.Millisecond)
+	reason, err := checker.Check(&models.Comment{UserID: 1, Content: "http://a.test http://b.test http://c.test"})
+	if err != nil || reason != "" {
+		t.Errorf("check = %q, %v", reason, err)
+	}
+}
@@ -14,25 +14,27 @@ import (
 )
 
 //获取订阅者信息
-func SubscribeGet(c *gin.Context) {
-	count, _ := models.CountSubscriber()
+func (ctl *Controller) SubscribeGet(c *gin.Context) {
+	count, _ := ctl.store.Subscribers().Count()
 	c.HTML(http.StatusOK, "other/subscribe.html", gin.H{
+		"csrf":  csrfToken(c),
 		"total": count,
 	})
 }
 
-func Subscribe(c *gin.Context) {
+func (ctl *Controller) Subscribe(c *gin.Context) {
 	mail := c.PostForm("mail")
 	var err error
 	if len(mail) > 0 {
 		var subscriber *models.Subscriber
-		subscriber, err = models.GetSubscriberByEmail(mail)
+		subscriber, err = ctl.store.Subscribers().GetByEmail(mail)
 		if err == nil {
 			if !subscriber.VerifyState && helpers.GetCurrentTime().After(subscriber.OutTime) { //激活链接超时
-				err = sendActiveEmail(subscriber)
+				err = ctl.sendActiveEmail(subscriber)
 				if err == nil {
-					count, _ := models.CountSubscriber()
+					count, _ := ctl.store.Subscribers().Count()
 					c.HTML(http.StatusOK, "other/subscribe.html", gin.H{
+						"csrf":    csrfToken(c),
 						"message": "subscribe succeed.",
 						"total":   count,
 					})
@@ -40,7 +42,7 @@ func Subscribe(c *gin.Context) {
 				}
 			} else if subscriber.VerifyState && !subscriber.SubscribeState { //已认证，未订阅
 				subscriber.SubscribeState = true
-				err = subscriber.Update()
+				err = ctl.store.Subscribers().Update(subscriber)
 				if err == nil {
 					err = errors.New("subscribe succeed.")
 				}
@@ -51,12 +53,13 @@ func Subscribe(c *gin.Context) {
 			subscriber := &models.Subscriber{
 				Email: mail,
 			}
-			err = subscriber.Insert()
+			err = ctl.store.Subscribers().Create(subscriber)
 			if err == nil {
-				err = sendActiveEmail(subscriber)
+				err = ctl.sendActiveEmail(subscriber)
 				if err == nil {
-					count, _ := models.CountSubscriber()
+					count, _ := ctl.store.Subscribers().Count()
 					c.HTML(http.StatusOK, "other/subscribe.html", gin.H{
+						"csrf":    csrfToken(c),
 						"message": "subscribe succeed.",
 						"total":   count,
 					})
@@ -67,14 +70,15 @@ func Subscribe(c *gin.Context) {
 	} else {
 		err = errors.New("empty mail address.")
 	}
-	count, _ := models.CountSubscriber()
+	count, _ := ctl.store.Subscribers().Count()
 	c.HTML(http.StatusOK, "other/subscribe.html", gin.H{
+		"csrf":    csrfToken(c),
 		"message": err.Error(),
 		"total":   count,
 	})
 }
 
-func sendActiveEmail(subscriber *models.Subscriber) (err error) {
+func (ctl *Controller) sendActiveEmail(subscriber *models.Subscriber) (err error) {
 	uuid := helpers.UUID()
 	duration, _ := time.ParseDuration("30m")
 	subscriber.OutTime = helpers.GetCurrentTime().Add(duration)
@@ -85,11 +89,11 @@ func sendActiveEmail(subscriber *models.Subscriber) (err error) {
 	if err != nil {
 		return
 	}
-	err = subscriber.Update()
+	err = ctl.store.Subscribers().Update(subscriber)
 	return
 }
 
-func ActiveSubscriber(c *gin.Context) {
+func (ctl *Controller) ActiveSubscriber(c *gin.Context) {
 	var (
 		err        error
 		subscriber *models.Subscriber
@@ -99,7 +103,7 @@ func ActiveSubscriber(c *gin.Context) {
 		HandleMessage(c, "激活链接有误，请重新获取！")
 		return
 	}
-	subscriber, err = models.GetSubscriberBySignature(sid)
+	subscriber, err = ctl.store.Subscribers().GetBySignature(sid)
 	if err != nil {
 		HandleMessage(c, "激活链接有误，请重新获取！")
 		return
@@ -110,7 +114,7 @@ func ActiveSubscriber(c *gin.Context) {
 	}
 	subscriber.VerifyState = true
 	subscriber.OutTime = helpers.GetCurrentTime()
-	err = subscriber.Update()
+	err = ctl.store.Subscribers().Update(subscriber)
 	if err != nil {
 		HandleMessage(c, fmt.Sprintf("激活失败！%s", err.Error()))
 		return
@@ -118,19 +122,19 @@ func ActiveSubscriber(c *gin.Context) {
 	HandleMessage(c, "激活成功！")
 }
 
-func UnSubscribe(c *gin.Context) {
+func (ctl *Controller) UnSubscribe(c *gin.Context) {
 	sid := c.Query("sid")
 	if sid == "" {
 		HandleMessage(c, "Internal Server Error!")
 		return
 	}
-	subscriber, err := models.GetSubscriberBySignature(sid)
+	subscriber, err := ctl.store.Subscribers().GetBySignature(sid)
 	if err != nil || !subscriber.VerifyState || !subscriber.SubscribeState {
 		HandleMessage(c, "Unscribe failed.")
 		return
 	}
 	subscriber.SubscribeState = false
-	err = subscriber.Update()
+	err = ctl.store.Subscribers().Update(subscriber)
 	if err == nil {
 		HandleMessage(c, fmt.Sprintf("Unscribe failed.%s", err.Error()))
 		return
@@ -138,21 +142,21 @@ func UnSubscribe(c *gin.Context) {
 	HandleMessage(c, "Unscribe Succeessful!")
 }
 
-func GetUnSubcribeUrl(subscriber *models.Subscriber) (string, error) {
+func (ctl *Controller) GetUnSubcribeUrl(subscriber *models.Subscriber) (string, error) {
 	uuid := helpers.UUID()
 	signature := helpers.Md5(subscriber.Email + uuid)
 	subscriber.SecretKey = uuid
 	subscriber.Signature = signature
-	err := subscriber.Update()
+	err := ctl.store.Subscribers().Update(subscriber)
 	return fmt.Sprintf("%s/unsubscribe?sid=%s", system.GetConfiguration().Domain, signature), err
 }
 
-func sendEmailToSubscribers(subject, body string) (err error) {
+func (ctl *Controller) sendEmailToSubscribers(subject, body string) (err error) {
 	var (
 		subscribers []*models.Subscriber
 		emails      = make([]string, 0)
 	)
-	subscribers, err = models.ListSubscriber(true)
+	subscribers, err = ctl.store.Subscribers().List(true)
 	if err != nil {
 		return
 	}
@@ -167,18 +171,19 @@ func sendEmailToSubscribers(subject, body string) (err error) {
 	return
 }
 
-func SubscriberIndex(c *gin.Context) {
-	subscribers, _ := models.ListSubscriber(false)
+func (ctl *Controller) SubscriberIndex(c *gin.Context) {
+	subscribers, _ := ctl.store.Subscribers().List(false)
 	user, _ := c.Get(CONTEXT_USER_KEY)
 	c.HTML(http.StatusOK, "admin/subscriber.html", gin.H{
+		"csrf":        csrfToken(c),
 		"subscribers": subscribers,
 		"user":        user,
-		"comments":    models.MustListUnreadComment(),
+		"comments":    ctl.mustListUnreadComment(),
 	})
 }
 
 // 邮箱为空时，发送给所有订阅者
-func SubscriberPost(c *gin.Context) {
+func (ctl *Controller) SubscriberPost(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -190,7 +195,7 @@ func SubscriberPost(c *gin.Context) {
 	if len(mail) > 0 {
 		err = sendMail(mail, subject, body)
 	} else {
-		err = sendEmailToSubscribers(subject, body)
+		err = ctl.sendEmailToSubscribers(subject, body)
 	}
 	if err != nil {
 		res["message"] = err.Error()
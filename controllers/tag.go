@@ -15,7 +15,7 @@ import (
 
 
 //创建标签
-func TagCreate(c *gin.Context) {
+func (ctl *Controller) TagCreate(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -23,7 +23,7 @@ func TagCreate(c *gin.Context) {
 	defer writeJSON(c, res)
 	name := c.PostForm("value")
 	tag := &models.Tag{Name: name}
-	err = tag.Insert()
+	err = ctl.store.Tags().Create(tag)
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -33,9 +33,10 @@ func TagCreate(c *gin.Context) {
 }
 
 //获取tag标签
-func TagGet(c *gin.Context) {
+func (ctl *Controller) TagGet(c *gin.Context) {
 	var (
 		tagName   string
+		tagId     uint
 		page      string
 		pageIndex int
 		pageSize  = system.GetConfiguration().PageSize
@@ -45,34 +46,39 @@ func TagGet(c *gin.Context) {
 		posts     []*models.Post
 	)
 	tagName = c.Param("tag")
+	tagId, err = parseId(tagName)
+	if err != nil {
+		Handle404(c)
+		return
+	}
 	page = c.Query("page")
 	pageIndex, _ = strconv.Atoi(page)
 	if pageIndex <= 0 {
 		pageIndex = 1
 	}
-	posts, err = models.ListPublishedPost(tagName, pageIndex, pageSize)
+	posts, err = ctl.store.Posts().ListPublished(tagId, pageIndex, pageSize)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
-	total, err = models.CountPostByTag(tagName)
+	total, err = ctl.store.Posts().CountByTag(tagId)
 	if err != nil {
 		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 	policy = bluemonday.StrictPolicy()
 	for _, post := range posts {
-		post.Tags, _ = models.ListTagByPostId(strconv.FormatUint(uint64(post.ID), 10))
+		post.Tags, _ = ctl.store.Tags().ListByPostId(post.ID)
 		post.Body = policy.Sanitize(string(blackfriday.Run([]byte(post.Body))))
 	}
 	c.HTML(http.StatusOK, "index/index.html", gin.H{
 		"posts":           posts,
-		"tags":            models.MustListTag(),
-		"archives":        models.MustListPostArchives(),
-		"links":           models.MustListLinks(),
+		"tags":            ctl.mustListTag(),
+		"archives":        ctl.mustListPostArchives(),
+		"links":           ctl.mustListLinks(),
 		"pageIndex":       pageIndex,
 		"totalPage":       int(math.Ceil(float64(total) / float64(pageSize))),
-		"maxReadPosts":    models.MustListMaxReadPost(),
-		"maxCommentPosts": models.MustListMaxCommentPost(),
+		"maxReadPosts":    ctl.mustListMaxReadPost(),
+		"maxCommentPosts": ctl.mustListMaxCommentPost(),
 	})
 }
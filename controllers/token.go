@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ACCESS_TOKEN_PREFIX     = "wblog_" // 令牌前缀，便于在日志和代码中识别泄露的令牌
+	ACCESS_TOKEN_SHOW_SIZE  = 12       // 列表中展示的令牌长度
+	ACCESS_TOKEN_TOUCH_TIME = time.Minute
+)
+
+// 生成个人访问令牌，明文只在创建时返回一次
+func newAccessToken() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return ACCESS_TOKEN_PREFIX + hex.EncodeToString(b), nil
+}
+
+func HashAccessToken(token string) string {
+	return helpers.Sha256(token)
+}
+
+// 校验令牌，返回令牌和所属用户，并更新最后使用时间
+func AuthenticateToken(store models.Store, raw string) (*models.AccessToken, *models.User, error) {
+	if !strings.HasPrefix(raw, ACCESS_TOKEN_PREFIX) {
+		return nil, nil, models.ErrNotFound
+	}
+	token, err := store.AccessTokens().GetByHash(HashAccessToken(raw))
+	if err != nil {
+		return nil, nil, err
+	}
+	if token.IsExpired() {
+		return nil, nil, models.ErrNotFound
+	}
+	user, err := store.Users().Get(token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	//每分钟最多更新一次，避免每个请求都写库
+	now := helpers.GetCurrentTime()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= ACCESS_TOKEN_TOUCH_TIME {
+		token.LastUsedAt = &now
+		store.AccessTokens().UpdateLastUsed(token)
+	}
+	return token, user, nil
+}
+
+// 当前请求的令牌是否包含该权限范围，且用户角色仍拥有对应权限
+func TokenAllows(c *gin.Context, scope models.Scope) bool {
+	token, _ := c.Get(CONTEXT_TOKEN_KEY)
+	t, ok := token.(*models.AccessToken)
+	user := apiUser(c)
+	return ok && user != nil && t.HasScope(scope) && user.CanUseScope(scope)
+}
+
+// 创建个人访问令牌，只能授予自己角色拥有的权限范围，expires为有效天数，0表示永不过期
+func (ctl *Controller) TokenCreate(c *gin.Context) {
+	res := gin.H{}
+	defer writeJSON(c, res)
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		res["message"] = "server interval error"
+		return
+	}
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		res["message"] = "token name cannot be empty"
+		return
+	}
+	scopes := c.PostFormArray("scopes")
+	if len(scopes) == 0 {
+		res["message"] = "please select at least one scope"
+		return
+	}
+	for _, scope := range scopes {
+		if !user.CanUseScope(models.Scope(scope)) {
+			res["message"] = "invalid scope " + scope
+			return
+		}
+	}
+	days, err := strconv.Atoi(c.DefaultPostForm("expires", "0"))
+	if err != nil || days < 0 {
+		res["message"] = "invalid expiration"
+		return
+	}
+	raw, err := newAccessToken()
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	token := &models.AccessToken{
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: HashAccessToken(raw),
+		Prefix:    raw[:ACCESS_TOKEN_SHOW_SIZE],
+		Scopes:    strings.Join(scopes, ","),
+	}
+	if days > 0 {
+		expires := helpers.GetCurrentTime().AddDate(0, 0, days)
+		token.ExpiresAt = &expires
+	}
+	if err = ctl.store.AccessTokens().Create(token); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["token"] = raw
+	res["succeed"] = true
+}
+
+// 撤销个人访问令牌，只能撤销自己的令牌
+func (ctl *Controller) TokenRevoke(c *gin.Context) {
+	res := gin.H{}
+	defer writeJSON(c, res)
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		res["message"] = "server interval error"
+		return
+	}
+	id, err := parseId(c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	if err = ctl.store.AccessTokens().Delete(user.ID, id); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+}
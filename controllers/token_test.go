@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gingorm/models"
+)
+
+// 为用户创建令牌，返回令牌明文
+func createTestToken(t *testing.T, store models.Store, user *models.User, scopes ...models.Scope) string {
+	t.Helper()
+	raw, err := newAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		list = append(list, string(scope))
+	}
+	token := &models.AccessToken{
+		UserID:    user.ID,
+		Name:      "test",
+		TokenHash: HashAccessToken(raw),
+		Prefix:    raw[:ACCESS_TOKEN_SHOW_SIZE],
+		Scopes:    strings.Join(list, ","),
+	}
+	if err = store.AccessTokens().Create(token); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	store := models.NewMemoryStore()
+	user := createTestUser(t, store, "author", models.ROLE_AUTHOR)
+	raw := createTestToken(t, store, user, models.SCOPE_POSTS_READ)
+
+	token, u, err := AuthenticateToken(store, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != user.ID || !token.HasScope(models.SCOPE_POSTS_READ) {
+		t.Errorf("token = %+v, user = %+v", token, u)
+	}
+	//记录最后使用时间
+	stored, _ := store.AccessTokens().GetByHash(HashAccessToken(raw))
+	if stored.LastUsedAt == nil {
+		t.Error("last used time not recorded")
+	}
+
+	if _, _, err = AuthenticateToken(store, strings.TrimPrefix(raw, ACCESS_TOKEN_PREFIX)); err == nil {
+		t.Error("token without prefix accepted")
+	}
+	if _, _, err = AuthenticateToken(store, raw+"0"); err == nil {
+		t.Error("unknown token accepted")
+	}
+
+	//过期的令牌无效
+	expired := time.Now().Add(-time.Minute)
+	raw, _ = newAccessToken()
+	if err = store.AccessTokens().Create(&models.AccessToken{UserID: user.ID, TokenHash: HashAccessToken(raw), ExpiresAt: &expired}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = AuthenticateToken(store, raw); err == nil {
+		t.Error("expired token accepted")
+	}
+}
+
+func TestTokenCreateRevoke(t *testing.T) {
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	author := createTestUser(t, store, "author", models.ROLE_AUTHOR)
+	r := newTestRouter(author)
+	r.POST("/profile/tokens", ctl.TokenCreate)
+	r.POST("/profile/token/:id/revoke", ctl.TokenRevoke)
+
+	create := func(form url.Values) map[string]interface{} {
+		res := map[string]interface{}{}
+		w := postForm(r, "/profile/tokens", form)
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: %v", w.Body.String(), err)
+		}
+		return res
+	}
+	//作者不能授予自己角色没有的权限范围
+	if res := create(url.Values{"name": {"deploy"}, "scopes": {"pages:write"}}); res["succeed"] == true {
+		t.Error("author granted the pages:write scope")
+	}
+	if res := create(url.Values{"name": {"deploy"}}); res["succeed"] == true {
+		t.Error("token created without scopes")
+	}
+	if res := create(url.Values{"name": {" "}, "scopes": {"posts:read"}}); res["succeed"] == true {
+		t.Error("token created without a name")
+	}
+
+	res := create(url.Values{"name": {"deploy"}, "scopes": {"posts:read", "posts:write"}, "expires": {"30"}})
+	if res["succeed"] != true {
+		t.Fatalf("create token: %v", res)
+	}
+	raw, _ := res["token"].(string)
+	token, _, err := AuthenticateToken(store, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.ExpiresAt == nil || !token.HasScope(models.SCOPE_POSTS_WRITE) {
+		t.Errorf("token = %+v", token)
+	}
+	//只保存令牌的哈希
+	if token.TokenHash == raw || !strings.HasPrefix(raw, token.Prefix) {
+		t.Errorf("token hash = %q, prefix = %q", token.TokenHash, token.Prefix)
+	}
+
+	//不能撤销他人的令牌
+	other := createTestUser(t, store, "other", models.ROLE_AUTHOR)
+	otherRouter := newTestRouter(other)
+	otherRouter.POST("/profile/token/:id/revoke", ctl.TokenRevoke)
+	path := fmt.Sprintf("/profile/token/%d/revoke", token.ID)
+	postForm(otherRouter, path, nil)
+	if _, _, err = AuthenticateToken(store, raw); err != nil {
+		t.Error("token revoked by another user")
+	}
+	postForm(r, path, nil)
+	if _, _, err = AuthenticateToken(store, raw); err == nil {
+		t.Error("revoked token still valid")
+	}
+}
@@ -0,0 +1,353 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"gingorm/system"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	SESSION_2FA_USER    = "2FA_USER"    // 已通过密码验证、等待输入动态码的用户id
+	SESSION_2FA_EXPIRES = "2FA_EXPIRES" // 输入动态码的截止时间
+	SESSION_TOTP_SECRET = "TOTP_SECRET" // 启用两步验证时生成、尚未确认的密钥
+
+	TOTP_ISSUER         = "Wblog"
+	TOTP_PERIOD         = 30 // 动态码有效时间，秒
+	TWO_FACTOR_DURATION = 5 * time.Minute
+	RECOVERY_CODE_COUNT = 10
+)
+
+var errInvalidCode = errors.New("invalid verification code")
+
+// 两步验证用户在验证器中显示的账号名
+func totpAccountName(user *models.User) string {
+	switch {
+	case user.Email != "":
+		return user.Email
+	case user.GithubLoginId != "":
+		return user.GithubLoginId
+	default:
+		return fmt.Sprintf("user%d", user.ID)
+	}
+}
+
+// 恢复码形如xxxxx-xxxxx，包含48位随机数
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+	return code[:5] + "-" + code[5:], nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return helpers.Sha256(code)
+}
+
+// 重新生成恢复码，旧的恢复码全部失效，返回的明文只展示一次
+func resetRecoveryCodes(codes models.RecoveryCodeRepository, user *models.User) ([]string, error) {
+	if err := codes.DeleteByUserId(user.ID); err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, RECOVERY_CODE_COUNT)
+	for i := 0; i < RECOVERY_CODE_COUNT; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if err = codes.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: hashRecoveryCode(code)}); err != nil {
+			return nil, err
+		}
+		result = append(result, code)
+	}
+	return result, nil
+}
+
+// 动态码所在的时间片，与totp.Validate一样允许前后各一个时间片的误差
+func totpStep(code, secret string, now time.Time) (int64, bool) {
+	current := now.Unix() / TOTP_PERIOD
+	opts := totp.ValidateOpts{Period: TOTP_PERIOD, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	for _, step := range []int64{current, current - 1, current + 1} {
+		ok, err := totp.ValidateCustom(code, secret, time.Unix(step*TOTP_PERIOD, 0), opts)
+		if err != nil {
+			return 0, false
+		}
+		if ok {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// 校验动态码，最后一次通过验证的时间片及之前的动态码不能再使用，防止动态码被重放
+func (ctl *Controller) useTotpCode(user *models.User, code string) bool {
+	step, ok := totpStep(strings.TrimSpace(code), user.TotpSecret, time.Now())
+	if !ok {
+		return false
+	}
+	return ctl.store.Users().UseTotpStep(user, step) == nil
+}
+
+// 校验动态码或恢复码，恢复码使用后失效
+func (ctl *Controller) verifySecondFactor(user *models.User, code string) bool {
+	code = strings.TrimSpace(code)
+	if code == "" || !user.TotpEnabled {
+		return false
+	}
+	if ctl.useTotpCode(user, code) {
+		return true
+	}
+	return ctl.store.RecoveryCodes().Use(user.ID, hashRecoveryCode(code)) == nil
+}
+
+// 管理员是否需要先启用两步验证
+func twoFactorEnrollRequired(user *models.User) bool {
+	return system.GetConfiguration().TwoFactorRequired && user.IsAdmin() && !user.TotpEnabled
+}
+
+// 第一步验证通过，开启两步验证的用户跳转到动态码页面，否则完成登录
+func (ctl *Controller) beginSignin(c *gin.Context, user *models.User) {
+	if user.TotpEnabled {
+		s := sessions.Default(c)
+		s.Set(SESSION_2FA_USER, user.ID)
+		s.Set(SESSION_2FA_EXPIRES, helpers.GetCurrentTime().Add(TWO_FACTOR_DURATION).Unix())
+		s.Save()
+		c.Redirect(http.StatusMovedPermanently, "/signin/2fa")
+		return
+	}
+	ctl.loginSucceeded(user, user.Email, clientIP(c))
+	finishSignin(c, user)
+}
+
+// 写入session完成登录
+func finishSignin(c *gin.Context, user *models.User) {
+	s := sessions.Default(c)
+	s.Clear()
+	s.Set(SESSION_KEY, user.ID)
+	s.Save()
+	if !user.IsVerified() {
+		HandleMessage(c, "邮箱尚未验证，请查收验证邮件，或访问/visitor/verify/resend重新发送。")
+	} else if twoFactorEnrollRequired(user) {
+		c.Redirect(http.StatusMovedPermanently, "/admin/profile")
+	} else if user.IsAdmin() {
+		c.Redirect(http.StatusMovedPermanently, "/admin/index")
+	} else {
+		c.Redirect(http.StatusMovedPermanently, "/")
+	}
+}
+
+// 等待输入动态码的用户，超时或不存在时返回错误
+func (ctl *Controller) pendingSigninUser(c *gin.Context) (*models.User, error) {
+	s := sessions.Default(c)
+	userId, ok := s.Get(SESSION_2FA_USER).(uint)
+	expires, _ := s.Get(SESSION_2FA_EXPIRES).(int64)
+	if !ok || helpers.GetCurrentTime().Unix() >= expires {
+		return nil, errors.New("sign in expired, please sign in again")
+	}
+	user, err := ctl.store.Users().Get(userId)
+	if err != nil || !user.TotpEnabled || user.LockState {
+		return nil, errors.New("sign in expired, please sign in again")
+	}
+	return user, nil
+}
+
+func twoFactorPage(c *gin.Context, message string) {
+	c.HTML(http.StatusOK, "auth/twofactor.html", gin.H{
+		"csrf":    csrfToken(c),
+		"message": message,
+	})
+}
+
+func (ctl *Controller) TwoFactorGet(c *gin.Context) {
+	if _, err := ctl.pendingSigninUser(c); err != nil {
+		c.Redirect(http.StatusMovedPermanently, "/signin")
+		return
+	}
+	twoFactorPage(c, "")
+}
+
+// 登录第二步，校验动态码或恢复码，失败次数与密码错误一起计入登录失败
+func (ctl *Controller) TwoFactorPost(c *gin.Context) {
+	user, err := ctl.pendingSigninUser(c)
+	if err != nil {
+		signinPage(c, err.Error(), ctl.newLoginGuard(nil, clientIP(c)).captchaRequired())
+		return
+	}
+	ip := clientIP(c)
+	guard := ctl.newLoginGuard(user, ip)
+	if user.IsTemporarilyLocked() {
+		ctl.recordLogin(user, user.Email, ip, models.LOGIN_RESULT_BLOCKED)
+		twoFactorPage(c, "Too many failed attempts, your account is temporarily locked, please try again later")
+		return
+	}
+	if wait := guard.retryAfter(helpers.GetCurrentTime()); wait > 0 {
+		ctl.recordLogin(user, user.Email, ip, models.LOGIN_RESULT_BLOCKED)
+		twoFactorPage(c, fmt.Sprintf("Too many failed attempts, please try again in %d seconds", int(wait.Seconds())+1))
+		return
+	}
+	if !ctl.verifySecondFactor(user, c.PostForm("code")) {
+		ctl.loginFailed(guard, user.Email, ip)
+		twoFactorPage(c, errInvalidCode.Error())
+		return
+	}
+	ctl.loginSucceeded(user, user.Email, ip)
+	finishSignin(c, user)
+}
+
+// 生成两步验证密钥和二维码，输入动态码确认后才会启用
+func (ctl *Controller) TwoFactorSetup(c *gin.Context) {
+	res := gin.H{}
+	defer writeJSON(c, res)
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		res["message"] = "server interval error"
+		return
+	}
+	if user.TotpEnabled {
+		res["message"] = "two-factor authentication is already enabled"
+		return
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: TOTP_ISSUER, AccountName: totpAccountName(user)})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	img, err := key.Image(200, 200)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, img); err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	s := sessions.Default(c)
+	s.Set(SESSION_TOTP_SECRET, key.Secret())
+	s.Save()
+	res["secret"] = key.Secret()
+	res["uri"] = key.URL()
+	res["qrcode"] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	res["succeed"] = true
+}
+
+// 确认动态码后启用两步验证，返回恢复码
+func (ctl *Controller) TwoFactorEnable(c *gin.Context) {
+	res := gin.H{}
+	defer writeJSON(c, res)
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		res["message"] = "server interval error"
+		return
+	}
+	s := sessions.Default(c)
+	secret, _ := s.Get(SESSION_TOTP_SECRET).(string)
+	if user.TotpEnabled || secret == "" {
+		res["message"] = "please generate a new secret first"
+		return
+	}
+	step, ok := totpStep(strings.TrimSpace(c.PostForm("code")), secret, time.Now())
+	if !ok {
+		res["message"] = errInvalidCode.Error()
+		return
+	}
+	var codes []string
+	err := ctl.store.Transaction(func(tx models.Store) (err error) {
+		user.TotpSecret = secret
+		user.TotpEnabled = true
+		user.TotpLastStep = step
+		if err = tx.Users().UpdateTotp(user); err != nil {
+			return
+		}
+		codes, err = resetRecoveryCodes(tx.RecoveryCodes(), user)
+		return
+	})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	s.Delete(SESSION_TOTP_SECRET)
+	s.Save()
+	res["codes"] = codes
+	res["succeed"] = true
+}
+
+// 关闭两步验证，需要输入动态码或恢复码
+func (ctl *Controller) TwoFactorDisable(c *gin.Context) {
+	res := gin.H{}
+	defer writeJSON(c, res)
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		res["message"] = "server interval error"
+		return
+	}
+	if system.GetConfiguration().TwoFactorRequired && user.IsAdmin() {
+		res["message"] = "two-factor authentication is required for admins"
+		return
+	}
+	if !ctl.verifySecondFactor(user, c.PostForm("code")) {
+		res["message"] = errInvalidCode.Error()
+		return
+	}
+	err := ctl.store.Transaction(func(tx models.Store) error {
+		user.TotpSecret = ""
+		user.TotpEnabled = false
+		user.TotpLastStep = 0
+		if err := tx.Users().UpdateTotp(user); err != nil {
+			return err
+		}
+		return tx.RecoveryCodes().DeleteByUserId(user.ID)
+	})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["succeed"] = true
+}
+
+// 重新生成恢复码，需要输入动态码
+func (ctl *Controller) RecoveryCodesReset(c *gin.Context) {
+	res := gin.H{}
+	defer writeJSON(c, res)
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		res["message"] = "server interval error"
+		return
+	}
+	if !user.TotpEnabled || !ctl.useTotpCode(user, c.PostForm("code")) {
+		res["message"] = errInvalidCode.Error()
+		return
+	}
+	var codes []string
+	err := ctl.store.Transaction(func(tx models.Store) (err error) {
+		codes, err = resetRecoveryCodes(tx.RecoveryCodes(), user)
+		return
+	})
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	res["codes"] = codes
+	res["succeed"] = true
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gingorm/models"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/pquerna/otp/totp"
+)
+
+func (sc *sessionClient) post(path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if sc.cookie != nil {
+		req.AddCookie(sc.cookie)
+	}
+	w := httptest.NewRecorder()
+	sc.router.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == SESSION_NAME {
+			sc.cookie = cookie
+		}
+	}
+	return w
+}
+
+func enableTestTotp(t *testing.T, store models.Store, user *models.User) []string {
+	t.Helper()
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: TOTP_ISSUER, AccountName: user.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.TotpSecret = key.Secret()
+	user.TotpEnabled = true
+	if err = store.Users().UpdateTotp(user); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := resetRecoveryCodes(store.RecoveryCodes(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codes
+}
+
+func TestTwoFactorSignin(t *testing.T) {
+	loadTestConfig(t, "login_captcha_after: 100\n")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createSigninUser(t, store, "right")
+	codes := enableTestTotp(t, store, user)
+	r := newTestRouter(nil, "auth/signin.html", "auth/twofactor.html")
+	r.Use(sessions.Sessions(SESSION_NAME, ctl.sessions))
+	r.POST("/signin", ctl.SigninPost)
+	r.POST("/signin/2fa", ctl.TwoFactorPost)
+	r.GET("/whoami", func(c *gin.Context) {
+		id, _ := sessions.Default(c).Get(SESSION_KEY).(uint)
+		c.String(http.StatusOK, fmt.Sprint(id))
+	})
+
+	client := &sessionClient{router: r}
+	w := client.post("/signin", url.Values{"username": {user.Email}, "password": {"right"}})
+	if w.Header().Get("Location") != "/signin/2fa" {
+		t.Fatalf("password step: status = %d, location = %q", w.Code, w.Header().Get("Location"))
+	}
+	if id := client.get("/whoami"); id != "0" {
+		t.Fatalf("signed in as %s before the second step", id)
+	}
+	if body := client.post("/signin/2fa", url.Values{"code": {"000000"}}).Body.String(); body != errInvalidCode.Error() {
+		t.Errorf("wrong code: %q", body)
+	}
+
+	//失败后需要等待退避时间，清空失败记录后再试
+	store.LoginAttempts().DeleteBefore(time.Now().Add(time.Hour))
+	saved, _ := store.Users().Get(user.ID)
+	saved.FailedLogins = 0
+	saved.LastFailedAt = nil
+	store.Users().UpdateLoginState(saved)
+
+	code, _ := totp.GenerateCode(user.TotpSecret, time.Now())
+	w = client.post("/signin/2fa", url.Values{"code": {code}})
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("valid code: status = %d, body = %q", w.Code, w.Body.String())
+	}
+	if id := client.get("/whoami"); id != fmt.Sprint(user.ID) {
+		t.Errorf("whoami = %s, want %d", id, user.ID)
+	}
+
+	//恢复码只能使用一次
+	if !ctl.verifySecondFactor(user, strings.ToUpper(codes[0])) {
+		t.Error("recovery code rejected")
+	}
+	if ctl.verifySecondFactor(user, codes[0]) {
+		t.Error("recovery code accepted twice")
+	}
+	if n, _ := store.RecoveryCodes().CountUnused(user.ID); n != RECOVERY_CODE_COUNT-1 {
+		t.Errorf("unused recovery codes = %d, want %d", n, RECOVERY_CODE_COUNT-1)
+	}
+}
+
+func TestTwoFactorEnableDisable(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	r := newTestRouter(user)
+	r.Use(sessions.Sessions(SESSION_NAME, ctl.sessions))
+	r.POST("/2fa/setup", ctl.TwoFactorSetup)
+	r.POST("/2fa/enable", ctl.TwoFactorEnable)
+	r.POST("/2fa/disable", ctl.TwoFactorDisable)
+	client := &sessionClient{router: r}
+
+	var res struct {
+		Succeed bool
+		Message string
+		Secret  string
+		Codes   []string
+	}
+	json.Unmarshal(client.post("/2fa/setup", nil).Body.Bytes(), &res)
+	if !res.Succeed || res.Secret == "" {
+		t.Fatalf("setup: %+v", res)
+	}
+	if saved, _ := store.Users().Get(user.ID); saved.TotpEnabled {
+		t.Fatal("enabled before confirming a code")
+	}
+	json.Unmarshal(client.post("/2fa/enable", url.Values{"code": {"000000"}}).Body.Bytes(), &res)
+	if res.Succeed {
+		t.Fatal("enabled with a wrong code")
+	}
+	code, _ := totp.GenerateCode(res.Secret, time.Now())
+	json.Unmarshal(client.post("/2fa/enable", url.Values{"code": {code}}).Body.Bytes(), &res)
+	if !res.Succeed || len(res.Codes) != RECOVERY_CODE_COUNT {
+		t.Fatalf("enable: %+v", res)
+	}
+	if saved, _ := store.Users().Get(user.ID); !saved.TotpEnabled || saved.TotpSecret != res.Secret {
+		t.Fatalf("totp not saved: %+v", saved)
+	}
+
+	json.Unmarshal(client.post("/2fa/disable", url.Values{"code": {res.Codes[0]}}).Body.Bytes(), &res)
+	if !res.Succeed {
+		t.Fatalf("disable: %+v", res)
+	}
+	if saved, _ := store.Users().Get(user.ID); saved.TotpEnabled || saved.TotpSecret != "" {
+		t.Errorf("totp not disabled: %+v", saved)
+	}
+	if n, _ := store.RecoveryCodes().CountUnused(user.ID); n != 0 {
+		t.Errorf("%d recovery codes left after disabling", n)
+	}
+}
+
+// 通过验证的动态码不能再次使用，同一时间片及之前的动态码都失效
+func TestTotpCodeReplay(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	enableTestTotp(t, store, user)
+
+	now := time.Now()
+	code, _ := totp.GenerateCode(user.TotpSecret, now)
+	if !ctl.verifySecondFactor(user, code) {
+		t.Fatal("valid code rejected")
+	}
+	if ctl.verifySecondFactor(user, code) {
+		t.Error("code accepted twice")
+	}
+	previous, _ := totp.GenerateCode(user.TotpSecret, now.Add(-TOTP_PERIOD*time.Second))
+	if ctl.verifySecondFactor(user, previous) {
+		t.Error("code of an earlier time-step accepted")
+	}
+
+	//重新读取用户，最后使用的时间片已保存
+	user, _ = store.Users().Get(user.ID)
+	r := newTestRouter(user)
+	r.POST("/recovery_codes", ctl.RecoveryCodesReset)
+	if body := postForm(r, "/recovery_codes", url.Values{"code": {code}}).Body.String(); !strings.Contains(body, errInvalidCode.Error()) {
+		t.Errorf("reused code accepted: %s", body)
+	}
+	next, _ := totp.GenerateCode(user.TotpSecret, now.Add(TOTP_PERIOD*time.Second))
+	if body := postForm(r, "/recovery_codes", url.Values{"code": {next}}).Body.String(); !strings.Contains(body, `"succeed":true`) {
+		t.Errorf("code of the next time-step rejected: %s", body)
+	}
+}
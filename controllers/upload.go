@@ -7,7 +7,7 @@ import (
 )
 
 //文件上传
-func Upload(c *gin.Context) {
+func (ctl *Controller) Upload(c *gin.Context) {
 	var (
 		err      error
 		res      = gin.H{}
@@ -24,7 +24,7 @@ func Upload(c *gin.Context) {
 	}
 
 	//uploader = QiniuUploader{}
-	uploader = SmmsUploader{}
+	uploader = SmmsUploader{files: ctl.store.SmmsFiles()}
 
 	url, err = uploader.upload(file, fh)
 	if err != nil {
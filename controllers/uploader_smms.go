@@ -13,6 +13,7 @@ import (
 )
 
 type SmmsUploader struct {
+	files models.SmmsFileRepository
 }
 
 type SmmsRet struct {
@@ -78,7 +79,7 @@ func (u SmmsUploader) upload(file multipart.File, fileHeader *multipart.FileHead
 		Url:       ret.Data.Url,
 		Path:      ret.Data.Path,
 	}
-	err = smmsFile.Insert()
+	err = u.files.Create(&smmsFile)
 	if err != nil {
 		return
 	}
@@ -1,62 +1,26 @@
 package controllers
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 
-	"github.com/alimoeeny/gooauth2"
 	"github.com/cihub/seelog"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"github.com/pkg/errors"
 	"gingorm/helpers"
 	"gingorm/models"
-	"gingorm/system"
 )
 
-type GithubUserInfo struct {
-	AvatarURL         string      `json:"avatar_url"`
-	Bio               interface{} `json:"bio"`
-	Blog              string      `json:"blog"`
-	Company           interface{} `json:"company"`
-	CreatedAt         string      `json:"created_at"`
-	Email             interface{} `json:"email"`
-	EventsURL         string      `json:"events_url"`
-	Followers         int         `json:"followers"`
-	FollowersURL      string      `json:"followers_url"`
-	Following         int         `json:"following"`
-	FollowingURL      string      `json:"following_url"`
-	GistsURL          string      `json:"gists_url"`
-	GravatarID        string      `json:"gravatar_id"`
-	Hireable          interface{} `json:"hireable"`
-	HTMLURL           string      `json:"html_url"`
-	ID                int         `json:"id"`
-	Location          interface{} `json:"location"`
-	Login             string      `json:"login"`
-	Name              interface{} `json:"name"`
-	OrganizationsURL  string      `json:"organizations_url"`
-	PublicGists       int         `json:"public_gists"`
-	PublicRepos       int         `json:"public_repos"`
-	ReceivedEventsURL string      `json:"received_events_url"`
-	ReposURL          string      `json:"repos_url"`
-	SiteAdmin         bool        `json:"site_admin"`
-	StarredURL        string      `json:"starred_url"`
-	SubscriptionsURL  string      `json:"subscriptions_url"`
-	Type              string      `json:"type"`
-	UpdatedAt         string      `json:"updated_at"`
-	URL               string      `json:"url"`
-}
-
-func SigninGet(c *gin.Context) {
-	c.HTML(http.StatusOK, "auth/signin.html", nil)
+func (ctl *Controller) SigninGet(c *gin.Context) {
+	signinPage(c, "", ctl.newLoginGuard(nil, clientIP(c)).captchaRequired())
 }
 
 //跳转到注册页面
 func SignupGet(c *gin.Context) {
-	c.HTML(http.StatusOK, "auth/signup.html", nil)
+	c.HTML(http.StatusOK, "auth/signup.html", gin.H{
+		"csrf": csrfToken(c),
+	})
 }
 
 func LogoutGet(c *gin.Context) {
@@ -66,7 +30,22 @@ func LogoutGet(c *gin.Context) {
 	c.Redirect(http.StatusSeeOther, "/signin")
 }
 
-func SignupPost(c *gin.Context) {
+//第一个用户成为owner，之后注册的用户默认为评论者，需要owner在用户管理中分配角色
+//在创建用户的事务中调用，并发注册时只有一个用户成为owner
+func assignInitialRole(users models.UserRepository, user *models.User) error {
+	claimed, err := users.ClaimOwner()
+	if err != nil {
+		return err
+	}
+	if claimed {
+		user.Role = models.ROLE_OWNER
+	} else {
+		user.Role = models.ROLE_COMMENTER
+	}
+	return nil
+}
+
+func (ctl *Controller) SignupPost(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -75,197 +54,127 @@ func SignupPost(c *gin.Context) {
 	email := c.PostForm("email")
 	telephone := c.PostForm("telephone")
 	password := c.PostForm("password")
-	//此处注册就是管理员
 	user := &models.User{
 		Email:     email,
 		Telephone: telephone,
 		Password:  password,
-		IsAdmin:   true,
 	}
 	if len(user.Email) == 0 || len(user.Password) == 0 {
 		res["message"] = "email or password cannot be null"
 		return
 	}
-	user.Password = helpers.Md5(user.Email + user.Password)
-	err = user.Insert()
+	user.Password, err = helpers.HashPassword(user.Password)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	err = ctl.store.Transaction(func(tx models.Store) error {
+		if err := assignInitialRole(tx.Users(), user); err != nil {
+			return err
+		}
+		return tx.Users().Create(user)
+	})
 	if err != nil {
 		res["message"] = "email already exists"
 		return
 	}
 	res["succeed"] = true
+	res["message"] = "注册成功，验证邮件已发送，请在24小时内完成验证"
+	if err = sendVerifyEmail(user); err != nil {
+		seelog.Error(err)
+		res["message"] = "注册成功，但验证邮件发送失败，请登录后重新发送"
+	}
 }
 
-func SigninPost(c *gin.Context) {
+func (ctl *Controller) SigninPost(c *gin.Context) {
 	var (
-		err  error
-		user *models.User
+		err    error
+		user   *models.User
+		ok     bool
+		rehash bool
 	)
 	username := c.PostForm("username")
 	password := c.PostForm("password")
+	ip := clientIP(c)
 	if username == "" || password == "" {
-		c.HTML(http.StatusOK, "auth/signin.html", gin.H{
-			"message": "username or password cannot be null",
-		})
+		signinPage(c, "username or password cannot be null", ctl.newLoginGuard(nil, ip).captchaRequired())
 		return
 	}
-	user, err = models.GetUserByUsername(username)
-	if err != nil || user.Password != helpers.Md5(username+password) {
-		c.HTML(http.StatusOK, "auth/signin.html", gin.H{
-			"message": "invalid username or password",
-		})
-		return
-	}
-	if user.LockState {
-		c.HTML(http.StatusOK, "auth/signin.html", gin.H{
-			"message": "Your account have been locked",
-		})
-		return
-	}
-	s := sessions.Default(c)
-	s.Clear()
-	s.Set(SESSION_KEY, user.ID)
-	s.Save()
-	if user.IsAdmin {
-		c.Redirect(http.StatusMovedPermanently, "/admin/index")
-	} else {
-		c.Redirect(http.StatusMovedPermanently, "/")
+	user, err = ctl.store.Users().GetByUsername(username)
+	if err != nil {
+		user = nil
 	}
-}
-
-func Oauth2Callback(c *gin.Context) {
-	var (
-		userInfo *GithubUserInfo
-		user     *models.User
-	)
-	code := c.Query("code")
-	state := c.Query("state")
-
-	// validate state
-	session := sessions.Default(c)
-	if len(state) == 0 || state != session.Get(SESSION_GITHUB_STATE) {
-		c.Abort()
+	//临时锁定、退避时间内或验证码错误时不校验密码
+	guard := ctl.newLoginGuard(user, ip)
+	if user != nil && user.IsTemporarilyLocked() {
+		ctl.recordLogin(user, username, ip, models.LOGIN_RESULT_BLOCKED)
+		signinPage(c, "Too many failed attempts, your account is temporarily locked, please try again later or reset your password", guard.captchaRequired())
 		return
 	}
-	// remove state from session
-	session.Delete(SESSION_GITHUB_STATE)
-	session.Save()
-
-	// exchange accesstoken by code
-	token, err := exchangeTokenByCode(code)
-	if err != nil {
-		seelog.Error(err)
-		c.Redirect(http.StatusMovedPermanently, "/signin")
+	if wait := guard.retryAfter(helpers.GetCurrentTime()); wait > 0 {
+		ctl.recordLogin(user, username, ip, models.LOGIN_RESULT_BLOCKED)
+		signinPage(c, fmt.Sprintf("Too many failed attempts, please try again in %d seconds", int(wait.Seconds())+1), guard.captchaRequired())
 		return
 	}
-
-	//get github userinfo by accesstoken
-	userInfo, err = getGithubUserInfoByAccessToken(token)
-	if err != nil {
-		seelog.Error(err)
-		c.Redirect(http.StatusMovedPermanently, "/signin")
+	if guard.captchaRequired() && !verifyCaptcha(c) {
+		ctl.recordLogin(user, username, ip, models.LOGIN_RESULT_BLOCKED)
+		signinPage(c, "error verifycode", true)
 		return
 	}
-
-	sessionUser, exists := c.Get(CONTEXT_USER_KEY)
-	if exists { // 已登录
-		user, _ = sessionUser.(*models.User)
-		_, err1 := models.IsGithubIdExists(userInfo.Login, user.ID)
-		if err1 != nil { // 未绑定
-			if user.IsAdmin {
-				user.GithubLoginId = userInfo.Login
-			}
-			user.AvatarUrl = userInfo.AvatarURL
-			user.GithubUrl = userInfo.HTMLURL
-			err = user.UpdateGithubUserInfo()
-		} else {
-			err = errors.New("this github loginId has bound another account.")
-		}
+	if user != nil && user.Password != "" {
+		ok, rehash = helpers.VerifyPassword(user.Password, password, user.Email)
 	} else {
-		user = &models.User{
-			GithubLoginId: userInfo.Login,
-			AvatarUrl:     userInfo.AvatarURL,
-			GithubUrl:     userInfo.HTMLURL,
-		}
-		user, err = user.FirstOrCreate()
-		if err == nil {
-			if user.LockState {
-				err = errors.New("Your account have been locked.")
-				HandleMessage(c, "Your account have been locked.")
-				return
-			}
-		}
+		//用户不存在时同样校验一次，避免通过响应时间判断用户是否存在
+		helpers.VerifyDummyPassword(password)
 	}
-
-	if err == nil {
-		s := sessions.Default(c)
-		s.Clear()
-		s.Set(SESSION_KEY, user.ID)
-		s.Save()
-		if user.IsAdmin {
-			c.Redirect(http.StatusMovedPermanently, "/admin/index")
-		} else {
-			c.Redirect(http.StatusMovedPermanently, "/")
-		}
+	if !ok {
+		ctl.loginFailed(guard, username, ip)
+		signinPage(c, "invalid username or password", guard.captchaRequired())
 		return
 	}
-}
-
-func exchangeTokenByCode(code string) (accessToken string, err error) {
-	var (
-		transport *oauth.Transport
-		token     *oauth.Token
-	)
-	transport = &oauth.Transport{Config: &oauth.Config{
-		ClientId:     system.GetConfiguration().GithubClientId,
-		ClientSecret: system.GetConfiguration().GithubClientSecret,
-		RedirectURL:  system.GetConfiguration().GithubRedirectURL,
-		TokenURL:     system.GetConfiguration().GithubTokenUrl,
-		Scope:        system.GetConfiguration().GithubScope,
-	}}
-	token, err = transport.Exchange(code)
-	if err != nil {
+	if user.LockState {
+		signinPage(c, "Your account have been locked", false)
 		return
 	}
-	accessToken = token.AccessToken
-	// cache token
-	tokenCache := oauth.CacheFile("./request.token")
-	if err := tokenCache.PutToken(token); err != nil {
-		seelog.Error(err)
-	}
-	return
-}
-
-func getGithubUserInfoByAccessToken(token string) (*GithubUserInfo, error) {
-	var (
-		resp *http.Response
-		body []byte
-		err  error
-	)
-	resp, err = http.Get(fmt.Sprintf("https://api.github.com/user?access_token=%s", token))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	//旧版md5或参数过时的哈希，密码验证通过后重新哈希
+	if rehash {
+		if hash, err := helpers.HashPassword(password); err == nil {
+			if err = ctl.store.Users().UpdatePassword(user, hash); err != nil {
+				seelog.Error(err)
+			}
+		}
 	}
-	var userInfo GithubUserInfo
-	err = json.Unmarshal(body, &userInfo)
-	return &userInfo, err
+	ctl.beginSignin(c, user)
 }
 
-func ProfileGet(c *gin.Context) {
-	sessionUser, exists := c.Get(CONTEXT_USER_KEY)
-	if exists {
+func (ctl *Controller) ProfileGet(c *gin.Context) {
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	if user, ok := sessionUser.(*models.User); ok {
+		sessionList, _ := ctl.sessions.List(user.ID)
+		recoveryCodes, _ := ctl.store.RecoveryCodes().CountUnused(user.ID)
+		identities := make(map[string]*models.UserIdentity)
+		if list, err := ctl.store.Identities().ListByUserId(user.ID); err == nil {
+			for _, identity := range list {
+				identities[identity.Provider] = identity
+			}
+		}
+		tokens, _ := ctl.store.AccessTokens().ListByUserId(user.ID)
 		c.HTML(http.StatusOK, "admin/profile.html", gin.H{
-			"user":     sessionUser,
-			"comments": models.MustListUnreadComment(),
+			"csrf":              csrfToken(c),
+			"user":              sessionUser,
+			"comments":          ctl.mustListUnreadComment(),
+			"sessions":          sessionList,
+			"currentSession":    ctl.sessions.CurrentID(c),
+			"recoveryCodes":     recoveryCodes,
+			"twoFactorRequired": twoFactorEnrollRequired(user),
+			"identities":        identities,
+			"tokens":            tokens,
+			"scopes":            user.GrantableScopes(),
 		})
 	}
 }
 
-func ProfileUpdate(c *gin.Context) {
+func (ctl *Controller) ProfileUpdate(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -279,7 +188,7 @@ func ProfileUpdate(c *gin.Context) {
 		res["message"] = "server interval error"
 		return
 	}
-	err = user.UpdateProfile(avatarUrl, nickName)
+	err = ctl.store.Users().UpdateProfile(user, avatarUrl, nickName)
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -288,7 +197,7 @@ func ProfileUpdate(c *gin.Context) {
 	res["user"] = models.User{AvatarUrl: avatarUrl, NickName: nickName}
 }
 
-func BindEmail(c *gin.Context) {
+func (ctl *Controller) BindEmail(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -305,20 +214,24 @@ func BindEmail(c *gin.Context) {
 		res["message"] = "email have bound"
 		return
 	}
-	_, err = models.GetUserByUsername(email)
+	_, err = ctl.store.Users().GetByUsername(email)
 	if err == nil {
 		res["message"] = "email have be registered"
 		return
 	}
-	err = user.UpdateEmail(email)
+	err = ctl.store.Users().UpdateEmail(user, email)
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
 	res["succeed"] = true
+	if err = sendVerifyEmail(user); err != nil {
+		seelog.Error(err)
+		res["message"] = fmt.Sprintf("send verify email failed: %s", err.Error())
+	}
 }
 
-func UnbindEmail(c *gin.Context) {
+func (ctl *Controller) UnbindEmail(c *gin.Context) {
 	var (
 		err error
 		res = gin.H{}
@@ -334,7 +247,17 @@ func UnbindEmail(c *gin.Context) {
 		res["message"] = "email haven't bound"
 		return
 	}
-	err = user.UpdateEmail("")
+	//邮箱和密码用于登录，没有绑定第三方账号时解绑后无法再登录
+	identities, err := ctl.store.Identities().ListByUserId(user.ID)
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	if len(identities) == 0 {
+		res["message"] = "this is the only way to sign in, please bind another account first"
+		return
+	}
+	err = ctl.store.Users().UpdateEmail(user, "")
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -342,24 +265,51 @@ func UnbindEmail(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func UnbindGithub(c *gin.Context) {
+func (ctl *Controller) UserIndex(c *gin.Context) {
+	users, _ := ctl.store.Users().List()
+	attempts, _ := ctl.store.LoginAttempts().ListRecent(LOGIN_RECENT_ATTEMPTS)
+	user, _ := c.Get(CONTEXT_USER_KEY)
+	c.HTML(http.StatusOK, "admin/user.html", gin.H{
+		"csrf":     csrfToken(c),
+		"users":    users,
+		"user":     user,
+		"roles":    models.Roles,
+		"attempts": attempts,
+		"comments": ctl.mustListUnreadComment(),
+	})
+}
+
+//分配角色，不能修改自己的角色，避免owner误操作后无人管理
+func (ctl *Controller) UserRole(c *gin.Context) {
 	var (
-		err error
-		res = gin.H{}
+		err  error
+		id   uint
+		res  = gin.H{}
+		user *models.User
 	)
 	defer writeJSON(c, res)
+	id, err = parseId(c.Param("id"))
+	if err != nil {
+		res["message"] = err.Error()
+		return
+	}
+	role := c.PostForm("role")
+	if !models.IsValidRole(role) {
+		res["message"] = "invalid role"
+		return
+	}
 	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
-	user, ok := sessionUser.(*models.User)
-	if !ok {
-		res["message"] = "server interval error"
+	if current, ok := sessionUser.(*models.User); !ok || current.ID == id {
+		res["message"] = "cannot change your own role"
 		return
 	}
-	if user.GithubLoginId == "" {
-		res["message"] = "github haven't bound"
+	user, err = ctl.store.Users().Get(id)
+	if err != nil {
+		res["message"] = err.Error()
 		return
 	}
-	user.GithubLoginId = ""
-	err = user.UpdateGithubUserInfo()
+	user.Role = role
+	err = ctl.store.Users().UpdateRole(user)
 	if err != nil {
 		res["message"] = err.Error()
 		return
@@ -367,17 +317,7 @@ func UnbindGithub(c *gin.Context) {
 	res["succeed"] = true
 }
 
-func UserIndex(c *gin.Context) {
-	users, _ := models.ListUsers()
-	user, _ := c.Get(CONTEXT_USER_KEY)
-	c.HTML(http.StatusOK, "admin/user.html", gin.H{
-		"users":    users,
-		"user":     user,
-		"comments": models.MustListUnreadComment(),
-	})
-}
-
-func UserLock(c *gin.Context) {
+func (ctl *Controller) UserLock(c *gin.Context) {
 	var (
 		err  error
 		_id  uint64
@@ -391,16 +331,39 @@ func UserLock(c *gin.Context) {
 		res["message"] = err.Error()
 		return
 	}
-	user, err = models.GetUser(uint(_id))
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	if current, ok := sessionUser.(*models.User); !ok || current.ID == uint(_id) {
+		res["message"] = "cannot lock yourself"
+		return
+	}
+	user, err = ctl.store.Users().Get(uint(_id))
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
+	//临时锁定中的账号直接解除临时锁定
+	if !user.LockState && user.IsTemporarilyLocked() {
+		user.FailedLogins = 0
+		user.LockedUntil = nil
+		if err = ctl.store.Users().UpdateLoginState(user); err != nil {
+			res["message"] = err.Error()
+			return
+		}
+		res["succeed"] = true
+		return
+	}
 	user.LockState = !user.LockState
-	err = user.Lock()
+	err = ctl.store.Users().Lock(user)
 	if err != nil {
 		res["message"] = err.Error()
 		return
 	}
+	//锁定后立即结束该用户所有已登录的session
+	if user.LockState {
+		if err = ctl.sessions.RevokeAll(user.ID, ""); err != nil {
+			res["message"] = err.Error()
+			return
+		}
+	}
 	res["succeed"] = true
 }
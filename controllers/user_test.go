@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"github.com/gin-contrib/sessions"
+)
+
+func TestSigninRehashesLegacyPassword(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := &models.User{Email: "user@example.com", Password: helpers.Md5("user@example.com" + "secret"), VerifyState: models.VERIFY_STATE_VERIFIED, Role: models.ROLE_COMMENTER}
+	if err := store.Users().Create(user); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(nil, "auth/signin.html")
+	r.Use(sessions.Sessions(SESSION_NAME, ctl.sessions))
+	r.POST("/signin", ctl.SigninPost)
+
+	w := postForm(r, "/signin", url.Values{"username": {user.Email}, "password": {"secret"}})
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body.String())
+	}
+	saved, _ := store.Users().Get(user.ID)
+	if saved.Password == user.Password {
+		t.Fatal("legacy md5 password was not rehashed")
+	}
+	if ok, rehash := helpers.VerifyPassword(saved.Password, "secret", ""); !ok || rehash {
+		t.Errorf("rehashed password: ok = %v, rehash = %v", ok, rehash)
+	}
+}
+
+func TestSignupFirstUserIsOwner(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	r := newTestRouter(nil)
+	r.POST("/signup", ctl.SignupPost)
+
+	for i := 0; i < 3; i++ {
+		postForm(r, "/signup", url.Values{"email": {fmt.Sprintf("user%d@example.com", i)}, "password": {"password"}})
+	}
+	for i := 0; i < 3; i++ {
+		user, err := store.Users().GetByUsername(fmt.Sprintf("user%d@example.com", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := models.ROLE_COMMENTER
+		if i == 0 {
+			want = models.ROLE_OWNER
+		}
+		if user.Role != want {
+			t.Errorf("user%d role = %q, want %q", i, user.Role, want)
+		}
+	}
+}
+
+// 并发注册时只有一个用户成为所有者
+func TestSignupConcurrentOwner(t *testing.T) {
+	loadTestConfig(t, "signup_enabled: true\n")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	r := newTestRouter(nil)
+	r.POST("/signup", ctl.SignupPost)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			postForm(r, "/signup", url.Values{"email": {fmt.Sprintf("user%d@example.com", i)}, "password": {"password"}})
+		}(i)
+	}
+	wg.Wait()
+	//邮箱重复时回滚，不影响之后的注册
+	postForm(r, "/signup", url.Values{"email": {"user0@example.com"}, "password": {"password"}})
+
+	users, _ := store.Users().List()
+	owners := 0
+	for _, user := range users {
+		if user.Role == models.ROLE_OWNER {
+			owners++
+		}
+	}
+	if len(users) != 10 || owners != 1 {
+		t.Errorf("got %d users and %d owners, want 10 and 1", len(users), owners)
+	}
+}
+
+func TestUserRole(t *testing.T) {
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	owner := createTestUser(t, store, "owner", models.ROLE_OWNER)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	r := newTestRouter(owner)
+	r.POST("/admin/user/:id/role", ctl.UserRole)
+	var res struct {
+		Succeed bool
+		Message string
+	}
+
+	w := postForm(r, fmt.Sprintf("/admin/user/%d/role", owner.ID), url.Values{"role": {models.ROLE_COMMENTER}})
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res.Succeed {
+		t.Error("owner changed their own role")
+	}
+	w = postForm(r, fmt.Sprintf("/admin/user/%d/role", user.ID), url.Values{"role": {"admin"}})
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res.Succeed {
+		t.Error("invalid role accepted")
+	}
+	w = postForm(r, fmt.Sprintf("/admin/user/%d/role", user.ID), url.Values{"role": {models.ROLE_EDITOR}})
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if !res.Succeed {
+		t.Fatalf("body = %s", w.Body.String())
+	}
+	if saved, _ := store.Users().Get(user.ID); saved.Role != models.ROLE_EDITOR {
+		t.Errorf("role = %q, want editor", saved.Role)
+	}
+}
+
+// 邮箱是唯一的登录方式时不能解绑，解绑后账号仍然是已验证状态
+func TestUnbindEmail(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := createTestUser(t, store, "user", models.ROLE_COMMENTER)
+	r := newTestRouter(user)
+	r.POST("/admin/profile/email/unbind", ctl.UnbindEmail)
+	var res struct {
+		Succeed bool
+		Message string
+	}
+
+	w := postForm(r, "/admin/profile/email/unbind", nil)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if res.Succeed {
+		t.Fatal("unbound the only way to sign in")
+	}
+	if saved, _ := store.Users().Get(user.ID); saved.Email == "" {
+		t.Fatal("email cleared")
+	}
+
+	if err := store.Identities().Create(&models.UserIdentity{UserID: user.ID, Provider: "github", Subject: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	w = postForm(r, "/admin/profile/email/unbind", nil)
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if !res.Succeed {
+		t.Fatalf("body = %s", w.Body.String())
+	}
+	saved, _ := store.Users().Get(user.ID)
+	if saved.Email != "" || !saved.IsVerified() {
+		t.Errorf("user after unbinding = %+v", saved)
+	}
+}
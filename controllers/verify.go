@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gingorm/helpers"
+	"gingorm/models"
+	"gingorm/system"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TOKEN_EMAIL_VERIFY = "email_verify"
+
+	EMAIL_VERIFY_DURATION = 24 * time.Hour
+)
+
+// 邮箱验证token形如 <用户id>.<过期时间>.<签名>，签名中包含邮箱，邮箱变更后旧链接即失效
+func signEmailToken(user *models.User, expires int64) string {
+	return helpers.HmacSha256(system.GetConfiguration().SessionSecret,
+		fmt.Sprintf("%s|%d|%s|%d", TOKEN_EMAIL_VERIFY, user.ID, user.Email, expires))
+}
+
+// 发送邮箱验证链接
+func sendVerifyEmail(user *models.User) error {
+	expires := helpers.GetCurrentTime().Add(EMAIL_VERIFY_DURATION).Unix()
+	token := fmt.Sprintf("%d.%d.%s", user.ID, expires, signEmailToken(user, expires))
+	return sendMail(user.Email, "[Wblog]邮箱验证", fmt.Sprintf("%s/verify?token=%s", system.GetConfiguration().Domain, token))
+}
+
+func (ctl *Controller) VerifyEmail(c *gin.Context) {
+	parts := strings.Split(c.Query("token"), ".")
+	if len(parts) != 3 {
+		HandleMessage(c, "验证链接有误，请重新获取！")
+		return
+	}
+	id, err1 := strconv.ParseUint(parts[0], 10, 64)
+	expires, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		HandleMessage(c, "验证链接有误，请重新获取！")
+		return
+	}
+	user, err := ctl.store.Users().Get(uint(id))
+	if err != nil || user.Email == "" || subtle.ConstantTimeCompare([]byte(parts[2]), []byte(signEmailToken(user, expires))) != 1 {
+		HandleMessage(c, "验证链接有误，请重新获取！")
+		return
+	}
+	if user.VerifyState == models.VERIFY_STATE_VERIFIED {
+		HandleMessage(c, "邮箱已验证！")
+		return
+	}
+	if helpers.GetCurrentTime().Unix() >= expires {
+		HandleMessage(c, "验证链接已过期，请重新获取！")
+		return
+	}
+	user.VerifyState = models.VERIFY_STATE_VERIFIED
+	if err = ctl.store.Users().UpdateVerifyState(user); err != nil {
+		HandleMessage(c, fmt.Sprintf("验证失败！%s", err.Error()))
+		return
+	}
+	HandleMessage(c, "验证成功！")
+}
+
+// 重新发送验证邮件
+func ResendVerifyEmail(c *gin.Context) {
+	sessionUser, _ := c.Get(CONTEXT_USER_KEY)
+	user, ok := sessionUser.(*models.User)
+	if !ok {
+		HandleMessage(c, "server interval error")
+		return
+	}
+	if user.Email == "" || user.VerifyState == models.VERIFY_STATE_VERIFIED {
+		HandleMessage(c, "邮箱无需验证！")
+		return
+	}
+	if err := sendVerifyEmail(user); err != nil {
+		HandleMessage(c, fmt.Sprintf("发送验证邮件失败！%s", err.Error()))
+		return
+	}
+	HandleMessage(c, fmt.Sprintf("验证邮件已发送到%s，请在24小时内完成验证。", user.Email))
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"gingorm/helpers"
+	"gingorm/models"
+)
+
+func emailToken(user *models.User, expires time.Time) string {
+	return fmt.Sprintf("%d.%d.%s", user.ID, expires.Unix(), signEmailToken(user, expires.Unix()))
+}
+
+func getPath(r http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestVerifyEmail(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	user := &models.User{Email: "user@example.com", VerifyState: models.VERIFY_STATE_UNVERIFIED}
+	if err := store.Users().Create(user); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestRouter(nil)
+	r.GET("/verify", ctl.VerifyEmail)
+	verify := func(token string) string {
+		return getPath(r, "/verify?token="+url.QueryEscape(token)).Body.String()
+	}
+
+	valid := emailToken(user, helpers.GetCurrentTime().Add(EMAIL_VERIFY_DURATION))
+	if body := verify(valid + "x"); body != "验证链接有误，请重新获取！" {
+		t.Errorf("tampered token: %q", body)
+	}
+	if body := verify(emailToken(user, helpers.GetCurrentTime().Add(-time.Minute))); body != "验证链接已过期，请重新获取！" {
+		t.Errorf("expired token: %q", body)
+	}
+	//邮箱变更后，发给旧邮箱的链接失效
+	changed := *user
+	changed.Email = "other@example.com"
+	if body := verify(emailToken(&changed, helpers.GetCurrentTime().Add(EMAIL_VERIFY_DURATION))); body != "验证链接有误，请重新获取！" {
+		t.Errorf("token for another email: %q", body)
+	}
+	if saved, _ := store.Users().Get(user.ID); saved.IsVerified() {
+		t.Fatal("user verified by an invalid token")
+	}
+
+	if body := verify(valid); body != "验证成功！" {
+		t.Fatalf("valid token: %q", body)
+	}
+	if saved, _ := store.Users().Get(user.ID); !saved.IsVerified() {
+		t.Error("user not verified")
+	}
+	if body := verify(valid); body != "邮箱已验证！" {
+		t.Errorf("reused token: %q", body)
+	}
+}
+
+func TestSignupRequiresVerification(t *testing.T) {
+	loadTestConfig(t, "")
+	store := models.NewMemoryStore()
+	ctl := newTestController(t, store)
+	r := newTestRouter(nil)
+	r.POST("/signup", ctl.SignupPost)
+
+	postForm(r, "/signup", url.Values{"email": {"user@example.com"}, "password": {"password"}})
+	user, err := store.Users().GetByUsername("user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.IsVerified() {
+		t.Error("new signup is verified before following the email link")
+	}
+}
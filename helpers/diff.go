@@ -0,0 +1,137 @@
+package helpers
+
+import "strings"
+
+// 按行比较的结果类型
+const (
+	DIFF_EQUAL  = "="
+	DIFF_INSERT = "+"
+	DIFF_DELETE = "-"
+	DIFF_SKIP   = "..." //折叠的未修改行
+
+	//不同部分的行数乘积超过该值时不再计算最长公共子序列，直接显示为全部删除后新增
+	DIFF_MAX_CELLS = 4000000
+)
+
+// 按行比较的一行结果，OldLine和NewLine为行号，新增的行没有OldLine，删除的行没有NewLine
+type DiffLine struct {
+	Op      string
+	OldLine int
+	NewLine int
+	Text    string
+	Skipped int //折叠的行数
+}
+
+// 按行比较两段文本，先去掉相同的开头和结尾，再按最长公共子序列比较中间部分
+func DiffLines(a, b string) []DiffLine {
+	x, y := splitLines(a), splitLines(b)
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	lines := make([]DiffLine, 0, len(x)+len(y))
+	i, j := 0, 0
+	equal := func() {
+		lines = append(lines, DiffLine{Op: DIFF_EQUAL, OldLine: i + 1, NewLine: j + 1, Text: x[i]})
+		i++
+		j++
+	}
+	remove := func() {
+		lines = append(lines, DiffLine{Op: DIFF_DELETE, OldLine: i + 1, Text: x[i]})
+		i++
+	}
+	insert := func() {
+		lines = append(lines, DiffLine{Op: DIFF_INSERT, NewLine: j + 1, Text: y[j]})
+		j++
+	}
+	for i < prefix {
+		equal()
+	}
+	n, m := len(x)-prefix-suffix, len(y)-prefix-suffix
+	if n*m > DIFF_MAX_CELLS {
+		for i < prefix+n {
+			remove()
+		}
+		for j < prefix+m {
+			insert()
+		}
+	} else {
+		//lcs[p][q]为x和y中间部分从第p行和第q行开始的最长公共子序列长度
+		lcs := make([][]int32, n+1)
+		for p := range lcs {
+			lcs[p] = make([]int32, m+1)
+		}
+		for p := n - 1; p >= 0; p-- {
+			for q := m - 1; q >= 0; q-- {
+				if x[prefix+p] == y[prefix+q] {
+					lcs[p][q] = lcs[p+1][q+1] + 1
+				} else if lcs[p+1][q] >= lcs[p][q+1] {
+					lcs[p][q] = lcs[p+1][q]
+				} else {
+					lcs[p][q] = lcs[p][q+1]
+				}
+			}
+		}
+		for i < prefix+n || j < prefix+m {
+			p, q := i-prefix, j-prefix
+			switch {
+			case p < n && q < m && x[i] == y[j]:
+				equal()
+			case q == m || (p < n && lcs[p+1][q] >= lcs[p][q+1]):
+				remove()
+			default:
+				insert()
+			}
+		}
+	}
+	for i < len(x) {
+		equal()
+	}
+	return lines
+}
+
+// 折叠距离修改超过context行的未修改行
+func CollapseDiff(lines []DiffLine, context int) []DiffLine {
+	result := make([]DiffLine, 0, len(lines))
+	for start := 0; start < len(lines); {
+		if lines[start].Op != DIFF_EQUAL {
+			result = append(result, lines[start])
+			start++
+			continue
+		}
+		end := start
+		for end < len(lines) && lines[end].Op == DIFF_EQUAL {
+			end++
+		}
+		//开头和结尾只保留靠近修改的一侧
+		head, tail := context, context
+		if start == 0 {
+			head = 0
+		}
+		if end == len(lines) {
+			tail = 0
+		}
+		if end-start <= head+tail+1 {
+			result = append(result, lines[start:end]...)
+		} else {
+			result = append(result, lines[start:start+head]...)
+			result = append(result, DiffLine{Op: DIFF_SKIP, Skipped: end - start - head - tail})
+			result = append(result, lines[end-tail:end]...)
+		}
+		start = end
+	}
+	return result
+}
+
+// 统一换行符后按行分割，忽略结尾的换行
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(strings.Replace(s, "\r\n", "\n", -1), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,58 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+)
+
+// 按"操作+文本"拼接，便于比较
+func formatDiff(lines []DiffLine) string {
+	parts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line.Op == DIFF_SKIP {
+			parts = append(parts, DIFF_SKIP+strings.Repeat("x", line.Skipped))
+			continue
+		}
+		parts = append(parts, line.Op+line.Text)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestDiffLines(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want string
+	}{
+		{"", "", ""},
+		{"a\nb\nc", "a\nb\nc\n", "=a =b =c"},
+		{"a\r\nb", "a\nb", "=a =b"},
+		{"", "a\nb", "+a +b"},
+		{"a\nb", "", "-a -b"},
+		{"a\nb\nc", "a\nx\nc", "=a -b +x =c"},
+		{"a\nb\nc\nd", "b\nc\nd\ne", "-a =b =c =d +e"},
+	}
+	for _, tc := range cases {
+		if got := formatDiff(DiffLines(tc.a, tc.b)); got != tc.want {
+			t.Errorf("DiffLines(%q, %q) = %q, want %q", tc.a, tc.b, got, tc.want)
+		}
+	}
+
+	lines := DiffLines("a\nb\nc", "a\nx\nc")
+	if lines[1].OldLine != 2 || lines[1].NewLine != 0 || lines[2].OldLine != 0 || lines[2].NewLine != 2 || lines[3].OldLine != 3 {
+		t.Errorf("line numbers = %+v", lines)
+	}
+}
+
+func TestCollapseDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10"
+	b := "1\n2\n3\n4\n5\nx\n7\n8\n9\n10"
+	got := formatDiff(CollapseDiff(DiffLines(a, b), 2))
+	if want := "...xxx =4 =5 -6 +x =7 =8 ...xx"; got != want {
+		t.Errorf("CollapseDiff = %q, want %q", got, want)
+	}
+	//未修改的行数不超过上下文时不折叠
+	got = formatDiff(CollapseDiff(DiffLines("1\n2\n3", "1\nx\n3"), 2))
+	if want := "=1 -2 +x =3"; got != want {
+		t.Errorf("CollapseDiff = %q, want %q", got, want)
+	}
+}
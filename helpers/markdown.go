@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"html"
+	"html/template"
+	"io"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/russross/blackfriday"
+)
+
+// 评论支持的markdown扩展：围栏代码、自动链接和换行
+const commentExtensions = blackfriday.NoIntraEmphasis | blackfriday.FencedCode | blackfriday.Autolink |
+	blackfriday.Strikethrough | blackfriday.HardLineBreak
+
+// 评论中允许的html，只保留段落、强调、代码、引用、列表和链接
+var commentPolicy = newCommentPolicy()
+
+func newCommentPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "em", "strong", "del", "code", "pre", "blockquote", "ul", "ol", "li")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w-]+$`)).OnElements("code")
+	p.AllowStandardURLs()
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^nofollow ugc$`)).OnElements("a")
+	return p
+}
+
+// 评论的渲染器，标题显示为段落，图片显示为链接，所有链接加上rel="nofollow ugc"
+type commentRenderer struct {
+	*blackfriday.HTMLRenderer
+}
+
+func (r *commentRenderer) RenderNode(w io.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.Link, blackfriday.Image:
+		if entering {
+			io.WriteString(w, `<a href="`+html.EscapeString(string(node.LinkData.Destination))+`" rel="nofollow ugc">`)
+		} else {
+			io.WriteString(w, "</a>")
+		}
+		return blackfriday.GoToNext
+	case blackfriday.Heading:
+		if entering {
+			io.WriteString(w, "<p>")
+		} else {
+			io.WriteString(w, "</p>\n")
+		}
+		return blackfriday.GoToNext
+	}
+	return r.HTMLRenderer.RenderNode(w, node, entering)
+}
+
+// 把评论内容按markdown渲染为安全的html，评论中的html标签不生效
+func CommentMarkdown(content string) template.HTML {
+	renderer := &commentRenderer{blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+		Flags: blackfriday.SkipHTML,
+	})}
+	output := blackfriday.Run([]byte(content), blackfriday.WithExtensions(commentExtensions), blackfriday.WithRenderer(renderer))
+	return template.HTML(commentPolicy.SanitizeBytes(output))
+}
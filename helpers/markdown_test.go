@@ -0,0 +1,39 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommentMarkdown(t *testing.T) {
+	cases := []struct {
+		content  string
+		contains []string
+		excludes []string
+	}{
+		{"**bold** and `code`", []string{"<strong>bold</strong>", "<code>code</code>"}, nil},
+		//评论中的html标签不生效
+		{`<script>alert(1)</script><b onclick="x()">b</b>`, nil, []string{"<script", "<b", "onclick"}},
+		{"[link](http://a.test)", []string{`<a href="http://a.test" rel="nofollow ugc">link</a>`}, nil},
+		{"http://a.test", []string{`rel="nofollow ugc"`}, nil},
+		{"[x](javascript:alert(1))", nil, []string{"javascript:"}},
+		//图片显示为链接，标题显示为段落
+		{"![img](http://a.test/a.png)", []string{`<a href="http://a.test/a.png" rel="nofollow ugc">img</a>`}, []string{"<img"}},
+		{"# title", []string{"<p>title</p>"}, []string{"<h1"}},
+		{"```go\nfmt.Println()\n```", []string{`<pre><code class="language-go">`}, nil},
+		{"line1\nline2", []string{"<br"}, nil},
+	}
+	for _, c := range cases {
+		html := string(CommentMarkdown(c.content))
+		for _, s := range c.contains {
+			if !strings.Contains(html, s) {
+				t.Errorf("CommentMarkdown(%q) = %q, want %q", c.content, html, s)
+			}
+		}
+		for _, s := range c.excludes {
+			if strings.Contains(html, s) {
+				t.Errorf("CommentMarkdown(%q) = %q, should not contain %q", c.content, html, s)
+			}
+		}
+	}
+}
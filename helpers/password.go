@@ -0,0 +1,201 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PASSWORD_BCRYPT   = "bcrypt"
+	PASSWORD_ARGON2ID = "argon2id"
+)
+
+// 密码哈希算法，编码后的哈希中记录了算法和参数，便于校验和升级
+type PasswordHasher interface {
+	Name() string
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (bool, error)
+	Match(encoded string) bool       // 是否由该算法生成
+	NeedsRehash(encoded string) bool // 参数低于当前配置时需要重新哈希
+}
+
+// bcrypt，编码格式为 $2a$<cost>$<salt+hash>
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Name() string {
+	return PASSWORD_BCRYPT
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < h.Cost
+}
+
+// argon2id，编码格式为 $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+type Argon2Hasher struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+	KeyLen  uint32
+}
+
+func (h Argon2Hasher) Name() string {
+	return PASSWORD_ARGON2ID
+}
+
+func (h Argon2Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// 解析argon2id编码后的哈希
+func decodeArgon2(encoded string) (params Argon2Hasher, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != PASSWORD_ARGON2ID {
+		err = errors.New("invalid argon2id hash")
+		return
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return
+	}
+	if version != argon2.Version {
+		err = errors.New("incompatible argon2 version")
+		return
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return
+	}
+	params.KeyLen = uint32(len(key))
+	return
+}
+
+func (h Argon2Hasher) Verify(encoded, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2(encoded)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h Argon2Hasher) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h Argon2Hasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeArgon2(encoded)
+	return err != nil || params.Time < h.Time || params.Memory < h.Memory || params.Threads < h.Threads || params.KeyLen < h.KeyLen
+}
+
+// 根据配置创建密码哈希算法，cost对bcrypt为cost，对argon2id为迭代次数
+func NewPasswordHasher(algorithm string, cost int) (PasswordHasher, error) {
+	switch algorithm {
+	case "", PASSWORD_BCRYPT:
+		if cost <= 0 {
+			cost = bcrypt.DefaultCost
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("invalid bcrypt cost: %d", cost)
+		}
+		return BcryptHasher{Cost: cost}, nil
+	case PASSWORD_ARGON2ID:
+		if cost <= 0 {
+			cost = 1
+		}
+		return Argon2Hasher{Time: uint32(cost), Memory: 64 * 1024, Threads: 4, KeyLen: 32}, nil
+	default:
+		return nil, fmt.Errorf("unsupported password algorithm: %s", algorithm)
+	}
+}
+
+// 当前使用的密码哈希算法
+var passwordHasher PasswordHasher = BcryptHasher{Cost: bcrypt.DefaultCost}
+
+func SetPasswordHasher(h PasswordHasher) {
+	dummyMu.Lock()
+	defer dummyMu.Unlock()
+	passwordHasher = h
+	dummyHash, _ = h.Hash("dummy password")
+}
+
+// 用户不存在时校验的哈希，使用当前算法和参数生成
+var (
+	dummyMu   sync.Mutex
+	dummyHash string
+)
+
+// 用户不存在或没有设置密码时调用，耗时和校验真实密码相同，避免通过响应时间判断用户是否存在
+func VerifyDummyPassword(password string) {
+	dummyMu.Lock()
+	if dummyHash == "" {
+		dummyHash, _ = passwordHasher.Hash("dummy password")
+	}
+	hasher, hash := passwordHasher, dummyHash
+	dummyMu.Unlock()
+	hasher.Verify(hash, password)
+}
+
+// 计算密码哈希
+func HashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
+// 校验密码，legacySalt为旧版md5(email+password)哈希中使用的email
+// rehash为true时表示密码正确但哈希已过时，应使用HashPassword重新计算后保存
+func VerifyPassword(encoded, password, legacySalt string) (ok, rehash bool) {
+	if encoded == "" || password == "" {
+		return false, false
+	}
+	for _, h := range []PasswordHasher{passwordHasher, BcryptHasher{}, Argon2Hasher{}} {
+		if !h.Match(encoded) {
+			continue
+		}
+		ok, _ = h.Verify(encoded, password)
+		if !ok {
+			return false, false
+		}
+		return true, h.Name() != passwordHasher.Name() || passwordHasher.NeedsRehash(encoded)
+	}
+	// 旧版的无盐md5
+	ok = subtle.ConstantTimeCompare([]byte(encoded), []byte(Md5(legacySalt+password))) == 1
+	return ok, ok
+}
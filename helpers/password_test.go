@@ -0,0 +1,104 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	hashers := []PasswordHasher{
+		BcryptHasher{Cost: bcrypt.MinCost},
+		Argon2Hasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32},
+	}
+	for _, h := range hashers {
+		encoded, err := h.Hash("secret")
+		if err != nil {
+			t.Fatalf("%s: %v", h.Name(), err)
+		}
+		if !h.Match(encoded) {
+			t.Errorf("%s: hash %q not matched", h.Name(), encoded)
+		}
+		if ok, err := h.Verify(encoded, "secret"); !ok || err != nil {
+			t.Errorf("%s: Verify(correct) = %v, %v", h.Name(), ok, err)
+		}
+		if ok, _ := h.Verify(encoded, "wrong"); ok {
+			t.Errorf("%s: Verify(wrong) = true", h.Name())
+		}
+		if h.NeedsRehash(encoded) {
+			t.Errorf("%s: fresh hash needs rehash", h.Name())
+		}
+	}
+
+	weak, _ := BcryptHasher{Cost: bcrypt.MinCost}.Hash("secret")
+	if !(BcryptHasher{Cost: bcrypt.MinCost + 1}).NeedsRehash(weak) {
+		t.Error("bcrypt hash with a lower cost should need rehash")
+	}
+	weak, _ = Argon2Hasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32}.Hash("secret")
+	if !(Argon2Hasher{Time: 2, Memory: 1024, Threads: 1, KeyLen: 32}).NeedsRehash(weak) {
+		t.Error("argon2id hash with fewer iterations should need rehash")
+	}
+}
+
+func TestNewPasswordHasher(t *testing.T) {
+	if h, err := NewPasswordHasher("", 0); err != nil || h.Name() != PASSWORD_BCRYPT {
+		t.Errorf("default hasher = %v, %v", h, err)
+	}
+	if h, err := NewPasswordHasher(PASSWORD_ARGON2ID, 2); err != nil || h.(Argon2Hasher).Time != 2 {
+		t.Errorf("argon2id hasher = %v, %v", h, err)
+	}
+	if _, err := NewPasswordHasher(PASSWORD_BCRYPT, 100); err == nil {
+		t.Error("invalid bcrypt cost should fail")
+	}
+	if _, err := NewPasswordHasher("md5", 0); err == nil {
+		t.Error("unsupported algorithm should fail")
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	defer SetPasswordHasher(passwordHasher)
+	SetPasswordHasher(BcryptHasher{Cost: bcrypt.MinCost})
+
+	//旧版md5哈希校验通过后需要重新哈希
+	legacy := Md5("user@example.com" + "secret")
+	if ok, rehash := VerifyPassword(legacy, "secret", "user@example.com"); !ok || !rehash {
+		t.Errorf("legacy md5: ok = %v, rehash = %v", ok, rehash)
+	}
+	if ok, _ := VerifyPassword(legacy, "wrong", "user@example.com"); ok {
+		t.Error("legacy md5 accepted a wrong password")
+	}
+
+	encoded, _ := HashPassword("secret")
+	if !strings.HasPrefix(encoded, "$2a$") {
+		t.Fatalf("HashPassword = %q, want bcrypt", encoded)
+	}
+	if ok, rehash := VerifyPassword(encoded, "secret", ""); !ok || rehash {
+		t.Errorf("current hash: ok = %v, rehash = %v", ok, rehash)
+	}
+
+	//切换算法后，旧算法的哈希仍可登录，但需要重新哈希
+	SetPasswordHasher(Argon2Hasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32})
+	if ok, rehash := VerifyPassword(encoded, "secret", ""); !ok || !rehash {
+		t.Errorf("bcrypt hash after switching to argon2id: ok = %v, rehash = %v", ok, rehash)
+	}
+	if ok, _ := VerifyPassword("", "", ""); ok {
+		t.Error("empty password accepted")
+	}
+}
+
+// 校验用的哈希随算法一起更换，耗时和真实密码一致
+func TestVerifyDummyPassword(t *testing.T) {
+	defer SetPasswordHasher(passwordHasher)
+	SetPasswordHasher(BcryptHasher{Cost: bcrypt.MinCost})
+	VerifyDummyPassword("secret")
+	if !strings.HasPrefix(dummyHash, "$2a$04$") {
+		t.Errorf("dummy hash = %s", dummyHash)
+	}
+	argon2 := Argon2Hasher{Time: 1, Memory: 1024, Threads: 1, KeyLen: 32}
+	SetPasswordHasher(argon2)
+	VerifyDummyPassword("secret")
+	if argon2.NeedsRehash(dummyHash) {
+		t.Errorf("dummy hash not regenerated: %s", dummyHash)
+	}
+}
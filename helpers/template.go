@@ -1,7 +1,9 @@
 package helpers
 
 import (
+	"fmt"
 	"gingorm/models"
+	"html/template"
 	"strings"
 	"time"
 )
@@ -11,6 +13,17 @@ func DateFormat(date time.Time, layout string) string {
 	return date.Format(layout)
 }
 
+// html中datetime-local输入框的时间格式
+const DATETIME_LOCAL_LAYOUT = "2006-01-02T15:04"
+
+// 格式化为datetime-local输入框的值，时间为空时返回空字符串
+func DatetimeLocal(date *time.Time) string {
+	if date == nil {
+		return ""
+	}
+	return date.Local().Format(DATETIME_LOCAL_LAYOUT)
+}
+
 // 截取字符串
 func Substring(source string, start, end int) string {
 	rs := []rune(source)
@@ -42,16 +55,28 @@ func Minus(a1, a2 int) int {
 	return a1 - a2
 }
 
-//获取标签
-func ListTag() (tagstr string) {
-	tags, err := models.ListTag()
-	if err != nil {
+//获取标签，返回给模板使用的函数
+func ListTag(repo models.TagRepository) func() string {
+	return func() (tagstr string) {
+		tags, err := repo.ListPublished()
+		if err != nil {
+			return
+		}
+		tagNames := make([]string, 0)
+		for _, tag := range tags {
+			tagNames = append(tagNames, tag.Name)
+		}
+		tagstr = strings.Join(tagNames, ",")
 		return
 	}
-	tagNames := make([]string, 0)
-	for _, tag := range tags {
-		tagNames = append(tagNames, tag.Name)
-	}
-	tagstr = strings.Join(tagNames, ",")
-	return
+}
+
+// 输出包含csrf token的隐藏表单字段，用于普通表单和ajaxForm
+func CsrfField(token string) template.HTML {
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="_csrf" value="%s">`, template.HTMLEscapeString(token)))
+}
+
+// 输出设置jQuery ajax请求头的脚本，需放在引入jQuery之后
+func CsrfAjax(token string) template.HTML {
+	return template.HTML(fmt.Sprintf(`<script>$.ajaxSetup({headers: {"X-CSRF-Token": "%s"}});</script>`, template.JSEscapeString(token)))
 }
@@ -0,0 +1,11 @@
+package helpers
+
+import "testing"
+
+func TestCsrfField(t *testing.T) {
+	got := string(CsrfField(`"><script>`))
+	want := `<input type="hidden" name="_csrf" value="&#34;&gt;&lt;script&gt;">`
+	if got != want {
+		t.Errorf("CsrfField = %s, want %s", got, want)
+	}
+}
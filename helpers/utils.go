@@ -3,8 +3,10 @@ package helpers
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"io"
 	"net/smtp"
@@ -21,6 +23,20 @@ func Md5(source string) string {
 	md5h.Write([]byte(source))
 	return hex.EncodeToString(md5h.Sum(nil))
 }
+
+// 计算字符串的sha256
+func Sha256(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// 使用key计算字符串的hmac-sha256签名
+func HmacSha256(key, source string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(source))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 //字符串截取
 func Truncate(s string, n int) string {
 	runes := []rune(s)
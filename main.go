@@ -1,7 +1,9 @@
 package main
 
 import (
+	"crypto/subtle"
 	"flag"
+	"fmt"
 	"gingorm/controllers"
 	"gingorm/helpers"
 	"gingorm/models"
@@ -9,10 +11,11 @@ import (
 	"github.com/cihub/seelog"
 	"github.com/claudiu/gocron"
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 	"html/template"
 	"net/http"
+	"strings"
 )
 
 func main() {
@@ -20,6 +23,8 @@ func main() {
 	configFilePath := flag.String("C", "conf/conf.yaml", "config file path")
 	// 输出了指针类型logConfigPath，实际默认获取了指针值“conf/seelog.xml”
 	logConfigPath := flag.String("L", "conf/seelog.xml", "log config file path")
+	//数据库迁移模式，执行完迁移后直接退出
+	migrate := flag.String("migrate", "", "run database migrations: up|down|status")
 	//flag解析， 还没有想通通过flag的意义，后面看完代码再补充。
 	flag.Parse()
 	//更改默认配置文件，实际取值*logConfigPath就是“config/seelog.xml"
@@ -52,63 +57,132 @@ func main() {
 		seelog.Critical("err parsing config log file", err)
 		return
 	}
+	hasher, err := helpers.NewPasswordHasher(system.GetConfiguration().PasswordAlgorithm, system.GetConfiguration().PasswordCost)
+	if err != nil {
+		seelog.Critical("err password algorithm", err)
+		return
+	}
+	helpers.SetPasswordHasher(hasher)
+	if err := controllers.SetTrustedProxies(system.GetConfiguration().TrustedProxies); err != nil {
+		seelog.Critical("err trusted proxies ", err)
+		return
+	}
 	//初始化数据库，将db赋值给全局声明DB,延迟数据库关闭.
-	db, err := models.InitDB()
+	db, err := models.InitDB(system.GetConfiguration().Driver, system.GetConfiguration().DSN)
 	if err != nil {
 		seelog.Critical("err open databases", err)
 		return
 	}
 	defer db.Close()
 
+	if *migrate != "" {
+		if err := runMigrate(db, *migrate); err != nil {
+			seelog.Critical("err migrating database ", err)
+		}
+		return
+	}
+	//数据库结构落后于当前版本时拒绝启动
+	if err := models.CheckSchema(db); err != nil {
+		seelog.Critical(err)
+		return
+	}
+	store, err := models.NewGormStore(db)
+	if err != nil {
+		seelog.Critical("err creating store ", err)
+		return
+	}
+	sessionStore, err := newSessionStore(store)
+	if err != nil {
+		seelog.Critical("err creating session store ", err)
+		return
+	}
+	oauthProviders, err := controllers.NewOAuthProviders(system.GetConfiguration().OAuthProviders)
+	if err != nil {
+		seelog.Critical("err creating oauth providers ", err)
+		return
+	}
+	permalinks, err := controllers.NewPermalinks(system.GetConfiguration().PostPermalink, system.GetConfiguration().PagePermalink)
+	if err != nil {
+		seelog.Critical("err parsing permalinks ", err)
+		return
+	}
+	ctl := controllers.NewController(store, sessionStore, oauthProviders, permalinks, controllers.NewHeuristicSpamChecker(store.Comments()))
+	//建立搜索索引
+	ctl.RebuildSearchIndex()
+
 	//设置gin模式
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 
 	//设置输出模板配置
-	setTemplate(router)
+	setTemplate(router, store, oauthProviders, permalinks)
 	//设置session中间件
-	setSessions(router)
+	setSessions(router, sessionStore)
 
 	//使用shareData（）中间件
-	router.Use(SharedData())
+	router.Use(SharedData(store))
 
 	//Periodic tasks
 	//每一天执行一次CreateXMLSitemap
 	//每7天执行一次backup
-	gocron.Every(1).Day().Do(controllers.CreateXMLSitemap)
+	//每小时清理一次过期的session
+	//每一天清理一次30天前的登录记录
+	//每分钟发布一次到期的定时文章和页面
+	gocron.Every(1).Day().Do(ctl.CreateXMLSitemap)
 	gocron.Every(7).Days().Do(controllers.Backup)
+	gocron.Every(1).Hour().Do(sessionStore.DeleteExpired)
+	gocron.Every(1).Day().Do(ctl.CleanLoginAttempts)
+	gocron.Every(1).Minute().Do(ctl.PublishScheduled)
 	gocron.Start()
 
+	setRoutes(router, store, ctl)
+
+	router.Run(system.GetConfiguration().Addr)
+
+}
+
+//注册路由，/api/v1下的路由需要与controllers中登记的openapi接口定义一致，由测试检查
+func setRoutes(router *gin.Engine, store models.Store, ctl *controllers.Controller) {
 	//设置静态资源位置
 	//router.Static("/static", filepath.Join(getCurrentDirectory(), "./static"))
 	router.Static("/static", "./static")
 
-	//设置访问错误路径状态
-	router.NoRoute(controllers.Handle404)
-	router.GET("/", controllers.IndexGet)
-	router.GET("/index", controllers.IndexGet)
-	router.GET("/rss", controllers.RssGet)
+	//设置访问错误路径状态，没有匹配的路由时按固定链接查找文章和页面
+	router.NoRoute(ctl.PermalinkGet)
+	router.GET("/", ctl.IndexGet)
+	router.GET("/index", ctl.IndexGet)
+	router.GET("/rss", ctl.RssGet)
 
 	// 默认条件已经设置为true，所以可以下面的操作
 	//先是跳转到执行controllers.SignupGet，跳转到signup.html,然后页面form注册成功后跳转到controllers.SigninGet
 	//默认开启注册,config配置文件中signupenabled=true
 	if system.GetConfiguration().SignupEnabled {
 		router.GET("/signup", controllers.SignupGet)
-		router.POST("/signup", controllers.SignupPost)
+		router.POST("/signup", ctl.SignupPost)
 		//此处注册就是管理员了，所以可以关闭注册，或者设置isadmin=false
 	}
 	// user signin and logout
 	//登录
 	//登出，登出后跳转到/signin页面
 	//github认证退出
-	router.GET("/signin", controllers.SigninGet)
+	router.GET("/signin", ctl.SigninGet)
 	//登录认证如果是管理员则跳转到/admin,不是则跳转到/
-	router.POST("/signin", controllers.SigninPost)
+	router.POST("/signin", ctl.SigninPost)
+	//开启两步验证的用户在密码验证通过后输入动态码或恢复码
+	router.GET("/signin/2fa", ctl.TwoFactorGet)
+	router.POST("/signin/2fa", ctl.TwoFactorPost)
 	//登录出去，清空所有登录信息
 	router.GET("/logout", controllers.LogoutGet)
-	//使用github认证
-	router.GET("/oauth2callback", controllers.Oauth2Callback)
-	router.GET("/auth/:authType", controllers.AuthGet)
+
+	//找回密码
+	router.GET("/password/forgot", controllers.ForgotPasswordGet)
+	router.POST("/password/forgot", ctl.ForgotPasswordPost)
+	router.GET("/password/reset", ctl.ResetPasswordGet)
+	router.POST("/password/reset", ctl.ResetPasswordPost)
+	//第三方登录，/oauth2callback为旧的github回调地址
+	router.GET("/oauth2callback", ctl.Oauth2Callback)
+	router.GET("/oauth2callback/:provider", ctl.Oauth2Callback)
+	router.GET("/auth/:authType", ctl.AuthGet)
 
 	// captcha 获取验证码
 	router.GET("/captcha", controllers.CaptchaGet)
@@ -118,111 +192,224 @@ func main() {
 	visitor.Use(AuthRequired())
 	{
 		//发布评论
-		visitor.POST("/new_comment", controllers.CommentPost)
-		//删除评论
-		visitor.POST("/comment/:id/delete", controllers.CommentDelete)
+		visitor.POST("/new_comment", ctl.CommentPost)
+		//删除评论，有回复的评论显示为[deleted]
+		visitor.POST("/comment/:id/delete", ctl.CommentDelete)
+		//重新发送邮箱验证邮件
+		visitor.GET("/verify/resend", controllers.ResendVerifyEmail)
 	}
 
 	// subscriber //访问订阅，激活订阅，取消订阅
-	router.GET("/subscribe", controllers.SubscribeGet)
-	router.POST("/subscribe", controllers.Subscribe)
-	router.GET("/active", controllers.ActiveSubscriber)
-	router.GET("/unsubscribe", controllers.UnSubscribe)
+	router.GET("/subscribe", ctl.SubscribeGet)
+	router.POST("/subscribe", ctl.Subscribe)
+	router.GET("/active", ctl.ActiveSubscriber)
+	router.GET("/unsubscribe", ctl.UnSubscribe)
+
+	//用户邮箱验证
+	router.GET("/verify", ctl.VerifyEmail)
+	//退订评论回复通知
+	router.GET("/comment/unsubscribe", ctl.CommentUnsubscribe)
+	//游客评论，需要开启guest_comments
+	router.POST("/comment/guest", ctl.GuestCommentPost)
+	//评论预览
+	router.POST("/comment/preview", controllers.CommentPreview)
 
 	//获取博文信息，暂时没发现博文post和页面page的关系。不知道为什么这么做。
-	router.GET("/page/:id", controllers.PageGet)
+	//数字id跳转到固定链接，其他固定链接格式由NoRoute处理
+	router.GET("/page/:id", ctl.PageGet)
 	//获取博文
-	router.GET("/post/:id", controllers.PostGet)
+	router.GET("/post/:id", ctl.PostGet)
 	//获取标签
-	router.GET("/tag/:tag", controllers.TagGet)
+	router.GET("/tag/:tag", ctl.TagGet)
 	//获取归档
-	router.GET("/archives/:year/:month", controllers.ArchiveGet)
+	router.GET("/archives/:year/:month", ctl.ArchiveGet)
+	//搜索文章和页面
+	router.GET("/search", ctl.SearchGet)
+	router.GET("/search.json", ctl.SearchJSON)
 
 	//获取链接信息
-	router.GET("/link/:id", controllers.LinkGet)
+	router.GET("/link/:id", ctl.LinkGet)
 
 	//管理员页面
 	authorized := router.Group("/admin")
-	//使用认证中间件,只有管理员账号才能跳转
+	//使用认证中间件,只有已登录且邮箱已验证的用户才能进入，各功能再按角色权限检查
 	authorized.Use(AdminScopeRequired())
 	{
 		// index 索引
-		authorized.GET("/index", controllers.AdminIndex)
+		authorized.GET("/index", PermissionRequired(models.PERM_DASHBOARD), ctl.AdminIndex)
 
 		// image upload 图片上传
-		authorized.POST("/upload", controllers.Upload)
+		authorized.POST("/upload", PermissionRequired(models.PERM_POST), ctl.Upload)
 
 		// page 页面管理
-		authorized.GET("/page", controllers.PageIndex)
-		authorized.GET("/new_page", controllers.PageNew)
-		authorized.POST("/new_page", controllers.PageCreate)
-		authorized.GET("/page/:id/edit", controllers.PageEdit)
-		authorized.POST("/page/:id/edit", controllers.PageUpdate)
-		authorized.POST("/page/:id/publish", controllers.PagePublish)
-		authorized.POST("/page/:id/delete", controllers.PageDelete)
+		authorized.GET("/page", PermissionRequired(models.PERM_PAGE), ctl.PageIndex)
+		authorized.GET("/new_page", PermissionRequired(models.PERM_PAGE), controllers.PageNew)
+		authorized.POST("/new_page", PermissionRequired(models.PERM_PAGE), ctl.PageCreate)
+		authorized.GET("/page/:id/edit", PermissionRequired(models.PERM_PAGE), ctl.PageEdit)
+		authorized.POST("/page/:id/edit", PermissionRequired(models.PERM_PAGE), ctl.PageUpdate)
+		authorized.POST("/page/:id/publish", PermissionRequired(models.PERM_PAGE), ctl.PagePublish)
+		authorized.POST("/page/:id/delete", PermissionRequired(models.PERM_PAGE), ctl.PageDelete)
+		authorized.GET("/page/:id/revisions", PermissionRequired(models.PERM_PAGE), ctl.PageRevisions)
+		authorized.POST("/page/:id/revisions/:rid/restore", PermissionRequired(models.PERM_PAGE), ctl.PageRevisionRestore)
+		authorized.POST("/page/:id/draft", PermissionRequired(models.PERM_PAGE), ctl.PageDraftSave)
+		authorized.POST("/page/:id/draft/publish", PermissionRequired(models.PERM_PAGE), ctl.PageDraftPublish)
+		authorized.POST("/page/:id/draft/discard", PermissionRequired(models.PERM_PAGE), ctl.PageDraftDiscard)
 
 		// post 博客发布页面
-		authorized.GET("/post", controllers.PostIndex)
-		authorized.GET("/new_post", controllers.PostNew)
-		authorized.POST("/new_post", controllers.PostCreate)
-		authorized.GET("/post/:id/edit", controllers.PostEdit)
-		authorized.POST("/post/:id/edit", controllers.PostUpdate)
-		authorized.POST("/post/:id/publish", controllers.PostPublish)
-		authorized.POST("/post/:id/delete", controllers.PostDelete)
+		authorized.GET("/post", PermissionRequired(models.PERM_POST), ctl.PostIndex)
+		authorized.GET("/new_post", PermissionRequired(models.PERM_POST), controllers.PostNew)
+		authorized.POST("/new_post", PermissionRequired(models.PERM_POST), ctl.PostCreate)
+		authorized.GET("/post/:id/edit", PermissionRequired(models.PERM_POST), ctl.PostEdit)
+		authorized.POST("/post/:id/edit", PermissionRequired(models.PERM_POST), ctl.PostUpdate)
+		authorized.POST("/post/:id/publish", PermissionRequired(models.PERM_POST), ctl.PostPublish)
+		authorized.POST("/post/:id/delete", PermissionRequired(models.PERM_POST), ctl.PostDelete)
+		authorized.GET("/post/:id/revisions", PermissionRequired(models.PERM_POST), ctl.PostRevisions)
+		authorized.POST("/post/:id/revisions/:rid/restore", PermissionRequired(models.PERM_POST), ctl.PostRevisionRestore)
+		authorized.POST("/post/:id/draft", PermissionRequired(models.PERM_POST), ctl.PostDraftSave)
+		authorized.POST("/post/:id/draft/publish", PermissionRequired(models.PERM_POST), ctl.PostDraftPublish)
+		authorized.POST("/post/:id/draft/discard", PermissionRequired(models.PERM_POST), ctl.PostDraftDiscard)
 
 		// tag 标签创建
-		authorized.POST("/new_tag", controllers.TagCreate)
+		authorized.POST("/new_tag", PermissionRequired(models.PERM_TAG), ctl.TagCreate)
 
 		//用户管理页面
-		authorized.GET("/user", controllers.UserIndex)
-		authorized.POST("/user/:id/lock", controllers.UserLock)
+		authorized.GET("/user", PermissionRequired(models.PERM_USER), ctl.UserIndex)
+		authorized.POST("/user/:id/lock", PermissionRequired(models.PERM_USER), ctl.UserLock)
+		authorized.POST("/user/:id/role", PermissionRequired(models.PERM_USER), ctl.UserRole)
 
 		// profile 配置
 		//跟个人账户有关
-		authorized.GET("/profile", controllers.ProfileGet)
-		authorized.POST("/profile", controllers.ProfileUpdate)
-		authorized.POST("/profile/email/bind", controllers.BindEmail)
-		authorized.POST("/profile/email/unbind", controllers.UnbindEmail)
-		authorized.POST("/profile/github/unbind", controllers.UnbindGithub)
+		authorized.GET("/profile", ctl.ProfileGet)
+		authorized.POST("/profile", ctl.ProfileUpdate)
+		authorized.POST("/profile/email/bind", ctl.BindEmail)
+		authorized.POST("/profile/email/unbind", ctl.UnbindEmail)
+		authorized.POST("/profile/oauth/:provider/unbind", ctl.IdentityUnbind)
+		authorized.POST("/profile/password", ctl.PasswordUpdate)
+		authorized.POST("/profile/session/:id/revoke", ctl.SessionRevoke)
+		authorized.POST("/profile/sessions/revoke", ctl.SessionRevokeAll)
+		authorized.POST("/profile/2fa/setup", ctl.TwoFactorSetup)
+		authorized.POST("/profile/2fa/enable", ctl.TwoFactorEnable)
+		authorized.POST("/profile/2fa/disable", ctl.TwoFactorDisable)
+		authorized.POST("/profile/2fa/recovery", ctl.RecoveryCodesReset)
+		authorized.POST("/profile/tokens", ctl.TokenCreate)
+		authorized.POST("/profile/token/:id/revoke", ctl.TokenRevoke)
 
 		// subscriber 订阅者，暂时感觉用不到
-		authorized.GET("/subscriber", controllers.SubscriberIndex)
-		authorized.POST("/subscriber", controllers.SubscriberPost)
+		authorized.GET("/subscriber", PermissionRequired(models.PERM_MAIL), ctl.SubscriberIndex)
+		authorized.POST("/subscriber", PermissionRequired(models.PERM_MAIL), ctl.SubscriberPost)
 
 		// link  链接
-		authorized.GET("/link", controllers.LinkIndex)
-		authorized.POST("/new_link", controllers.LinkCreate)
-		authorized.POST("/link/:id/edit", controllers.LinkUpdate)
-		authorized.POST("/link/:id/delete", controllers.LinkDelete)
+		authorized.GET("/link", PermissionRequired(models.PERM_LINK), ctl.LinkIndex)
+		authorized.POST("/new_link", PermissionRequired(models.PERM_LINK), ctl.LinkCreate)
+		authorized.POST("/link/:id/edit", PermissionRequired(models.PERM_LINK), ctl.LinkUpdate)
+		authorized.POST("/link/:id/delete", PermissionRequired(models.PERM_LINK), ctl.LinkDelete)
 
 		// comment 评论
-		authorized.POST("/comment/:id", controllers.CommentRead)
-		authorized.POST("/read_all", controllers.CommentReadAll)
+		authorized.POST("/comment/:id", PermissionRequired(models.PERM_COMMENT), ctl.CommentRead)
+		authorized.POST("/read_all", PermissionRequired(models.PERM_COMMENT), ctl.CommentReadAll)
+		authorized.GET("/comments", PermissionRequired(models.PERM_COMMENT), ctl.CommentIndex)
+		authorized.POST("/comments/moderate", PermissionRequired(models.PERM_COMMENT), ctl.CommentModerate)
+		authorized.POST("/comments/edit", PermissionRequired(models.PERM_COMMENT), ctl.CommentEdit)
+		authorized.POST("/comments/purge", PermissionRequired(models.PERM_COMMENT), ctl.CommentPurge)
+		authorized.POST("/comments/trash_user", PermissionRequired(models.PERM_COMMENT), ctl.CommentTrashUser)
 
 		// backup  备份
-		authorized.POST("/backup", controllers.BackupPost)
-		authorized.POST("/restore", controllers.RestorePost)
+		authorized.POST("/backup", PermissionRequired(models.PERM_BACKUP), controllers.BackupPost)
+		authorized.POST("/restore", PermissionRequired(models.PERM_BACKUP), controllers.RestorePost)
 
 		// mail 邮件
-		authorized.POST("/new_mail", controllers.SendMail)
-		authorized.POST("/new_batchmail", controllers.SendBatchMail)
+		authorized.POST("/new_mail", PermissionRequired(models.PERM_MAIL), ctl.SendMail)
+		authorized.POST("/new_batchmail", PermissionRequired(models.PERM_MAIL), ctl.SendBatchMail)
 	}
 
-	router.Run(system.GetConfiguration().Addr)
+	//openapi文档，由controllers中登记的接口定义生成，同时用于校验请求
+	openapi := controllers.NewOpenAPI(system.GetConfiguration().Domain)
+	router.GET("/api/openapi.json", openapi.Get)
 
+	//json api，使用个人访问令牌认证，不使用session和csrf token
+	api := router.Group("/api/v1")
+	api.Use(TokenRequired(store), openapi.ValidateRequest())
+	{
+		api.GET("/posts", ScopeRequired(models.SCOPE_POSTS_READ), ctl.APIPostList)
+		api.POST("/posts", ScopeRequired(models.SCOPE_POSTS_WRITE), ctl.APIPostCreate)
+		api.GET("/posts/:id", ScopeRequired(models.SCOPE_POSTS_READ), ctl.APIPostGet)
+		api.PUT("/posts/:id", ScopeRequired(models.SCOPE_POSTS_WRITE), ctl.APIPostUpdate)
+		api.DELETE("/posts/:id", ScopeRequired(models.SCOPE_POSTS_WRITE), ctl.APIPostDelete)
+
+		api.GET("/pages", ScopeRequired(models.SCOPE_PAGES_READ), ctl.APIPageList)
+		api.POST("/pages", ScopeRequired(models.SCOPE_PAGES_WRITE), ctl.APIPageCreate)
+		api.GET("/pages/:id", ScopeRequired(models.SCOPE_PAGES_READ), ctl.APIPageGet)
+		api.PUT("/pages/:id", ScopeRequired(models.SCOPE_PAGES_WRITE), ctl.APIPageUpdate)
+		api.DELETE("/pages/:id", ScopeRequired(models.SCOPE_PAGES_WRITE), ctl.APIPageDelete)
+
+		api.GET("/tags", ScopeRequired(models.SCOPE_TAGS_READ), ctl.APITagList)
+		api.POST("/tags", ScopeRequired(models.SCOPE_TAGS_WRITE), ctl.APITagCreate)
+		api.GET("/tags/:id", ScopeRequired(models.SCOPE_TAGS_READ), ctl.APITagGet)
+		api.PUT("/tags/:id", ScopeRequired(models.SCOPE_TAGS_WRITE), ctl.APITagUpdate)
+		api.DELETE("/tags/:id", ScopeRequired(models.SCOPE_TAGS_WRITE), ctl.APITagDelete)
+
+		api.GET("/links", ScopeRequired(models.SCOPE_LINKS_READ), ctl.APILinkList)
+		api.POST("/links", ScopeRequired(models.SCOPE_LINKS_WRITE), ctl.APILinkCreate)
+		api.GET("/links/:id", ScopeRequired(models.SCOPE_LINKS_READ), ctl.APILinkGet)
+		api.PUT("/links/:id", ScopeRequired(models.SCOPE_LINKS_WRITE), ctl.APILinkUpdate)
+		api.DELETE("/links/:id", ScopeRequired(models.SCOPE_LINKS_WRITE), ctl.APILinkDelete)
+
+		api.GET("/comments", ScopeRequired(models.SCOPE_COMMENTS_READ), ctl.APICommentList)
+		api.GET("/comments/:id", ScopeRequired(models.SCOPE_COMMENTS_READ), ctl.APICommentGet)
+		api.PUT("/comments/:id", ScopeRequired(models.SCOPE_COMMENTS_WRITE), ctl.APICommentUpdate)
+		api.DELETE("/comments/:id", ScopeRequired(models.SCOPE_COMMENTS_WRITE), ctl.APICommentDelete)
+
+		api.GET("/subscribers", ScopeRequired(models.SCOPE_SUBSCRIBERS_READ), ctl.APISubscriberList)
+		api.POST("/subscribers", ScopeRequired(models.SCOPE_SUBSCRIBERS_WRITE), ctl.APISubscriberCreate)
+		api.GET("/subscribers/:id", ScopeRequired(models.SCOPE_SUBSCRIBERS_READ), ctl.APISubscriberGet)
+		api.PUT("/subscribers/:id", ScopeRequired(models.SCOPE_SUBSCRIBERS_WRITE), ctl.APISubscriberUpdate)
+		api.DELETE("/subscribers/:id", ScopeRequired(models.SCOPE_SUBSCRIBERS_WRITE), ctl.APISubscriberDelete)
+	}
 }
 
-func setTemplate(engine *gin.Engine) {
+//执行数据库迁移命令
+func runMigrate(db *gorm.DB, command string) error {
+	switch command {
+	case "up":
+		return models.MigrateUp(db)
+	case "down":
+		return models.MigrateDown(db)
+	case "status":
+		list, err := models.ListMigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, status := range list {
+			if status.Applied {
+				fmt.Printf("%04d_%s\tapplied at %s\n", status.Version, status.Name, status.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%04d_%s\tpending\n", status.Version, status.Name)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s", command)
+	}
+}
+
+func setTemplate(engine *gin.Engine, store models.Store, oauthProviders *controllers.OAuthProviders, permalinks *controllers.Permalinks) {
 
 	funcMap := template.FuncMap{
-		"dateFormat": helpers.DateFormat,
-		"substring":  helpers.Substring,
-		"isOdd":      helpers.IsOdd,
-		"isEven":     helpers.IsEven,
-		"truncate":   helpers.Truncate,
-		"add":        helpers.Add,
-		"minus":      helpers.Minus,
-		"listtag":    helpers.ListTag,
+		"dateFormat":      helpers.DateFormat,
+		"substring":       helpers.Substring,
+		"isOdd":           helpers.IsOdd,
+		"isEven":          helpers.IsEven,
+		"truncate":        helpers.Truncate,
+		"add":             helpers.Add,
+		"minus":           helpers.Minus,
+		"listtag":         helpers.ListTag(store.Tags()),
+		"csrfField":       helpers.CsrfField,
+		"csrfAjax":        helpers.CsrfAjax,
+		"oauthProviders":  oauthProviders.List,
+		"postURL":         permalinks.Post,
+		"pageURL":         permalinks.Page,
+		"datetimeLocal":   helpers.DatetimeLocal,
+		"commentMarkdown": helpers.CommentMarkdown,
 	}
 
 	engine.SetFuncMap(funcMap)
@@ -231,34 +418,40 @@ func setTemplate(engine *gin.Engine) {
 	engine.LoadHTMLGlob( "views/**/*")
 }
 
+//根据配置创建服务端session存储，memory只用于测试，进程重启后session全部失效
+func newSessionStore(store models.Store) (*controllers.SessionStore, error) {
+	config := system.GetConfiguration()
+	var repo models.SessionRepository
+	switch config.SessionBackend {
+	case system.SESSION_BACKEND_DATABASE:
+		repo = store.Sessions()
+	case system.SESSION_BACKEND_MEMORY:
+		repo = models.NewMemoryStore().Sessions()
+	default:
+		return nil, fmt.Errorf("unsupported session backend %q", config.SessionBackend)
+	}
+	return controllers.NewSessionStore(repo, config.SessionIdleTimeout, config.SessionAbsoluteTimeout), nil
+}
+
 //setSessions initializes sessions & csrf middlewares
-//初始化session，此处与原github有所变更
-func setSessions(router *gin.Engine) {
+//初始化session，此处与原github有所变更，cookie中只保存session id，数据保存在服务端
+func setSessions(router *gin.Engine, store *controllers.SessionStore) {
 	config := system.GetConfiguration()
-	//https://github.com/gin-gonic/contrib/tree/master/sessions
-	store := cookie.NewStore([]byte(config.SessionSecret))
-	store.Options(sessions.Options{HttpOnly: true, MaxAge: 7 * 86400, Path: "/"}) //Also set Secure: true if using SSL, you should though
-	router.Use(sessions.Sessions("gin-session", store))
-	//https://github.com/utrack/gin-csrf
-	/*router.Use(csrf.Middleware(csrf.Options{
-		Secret: config.SessionSecret,
-		ErrorFunc: func(c *gin.Context) {
-			c.String(400, "CSRF token mismatch")
-			c.Abort()
-		},
-	}))*/
+	store.Options(sessions.Options{HttpOnly: true, MaxAge: int(config.SessionAbsoluteTimeout.Seconds()), Path: "/"}) //Also set Secure: true if using SSL, you should though
+	router.Use(sessions.Sessions(controllers.SESSION_NAME, store))
+	router.Use(CSRFRequired())
 }
 
 //+++++++++++++ middlewares +++++++++++++++++++++++
 
 //SharedData fills in common data, such as user info, etc...
 //获取用户的信息，设置于用户配置
-func SharedData() gin.HandlerFunc {
+func SharedData(store models.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
-		if uID := session.Get(controllers.SESSION_KEY); uID != nil {
-			user, err := models.GetUser(uID)
-			if err == nil {
+		if uID, ok := session.Get(controllers.SESSION_KEY).(uint); ok {
+			user, err := store.Users().Get(uID)
+			if err == nil && !user.LockState {
 				c.Set(controllers.CONTEXT_USER_KEY, user)
 			}
 		}
@@ -269,11 +462,89 @@ func SharedData() gin.HandlerFunc {
 	}
 }
 
-//AuthRequired grants access to authenticated users, requires SharedData middleware
+//CSRFRequired 为每个访客生成csrf token，非GET/HEAD/OPTIONS请求必须通过表单字段_csrf或请求头X-CSRF-Token提交该token
+//已登录用户的token保存在session中，未登录时保存在签名的cookie中，不为每个访客创建session
+func CSRFRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		//json api使用令牌认证，不依赖cookie，无需csrf token
+		if strings.HasPrefix(c.Request.URL.Path, "/api/") {
+			c.Next()
+			return
+		}
+		var token string
+		session := sessions.Default(c)
+		if _, ok := session.Get(controllers.SESSION_KEY).(uint); ok {
+			token, _ = session.Get(controllers.SESSION_CSRF).(string)
+			if token == "" {
+				token = helpers.UUID()
+				session.Set(controllers.SESSION_CSRF, token)
+				session.Save()
+			}
+		} else {
+			token = anonymousCSRFToken(c)
+		}
+		c.Set(controllers.CONTEXT_CSRF_KEY, token)
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		sent := c.GetHeader("X-CSRF-Token")
+		if sent == "" {
+			sent = c.PostForm("_csrf")
+		}
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			seelog.Warnf("CSRF token mismatch when visit %s", c.Request.RequestURI)
+			c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
+				"message": "CSRF token mismatch, please refresh the page and try again.",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+//未登录访客的csrf token，cookie中保存token和签名，签名不对时重新生成
+func anonymousCSRFToken(c *gin.Context) string {
+	secret := system.GetConfiguration().SessionSecret
+	if cookie, err := c.Request.Cookie(controllers.CSRF_COOKIE_NAME); err == nil {
+		parts := strings.SplitN(cookie.Value, ".", 2)
+		if len(parts) == 2 && subtle.ConstantTimeCompare([]byte(parts[1]), []byte(helpers.HmacSha256(secret, "csrf|"+parts[0]))) == 1 {
+			return parts[0]
+		}
+	}
+	token := helpers.UUID()
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     controllers.CSRF_COOKIE_NAME,
+		Value:    token + "." + helpers.HmacSha256(secret, "csrf|"+token),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+//AdminScopeRequired grants access to authenticated users with verified email and two-factor authentication when required, requires SharedData middleware
 func AdminScopeRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if user, _ := c.Get(controllers.CONTEXT_USER_KEY); user != nil {
-			if u, ok := user.(*models.User); ok && u.IsAdmin {
+			if u, ok := user.(*models.User); ok {
+				if !u.IsVerified() {
+					c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
+						"message": "Please verify your email first, visit /visitor/verify/resend to resend the email.",
+					})
+					c.Abort()
+					return
+				}
+				//要求管理员启用两步验证时，启用前只能访问个人资料页
+				if system.GetConfiguration().TwoFactorRequired && u.IsAdmin() && !u.TotpEnabled && !strings.HasPrefix(c.Request.URL.Path, "/admin/profile") {
+					c.HTML(http.StatusForbidden, "errors/error.html", gin.H{
+						"message": "Two-factor authentication is required for admins, please enable it on /admin/profile first.",
+					})
+					c.Abort()
+					return
+				}
 				c.Next()
 				return
 			}
@@ -286,6 +557,21 @@ func AdminScopeRequired() gin.HandlerFunc {
 	}
 }
 
+//权限检查中间件，用户角色没有对应权限时返回403，requires AdminScopeRequired middleware
+func PermissionRequired(perm models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, _ := c.Get(controllers.CONTEXT_USER_KEY); user != nil {
+			if u, ok := user.(*models.User); ok && u.HasPermission(perm) {
+				c.Next()
+				return
+			}
+		}
+		seelog.Warnf("User has no permission %s to visit %s", perm, c.Request.RequestURI)
+		controllers.Handle403(c)
+		c.Abort()
+	}
+}
+
 //认证要求中间件，认证不通过直接报错退出，认证成功则能够handle住
 func AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -303,6 +589,47 @@ func AuthRequired() gin.HandlerFunc {
 	}
 }
 
+//个人访问令牌认证中间件，令牌通过请求头Authorization: Bearer <token>提交，认证失败返回json错误
+func TokenRequired(store models.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			c.Header("WWW-Authenticate", "Bearer")
+			controllers.APIError(c, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		token, user, err := controllers.AuthenticateToken(store, strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")))
+		if err != nil || user.LockState {
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			controllers.APIError(c, http.StatusUnauthorized, "invalid or expired token")
+			return
+		}
+		if !user.IsVerified() {
+			controllers.APIError(c, http.StatusForbidden, "please verify your email first")
+			return
+		}
+		if system.GetConfiguration().TwoFactorRequired && user.IsAdmin() && !user.TotpEnabled {
+			controllers.APIError(c, http.StatusForbidden, "two-factor authentication is required for admins")
+			return
+		}
+		c.Set(controllers.CONTEXT_USER_KEY, user)
+		c.Set(controllers.CONTEXT_TOKEN_KEY, token)
+		c.Next()
+	}
+}
+
+//令牌权限范围检查中间件，令牌需要包含该范围且用户角色仍拥有对应权限，requires TokenRequired middleware
+func ScopeRequired(scope models.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !controllers.TokenAllows(c, scope) {
+			seelog.Warnf("Token has no scope %s to visit %s", scope, c.Request.RequestURI)
+			controllers.APIError(c, http.StatusForbidden, "token does not have the "+string(scope)+" scope")
+			return
+		}
+		c.Next()
+	}
+}
+
 //func getCurrentDirectory() string {
 //	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
 //	if err != nil {
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"gingorm/controllers"
+	"gingorm/models"
+	"gingorm/system"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func loadTestConfig(t *testing.T) {
+	t.Helper()
+	f, err := ioutil.TempFile("", "conf*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("session_secret: secret\ndomain: http://blog.test\n")
+	f.Close()
+	if err = system.LoadConfiguration(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 记录创建session的次数
+type countingSessions struct {
+	models.SessionRepository
+	created int
+}
+
+func (r *countingSessions) Create(session *models.Session) error {
+	r.created++
+	return r.SessionRepository.Create(session)
+}
+
+type testClient struct {
+	router  http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func (tc *testClient) do(method, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range tc.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	tc.router.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		tc.cookies[cookie.Name] = cookie
+	}
+	return w
+}
+
+func TestCSRFRequired(t *testing.T) {
+	loadTestConfig(t)
+	store := models.NewMemoryStore()
+	user := &models.User{Email: "user@example.com", Role: models.ROLE_COMMENTER}
+	store.Users().Create(user)
+	repo := &countingSessions{SessionRepository: store.Sessions()}
+	router := gin.New()
+	router.SetHTMLTemplate(template.Must(template.New("errors/error.html").Parse("{{.message}}")))
+	setSessions(router, controllers.NewSessionStore(repo, system.DEFAULT_SESSION_IDLE_TIMEOUT, system.DEFAULT_SESSION_ABSOLUTE_TIMEOUT))
+	router.Use(SharedData(store))
+	router.GET("/form", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(controllers.CONTEXT_CSRF_KEY))
+	})
+	router.POST("/form", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	router.POST("/signin", func(c *gin.Context) {
+		s := sessions.Default(c)
+		s.Set(controllers.SESSION_KEY, user.ID)
+		s.Save()
+	})
+
+	//未登录的访客浏览页面不创建session
+	for i := 0; i < 3; i++ {
+		(&testClient{router: router, cookies: map[string]*http.Cookie{}}).do(http.MethodGet, "/form", nil)
+	}
+	if repo.created != 0 {
+		t.Fatalf("%d sessions created for anonymous visitors", repo.created)
+	}
+
+	client := &testClient{router: router, cookies: map[string]*http.Cookie{}}
+	token := client.do(http.MethodGet, "/form", nil).Body.String()
+	if again := client.do(http.MethodGet, "/form", nil).Body.String(); again != token {
+		t.Errorf("token changed between requests: %q, %q", token, again)
+	}
+	if w := client.do(http.MethodPost, "/form", nil); w.Code != http.StatusForbidden {
+		t.Errorf("post without token: status = %d", w.Code)
+	}
+	if w := client.do(http.MethodPost, "/form", url.Values{"_csrf": {token}}); w.Body.String() != "ok" {
+		t.Errorf("post with token: %q", w.Body.String())
+	}
+
+	//篡改cookie中的token后签名不匹配，重新生成token
+	forged := &testClient{router: router, cookies: map[string]*http.Cookie{
+		controllers.CSRF_COOKIE_NAME: {Name: controllers.CSRF_COOKIE_NAME, Value: "forged.signature"},
+	}}
+	if w := forged.do(http.MethodPost, "/form", url.Values{"_csrf": {"forged"}}); w.Code != http.StatusForbidden {
+		t.Errorf("forged cookie accepted: status = %d", w.Code)
+	}
+
+	//登录后token保存在session中
+	client.do(http.MethodPost, "/signin", url.Values{"_csrf": {token}})
+	if repo.created != 1 {
+		t.Fatalf("sessions created = %d, want 1", repo.created)
+	}
+	signedIn := client.do(http.MethodGet, "/form", nil).Body.String()
+	if signedIn == "" || signedIn == token {
+		t.Errorf("token after sign in = %q", signedIn)
+	}
+	if w := client.do(http.MethodPost, "/form", url.Values{"_csrf": {token}}); w.Code != http.StatusForbidden {
+		t.Errorf("anonymous token accepted after sign in: status = %d", w.Code)
+	}
+	if w := client.do(http.MethodPost, "/form", url.Values{"_csrf": {signedIn}}); w.Body.String() != "ok" {
+		t.Errorf("post with session token: %q", w.Body.String())
+	}
+
+	//其他访客的token无效
+	other := &testClient{router: router, cookies: map[string]*http.Cookie{}}
+	other.do(http.MethodGet, "/form", nil)
+	if w := other.do(http.MethodPost, "/form", url.Values{"_csrf": {signedIn}}); w.Code != http.StatusForbidden {
+		t.Errorf("token of another visitor accepted: status = %d", w.Code)
+	}
+
+	//ajax请求通过请求头提交token
+	req := httptest.NewRequest(http.MethodPost, "/form", nil)
+	req.Header.Set("X-CSRF-Token", signedIn)
+	for _, cookie := range client.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Body.String() != "ok" {
+		t.Errorf("post with header token: %q", w.Body.String())
+	}
+}
+
+func TestAdminPermissions(t *testing.T) {
+	cases := []struct {
+		user *models.User
+		path string
+		code int
+	}{
+		{nil, "/admin/post", http.StatusForbidden},
+		{&models.User{Email: "a@example.com", Role: models.ROLE_OWNER}, "/admin/post", http.StatusForbidden}, //邮箱未验证
+		{&models.User{GithubLoginId: "commenter", Role: models.ROLE_COMMENTER}, "/admin/post", http.StatusForbidden},
+		{&models.User{GithubLoginId: "author", Role: models.ROLE_AUTHOR}, "/admin/post", http.StatusOK},
+		{&models.User{GithubLoginId: "author", Role: models.ROLE_AUTHOR}, "/admin/page", http.StatusForbidden},
+		{&models.User{GithubLoginId: "editor", Role: models.ROLE_EDITOR}, "/admin/page", http.StatusOK},
+		{&models.User{GithubLoginId: "editor", Role: models.ROLE_EDITOR}, "/admin/user", http.StatusForbidden},
+		{&models.User{GithubLoginId: "owner", Role: models.ROLE_OWNER}, "/admin/user", http.StatusOK},
+	}
+	for _, tc := range cases {
+		router := gin.New()
+		router.SetHTMLTemplate(template.Must(template.New("errors/error.html").Parse("{{.message}}")))
+		user := tc.user
+		router.Use(func(c *gin.Context) {
+			if user != nil {
+				c.Set(controllers.CONTEXT_USER_KEY, user)
+			}
+		})
+		authorized := router.Group("/admin")
+		authorized.Use(AdminScopeRequired())
+		ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+		authorized.GET("/post", PermissionRequired(models.PERM_POST), ok)
+		authorized.GET("/page", PermissionRequired(models.PERM_PAGE), ok)
+		authorized.GET("/user", PermissionRequired(models.PERM_USER), ok)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if w.Code != tc.code {
+			t.Errorf("%+v GET %s: status = %d, want %d", user, tc.path, w.Code, tc.code)
+		}
+	}
+}
+
+func TestTokenRequired(t *testing.T) {
+	loadTestConfig(t)
+	store := models.NewMemoryStore()
+	author := &models.User{GithubLoginId: "author", Role: models.ROLE_AUTHOR}
+	locked := &models.User{GithubLoginId: "locked", Role: models.ROLE_AUTHOR, LockState: true}
+	for _, user := range []*models.User{author, locked} {
+		if err := store.Users().Create(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createToken := func(user *models.User, scopes string) string {
+		raw := controllers.ACCESS_TOKEN_PREFIX + user.GithubLoginId + scopes
+		err := store.AccessTokens().Create(&models.AccessToken{UserID: user.ID, TokenHash: controllers.HashAccessToken(raw), Scopes: scopes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	postsToken := createToken(author, "posts:read")
+	pagesToken := createToken(author, "pages:read") //作者没有页面权限
+	lockedToken := createToken(locked, "posts:read")
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+	api.Use(TokenRequired(store))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	api.GET("/posts", ScopeRequired(models.SCOPE_POSTS_READ), ok)
+	api.GET("/pages", ScopeRequired(models.SCOPE_PAGES_READ), ok)
+
+	cases := []struct {
+		auth string
+		path string
+		code int
+	}{
+		{"", "/api/v1/posts", http.StatusUnauthorized},
+		{"Token " + postsToken, "/api/v1/posts", http.StatusUnauthorized},
+		{"Bearer wblog_unknown", "/api/v1/posts", http.StatusUnauthorized},
+		{"Bearer " + lockedToken, "/api/v1/posts", http.StatusUnauthorized},
+		{"Bearer " + postsToken, "/api/v1/posts", http.StatusOK},
+		{"Bearer " + postsToken, "/api/v1/pages", http.StatusForbidden},
+		{"Bearer " + pagesToken, "/api/v1/pages", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%q GET %s: status = %d, want %d", tc.auth, tc.path, w.Code, tc.code)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%q GET %s: no WWW-Authenticate header", tc.auth, tc.path)
+		}
+	}
+}
+
+// /api/v1下的路由与openapi接口定义一一对应
+func TestAPIRoutesMatchOpenAPI(t *testing.T) {
+	loadTestConfig(t)
+	store := models.NewMemoryStore()
+	permalinks, err := controllers.NewPermalinks(system.DEFAULT_POST_PERMALINK, system.DEFAULT_PAGE_PERMALINK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionStore := controllers.NewSessionStore(store.Sessions(), system.DEFAULT_SESSION_IDLE_TIMEOUT, system.DEFAULT_SESSION_ABSOLUTE_TIMEOUT)
+	ctl := controllers.NewController(store, sessionStore, nil, permalinks, controllers.NewHeuristicSpamChecker(store.Comments()))
+	router := gin.New()
+	setRoutes(router, store, ctl)
+	if err = controllers.NewOpenAPI(system.GetConfiguration().Domain).CheckRoutes(router.Routes()); err != nil {
+		t.Error(err)
+	}
+}
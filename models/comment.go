@@ -0,0 +1,111 @@
+package models
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// 评论的审核状态，新评论根据垃圾评论检查和评论者的历史评论确定状态
+const (
+	COMMENT_STATUS_PENDING  = "pending"  //等待审核
+	COMMENT_STATUS_APPROVED = "approved" //已通过，在文章中显示
+	COMMENT_STATUS_SPAM     = "spam"     //垃圾评论
+	COMMENT_STATUS_TRASH    = "trash"    //回收站
+)
+
+var CommentStatuses = []string{COMMENT_STATUS_PENDING, COMMENT_STATUS_APPROVED, COMMENT_STATUS_SPAM, COMMENT_STATUS_TRASH}
+
+// 游客评论没有关联的用户
+func (comment *Comment) IsGuest() bool {
+	return comment.UserID == 0
+}
+
+// 是否为同一评论者发表，游客按邮箱区分
+func (comment *Comment) SameAuthor(other *Comment) bool {
+	if comment.IsGuest() && other.IsGuest() {
+		return strings.EqualFold(strings.TrimSpace(comment.GuestEmail), strings.TrimSpace(other.GuestEmail))
+	}
+	return comment.UserID == other.UserID
+}
+
+// 游客评论使用填写的昵称、网站和Gravatar头像显示
+func (comment *Comment) fillGuest() {
+	comment.NickName = comment.GuestName
+	comment.AvatarUrl = GravatarURL(comment.GuestEmail)
+	comment.GithubUrl = comment.GuestUrl
+}
+
+// 根据邮箱的md5生成Gravatar头像地址，没有头像时显示默认图案
+func GravatarURL(email string) string {
+	hash := md5.Sum([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "https://www.gravatar.com/avatar/" + hex.EncodeToString(hash[:]) + "?s=64&d=identicon"
+}
+
+func IsCommentStatus(status string) bool {
+	for _, s := range CommentStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// 把评论按回复关系组织为树，返回直接评论，顺序和comments相同，回复按时间正序
+// 超过maxDepth层的回复显示在第maxDepth层，上级评论不存在的回复作为直接评论
+func ThreadComments(comments []*Comment, maxDepth int) []*Comment {
+	byId := make(map[uint]*Comment, len(comments))
+	for _, comment := range comments {
+		comment.Replies = nil
+		byId[comment.ID] = comment
+	}
+	roots := make([]*Comment, 0)
+	for _, comment := range comments {
+		parent, ok := byId[comment.ParentID]
+		if comment.ParentID == 0 || !ok {
+			roots = append(roots, comment)
+			continue
+		}
+		if !parent.Deleted {
+			comment.ReplyTo = parent.NickName
+		}
+		parent.Replies = append(parent.Replies, comment)
+	}
+	var walk func(comments []*Comment, depth int)
+	walk = func(comments []*Comment, depth int) {
+		sort.SliceStable(comments, func(i, j int) bool {
+			if comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+				return comments[i].ID < comments[j].ID
+			}
+			return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+		})
+		for _, comment := range comments {
+			comment.Depth = depth
+			next := depth + 1
+			if next > maxDepth {
+				next = maxDepth
+			}
+			walk(comment.Replies, next)
+		}
+	}
+	for _, root := range roots {
+		root.Depth = 0
+		walk(root.Replies, 1)
+	}
+	return roots
+}
+
+// 按显示顺序展开评论树，回复紧跟在上级评论后面
+func FlattenComments(roots []*Comment) []*Comment {
+	comments := make([]*Comment, 0)
+	var walk func(list []*Comment)
+	walk = func(list []*Comment) {
+		for _, comment := range list {
+			comments = append(comments, comment)
+			walk(comment.Replies)
+		}
+	}
+	walk(roots)
+	return comments
+}
@@ -0,0 +1,299 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 按显示顺序输出"层级:内容"
+func formatThread(roots []*Comment) string {
+	parts := make([]string, 0)
+	for _, comment := range FlattenComments(roots) {
+		parts = append(parts, fmt.Sprintf("%d:%s", comment.Depth, comment.Content))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestThreadComments(t *testing.T) {
+	base := time.Now()
+	newComment := func(id, parentId uint, content string, minutes int) *Comment {
+		comment := &Comment{ParentID: parentId, Content: content, NickName: content}
+		comment.ID = id
+		comment.CreatedAt = base.Add(time.Duration(minutes) * time.Minute)
+		return comment
+	}
+	//列表按时间倒序，回复按时间正序显示
+	list := func() []*Comment {
+		return []*Comment{
+			newComment(7, 99, "orphan", 7),
+			newComment(6, 5, "d4", 6),
+			newComment(5, 4, "d3", 5),
+			newComment(4, 2, "d2", 4),
+			newComment(3, 1, "r2", 3),
+			newComment(2, 1, "r1", 2),
+			newComment(1, 0, "root", 1),
+		}
+	}
+	comments := list()
+	roots := ThreadComments(comments, 3)
+	if got, want := formatThread(roots), "0:orphan 0:root 1:r1 2:d2 3:d3 3:d4 1:r2"; got != want {
+		t.Errorf("thread = %q, want %q", got, want)
+	}
+	if comments[4].ReplyTo != "root" || comments[0].ReplyTo != "" {
+		t.Errorf("ReplyTo = %q, %q", comments[4].ReplyTo, comments[0].ReplyTo)
+	}
+
+	//已删除的评论不显示回复对象
+	comments = list()
+	comments[6].Deleted = true
+	ThreadComments(comments, 1)
+	if comments[4].ReplyTo != "" || comments[1].Depth != 1 {
+		t.Errorf("reply to deleted = %q, depth = %d", comments[4].ReplyTo, comments[1].Depth)
+	}
+}
+
+func TestCommentDelete(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		root := &Comment{PostID: 1, UserID: 1, Content: "root"}
+		if err := store.Comments().Create(root); err != nil {
+			t.Fatal(err)
+		}
+		reply := &Comment{PostID: 1, UserID: 2, Content: "reply", ParentID: root.ID}
+		if err := store.Comments().Create(reply); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.Comments().Delete(999); err != ErrNotFound {
+			t.Errorf("delete missing comment: %v", err)
+		}
+		//有回复的评论保留，清空内容
+		if err := store.Comments().Delete(root.ID); err != nil {
+			t.Fatal(err)
+		}
+		c, err := store.Comments().Get(root.ID)
+		if err != nil || !c.Deleted || c.Content != "" {
+			t.Fatalf("deleted comment with replies = %+v, %v", c, err)
+		}
+		//最后一个回复删除后一起删除已删除的上级评论
+		if err = store.Comments().Delete(reply.ID); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []uint{root.ID, reply.ID} {
+			if _, err = store.Comments().Get(id); err != ErrNotFound {
+				t.Errorf("comment %d = %v", id, err)
+			}
+		}
+	})
+}
+
+func TestCommentStatus(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		post := &Post{Title: "post", Slug: "post"}
+		user := &User{Email: "user@example.com", NickName: "user"}
+		if err := store.Posts().Create(post); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Users().Create(user); err != nil {
+			t.Fatal(err)
+		}
+		statuses := []string{COMMENT_STATUS_PENDING, COMMENT_STATUS_APPROVED, COMMENT_STATUS_SPAM, COMMENT_STATUS_PENDING}
+		comments := make([]*Comment, len(statuses))
+		for i, status := range statuses {
+			comments[i] = &Comment{PostID: post.ID, UserID: user.ID, Content: status, Status: status}
+			if err := store.Comments().Create(comments[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		counts, err := store.Comments().CountByStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts[COMMENT_STATUS_PENDING] != 2 || counts[COMMENT_STATUS_APPROVED] != 1 || counts[COMMENT_STATUS_SPAM] != 1 {
+			t.Errorf("counts = %v", counts)
+		}
+		//文章中只显示通过审核的评论
+		if list, _ := store.Comments().ListByPostId(post.ID); len(list) != 1 || list[0].ID != comments[1].ID {
+			t.Errorf("ListByPostId = %+v", list)
+		}
+
+		if err := store.Comments().SetStatus(comments[0].ID, COMMENT_STATUS_APPROVED); err != nil {
+			t.Fatal(err)
+		}
+		comment, _ := store.Comments().Get(comments[0].ID)
+		if comment.Status != COMMENT_STATUS_APPROVED || !comment.ReadState {
+			t.Errorf("status = %s, read = %v", comment.Status, comment.ReadState)
+		}
+		if n, _ := store.Comments().CountApprovedByUserId(user.ID); n != 2 {
+			t.Errorf("CountApprovedByUserId = %d, want 2", n)
+		}
+		if list, _ := store.Comments().Search(&CommentFilter{Status: COMMENT_STATUS_PENDING}); len(list) != 1 || list[0].ID != comments[3].ID {
+			t.Errorf("Search = %+v", list)
+		}
+		if list, _ := store.Comments().ListSince(time.Now().Add(-time.Minute)); len(list) != 4 {
+			t.Errorf("ListSince = %d, want 4", len(list))
+		}
+		if list, _ := store.Comments().ListSince(time.Now().Add(time.Minute)); len(list) != 0 {
+			t.Errorf("ListSince future = %d, want 0", len(list))
+		}
+	})
+}
+
+func TestGravatarURL(t *testing.T) {
+	//邮箱忽略大小写和首尾空白
+	want := "https://www.gravatar.com/avatar/0bc83cb571cd1c50ba6f3e8a78ef1346?s=64&d=identicon"
+	for _, email := range []string{"myemailaddress@example.com", " MyEmailAddress@example.com "} {
+		if got := GravatarURL(email); got != want {
+			t.Errorf("GravatarURL(%q) = %s", email, got)
+		}
+	}
+}
+
+func TestCommentSameAuthor(t *testing.T) {
+	user := &Comment{UserID: 1}
+	guest := &Comment{GuestEmail: "guest@example.com"}
+	cases := []struct {
+		a, b *Comment
+		same bool
+	}{
+		{user, &Comment{UserID: 1}, true},
+		{user, &Comment{UserID: 2}, false},
+		{user, guest, false},
+		{guest, &Comment{GuestEmail: " Guest@Example.com"}, true},
+		{guest, &Comment{GuestEmail: "other@example.com"}, false},
+	}
+	for _, c := range cases {
+		if got := c.a.SameAuthor(c.b); got != c.same {
+			t.Errorf("SameAuthor(%+v, %+v) = %v", c.a, c.b, got)
+		}
+	}
+}
+
+func TestListGuestComments(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		post := &Post{Title: "post", Slug: "post"}
+		if err := store.Posts().Create(post); err != nil {
+			t.Fatal(err)
+		}
+		comment := &Comment{PostID: post.ID, Content: "hello", Status: COMMENT_STATUS_APPROVED,
+			GuestName: "guest", GuestEmail: "guest@example.com", GuestUrl: "https://guest.test"}
+		//用户已删除的评论不显示
+		orphan := &Comment{PostID: post.ID, UserID: 99, Content: "orphan", Status: COMMENT_STATUS_APPROVED}
+		for _, c := range []*Comment{comment, orphan} {
+			if err := store.Comments().Create(c); err != nil {
+				t.Fatal(err)
+			}
+		}
+		comments, err := store.Comments().ListByPostId(post.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(comments) != 1 {
+			t.Fatalf("comments = %+v", comments)
+		}
+		c := comments[0]
+		if c.NickName != "guest" || c.GithubUrl != "https://guest.test" || c.AvatarUrl != GravatarURL("guest@example.com") {
+			t.Errorf("comment = %+v", c)
+		}
+	})
+}
+
+func TestCommentAuthorNickName(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		post := &Post{Title: "post", Slug: "post"}
+		if err := store.Posts().Create(post); err != nil {
+			t.Fatal(err)
+		}
+		//有昵称时显示昵称，昵称为空时才显示github登录名
+		users := []*User{
+			{Email: "alice@example.com", NickName: "Alice", GithubLoginId: "alice-gh"},
+			{Email: "bob@example.com", GithubLoginId: "bob-gh"},
+			{Email: "carol@example.com", NickName: "Carol"},
+		}
+		for i, user := range users {
+			if err := store.Users().Create(user); err != nil {
+				t.Fatal(err)
+			}
+			comment := &Comment{PostID: post.ID, UserID: user.ID, Content: fmt.Sprint(i), Status: COMMENT_STATUS_APPROVED}
+			if err := store.Comments().Create(comment); err != nil {
+				t.Fatal(err)
+			}
+		}
+		comments, err := store.Comments().ListByPostId(post.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make(map[string]string)
+		for _, c := range comments {
+			names[c.Content] = c.NickName
+		}
+		if names["0"] != "Alice" || names["1"] != "bob-gh" || names["2"] != "Carol" {
+			t.Errorf("nick names = %v", names)
+		}
+	})
+}
+
+func TestCommentSearch(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		comments := []*Comment{
+			{PostID: 1, UserID: 1, Content: "Hello World", Status: COMMENT_STATUS_APPROVED},
+			{PostID: 1, UserID: 2, Content: "spam", Status: COMMENT_STATUS_SPAM},
+			{PostID: 2, UserID: 1, Content: "other post", Status: COMMENT_STATUS_PENDING},
+			{PostID: 2, Content: "guest", GuestName: "Visitor", GuestEmail: "v@example.com", Status: COMMENT_STATUS_PENDING},
+		}
+		for _, comment := range comments {
+			if err := store.Comments().Create(comment); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cases := []struct {
+			filter CommentFilter
+			want   []int
+		}{
+			{CommentFilter{}, []int{3, 2, 1, 0}},
+			{CommentFilter{Status: COMMENT_STATUS_PENDING}, []int{3, 2}},
+			{CommentFilter{PostID: 1}, []int{1, 0}},
+			{CommentFilter{UserID: 1}, []int{2, 0}},
+			{CommentFilter{UserID: 1, PostID: 2}, []int{2}},
+			//内容、游客昵称和邮箱不区分大小写
+			{CommentFilter{Query: "world"}, []int{0}},
+			{CommentFilter{Query: "visitor"}, []int{3}},
+			{CommentFilter{Query: "V@EXAMPLE"}, []int{3}},
+			{CommentFilter{Query: "missing"}, nil},
+		}
+		for _, c := range cases {
+			list, err := store.Comments().Search(&c.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, comment := range list {
+				for i := range comments {
+					if comments[i].ID == comment.ID {
+						got = append(got, i)
+					}
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(c.want) {
+				t.Errorf("Search(%+v) = %v, want %v", c.filter, got, c.want)
+			}
+		}
+
+		if err := store.Comments().UpdateContent(comments[0].ID, "edited"); err != nil {
+			t.Fatal(err)
+		}
+		if c, _ := store.Comments().Get(comments[0].ID); c.Content != "edited" {
+			t.Errorf("content = %q", c.Content)
+		}
+		//已经在回收站中的评论不计数
+		store.Comments().SetStatus(comments[2].ID, COMMENT_STATUS_TRASH)
+		count, err := store.Comments().SetStatusByUserId(1, COMMENT_STATUS_TRASH)
+		if err != nil || count != 1 {
+			t.Errorf("SetStatusByUserId = %d, %v", count, err)
+		}
+		if list, _ := store.Comments().Search(&CommentFilter{Status: COMMENT_STATUS_TRASH}); len(list) != 2 {
+			t.Errorf("trash = %d, want 2", len(list))
+		}
+	})
+}
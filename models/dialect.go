@@ -0,0 +1,76 @@
+package models
+
+import (
+	"fmt"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	DRIVER_MYSQL    = "mysql"
+	DRIVER_SQLITE   = "sqlite3"
+	DRIVER_POSTGRES = "postgres"
+)
+
+// 数据库方言，屏蔽各数据库之间sql语法的差异
+type Dialect interface {
+	Name() string                   //gorm中的方言名称，同时也是database/sql的驱动名称
+	MonthExpr(column string) string //按月份(yyyy-mm)格式化时间字段
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return DRIVER_MYSQL
+}
+
+func (mysqlDialect) MonthExpr(column string) string {
+	return fmt.Sprintf("date_format(%s,'%%Y-%%m')", column)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return DRIVER_SQLITE
+}
+
+func (sqliteDialect) MonthExpr(column string) string {
+	return fmt.Sprintf("strftime('%%Y-%%m',%s)", column)
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return DRIVER_POSTGRES
+}
+
+func (postgresDialect) MonthExpr(column string) string {
+	return fmt.Sprintf("to_char(%s,'YYYY-MM')", column)
+}
+
+var dialects = map[string]Dialect{
+	DRIVER_MYSQL:    mysqlDialect{},
+	DRIVER_SQLITE:   sqliteDialect{},
+	"sqlite":        sqliteDialect{},
+	DRIVER_POSTGRES: postgresDialect{},
+	"postgresql":    postgresDialect{},
+}
+
+// 注册数据库方言，可用于扩展其他数据库
+func RegisterDialect(name string, d Dialect) {
+	dialects[name] = d
+}
+
+// 根据配置的driver获取方言，driver为空时默认使用mysql
+func GetDialect(driver string) (Dialect, error) {
+	if driver == "" {
+		driver = DRIVER_MYSQL
+	}
+	d, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver: %s", driver)
+	}
+	return d, nil
+}
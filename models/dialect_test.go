@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGetDialect(t *testing.T) {
+	cases := map[string]string{
+		"":           DRIVER_MYSQL,
+		"mysql":      DRIVER_MYSQL,
+		"sqlite3":    DRIVER_SQLITE,
+		"sqlite":     DRIVER_SQLITE,
+		"postgres":   DRIVER_POSTGRES,
+		"postgresql": DRIVER_POSTGRES,
+	}
+	for driver, name := range cases {
+		d, err := GetDialect(driver)
+		if err != nil {
+			t.Fatalf("GetDialect(%q): %v", driver, err)
+		}
+		if d.Name() != name {
+			t.Errorf("GetDialect(%q).Name() = %q, want %q", driver, d.Name(), name)
+		}
+	}
+	if _, err := GetDialect("oracle"); err == nil {
+		t.Error("GetDialect(oracle) should fail")
+	}
+}
+
+// 归档查询依赖方言的月份表达式
+func TestPostArchives(t *testing.T) {
+	store, db := openTestStore(t)
+	defer db.Close()
+
+	created := []time.Time{
+		time.Date(2020, 1, 5, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 1, 20, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for i := range created {
+		//按发布时间归档
+		post := &Post{Title: "post", Slug: fmt.Sprintf("post-%d", i), IsPublished: true, PublishAt: &created[i]}
+		if err := store.Posts().Create(post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archives, err := store.Posts().ListArchives()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 2 || archives[0].Total != 1 || archives[1].Total != 2 {
+		t.Fatalf("archives = %+v", archives)
+	}
+	count, err := store.Posts().CountByArchive(2020, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("CountByArchive = %d, want 2", count)
+	}
+	posts, err := store.Posts().ListByArchive(2020, 3, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 {
+		t.Errorf("ListByArchive returned %d posts, want 1", len(posts))
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDraftRepository(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		drafts := store.Drafts()
+		if _, err := drafts.Get(SLUG_KIND_POST, 1, 1); err != ErrNotFound {
+			t.Fatalf("Get without draft = %v", err)
+		}
+		if err := drafts.Save(&Draft{Kind: SLUG_KIND_POST, TargetID: 1, UserID: 1, Title: "a", Tags: "1"}); err != nil {
+			t.Fatal(err)
+		}
+		//每个用户只有一份草稿，再次保存时覆盖
+		time.Sleep(10 * time.Millisecond)
+		if err := drafts.Save(&Draft{Kind: SLUG_KIND_POST, TargetID: 1, UserID: 1, Title: "b", Body: "body"}); err != nil {
+			t.Fatal(err)
+		}
+		draft, err := drafts.Get(SLUG_KIND_POST, 1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if draft.Title != "b" || draft.Body != "body" || draft.Tags != "" || !draft.UpdatedAt.After(draft.CreatedAt) {
+			t.Errorf("draft = %+v", draft)
+		}
+		time.Sleep(10 * time.Millisecond)
+		drafts.Save(&Draft{Kind: SLUG_KIND_POST, TargetID: 1, UserID: 2, Title: "c"})
+		drafts.Save(&Draft{Kind: SLUG_KIND_PAGE, TargetID: 1, UserID: 1, Title: "page"})
+
+		list, err := drafts.ListByTarget(SLUG_KIND_POST, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || list[0].UserID != 2 {
+			t.Fatalf("ListByTarget = %+v", list)
+		}
+		if err = drafts.Delete(SLUG_KIND_POST, 1, 2); err != nil {
+			t.Fatal(err)
+		}
+		if list, _ = drafts.ListByTarget(SLUG_KIND_POST, 1); len(list) != 1 {
+			t.Errorf("after Delete = %+v", list)
+		}
+		if err = drafts.DeleteByTarget(SLUG_KIND_POST, 1); err != nil {
+			t.Fatal(err)
+		}
+		if list, _ = drafts.ListByTarget(SLUG_KIND_POST, 1); len(list) != 0 {
+			t.Errorf("after DeleteByTarget = %+v", list)
+		}
+		if _, err = drafts.Get(SLUG_KIND_PAGE, 1, 1); err != nil {
+			t.Errorf("page draft deleted: %v", err)
+		}
+	})
+}
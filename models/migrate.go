@@ -0,0 +1,162 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 数据库迁移步骤，Up升级，Down回滚
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// table schema_migrations 已执行的迁移记录
+type SchemaMigration struct {
+	Version   uint `gorm:"primary_key;auto_increment:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// 迁移状态
+type MigrationStatus struct {
+	Version   uint
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// 按版本号排序后的迁移列表
+func sortedMigrations() []*Migration {
+	list := make([]*Migration, len(migrations))
+	copy(list, migrations)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list
+}
+
+// 已执行的迁移，key为版本号
+func appliedMigrations(db *gorm.DB) (map[uint]*SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}).Error; err != nil {
+		return nil, err
+	}
+	var records []*SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]*SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// 在事务中执行单个迁移步骤
+func runMigration(db *gorm.DB, fn func(tx *gorm.DB) error, after func(tx *gorm.DB) error) (err error) {
+	tx := db.Begin()
+	if err = tx.Error; err != nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	if err = fn(tx); err != nil {
+		return
+	}
+	if err = after(tx); err != nil {
+		return
+	}
+	return tx.Commit().Error
+}
+
+// 执行所有未执行的迁移
+func MigrateUp(db *gorm.DB) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range sortedMigrations() {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		record := &SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+		err = runMigration(db, m.Up, func(tx *gorm.DB) error {
+			return tx.Create(record).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s up: %v", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// 回滚最近一次执行的迁移
+func MigrateDown(db *gorm.DB) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	list := sortedMigrations()
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err = runMigration(db, m.Down, func(tx *gorm.DB) error {
+			return tx.Delete(&SchemaMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s down: %v", m.Version, m.Name, err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// 列出所有迁移及其执行状态
+func ListMigrationStatus(db *gorm.DB) ([]*MigrationStatus, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*MigrationStatus, 0)
+	for _, m := range sortedMigrations() {
+		status := &MigrationStatus{Version: m.Version, Name: m.Name}
+		if record, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+		}
+		list = append(list, status)
+	}
+	return list, nil
+}
+
+// 检查数据库结构是否为最新，存在未执行的迁移时返回错误
+func CheckSchema(db *gorm.DB) error {
+	list, err := ListMigrationStatus(db)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, status := range list {
+		if !status.Applied {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("database schema is behind, %d pending migration(s), run with -migrate up", pending)
+	}
+	return nil
+}
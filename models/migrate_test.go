@@ -0,0 +1,158 @@
+package models
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 内存sqlite数据库，限制为单连接，保证所有查询访问同一个库
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := InitDB(DRIVER_SQLITE, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	return db
+}
+
+func countApplied(t *testing.T, db *gorm.DB) int {
+	t.Helper()
+	list, err := ListMigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != len(migrations) {
+		t.Fatalf("status lists %d migrations, want %d", len(list), len(migrations))
+	}
+	applied := 0
+	for _, status := range list {
+		if status.Applied {
+			applied++
+		}
+	}
+	return applied
+}
+
+// 全部升级、逐个回滚、再全部升级，每一步的Down都要能撤销对应的Up
+func TestMigrateRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	if err := CheckSchema(db); err == nil {
+		t.Fatal("CheckSchema on an empty database should report pending migrations")
+	}
+	if err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	if n := countApplied(t, db); n != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", n, len(migrations))
+	}
+	//重复执行不会出错
+	if err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := len(migrations); i > 0; i-- {
+		if err := MigrateDown(db); err != nil {
+			t.Fatal(err)
+		}
+		if n := countApplied(t, db); n != i-1 {
+			t.Fatalf("applied %d migrations after rolling back, want %d", n, i-1)
+		}
+	}
+	if err := CheckSchema(db); err == nil {
+		t.Fatal("CheckSchema after rolling everything back should fail")
+	}
+	if db.HasTable("posts") || db.HasTable("users") {
+		t.Fatal("initial tables should be dropped by the first migration's Down")
+	}
+	//没有可回滚的迁移时什么也不做
+	if err := MigrateDown(db); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchema(db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 回滚到迁移3之前再升级，角色和发布状态按之前的版本的含义保留
+func TestMigrateRoundTripData(t *testing.T) {
+	store, db := openTestStore(t)
+	defer db.Close()
+
+	roles := []string{ROLE_OWNER, ROLE_EDITOR, ROLE_AUTHOR, ROLE_COMMENTER}
+	users := make([]*User, len(roles))
+	for i, role := range roles {
+		users[i] = &User{Email: role + "@example.com", Role: role}
+		if err := store.Users().Create(users[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	posts := []*Post{
+		{Title: "published", Slug: "published", IsPublished: true, PublishAt: &past},
+		{Title: "scheduled", Slug: "scheduled", PublishAt: &future},
+		{Title: "future", Slug: "future", IsPublished: true, PublishAt: &future},
+	}
+	for _, post := range posts {
+		if err := store.Posts().Create(post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for countApplied(t, db) > 2 {
+		if err := MigrateDown(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var admins []string
+	if err := db.Table("users").Where("is_admin = ?", true).Order("id").Pluck("email", &admins).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(admins, ","); got != "owner@example.com,editor@example.com" {
+		t.Errorf("admins after rollback = %s", got)
+	}
+	//之前的版本只按is_published显示文章
+	var published []string
+	if err := db.Table("posts").Where("is_published = ?", true).Order("id").Pluck("title", &published).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(published, ","); got != "published" {
+		t.Errorf("published posts after rollback = %s", got)
+	}
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{ROLE_OWNER, ROLE_EDITOR, ROLE_COMMENTER, ROLE_COMMENTER} {
+		if user, _ := store.Users().Get(users[i].ID); user.Role != want {
+			t.Errorf("%s role after upgrade = %s, want %s", users[i].Email, user.Role, want)
+		}
+	}
+	visible, err := store.Posts().ListPublished(0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visible) != 1 || visible[0].ID != posts[0].ID {
+		t.Errorf("visible posts after upgrade = %+v", visible)
+	}
+	//发布时间未到的文章在发布时间到达后由定时任务发布
+	due, _ := store.Posts().ListDue()
+	if len(due) != 0 {
+		t.Errorf("due posts = %+v", due)
+	}
+	if post, _ := store.Posts().Get(posts[2].ID); post.IsPublished || post.PublishAt == nil {
+		t.Errorf("future post after upgrade = %+v", post)
+	}
+}
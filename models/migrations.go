@@ -0,0 +1,822 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	"github.com/mozillazg/go-pinyin"
+)
+
+// 所有迁移步骤，新增迁移时追加到末尾，版本号递增，已发布的迁移不要再修改
+// 迁移中使用当时的表结构快照，不直接引用会随版本变化的model
+var migrations = []*Migration{
+	{
+		Version: 1,
+		Name:    "create_initial_schema",
+		Up: func(tx *gorm.DB) error {
+			//兼容之前由AutoMigrate创建的数据库，已存在的表只会补充缺失的列
+			err := tx.AutoMigrate(&page0001{}, &post0001{}, &tag0001{}, &postTag0001{}, &user0001{}, &comment0001{}, &subscriber0001{}, &link0001{}, &smmsFile0001{}).Error
+			if err != nil {
+				return err
+			}
+			if tx.Dialect().HasIndex("post_tags", "uk_post_tag") {
+				return nil
+			}
+			return tx.Model(&postTag0001{}).AddUniqueIndex("uk_post_tag", "post_id", "tag_id").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&page0001{}, &post0001{}, &tag0001{}, &postTag0001{}, &user0001{}, &comment0001{}, &subscriber0001{}, &link0001{}, &smmsFile0001{}).Error
+		},
+	},
+	{
+		Version: 2,
+		Name:    "verify_existing_users",
+		Up: func(tx *gorm.DB) error {
+			//启用邮箱验证之前注册的用户视为已验证，避免升级后无法进入后台
+			return tx.Exec("UPDATE users SET verify_state = '1' WHERE email IS NOT NULL AND email <> ''").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			//无法区分哪些用户是由该迁移标记的，回滚时保持不变
+			return nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add_user_roles",
+		Up: func(tx *gorm.DB) error {
+			err := tx.AutoMigrate(&user0003{}, &post0003{}).Error
+			if err != nil {
+				return err
+			}
+			//原来的第一个管理员成为owner，其余管理员成为editor，没有管理员时由第一个用户成为owner
+			var ids []uint
+			if err = tx.Table("users").Where("is_admin = ?", true).Order("id").Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				if err = tx.Table("users").Order("id").Limit(1).Pluck("id", &ids).Error; err != nil {
+					return err
+				}
+			}
+			if err = tx.Exec("UPDATE users SET role = ?", ROLE_COMMENTER).Error; err != nil {
+				return err
+			}
+			if err = tx.Exec("UPDATE users SET role = ? WHERE is_admin = ?", ROLE_EDITOR, true).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			if err = tx.Exec("UPDATE users SET role = ? WHERE id = ?", ROLE_OWNER, ids[0]).Error; err != nil {
+				return err
+			}
+			//已有文章归属于owner
+			return tx.Exec("UPDATE posts SET user_id = ? WHERE user_id IS NULL OR user_id = 0", ids[0]).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			//sqlite不支持删除列，回滚时只恢复is_admin，保留role和user_id列
+			//原来的管理员可以管理所有内容，author只能管理自己的文章，不能成为管理员
+			if err := tx.Exec("UPDATE users SET is_admin = ?", false).Error; err != nil {
+				return err
+			}
+			return tx.Exec("UPDATE users SET is_admin = ? WHERE role IN (?)", true, []string{ROLE_OWNER, ROLE_EDITOR}).Error
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_sessions",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&session0004{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&session0004{}).Error
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_login_attempts",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&user0005{}, &loginAttempt0005{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			//sqlite不支持删除列，回滚时保留users表新增的列
+			return tx.DropTableIfExists(&loginAttempt0005{}).Error
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add_two_factor",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&user0006{}, &recoveryCode0006{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			//sqlite不支持删除列，回滚时关闭所有用户的两步验证
+			if err := tx.Exec("UPDATE users SET totp_enabled = ?", false).Error; err != nil {
+				return err
+			}
+			return tx.DropTableIfExists(&recoveryCode0006{}).Error
+		},
+	},
+	{
+		Version: 7,
+		Name:    "create_user_identities",
+		Up: func(tx *gorm.DB) error {
+			//旧版本只保存了github登录名，已绑定github的用户需要登录后在个人资料中重新绑定
+			return tx.AutoMigrate(&userIdentity0007{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&userIdentity0007{}).Error
+		},
+	},
+	{
+		Version: 8,
+		Name:    "create_access_tokens",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&accessToken0008{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&accessToken0008{}).Error
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_slugs",
+		Up: func(tx *gorm.DB) error {
+			err := tx.AutoMigrate(&page0009{}, &post0009{}, &slugHistory0009{}).Error
+			if err != nil {
+				return err
+			}
+			//已有的文章和页面根据标题生成slug，再添加唯一索引
+			for _, table := range []string{"posts", "pages"} {
+				if err = backfillSlugs0009(tx, table); err != nil {
+					return err
+				}
+				index := "uk_" + table + "_slug"
+				if tx.Dialect().HasIndex(table, index) {
+					continue
+				}
+				if err = tx.Table(table).AddUniqueIndex(index, "slug").Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			//sqlite不支持删除列，回滚时只删除索引，保留slug列
+			for _, table := range []string{"posts", "pages"} {
+				index := "uk_" + table + "_slug"
+				if !tx.Dialect().HasIndex(table, index) {
+					continue
+				}
+				if err := tx.Table(table).RemoveIndex(index).Error; err != nil {
+					return err
+				}
+			}
+			return tx.DropTableIfExists(&slugHistory0009{}).Error
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_publish_at",
+		Up: func(tx *gorm.DB) error {
+			err := tx.AutoMigrate(&page0010{}, &post0010{}).Error
+			if err != nil {
+				return err
+			}
+			//已发布的文章和页面以创建时间作为发布时间
+			for _, table := range []string{"posts", "pages"} {
+				if err = backfillPublishAt0010(tx, table); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			//sqlite不支持删除列，回滚时只删除索引，保留publish_at列
+			//之前的版本不认识发布时间，发布时间未到的文章和页面改为草稿，避免提前显示
+			for _, table := range []string{"posts", "pages"} {
+				err := tx.Table(table).Where("is_published = ? and publish_at > ?", true, utcNow()).
+					UpdateColumn("is_published", false).Error
+				if err != nil {
+					return err
+				}
+				index := "idx_" + table + "_publish_at"
+				if !tx.Dialect().HasIndex(table, index) {
+					continue
+				}
+				if err := tx.Table(table).RemoveIndex(index).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 11,
+		Name:    "create_revisions",
+		Up: func(tx *gorm.DB) error {
+			err := tx.AutoMigrate(&revision0011{}).Error
+			if err != nil {
+				return err
+			}
+			//已有的文章和页面以当前内容作为第一个版本
+			return backfillRevisions0011(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&revision0011{}).Error
+		},
+	},
+	{
+		Version: 12,
+		Name:    "create_drafts",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&draft0012{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&draft0012{}).Error
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_comment_replies",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&comment0013{}, &user0013{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			//sqlite不支持删除列，回滚时只删除索引，保留parent_id等列，回复显示为直接评论
+			if !tx.Dialect().HasIndex("comments", "idx_comments_parent_id") {
+				return nil
+			}
+			return tx.Table("comments").RemoveIndex("idx_comments_parent_id").Error
+		},
+	},
+	{
+		Version: 14,
+		Name:    "add_comment_status",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&comment0014{}).Error; err != nil {
+				return err
+			}
+			//已有的评论都已经显示在文章中，视为已通过审核
+			return tx.Table("comments").Where("status is null or status = ''").
+				UpdateColumn("status", COMMENT_STATUS_APPROVED).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if !tx.Dialect().HasIndex("comments", "idx_comments_status") {
+				return nil
+			}
+			return tx.Table("comments").RemoveIndex("idx_comments_status").Error
+		},
+	},
+	{
+		Version: 15,
+		Name:    "add_guest_comments",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&comment0015{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			//sqlite不支持删除列，回滚时保留游客信息列
+			return nil
+		},
+	},
+	{
+		Version: 16,
+		Name:    "create_user_tokens",
+		Up: func(tx *gorm.DB) error {
+			//users表中的secret_key和out_time不再使用，尚未使用的重置密码链接需要重新获取
+			return tx.AutoMigrate(&userToken0016{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&userToken0016{}).Error
+		},
+	},
+	{
+		Version: 17,
+		Name:    "create_settings",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&setting0017{}).Error; err != nil {
+				return err
+			}
+			//已有用户时第一个用户已经是站长
+			var count int
+			if err := tx.Table("users").Count(&count).Error; err != nil {
+				return err
+			}
+			claimed := "0"
+			if count > 0 {
+				claimed = "1"
+			}
+			return tx.Create(&setting0017{Name: "owner_claimed", Value: claimed}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&setting0017{}).Error
+		},
+	},
+	{
+		Version: 18,
+		Name:    "add_totp_last_step",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&user0018{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			//sqlite不支持删除列，回滚时保留totp_last_step列
+			return nil
+		},
+	},
+}
+
+// 为没有版本的文章和页面创建第一个版本，保存时间为最后修改时间
+func backfillRevisions0011(tx *gorm.DB) error {
+	var posts []struct {
+		ID        uint
+		UpdatedAt time.Time
+		UserID    uint
+		Title     string
+		Body      string
+	}
+	err := tx.Table("posts").Select("id, updated_at, user_id, title, body").Order("id").Scan(&posts).Error
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		var tags []string
+		err = tx.Table("tags").Joins("join post_tags on post_tags.tag_id = tags.id").
+			Where("post_tags.post_id = ?", post.ID).Pluck("tags.name", &tags).Error
+		if err != nil {
+			return err
+		}
+		sort.Strings(tags)
+		revision := &revision0011{CreatedAt: post.UpdatedAt, Kind: "post", TargetID: post.ID, UserID: post.UserID,
+			Title: post.Title, Body: post.Body, Tags: strings.Join(tags, ",")}
+		if err = tx.Create(revision).Error; err != nil {
+			return err
+		}
+	}
+	var pages []struct {
+		ID        uint
+		UpdatedAt time.Time
+		Title     string
+		Body      string
+	}
+	if err = tx.Table("pages").Select("id, updated_at, title, body").Order("id").Scan(&pages).Error; err != nil {
+		return err
+	}
+	for _, page := range pages {
+		revision := &revision0011{CreatedAt: page.UpdatedAt, Kind: "page", TargetID: page.ID, Title: page.Title, Body: page.Body}
+		if err = tx.Create(revision).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 为slug为空的记录生成slug，重复时追加序号，纯数字时加上类型前缀
+func backfillSlugs0009(tx *gorm.DB, table string) error {
+	kind := strings.TrimSuffix(table, "s")
+	var rows []struct {
+		ID    uint
+		Title string
+		Slug  string
+	}
+	if err := tx.Table(table).Select("id, title, slug").Order("id").Scan(&rows).Error; err != nil {
+		return err
+	}
+	used := make(map[string]bool)
+	for _, row := range rows {
+		if row.Slug != "" {
+			used[row.Slug] = true
+		}
+	}
+	for _, row := range rows {
+		if row.Slug != "" {
+			continue
+		}
+		base := slugify0009(row.Title)
+		if base == "" || strings.Trim(base, "0123456789") == "" {
+			base = strings.Trim(kind+"-"+base, "-")
+		}
+		if len(base) > slugMaxLength0009-4 {
+			base = strings.TrimRight(base[:slugMaxLength0009-4], "-")
+		}
+		slug := base
+		for n := 2; used[slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[slug] = true
+		if err := tx.Table(table).Where("id = ?", row.ID).UpdateColumn("slug", slug).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const slugMaxLength0009 = 80
+
+// 0009时的Slugify，之后修改models.Slugify不影响这里的结果
+func slugify0009(title string) string {
+	args := pinyin.NewArgs()
+	words := make([]string, 0)
+	word := make([]rune, 0)
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range title {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			word = append(word, unicode.ToLower(r))
+		case unicode.Is(unicode.Han, r):
+			flush()
+			words = append(words, pinyin.LazyPinyin(string(r), args)...)
+		default:
+			flush()
+		}
+	}
+	flush()
+	slug := ""
+	for _, w := range words {
+		next := w
+		if slug != "" {
+			next = slug + "-" + w
+		}
+		if len(next) > slugMaxLength0009 {
+			if slug == "" {
+				slug = w[:slugMaxLength0009]
+			}
+			break
+		}
+		slug = next
+	}
+	return slug
+}
+
+// 为已发布但没有发布时间的记录设置发布时间，和repository一致以UTC保存
+func backfillPublishAt0010(tx *gorm.DB, table string) error {
+	var rows []struct {
+		ID        uint
+		CreatedAt time.Time
+	}
+	err := tx.Table(table).Select("id, created_at").Where("is_published = ? and publish_at is null", true).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err = tx.Table(table).Where("id = ?", row.ID).UpdateColumn("publish_at", row.CreatedAt.UTC()).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 0001 初始表结构
+type page0001 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Body        string
+	View        int
+	IsPublished bool
+}
+
+func (page0001) TableName() string { return "pages" }
+
+type post0001 struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Body        string
+	View        int
+	IsPublished bool
+}
+
+func (post0001) TableName() string { return "posts" }
+
+type tag0001 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Name      string
+}
+
+func (tag0001) TableName() string { return "tags" }
+
+type postTag0001 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	PostId    uint
+	TagId     uint
+}
+
+func (postTag0001) TableName() string { return "post_tags" }
+
+type user0001 struct {
+	gorm.Model
+	Email         string    `gorm:"unique_index;default:null"`
+	Telephone     string    `gorm:"unique_index;default:null"`
+	Password      string    `gorm:"default:null"`
+	VerifyState   string    `gorm:"default:'0'"`
+	SecretKey     string    `gorm:"default:null"`
+	OutTime       time.Time `gorm:"default:null"`
+	GithubLoginId string    `gorm:"unique_index;default:null"`
+	GithubUrl     string
+	IsAdmin       bool
+	AvatarUrl     string
+	NickName      string
+	LockState     bool `gorm:"default:'0'"`
+}
+
+func (user0001) TableName() string { return "users" }
+
+type comment0001 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint
+	Content   string
+	PostID    uint
+	ReadState bool `gorm:"default:'0'"`
+}
+
+func (comment0001) TableName() string { return "comments" }
+
+type subscriber0001 struct {
+	gorm.Model
+	Email          string `gorm:"unique_index"`
+	VerifyState    bool   `gorm:"default:'0'"`
+	SubscribeState bool   `gorm:"default:'1'"`
+	OutTime        time.Time
+	SecretKey      string
+	Signature      string
+}
+
+func (subscriber0001) TableName() string { return "subscribers" }
+
+type link0001 struct {
+	gorm.Model
+	Name string
+	Url  string
+	Sort int `gorm:"default:'0'"`
+	View int
+}
+
+func (link0001) TableName() string { return "links" }
+
+type smmsFile0001 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	FileName  string
+	StoreName string
+	Size      int
+	Width     int
+	Height    int
+	Hash      string
+	Delete    string
+	Url       string
+	Path      string
+}
+
+func (smmsFile0001) TableName() string { return "smms_files" }
+
+// 0003 用户角色和文章作者
+type user0003 struct {
+	ID   uint   `gorm:"primary_key"`
+	Role string `gorm:"default:'commenter'"`
+}
+
+func (user0003) TableName() string { return "users" }
+
+type post0003 struct {
+	ID     uint `gorm:"primary_key"`
+	UserID uint
+}
+
+func (post0003) TableName() string { return "posts" }
+
+// 0004 服务端session
+type session0004 struct {
+	ID         string `gorm:"primary_key;size:64"`
+	UserID     uint   `gorm:"index"`
+	Data       []byte
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+}
+
+func (session0004) TableName() string { return "sessions" }
+
+// 0005 登录失败统计和登录记录
+type user0005 struct {
+	ID           uint `gorm:"primary_key"`
+	FailedLogins int  `gorm:"default:'0'"`
+	LastFailedAt *time.Time
+	LockedUntil  *time.Time
+}
+
+func (user0005) TableName() string { return "users" }
+
+type loginAttempt0005 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UserID    uint `gorm:"index"`
+	Username  string
+	IP        string `gorm:"index"`
+	Result    string
+}
+
+func (loginAttempt0005) TableName() string { return "login_attempts" }
+
+// 0006 两步验证
+type user0006 struct {
+	ID          uint   `gorm:"primary_key"`
+	TotpSecret  string `gorm:"default:null"`
+	TotpEnabled bool   `gorm:"default:'0'"`
+}
+
+func (user0006) TableName() string { return "users" }
+
+type recoveryCode0006 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UserID    uint `gorm:"index"`
+	CodeHash  string
+	UsedAt    *time.Time
+}
+
+func (recoveryCode0006) TableName() string { return "recovery_codes" }
+
+// 0007 第三方登录账号
+type userIdentity0007 struct {
+	ID            uint `gorm:"primary_key"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	UserID        uint   `gorm:"unique_index:idx_identity_user_provider"`
+	Provider      string `gorm:"size:64;unique_index:idx_identity_user_provider,idx_identity_provider_subject"`
+	Subject       string `gorm:"size:191;unique_index:idx_identity_provider_subject"`
+	Login         string
+	Name          string
+	Email         string
+	EmailVerified bool `gorm:"default:'0'"`
+	AvatarUrl     string
+	ProfileUrl    string
+}
+
+func (userIdentity0007) TableName() string { return "user_identities" }
+
+// 0008 个人访问令牌
+type accessToken0008 struct {
+	ID         uint `gorm:"primary_key"`
+	CreatedAt  time.Time
+	UserID     uint `gorm:"index"`
+	Name       string
+	TokenHash  string `gorm:"size:64;unique_index"`
+	Prefix     string
+	Scopes     string
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+}
+
+func (accessToken0008) TableName() string { return "access_tokens" }
+
+// 0009 固定链接
+type page0009 struct {
+	ID   uint   `gorm:"primary_key"`
+	Slug string `gorm:"size:191"`
+}
+
+func (page0009) TableName() string { return "pages" }
+
+type post0009 struct {
+	ID   uint   `gorm:"primary_key"`
+	Slug string `gorm:"size:191"`
+}
+
+func (post0009) TableName() string { return "posts" }
+
+type slugHistory0009 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	Kind      string `gorm:"size:16;unique_index:uk_slug_history"`
+	TargetID  uint   `gorm:"index"`
+	Slug      string `gorm:"size:191;unique_index:uk_slug_history"`
+}
+
+func (slugHistory0009) TableName() string { return "slug_histories" }
+
+// 0010 定时发布
+type page0010 struct {
+	ID        uint       `gorm:"primary_key"`
+	PublishAt *time.Time `gorm:"index"`
+}
+
+func (page0010) TableName() string { return "pages" }
+
+type post0010 struct {
+	ID        uint       `gorm:"primary_key"`
+	PublishAt *time.Time `gorm:"index"`
+}
+
+func (post0010) TableName() string { return "posts" }
+
+// 0011 历史版本
+type revision0011 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	Kind      string `gorm:"size:16;index:idx_revision_target"`
+	TargetID  uint   `gorm:"index:idx_revision_target"`
+	UserID    uint
+	Title     string
+	Body      string
+	Tags      string
+}
+
+func (revision0011) TableName() string { return "revisions" }
+
+// 0012 自动保存的草稿
+type draft0012 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Kind      string `gorm:"size:16;unique_index:uk_draft"`
+	TargetID  uint   `gorm:"unique_index:uk_draft"`
+	UserID    uint   `gorm:"unique_index:uk_draft"`
+	Title     string
+	Body      string
+	Tags      string
+}
+
+func (draft0012) TableName() string { return "drafts" }
+
+// 0013 评论回复
+type comment0013 struct {
+	ID       uint `gorm:"primary_key"`
+	ParentID uint `gorm:"index"`
+	Deleted  bool `gorm:"default:'0'"`
+}
+
+func (comment0013) TableName() string { return "comments" }
+
+type user0013 struct {
+	ID          uint `gorm:"primary_key"`
+	MuteReplies bool `gorm:"default:'0'"`
+}
+
+func (user0013) TableName() string { return "users" }
+
+// 0014 评论审核
+type comment0014 struct {
+	ID     uint   `gorm:"primary_key"`
+	Status string `gorm:"size:16;index"`
+}
+
+func (comment0014) TableName() string { return "comments" }
+
+// 0015 游客评论
+type comment0015 struct {
+	ID         uint   `gorm:"primary_key"`
+	GuestName  string `gorm:"size:64"`
+	GuestEmail string `gorm:"size:128"`
+	GuestUrl   string `gorm:"size:255"`
+}
+
+func (comment0015) TableName() string { return "comments" }
+
+// 0016 一次性链接密钥
+type userToken0016 struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"unique_index:uk_user_token"`
+	Purpose   string `gorm:"size:64;unique_index:uk_user_token"`
+	SecretKey string
+	ExpiresAt time.Time
+}
+
+func (userToken0016) TableName() string { return "user_tokens" }
+
+// 0017 站点状态
+type setting0017 struct {
+	Name  string `gorm:"primary_key;size:64"`
+	Value string
+}
+
+func (setting0017) TableName() string { return "settings" }
+
+// 0018 动态码防重放
+type user0018 struct {
+	ID           uint  `gorm:"primary_key"`
+	TotpLastStep int64 `gorm:"default:'0'"`
+}
+
+func (user0018) TableName() string { return "users" }
@@ -1,14 +1,12 @@
 package models
 
 import (
-	"database/sql"
-	"fmt"
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/russross/blackfriday"
+	"html"
 	"html/template"
-	"strconv"
+	"strings"
 	"time"
 )
 
@@ -27,9 +25,11 @@ type BaseModel struct {
 type  Page struct {
 	BaseModel
 	Title string //title 标题
+	Slug string `gorm:"size:191;unique_index:uk_pages_slug"` //固定链接中使用的名称
 	Body string //body 文章内容
 	View int //view count 观看次数
 	IsPublished bool //是否发表
+	PublishAt *time.Time `gorm:"index"` //发布时间，定时发布时为计划发布时间，见publish.go
 
 }
 
@@ -39,9 +39,12 @@ type  Page struct {
 type Post struct {
 	BaseModel
 	Title        string     // title
+	Slug         string     `gorm:"size:191;unique_index:uk_posts_slug"` // 固定链接中使用的名称
 	Body         string     // body
 	View         int        // view count
 	IsPublished  bool       // published or not
+	PublishAt    *time.Time `gorm:"index"` // 发布时间，定时发布时为计划发布时间，见publish.go
+	UserID       uint       // author 作者id
 	Tags         []*Tag     `gorm:"-"` // tags of post  标签 引用标签
 	Comments     []*Comment `gorm:"-"` // comments of post 评论，引用评论
 	CommentTotal int        `gorm:"-"` // count of comment 评论总数
@@ -64,31 +67,46 @@ type PostTag struct {
 // table users
 type User struct {
 	gorm.Model
-	Email         string    `gorm:"unique_index;default:null"` //邮箱，默认为空
-	Telephone     string    `gorm:"unique_index;default:null"` //手机号码，默认为空
-	Password      string    `gorm:"default:null"`              //密码，默认为空
-	VerifyState   string    `gorm:"default:'0'"`               //邮箱验证状态
-	SecretKey     string    `gorm:"default:null"`              //密钥
-	OutTime       time.Time `gorm:"default:null"` //过期时间 #此处更改 不更改解析出错,可能是版本问题
-	GithubLoginId string    `gorm:"unique_index;default:null"` // github唯一标识，默认为空
-	GithubUrl     string    //github地址
-	IsAdmin       bool      //是否是管理员
-	AvatarUrl     string    // 头像链接
-	NickName      string    // 昵称
-	LockState     bool      `gorm:"default:'0'"` //锁定状态
+	Email         string     `gorm:"unique_index;default:null"` //邮箱，默认为空
+	Telephone     string     `gorm:"unique_index;default:null"` //手机号码，默认为空
+	Password      string     `gorm:"default:null"`              //密码，默认为空
+	VerifyState   string     `gorm:"default:'0'"`               //邮箱验证状态
+	SecretKey     string     `gorm:"default:null"`              //密钥
+	OutTime       time.Time  `gorm:"default:null"`              //过期时间 #此处更改 不更改解析出错,可能是版本问题
+	GithubLoginId string     `gorm:"unique_index;default:null"` // github唯一标识，默认为空
+	GithubUrl     string     //github地址
+	Role          string     `gorm:"default:'commenter'"` //角色，见role.go
+	AvatarUrl     string     // 头像链接
+	NickName      string     // 昵称
+	LockState     bool       `gorm:"default:'0'"` //锁定状态
+	FailedLogins  int        `gorm:"default:'0'"` //连续登录失败次数，登录成功或被临时锁定后清零
+	LastFailedAt  *time.Time //最后一次登录失败时间
+	LockedUntil   *time.Time //临时锁定截止时间
+	TotpSecret    string     `gorm:"default:null"` //两步验证密钥
+	TotpEnabled   bool       `gorm:"default:'0'"`  //是否已启用两步验证
+	TotpLastStep  int64      `gorm:"default:'0'"`  //最后一次通过验证的动态码时间片，之前的动态码不能再使用
+	MuteReplies   bool       `gorm:"default:'0'"`  //是否已退订评论回复和@提及通知
 }
 
 // table comments
 type Comment struct {
 	BaseModel
-	UserID    uint   // 用户id
-	Content   string // 内容
-	PostID    uint   // 文章id
-	ReadState bool   `gorm:"default:'0'"` // 阅读状态
-	//Replies []*Comment // 评论
-	NickName  string `gorm:"-"`
-	AvatarUrl string `gorm:"-"`
-	GithubUrl string `gorm:"-"`
+	UserID     uint       // 用户id，游客评论为0
+	Content    string     // 内容
+	PostID     uint       // 文章id
+	ReadState  bool       `gorm:"default:'0'"`   // 阅读状态
+	ParentID   uint       `gorm:"index"`         // 回复的评论id，0表示直接评论文章
+	Deleted    bool       `gorm:"default:'0'"`   // 有回复的评论删除后保留，显示为[deleted]
+	Status     string     `gorm:"size:16;index"` // 审核状态，见COMMENT_STATUS_*，只有approved的评论在文章中显示
+	GuestName  string     `gorm:"size:64"`       // 游客昵称
+	GuestEmail string     `gorm:"size:128"`      // 游客邮箱，不公开显示，用于生成Gravatar头像
+	GuestUrl   string     `gorm:"size:255"`      // 游客网站，可以为空
+	Replies    []*Comment `gorm:"-"`             // 回复，按时间正序
+	Depth      int        `gorm:"-"`             // 显示的嵌套层级，不超过comment_max_depth
+	ReplyTo    string     `gorm:"-"`             // 回复的评论者昵称
+	NickName   string     `gorm:"-"`
+	AvatarUrl  string     `gorm:"-"`
+	GithubUrl  string     `gorm:"-"`
 }
 
 // table subscribe
@@ -111,6 +129,122 @@ type Link struct {
 	View int    //访问次数
 }
 
+// table sessions 服务端session，id为随机生成的不透明字符串，保存在cookie中
+type Session struct {
+	ID         string    `gorm:"primary_key;size:64"` // session id
+	UserID     uint      `gorm:"index"`               // 登录用户id，未登录为0
+	Data       []byte    // session数据
+	UserAgent  string    // 设备
+	IP         string    // 最后访问ip
+	CreatedAt  time.Time // 创建时间
+	LastSeenAt time.Time // 最后访问时间
+	ExpiresAt  time.Time // 绝对过期时间
+}
+
+// table login_attempts 登录记录
+type LoginAttempt struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time // 登录时间
+	UserID    uint      `gorm:"index"` // 账号不存在时为0
+	Username  string    // 登录时填写的邮箱
+	IP        string    `gorm:"index"`
+	Result    string    // 结果，见LOGIN_RESULT_*
+}
+
+// table recovery_codes 两步验证恢复码，只保存哈希
+type RecoveryCode struct {
+	ID        uint       `gorm:"primary_key"`
+	CreatedAt time.Time  // 生成时间
+	UserID    uint       `gorm:"index"`
+	CodeHash  string     // 恢复码的sha256
+	UsedAt    *time.Time // 使用时间，未使用为空
+}
+
+// table user_identities 第三方登录账号，一个用户可以绑定多个提供方，每个提供方一个账号
+type UserIdentity struct {
+	ID            uint `gorm:"primary_key"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	UserID        uint   `gorm:"unique_index:idx_identity_user_provider"`
+	Provider      string `gorm:"size:64;unique_index:idx_identity_user_provider,idx_identity_provider_subject"` // 配置中的提供方名称
+	Subject       string `gorm:"size:191;unique_index:idx_identity_provider_subject"`                           // 提供方的用户唯一标识
+	Login         string // 用户名
+	Name          string // 昵称
+	Email         string // 邮箱
+	EmailVerified bool   `gorm:"default:'0'"` // 提供方是否已验证该邮箱
+	AvatarUrl     string // 头像链接
+	ProfileUrl    string // 个人主页
+}
+
+// table access_tokens 个人访问令牌，用于/api/v1，只保存哈希
+type AccessToken struct {
+	ID         uint       `gorm:"primary_key"`
+	CreatedAt  time.Time  // 创建时间
+	UserID     uint       `gorm:"index"`
+	Name       string     // 备注
+	TokenHash  string     `gorm:"size:64;unique_index"` // 令牌的sha256
+	Prefix     string     // 令牌的前几位，用于辨认
+	Scopes     string     // 权限范围，逗号分隔
+	LastUsedAt *time.Time // 最后使用时间
+	ExpiresAt  *time.Time // 过期时间，为空时不过期
+}
+
+// table slug_histories 文章和页面修改前的slug，旧链接301跳转到当前地址
+type SlugHistory struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time // 修改时间
+	Kind      string    `gorm:"size:16;unique_index:uk_slug_history"` // 见SLUG_KIND_*
+	TargetID  uint      `gorm:"index"`                                // 文章或页面id
+	Slug      string    `gorm:"size:191;unique_index:uk_slug_history"`
+}
+
+// table revisions 文章和页面每次保存后的版本，只新增不修改，见revision.go
+type Revision struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time // 保存时间
+	Kind      string    `gorm:"size:16;index:idx_revision_target"` // 见SLUG_KIND_*
+	TargetID  uint      `gorm:"index:idx_revision_target"`         // 文章或页面id
+	UserID    uint      // 保存者id
+	Title     string
+	Body      string
+	Tags      string // 标签名称，逗号分隔，页面为空
+	User      *User  `gorm:"-"` // 保存者，列表页使用
+}
+
+// table drafts 编辑器自动保存的草稿，每个用户对每篇文章或页面一份，发布修改或放弃后删除
+type Draft struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time // 开始编辑的时间
+	UpdatedAt time.Time // 最后保存的时间
+	Kind      string    `gorm:"size:16;unique_index:uk_draft"` // 见SLUG_KIND_*
+	TargetID  uint      `gorm:"unique_index:uk_draft"`         // 文章或页面id
+	UserID    uint      `gorm:"unique_index:uk_draft"`         // 编辑者id
+	Title     string
+	Body      string
+	Tags      string // 标签id，逗号分隔，页面为空
+	User      *User  `gorm:"-"` // 编辑者，提示其他人正在编辑时使用
+}
+
+// table user_tokens 一次性链接的密钥，每个用户每种用途一条，签发新链接时覆盖，使用后删除
+type UserToken struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time // 签发时间
+	UserID    uint      `gorm:"unique_index:uk_user_token"`
+	Purpose   string    `gorm:"size:64;unique_index:uk_user_token"` // 用途，如重置密码
+	SecretKey string    // 随机密钥，参与签名
+	ExpiresAt time.Time // 过期时间
+}
+
+// table settings 站点状态，name为SETTING_*
+type Setting struct {
+	Name  string `gorm:"primary_key;size:64"`
+	Value string
+}
+
+const (
+	SETTING_OWNER_CLAIMED = "owner_claimed" // 是否已有用户成为站长，"1"为是
+)
+
 // query result
 type QrArchive struct {
 	ArchiveDate time.Time //时间
@@ -134,659 +268,61 @@ type SmmsFile struct {
 	Path      string `json:"path"` //路径
 }
 
-var DB *gorm.DB   //做了一个全局的的DB, initDB函数中把db赋值给DB，同时initDB中的return的db在main函数中被defer db.close了，函数没有被关闭之前全局DB继承了db的属性，所以可以执行下面的函数。
-
-func InitDB() (*gorm.DB, error) {
-
-	db, err := gorm.Open("mysql", "root:123456@(127.0.0.1:3306)/wblog?charset=utf8mb4&parseTime=True&loc=Local")
-	if err == nil {
-		DB = db
-		//db.LogMode(true)
-		//根据struct创建数据库
-		db.AutoMigrate(&Page{}, &Post{}, &Tag{}, &PostTag{}, &User{}, &Comment{}, &Subscriber{}, &Link{}, &SmmsFile{})
-		//创建索引
-		db.Model(&PostTag{}).AddUniqueIndex("uk_post_tag", "post_id", "tag_id")
-		return db, err
-	}
-	return nil, err
-}
-
-// 插入页面
-func (page *Page) Insert() error {
-	return DB.Create(page).Error
-}
-
-//更新页面状态
-func (page *Page) Update() error {
-	return DB.Model(page).Updates(map[string]interface{}{
-		"title":        page.Title,
-		"body":         page.Body,
-		"is_published": page.IsPublished,
-	}).Error
-}
-//更新浏览量
-func (page *Page) UpdateView() error {
-	return DB.Model(page).Updates(map[string]interface{}{
-		"view": page.View,
-	}).Error
-}
-
-//删除文章页面
-func (page *Page) Delete() error {
-	return DB.Delete(page).Error
-}
-
-//获取指定行的页面信息
-func GetPageById(id string) (*Page, error) {
-	pid, err := strconv.ParseUint(id, 10, 64)
+//根据配置的driver和dsn打开数据库
+func InitDB(driver, dsn string) (*gorm.DB, error) {
+	d, err := GetDialect(driver)
 	if err != nil {
 		return nil, err
 	}
-	var page Page
-	err = DB.First(&page, "id = ?", pid).Error
-	return &page, err
-}
-
-
-//[]*page 其实可以看成gorm中的pages的实现，gorm的官方文档只说明了，Find(&pages),下面就说了，怎么实现这个pages
-//获取所有页面和获取所有公开页面
-func _listPage(published bool) ([]*Page, error) {
-	var pages []*Page
-	var err error
-	if published {
-		err = DB.Where("is_published = ?", true).Find(&pages).Error
-	} else {
-		err = DB.Find(&pages).Error
+	db, err := gorm.Open(d.Name(), dsn)
+	if err != nil {
+		return nil, err
 	}
-	return pages, err
+	//db.LogMode(true)
+	//表结构由migrations维护，见migrate.go，数据读写见repository.go
+	return db, nil
 }
 
-//获取所有公开页面
-func ListPublishedPage() ([]*Page, error) {
-	return _listPage(true)
-}
-
-//获取所有页面
-func ListAllPage() ([]*Page, error) {
-	return _listPage(false)
-}
-
-
-
-
-//获取页面数量
-func CountPage() int {
-	var count int
-	DB.Model(&Page{}).Count(&count)
-	return count
-}
-
-// Post 发布页面 发布页面插入
-func (post *Post) Insert() error {
-	return DB.Create(post).Error
-}
-
-//更新发布页面
-func (post *Post) Update() error {
-	return DB.Model(post).Updates(map[string]interface{}{
-		"title":        post.Title,
-		"body":         post.Body,
-		"is_published": post.IsPublished,
-	}).Error
-}
-
-//更新发布页面的次数
-func (post *Post) UpdateView() error {
-	return DB.Model(post).Updates(map[string]interface{}{
-		"view": post.View,
-	}).Error
-}
-
-//删除发布页面
-func (post *Post) Delete() error {
-	return DB.Delete(post).Error
-}
-
-
 //摘要，估计是主页显示使用，还需要进一步确定
 //blackfriday中的MarkdownBasic方法已经换成了run方法，此处使用了严格的html策略
 
 func (post *Post) Excerpt() template.HTML {
 	//you can sanitize, cut it down, add images, etc
-	policy := bluemonday.StrictPolicy() //remove all html tags
-	sanitized := policy.Sanitize(string(blackfriday.Run([]byte(post.Body))))
-	runes := []rune(sanitized)
+	runes := []rune(PlainText(post.Body))
 	if len(runes) > 300 {
-		sanitized = string(runes[:300])
+		runes = runes[:300]
 	}
-	excerpt := template.HTML(sanitized + "...")
+	excerpt := template.HTML(template.HTMLEscapeString(string(runes)) + "...")
 	return excerpt
 }
 
-
-//列举发布页面
-func _listPost(tag string, published bool, pageIndex, pageSize int) ([]*Post, error) {
-	var posts []*Post
-	var err error
-	if len(tag) > 0 {
-		tagId, err := strconv.ParseUint(tag, 10, 64)
-		if err != nil {
-			return nil, err
-		}
-		//调用gorm的原生函数。定义了rows。
-		var rows *sql.Rows
-		if published {
-			if pageIndex > 0 {
-				//使用了内聚函数。 定了posts的别名 p posts_tag的别名pt ，使用了内连接。查询当posts中的id与tag中的id相当的，当post-tag中id等于，p.is_published满足条件的posts，
-				rows, err = DB.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? and p.is_published = ? order by created_at desc limit ? offset ?", tagId, true, pageSize, (pageIndex-1)*pageSize).Rows()
-			} else {
-				rows, err = DB.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? and p.is_published = ? order by created_at desc", tagId, true).Rows()
-			}
-		} else {
-			rows, err = DB.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? order by created_at desc", tagId).Rows()
-		}
-		if err != nil {
-			return nil, err
-		}
-		defer rows.Close()
-		for rows.Next() {
-			var post Post
-			DB.ScanRows(rows, &post)
-			posts = append(posts, &post)
-		}
-	} else {
-		if published {
-			if pageIndex > 0 {
-				err = DB.Where("is_published = ?", true).Order("created_at desc").Limit(pageSize).Offset((pageIndex - 1) * pageSize).Find(&posts).Error
-			} else {
-				err = DB.Where("is_published = ?", true).Order("created_at desc").Find(&posts).Error
-			}
-		} else {
-			err = DB.Order("created_at desc").Find(&posts).Error
-		}
-	}
-	return posts, err
-}
-
-//显示所有公开发布
-func ListPublishedPost(tag string, pageIndex, pageSize int) ([]*Post, error) {
-	return _listPost(tag, true, pageIndex, pageSize)
-}
-
-//显示所有发布
-func ListAllPost(tag string) ([]*Post, error) {
-	return _listPost(tag, false, 0, 0)
-}
-
-
-
-//显示可公开最多阅读数
-func ListMaxReadPost() (posts []*Post, err error) {
-	err = DB.Where("is_published = ?", true).Order("view desc").Limit(5).Find(&posts).Error
-	return
-}
-
-//必须显示可公开最多阅读数
-func MustListMaxReadPost() (posts []*Post) {
-	posts, _ = ListMaxReadPost()
-	return
-}
-
-
-//显示最大评论数
-func ListMaxCommentPost() (posts []*Post, err error) {
-	var (
-		rows *sql.Rows
-	)
-	rows, err = DB.Raw("select p.*,c.total comment_total from posts p inner join (select post_id,count(*) total from comments group by post_id) c on p.id = c.post_id order by c.total desc limit 5").Rows()
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var post Post
-		DB.ScanRows(rows, &post)
-		posts = append(posts, &post)
-	}
-	return
-}
-
-
-//显示必须最大连接数
-func MustListMaxCommentPost() (posts []*Post) {
-	posts, _ = ListMaxCommentPost()
-	return
-}
-
-
-//显示发布标签数量
-func CountPostByTag(tag string) (count int, err error) {
-	var (
-		tagId uint64
-	)
-	if len(tag) > 0 {
-		tagId, err = strconv.ParseUint(tag, 10, 64)
-		if err != nil {
-			return
-		}
-		err = DB.Raw("select count(*) from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? and p.is_published = ?", tagId, true).Row().Scan(&count)
-	} else {
-		err = DB.Raw("select count(*) from posts p where p.is_published = ?", true).Row().Scan(&count)
-	}
-	return
-}
-
-
-//显示发布数量
-func CountPost() int {
-	var count int
-	DB.Model(&Post{}).Count(&count)
-	return count
-}
-
-//显示第n个发布的信息
-func GetPostById(id string) (*Post, error) {
-	pid, err := strconv.ParseUint(id, 10, 64)
-	if err != nil {
-		return nil, err
-	}
-	var post Post
-	err = DB.First(&post, "id = ?", pid).Error
-	return &post, err
-}
-
-//归档查询
-func ListPostArchives() ([]*QrArchive, error) {
-	var archives []*QrArchive
-	querysql := `select DATE_FORMAT(created_at,'%Y-%m') as month,count(*) as total from posts where is_published = ? group by month order by month desc`
-	//querysql := `select strftime('%Y-%m',created_at) as month,count(*) as total from posts where is_published = ? group by month order by month desc`
-	rows, err := DB.Raw(querysql, true).Rows()
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var archive QrArchive
-		var month string
-		rows.Scan(&month, &archive.Total)
-		//DB.ScanRows(rows, &archive)
-		archive.ArchiveDate, _ = time.Parse("2006-01", month)
-		archive.Year = archive.ArchiveDate.Year()
-		archive.Month = int(archive.ArchiveDate.Month())
-		archives = append(archives, &archive)
-	}
-	return archives, nil
-}
-
-//归档查询所有信息
-func MustListPostArchives() []*QrArchive {
-	archives, _ := ListPostArchives()
-	return archives
-}
-
-
-//文章查询
-func ListPostByArchive(year, month string, pageIndex, pageSize int) ([]*Post, error) {
-	var (
-		rows *sql.Rows
-		err  error
-	)
-	if len(month) == 1 {
-		month = "0" + month
-	}
-	condition := fmt.Sprintf("%s-%s", year, month)
-	if pageIndex > 0 {
-		querysql := `select * from posts where date_format(created_at,'%Y-%m') = ? and is_published = ? order by created_at desc limit ? offset ?`
-		//querysql := `select * from posts where strftime('%Y-%m',created_at) = ? and is_published = ? order by created_at desc limit ? offset ?`
-		rows, err = DB.Raw(querysql, condition, true, pageSize, (pageIndex-1)*pageSize).Rows()
-	} else {
-		querysql := `select * from posts where date_format(created_at,'%Y-%m') = ? and is_published = ? order by created_at desc`
-		//querysql := `select * from posts where strftime('%Y-%m',created_at) = ? and is_published = ? order by created_at desc`
-		rows, err = DB.Raw(querysql, condition, true).Rows()
-	}
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	posts := make([]*Post, 0)
-	for rows.Next() {
-		var post Post
-		DB.ScanRows(rows, &post)
-		posts = append(posts, &post)
-	}
-	return posts, nil
-}
-
-
-//发布归档数量
-func CountPostByArchive(year, month string) (count int, err error) {
-	if len(month) == 1 {
-		month = "0" + month
-	}
-	condition := fmt.Sprintf("%s-%s", year, month)
-	//querysql := `select count(*) from posts where date_format(created_at,'%Y-%m') = ? and is_published = ? order by created_at desc`
-	querysql := `select count(*) from posts where strftime('%Y-%m',created_at) = ? and is_published = ?`
-	err = DB.Raw(querysql, condition, true).Row().Scan(&count)
-	return
-}
-
-// Tag  插入标签
-func (tag *Tag) Insert() error {
-	return DB.FirstOrCreate(tag, "name = ?", tag.Name).Error
-}
-
-
-//列出标签和错误
-func ListTag() ([]*Tag, error) {
-	var tags []*Tag
-	rows, err := DB.Raw("select t.*,count(*) total from tags t inner join post_tags pt on t.id = pt.tag_id inner join posts p on pt.post_id = p.id where p.is_published = ? group by pt.tag_id", true).Rows()
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var tag Tag
-		DB.ScanRows(rows, &tag)
-		tags = append(tags, &tag)
-	}
-	return tags, nil
-}
-
-//列出标签
-func MustListTag() []*Tag {
-	tags, _ := ListTag()
-	return tags
-}
-
-
-//通过发布的序号，列出所有标签
-func ListTagByPostId(id string) ([]*Tag, error) {
-	var tags []*Tag
-	pid, err := strconv.ParseUint(id, 10, 64)
-	if err != nil {
-		return nil, err
-	}
-	rows, err := DB.Raw("select t.* from tags t inner join post_tags pt on t.id = pt.tag_id where pt.post_id = ?", uint(pid)).Rows()
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var tag Tag
-		DB.ScanRows(rows, &tag)
-		tags = append(tags, &tag)
-	}
-	return tags, nil
-}
-
-//标签数量
-func CountTag() int {
-	var count int
-	DB.Model(&Tag{}).Count(&count)
-	return count
-}
-
-//列出所有标签
-func ListAllTag() ([]*Tag, error) {
-	var tags []*Tag
-	err := DB.Model(&Tag{}).Find(&tags).Error
-	return tags, err
-}
-
-// post_tags
-//发布上插入的标签
-func (pt *PostTag) Insert() error {
-	return DB.FirstOrCreate(pt, "post_id = ? and tag_id = ?", pt.PostId, pt.TagId).Error
-}
-
-//删除发布的标签
-func DeletePostTagByPostId(postId uint) error {
-	return DB.Delete(&PostTag{}, "post_id = ?", postId).Error
-}
-
-// user
-// insert user 插入用户
-func (user *User) Insert() error {
-	return DB.Create(user).Error
-}
-
-// update user 更新用户信息 为什么更新所有用户信息，#存疑
-func (user *User) Update() error {
-	return DB.Save(user).Error
-}
-
-//查询用户的信息 内联条件查询 SELECT * FROM users WHERE email = 'username' LIMIT 1
-func GetUserByUsername(username string) (*User, error) {
-	var user User
-	err := DB.First(&user, "email = ?", username).Error
-	return &user, err
-}
-// 根据条件获取第一条记录，否则根据跟定条件创建一个新的记录
-func (user *User) FirstOrCreate() (*User, error) {
-	err := DB.FirstOrCreate(user, "github_login_id = ?", user.GithubLoginId).Error
-	return user, err
-}
-//根据githubid获取一个用户信息
-func IsGithubIdExists(githubId string, id uint) (*User, error) {
-	var user User
-	err := DB.First(&user, "github_login_id = ? and id != ?", githubId, id).Error
-	return &user, err
-}
-
-//根据主键id获取一个用户信息
-func GetUser(id interface{}) (*User, error) {
-	var user User
-	err := DB.First(&user, id).Error
-	return &user, err
-}
-
-//更新用户信息
-func (user *User) UpdateProfile(avatarUrl, nickName string) error {
-	return DB.Model(user).Update(User{AvatarUrl: avatarUrl, NickName: nickName}).Error
-}
-
-//更新用户邮箱信息
-func (user *User) UpdateEmail(email string) error {
-	if len(email) > 0 {
-		return DB.Model(user).Update("email", email).Error
-	} else {
-		return DB.Model(user).Update("email", gorm.Expr("NULL")).Error
-	}
-}
-
-//更新用户信息 #存疑
-func (user *User) UpdateGithubUserInfo() error {
-	var githubLoginId interface{}
-	if len(user.GithubLoginId) == 0 {
-		githubLoginId = gorm.Expr("NULL")
-	} else {
-		githubLoginId = user.GithubLoginId
-	}
-	return DB.Model(user).Update(map[string]interface{}{
-		"github_login_id": githubLoginId,
-		"avatar_url":      user.AvatarUrl,
-		"github_url":      user.GithubUrl,
-	}).Error
-}
-
-
-//设置用户锁定状态
-func (user *User) Lock() error {
-	return DB.Model(user).Update(map[string]interface{}{
-		"lock_state": user.LockState,
-	}).Error
-}
-
-//列出所有用户
-func ListUsers() ([]*User, error) {
-	var users []*User
-	err := DB.Find(&users, "is_admin = ?", false).Error
-	return users, err
-}
-
-// Comment 插入评论
-func (comment *Comment) Insert() error {
-	return DB.Create(comment).Error
-}
-
-//更新评论
-func (comment *Comment) Update() error {
-	return DB.Model(comment).UpdateColumn("read_state", true).Error
-}
-
-//设置所有的评论状态可读
-func SetAllCommentRead() error {
-	return DB.Model(&Comment{}).Where("read_state = ?", false).Update("read_state", true).Error
-}
-
-//列入所有未读评论
-func ListUnreadComment() ([]*Comment, error) {
-	var comments []*Comment
-	err := DB.Where("read_state = ?", false).Order("created_at desc").Find(&comments).Error
-	return comments, err
-}
-//列出所有必须未读
-func MustListUnreadComment() []*Comment {
-	comments, _ := ListUnreadComment()
-	return comments
-}
-
-//删除评论
-func (comment *Comment) Delete() error {
-	return DB.Delete(comment, "user_id = ?", comment.UserID).Error
-}
-
-//根据发布列出评论
-func ListCommentByPostID(postId string) ([]*Comment, error) {
-	pid, err := strconv.ParseUint(postId, 10, 64)
-	if err != nil {
-		return nil, err
-	}
-	var comments []*Comment
-	rows, err := DB.Raw("select c.*,u.github_login_id nick_name,u.avatar_url,u.github_url from comments c inner join users u on c.user_id = u.id where c.post_id = ? order by created_at desc", uint(pid)).Rows()
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var comment Comment
-		DB.ScanRows(rows, &comment)
-		comments = append(comments, &comment)
-	}
-	return comments, err
-}
-
-/*func GetComment(id interface{}) (*Comment, error) {
-	var comment Comment
-	err := DB.First(&comment, id).Error
-	return &comment, err
-}*/
-//列出评论数量
-func CountComment() int {
-	var count int
-	DB.Model(&Comment{}).Count(&count)
-	return count
-}
-
-// Subscriber 插入订阅用户
-func (s *Subscriber) Insert() error {
-	return DB.FirstOrCreate(s, "email = ?", s.Email).Error
+//markdown转为纯文本，摘要和搜索索引使用，返回的文本未转义
+func PlainText(body string) string {
+	policy := bluemonday.StrictPolicy() //remove all html tags
+	return strings.TrimSpace(html.UnescapeString(policy.Sanitize(string(blackfriday.Run([]byte(body))))))
 }
 
-//更新订阅用户信息
-func (s *Subscriber) Update() error {
-	return DB.Model(s).Update(map[string]interface{}{
-		"verify_state":    s.VerifyState,
-		"subscribe_state": s.SubscribeState,
-		"out_time":        s.OutTime,
-		"signature":       s.Signature,
-		"secret_key":      s.SecretKey,
-	}).Error
-}
+const (
+	VERIFY_STATE_UNVERIFIED = "0"
+	VERIFY_STATE_VERIFIED   = "1"
+)
 
-//列出所有有效订阅者
-func ListSubscriber(invalid bool) ([]*Subscriber, error) {
-	var subscribers []*Subscriber
-	db := DB.Model(&Subscriber{})
-	if invalid {
-		db.Where("verify_state = ? and subscribe_state = ?", true, true)
+//账号是否已验证，邮箱已验证或者没有邮箱、通过第三方账号注册的用户视为已验证
+func (user *User) IsVerified() bool {
+	if user.Email == "" {
+		return user.GithubLoginId != "" || user.VerifyState == VERIFY_STATE_VERIFIED
 	}
-	err := db.Find(&subscribers).Error
-	return subscribers, err
-}
-
-//列出有效订阅者数量
-func CountSubscriber() (int, error) {
-	var count int
-	err := DB.Model(&Subscriber{}).Where("verify_state = ? and subscribe_state = ?", true, true).Count(&count).Error
-	return count, err
-}
-
-//根据邮箱返回订阅者
-func GetSubscriberByEmail(mail string) (*Subscriber, error) {
-	var subscriber Subscriber
-	err := DB.Find(&subscriber, "email = ?", mail).Error
-	return &subscriber, err
-}
-
-//根据签名返回订阅者
-func GetSubscriberBySignature(key string) (*Subscriber, error) {
-	var subscriber Subscriber
-	err := DB.Find(&subscriber, "signature = ?", key).Error
-	return &subscriber, err
-}
-
-//根据id返回订阅者
-func GetSubscriberById(id uint) (*Subscriber, error) {
-	var subscriber Subscriber
-	err := DB.First(&subscriber, id).Error
-	return &subscriber, err
-}
-
-// Link 插入友情链接
-func (link *Link) Insert() error {
-	return DB.FirstOrCreate(link, "url = ?", link.Url).Error
+	return user.VerifyState == VERIFY_STATE_VERIFIED
 }
 
-//更新信息 #所有信息
-func (link *Link) Update() error {
-	return DB.Save(link).Error
-}
-
-//删除友情链接
-func (link *Link) Delete() error {
-	return DB.Delete(link).Error
-}
-
-//列入所有链接
-func ListLinks() ([]*Link, error) {
-	var links []*Link
-	err := DB.Order("sort asc").Find(&links).Error
-	return links, err
-}
-
-//列入所有链接
-func MustListLinks() []*Link {
-	links, _ := ListLinks()
-	return links
-}
-
-//根据id列出链接
-func GetLinkById(id uint) (*Link, error) {
-	var link Link
-	err := DB.FirstOrCreate(&link, "id = ?", id).Error
-	return &link, err
-}
-
-/*func GetLinkByUrl(url string) (*Link, error) {
-	var link Link
-	err := DB.Find(&link, "url = ?", url).Error
-	return &link, err
-}*/
+const (
+	LOGIN_RESULT_SUCCESS = "success" // 登录成功
+	LOGIN_RESULT_FAILURE = "failure" // 密码错误或账号不存在
+	LOGIN_RESULT_BLOCKED = "blocked" // 退避时间内、验证码错误或账号已锁定，未校验密码
+	LOGIN_RESULT_LOCKED  = "locked"  // 连续失败次数过多，账号被临时锁定
+)
 
-//插入smmsfile
-func (sf SmmsFile) Insert() (err error) {
-	err = DB.Create(&sf).Error
-	return
+//账号是否处于临时锁定中
+func (user *User) IsTemporarilyLocked() bool {
+	return user.LockedUntil != nil && time.Now().Before(*user.LockedUntil)
 }
-
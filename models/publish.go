@@ -0,0 +1,116 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// 文章和页面的发布状态，由IsPublished和PublishAt决定
+//
+//	草稿：IsPublished为false，PublishAt为空
+//	定时发布：IsPublished为false，PublishAt为计划发布时间，到期后由定时任务发布
+//	已发布：IsPublished为true，PublishAt为发布时间
+const (
+	PUBLISH_STATE_DRAFT     = "draft"
+	PUBLISH_STATE_SCHEDULED = "scheduled"
+	PUBLISH_STATE_PUBLISHED = "published"
+)
+
+var (
+	ErrInvalidPublishState = errors.New("state must be draft, scheduled or published")
+	ErrPublishAtRequired   = errors.New("publish time is required for scheduled state")
+	ErrPublishAtPassed     = errors.New("scheduled publish time must be in the future")
+	ErrPublishAtFuture     = errors.New("publish time is in the future, use scheduled state instead")
+)
+
+func publishState(isPublished bool, publishAt *time.Time) string {
+	if isPublished {
+		return PUBLISH_STATE_PUBLISHED
+	}
+	if publishAt != nil {
+		return PUBLISH_STATE_SCHEDULED
+	}
+	return PUBLISH_STATE_DRAFT
+}
+
+// 已发布且到达发布时间才在前台显示
+func isVisible(isPublished bool, publishAt *time.Time, now time.Time) bool {
+	return isPublished && publishAt != nil && !publishAt.After(now)
+}
+
+// 定时发布且已到达发布时间，等待定时任务发布
+func isDue(isPublished bool, publishAt *time.Time, now time.Time) bool {
+	return !isPublished && publishAt != nil && !publishAt.After(now)
+}
+
+// 设置发布状态，at为发布时间
+// 发布时at为空则保留原发布时间，原来不是已发布状态时使用当前时间，at可以早于当前时间用于补发旧文章
+func setPublishState(isPublished *bool, publishAt **time.Time, state string, at *time.Time) error {
+	now := time.Now()
+	switch state {
+	case PUBLISH_STATE_DRAFT:
+		*isPublished, *publishAt = false, nil
+	case PUBLISH_STATE_SCHEDULED:
+		if at == nil {
+			return ErrPublishAtRequired
+		}
+		if !at.After(now) {
+			return ErrPublishAtPassed
+		}
+		*isPublished, *publishAt = false, at
+	case PUBLISH_STATE_PUBLISHED:
+		if at == nil {
+			if *isPublished && *publishAt != nil {
+				return nil
+			}
+			at = &now
+		}
+		if at.After(now) {
+			return ErrPublishAtFuture
+		}
+		*isPublished, *publishAt = true, at
+	default:
+		return ErrInvalidPublishState
+	}
+	return nil
+}
+
+func (post *Post) State() string {
+	return publishState(post.IsPublished, post.PublishAt)
+}
+
+func (post *Post) IsVisible() bool {
+	return isVisible(post.IsPublished, post.PublishAt, time.Now())
+}
+
+func (post *Post) SetState(state string, at *time.Time) error {
+	return setPublishState(&post.IsPublished, &post.PublishAt, state, at)
+}
+
+// 固定链接和前台显示使用的日期，未发布时使用创建时间
+// 发布时间以UTC保存，转换为本地时间后和创建时间保持一致
+func (post *Post) Date() time.Time {
+	if post.PublishAt != nil {
+		return post.PublishAt.Local()
+	}
+	return post.CreatedAt
+}
+
+func (page *Page) State() string {
+	return publishState(page.IsPublished, page.PublishAt)
+}
+
+func (page *Page) IsVisible() bool {
+	return isVisible(page.IsPublished, page.PublishAt, time.Now())
+}
+
+func (page *Page) SetState(state string, at *time.Time) error {
+	return setPublishState(&page.IsPublished, &page.PublishAt, state, at)
+}
+
+func (page *Page) Date() time.Time {
+	if page.PublishAt != nil {
+		return page.PublishAt.Local()
+	}
+	return page.CreatedAt
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetPublishState(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	post := &Post{}
+	if post.State() != PUBLISH_STATE_DRAFT || post.IsVisible() {
+		t.Fatalf("new post state = %s", post.State())
+	}
+
+	if err := post.SetState(PUBLISH_STATE_SCHEDULED, nil); err != ErrPublishAtRequired {
+		t.Errorf("scheduled without time: %v", err)
+	}
+	if err := post.SetState(PUBLISH_STATE_SCHEDULED, &past); err != ErrPublishAtPassed {
+		t.Errorf("scheduled in the past: %v", err)
+	}
+	if err := post.SetState(PUBLISH_STATE_PUBLISHED, &future); err != ErrPublishAtFuture {
+		t.Errorf("published in the future: %v", err)
+	}
+	if err := post.SetState("hidden", nil); err != ErrInvalidPublishState {
+		t.Errorf("unknown state: %v", err)
+	}
+
+	if err := post.SetState(PUBLISH_STATE_SCHEDULED, &future); err != nil {
+		t.Fatal(err)
+	}
+	if post.State() != PUBLISH_STATE_SCHEDULED || post.IsVisible() || !post.Date().Equal(future) {
+		t.Errorf("scheduled post = %+v", post)
+	}
+
+	//立即发布使用当前时间
+	if err := post.SetState(PUBLISH_STATE_PUBLISHED, nil); err != nil {
+		t.Fatal(err)
+	}
+	if post.State() != PUBLISH_STATE_PUBLISHED || !post.IsVisible() || post.PublishAt.After(time.Now()) {
+		t.Errorf("published post = %+v", post)
+	}
+	//已发布的文章保留原发布时间
+	post.SetState(PUBLISH_STATE_PUBLISHED, &past)
+	if err := post.SetState(PUBLISH_STATE_PUBLISHED, nil); err != nil || !post.PublishAt.Equal(past) {
+		t.Errorf("publish time changed to %v, %v", post.PublishAt, err)
+	}
+
+	if err := post.SetState(PUBLISH_STATE_DRAFT, nil); err != nil {
+		t.Fatal(err)
+	}
+	if post.IsPublished || post.PublishAt != nil {
+		t.Errorf("draft = %+v", post)
+	}
+	post.CreatedAt = past
+	if !post.Date().Equal(past) {
+		t.Errorf("draft date = %v, want created time", post.Date())
+	}
+
+	page := &Page{}
+	if err := page.SetState(PUBLISH_STATE_SCHEDULED, &future); err != nil || page.State() != PUBLISH_STATE_SCHEDULED || page.IsVisible() {
+		t.Errorf("scheduled page = %+v, %v", page, err)
+	}
+}
+
+func TestPublishDue(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		past := time.Now().Add(-time.Minute)
+		future := time.Now().Add(time.Hour)
+		due := &Post{Title: "due", Slug: "due", PublishAt: &past}
+		later := &Post{Title: "later", Slug: "later", PublishAt: &future}
+		draft := &Post{Title: "draft", Slug: "draft"}
+		for _, post := range []*Post{due, later, draft} {
+			if err := store.Posts().Create(post); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if posts, _ := store.Posts().ListPublished(0, 0, 0); len(posts) != 0 {
+			t.Fatalf("scheduled posts listed: %+v", posts)
+		}
+		posts, err := store.Posts().ListDue()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(posts) != 1 || posts[0].ID != due.ID {
+			t.Fatalf("due posts = %+v", posts)
+		}
+		if published, err := store.Posts().PublishDue(due.ID); err != nil || !published {
+			t.Fatalf("PublishDue = %v, %v", published, err)
+		}
+		//已发布的文章不会重复发布
+		if published, _ := store.Posts().PublishDue(due.ID); published {
+			t.Error("post published twice")
+		}
+		if published, _ := store.Posts().PublishDue(later.ID); published {
+			t.Error("post published before its publish time")
+		}
+		if posts, _ = store.Posts().ListPublished(0, 0, 0); len(posts) != 1 || posts[0].ID != due.ID {
+			t.Errorf("published posts = %+v", posts)
+		}
+
+		page := &Page{Title: "about", Slug: "about", PublishAt: &past}
+		if err := store.Pages().Create(page); err != nil {
+			t.Fatal(err)
+		}
+		if pages, _ := store.Pages().ListDue(); len(pages) != 1 {
+			t.Fatalf("due pages = %+v", pages)
+		}
+		if published, err := store.Pages().PublishDue(page.ID); err != nil || !published {
+			t.Fatalf("page PublishDue = %v, %v", published, err)
+		}
+		if pages, _ := store.Pages().List(true); len(pages) != 1 {
+			t.Errorf("published pages = %+v", pages)
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 记录不存在，gorm实现和内存实现统一返回该错误
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// 页面仓库，前台查询只返回已发布且到达发布时间的页面
+type PageRepository interface {
+	Create(page *Page) error
+	Update(page *Page) error     //更新标题、slug、内容和发布状态
+	UpdateView(page *Page) error //更新浏览量
+	Delete(id uint) error
+	Get(id uint) (*Page, error)
+	GetBySlug(slug string) (*Page, error)
+	List(published bool) ([]*Page, error)
+	ListDue() ([]*Page, error)        //到达发布时间的定时页面
+	PublishDue(id uint) (bool, error) //发布到期的定时页面，返回false表示已发布或已取消定时
+	Count() int
+}
+
+// 文章仓库，前台查询只返回已发布且到达发布时间的文章，按发布时间倒序
+type PostRepository interface {
+	Create(post *Post) error
+	Update(post *Post) error     //更新标题、slug、内容和发布状态
+	UpdateView(post *Post) error //更新浏览量
+	Delete(id uint) error
+	Get(id uint) (*Post, error)
+	GetBySlug(slug string) (*Post, error)
+	ListPublished(tagId uint, pageIndex, pageSize int) ([]*Post, error) //tagId为0时不按标签过滤，pageIndex为0时不分页
+	ListAll(tagId uint) ([]*Post, error)
+	ListByUserId(userId uint) ([]*Post, error) //作者的所有文章
+	ListMaxRead() ([]*Post, error)             //阅读数最多的5篇
+	ListMaxComment() ([]*Post, error)          //评论数最多的5篇
+	CountByTag(tagId uint) (int, error)
+	Count() int
+	ListArchives() ([]*QrArchive, error)
+	ListByArchive(year, month, pageIndex, pageSize int) ([]*Post, error)
+	CountByArchive(year, month int) (int, error)
+	ListDue() ([]*Post, error)        //到达发布时间的定时文章
+	PublishDue(id uint) (bool, error) //发布到期的定时文章，返回false表示已发布或已取消定时
+}
+
+// 标签仓库
+type TagRepository interface {
+	Create(tag *Tag) error          //同名标签已存在时直接返回已有标签
+	ListPublished() ([]*Tag, error) //已发布文章使用的标签，附带文章数
+	ListAll() ([]*Tag, error)
+	ListByPostId(postId uint) ([]*Tag, error)
+	Get(id uint) (*Tag, error)
+	Update(tag *Tag) error //更新名称
+	Delete(id uint) error
+	Count() int
+}
+
+// 文章标签关联仓库
+type PostTagRepository interface {
+	Create(pt *PostTag) error
+	DeleteByPostId(postId uint) error
+	DeleteByTagId(tagId uint) error
+}
+
+// 用户仓库
+type UserRepository interface {
+	Create(user *User) error
+	Update(user *User) error //保存所有字段
+	Get(id uint) (*User, error)
+	GetByUsername(username string) (*User, error)
+	IsGithubIdExists(githubId string, id uint) (*User, error) //github账号是否已绑定到其他用户
+	UpdateProfile(user *User, avatarUrl, nickName string) error
+	UpdateEmail(user *User, email string) error //email为空时解绑并保留验证状态，变更为新邮箱后需要重新验证
+	UpdateGithubUserInfo(user *User) error
+	Lock(user *User) error                            //保存锁定状态
+	UpdatePassword(user *User, password string) error //password为已哈希的密码
+	UpdateVerifyState(user *User) error               //保存邮箱验证状态
+	UpdateRole(user *User) error
+	UpdateLoginState(user *User) error             //保存登录失败次数、最后失败时间和临时锁定时间
+	AddFailedLogin(user *User, at time.Time) error //失败次数原子加一并更新最后失败时间，user中的失败次数更新为加一后的值
+	UpdateTotp(user *User) error                   //保存两步验证密钥、启用状态和最后使用的时间片
+	//step大于最后使用的时间片时保存并返回nil，否则返回ErrNotFound，同一动态码并发使用时只有一个成功
+	UseTotpStep(user *User, step int64) error
+	UpdateMuteReplies(user *User) error
+	List() ([]*User, error)
+	Count() int
+	//站长尚未分配时标记为已分配并返回true，并发注册时只有一个用户能成为站长，需要在事务中调用，回滚时标记一起撤销
+	ClaimOwner() (bool, error)
+}
+
+// 评论仓库
+type CommentRepository interface {
+	Create(comment *Comment) error
+	Delete(id uint) error //有回复时清空内容并标记为已删除，调用方负责检查权限
+	SetRead(id uint) error
+	SetAllRead() error
+	ListUnread() ([]*Comment, error)
+	ListByPostId(postId uint) ([]*Comment, error) //已通过审核的评论，附带评论者的昵称和头像
+	Get(id uint) (*Comment, error)
+	List() ([]*Comment, error) //所有评论，按时间倒序
+	Count() int
+	SetStatus(id uint, status string) error           //修改审核状态，同时标记为已读
+	Search(filter *CommentFilter) ([]*Comment, error) //按时间倒序
+	UpdateContent(id uint, content string) error
+	SetStatusByUserId(userId uint, status string) (int, error) //修改用户所有评论的审核状态，返回修改的数量
+	CountByStatus() (map[string]int, error)
+	CountApprovedByUserId(userId uint) (int, error)
+	ListSince(since time.Time) ([]*Comment, error) //since之后的所有评论，用于检查重复内容和评论频率
+}
+
+// 后台评论搜索条件，零值表示不限
+type CommentFilter struct {
+	Status string
+	PostID uint
+	UserID uint
+	Query  string //评论内容、游客昵称或邮箱中包含的文字，不区分大小写
+}
+
+// 订阅者仓库
+type SubscriberRepository interface {
+	Create(s *Subscriber) error //同一邮箱已存在时直接返回已有订阅者
+	Update(s *Subscriber) error
+	List(invalid bool) ([]*Subscriber, error) //invalid为true时只列出有效订阅者
+	Count() (int, error)                      //有效订阅者数量
+	Get(id uint) (*Subscriber, error)
+	GetByEmail(mail string) (*Subscriber, error)
+	GetBySignature(key string) (*Subscriber, error)
+	Delete(id uint) error
+}
+
+// 友情链接仓库
+type LinkRepository interface {
+	Create(link *Link) error //同一url已存在时直接返回已有链接
+	Update(link *Link) error
+	Delete(id uint) error
+	Get(id uint) (*Link, error)
+	List() ([]*Link, error)
+}
+
+// smms文件仓库
+type SmmsFileRepository interface {
+	Create(file *SmmsFile) error
+}
+
+// session仓库
+type SessionRepository interface {
+	Create(session *Session) error
+	Update(session *Session) error //保存用户id、数据、ip和最后访问时间
+	Get(id string) (*Session, error)
+	Delete(id string) error
+	DeleteByUserId(userId uint, exceptId string) error //删除用户的所有session，exceptId不为空时保留该session
+	DeleteExpired(idleBefore, now time.Time) error     //删除空闲超时或已过期的session
+	ListByUserId(userId uint) ([]*Session, error)      //按最后访问时间倒序
+}
+
+// 登录记录仓库
+type LoginAttemptRepository interface {
+	Create(attempt *LoginAttempt) error
+	ListFailuresByIP(ip string, since time.Time) ([]*LoginAttempt, error) //since之后该ip的失败记录，按时间倒序
+	ListRecent(limit int) ([]*LoginAttempt, error)
+	DeleteBefore(t time.Time) error
+}
+
+// 两步验证恢复码仓库
+type RecoveryCodeRepository interface {
+	Create(code *RecoveryCode) error
+	DeleteByUserId(userId uint) error
+	Use(userId uint, codeHash string) error //将未使用的恢复码标记为已使用，不存在或已使用时返回ErrNotFound
+	CountUnused(userId uint) (int, error)
+}
+
+// 第三方登录账号仓库
+type IdentityRepository interface {
+	Create(identity *UserIdentity) error //该账号已绑定其他用户或用户已绑定该提供方的其他账号时返回错误
+	Update(identity *UserIdentity) error //保存用户名、昵称、邮箱和头像等资料
+	Get(provider, subject string) (*UserIdentity, error)
+	ListByUserId(userId uint) ([]*UserIdentity, error)
+	Delete(userId uint, provider string) error
+}
+
+// 个人访问令牌仓库
+type AccessTokenRepository interface {
+	Create(token *AccessToken) error
+	GetByHash(hash string) (*AccessToken, error)
+	ListByUserId(userId uint) ([]*AccessToken, error) //按创建时间倒序
+	UpdateLastUsed(token *AccessToken) error
+	Delete(userId, id uint) error //只能删除自己的令牌，不存在时返回ErrNotFound
+}
+
+// 旧slug仓库，kind见SLUG_KIND_*
+type SlugHistoryRepository interface {
+	Create(history *SlugHistory) error //同类型的slug已存在时改为指向新的目标
+	Get(kind, slug string) (*SlugHistory, error)
+	Delete(kind, slug string) error
+	DeleteByTarget(kind string, targetId uint) error
+}
+
+// 历史版本仓库，kind见SLUG_KIND_*
+type RevisionRepository interface {
+	Create(revision *Revision) error
+	Get(id uint) (*Revision, error)
+	Latest(kind string, targetId uint) (*Revision, error) //最新的版本，没有版本时返回ErrNotFound
+	List(kind string, targetId uint) ([]*Revision, error) //按保存时间倒序
+	Prune(kind string, targetId uint, keep int) error     //只保留最新的keep个版本
+	DeleteByTarget(kind string, targetId uint) error
+}
+
+// 草稿仓库，kind见SLUG_KIND_*
+type DraftRepository interface {
+	Save(draft *Draft) error //用户已有该文章或页面的草稿时覆盖标题、内容和标签
+	Get(kind string, targetId, userId uint) (*Draft, error)
+	ListByTarget(kind string, targetId uint) ([]*Draft, error) //所有用户的草稿，按最后保存时间倒序
+	Delete(kind string, targetId, userId uint) error
+	DeleteByTarget(kind string, targetId uint) error
+}
+
+// 一次性链接密钥仓库，不同用途的密钥互不影响
+type UserTokenRepository interface {
+	Save(token *UserToken) error //用户已有该用途的密钥时覆盖
+	Get(userId uint, purpose string) (*UserToken, error)
+	Delete(userId uint, purpose string) error
+}
+
+// Store聚合所有仓库，同时作为工作单元提供事务
+type Store interface {
+	Pages() PageRepository
+	Posts() PostRepository
+	Tags() TagRepository
+	PostTags() PostTagRepository
+	Users() UserRepository
+	Comments() CommentRepository
+	Subscribers() SubscriberRepository
+	Links() LinkRepository
+	SmmsFiles() SmmsFileRepository
+	Sessions() SessionRepository
+	LoginAttempts() LoginAttemptRepository
+	RecoveryCodes() RecoveryCodeRepository
+	Identities() IdentityRepository
+	AccessTokens() AccessTokenRepository
+	SlugHistories() SlugHistoryRepository
+	Revisions() RevisionRepository
+	Drafts() DraftRepository
+	UserTokens() UserTokenRepository
+	//在事务中执行fn，fn返回错误或panic时回滚，fn中应只使用tx提供的仓库
+	Transaction(fn func(tx Store) error) error
+}
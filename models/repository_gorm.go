@@ -0,0 +1,1114 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 基于gorm的仓库实现
+type gormStore struct {
+	db      *gorm.DB
+	dialect Dialect
+	inTx    bool
+}
+
+// 根据gorm连接创建Store，方言由连接的驱动决定
+func NewGormStore(db *gorm.DB) (Store, error) {
+	d, err := GetDialect(db.Dialect().GetName())
+	if err != nil {
+		return nil, err
+	}
+	return &gormStore{db: db, dialect: d}, nil
+}
+
+func (s *gormStore) Pages() PageRepository                 { return &gormPageRepository{s} }
+func (s *gormStore) Posts() PostRepository                 { return &gormPostRepository{s} }
+func (s *gormStore) Tags() TagRepository                   { return &gormTagRepository{s} }
+func (s *gormStore) PostTags() PostTagRepository           { return &gormPostTagRepository{s} }
+func (s *gormStore) Users() UserRepository                 { return &gormUserRepository{s} }
+func (s *gormStore) Comments() CommentRepository           { return &gormCommentRepository{s} }
+func (s *gormStore) Subscribers() SubscriberRepository     { return &gormSubscriberRepository{s} }
+func (s *gormStore) Links() LinkRepository                 { return &gormLinkRepository{s} }
+func (s *gormStore) SmmsFiles() SmmsFileRepository         { return &gormSmmsFileRepository{s} }
+func (s *gormStore) Sessions() SessionRepository           { return &gormSessionRepository{s} }
+func (s *gormStore) LoginAttempts() LoginAttemptRepository { return &gormLoginAttemptRepository{s} }
+func (s *gormStore) RecoveryCodes() RecoveryCodeRepository { return &gormRecoveryCodeRepository{s} }
+func (s *gormStore) Identities() IdentityRepository        { return &gormIdentityRepository{s} }
+func (s *gormStore) AccessTokens() AccessTokenRepository   { return &gormAccessTokenRepository{s} }
+func (s *gormStore) SlugHistories() SlugHistoryRepository  { return &gormSlugHistoryRepository{s} }
+func (s *gormStore) Revisions() RevisionRepository         { return &gormRevisionRepository{s} }
+func (s *gormStore) Drafts() DraftRepository               { return &gormDraftRepository{s} }
+func (s *gormStore) UserTokens() UserTokenRepository       { return &gormUserTokenRepository{s} }
+
+func (s *gormStore) Transaction(fn func(tx Store) error) error {
+	//已经在事务中时直接复用当前事务
+	if s.inTx {
+		return fn(s)
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx, dialect: s.dialect, inTx: true})
+	})
+}
+
+// sqlite中时间按字符串比较，发布时间统一以UTC保存，查询时也使用UTC时间
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+func utcNow() time.Time {
+	return time.Now().UTC()
+}
+
+// 将查询结果逐行扫描到dest中，dest为返回新元素指针的函数
+func scanRows(db *gorm.DB, rows *sql.Rows, next func() interface{}) {
+	defer rows.Close()
+	for rows.Next() {
+		db.ScanRows(rows, next())
+	}
+}
+
+// page
+type gormPageRepository struct {
+	*gormStore
+}
+
+func (r *gormPageRepository) Create(page *Page) error {
+	page.PublishAt = utcTime(page.PublishAt)
+	return r.db.Create(page).Error
+}
+
+func (r *gormPageRepository) Update(page *Page) error {
+	return r.db.Model(page).Updates(map[string]interface{}{
+		"title":        page.Title,
+		"slug":         page.Slug,
+		"body":         page.Body,
+		"is_published": page.IsPublished,
+		"publish_at":   utcTime(page.PublishAt),
+	}).Error
+}
+
+func (r *gormPageRepository) UpdateView(page *Page) error {
+	return r.db.Model(page).Updates(map[string]interface{}{
+		"view": page.View,
+	}).Error
+}
+
+func (r *gormPageRepository) Delete(id uint) error {
+	return r.db.Delete(&Page{}, "id = ?", id).Error
+}
+
+func (r *gormPageRepository) Get(id uint) (*Page, error) {
+	var page Page
+	err := r.db.First(&page, "id = ?", id).Error
+	return &page, err
+}
+
+func (r *gormPageRepository) GetBySlug(slug string) (*Page, error) {
+	var page Page
+	err := r.db.First(&page, "slug = ?", slug).Error
+	return &page, err
+}
+
+func (r *gormPageRepository) List(published bool) ([]*Page, error) {
+	var pages []*Page
+	var err error
+	if published {
+		err = r.db.Where("is_published = ? and publish_at <= ?", true, utcNow()).Find(&pages).Error
+	} else {
+		err = r.db.Find(&pages).Error
+	}
+	return pages, err
+}
+
+func (r *gormPageRepository) ListDue() (pages []*Page, err error) {
+	err = r.db.Where("is_published = ? and publish_at <= ?", false, utcNow()).Order("publish_at").Find(&pages).Error
+	return
+}
+
+func (r *gormPageRepository) PublishDue(id uint) (bool, error) {
+	//条件更新，多个实例同时执行定时任务时只有一个会成功
+	db := r.db.Model(&Page{}).Where("id = ? and is_published = ? and publish_at <= ?", id, false, utcNow()).Update("is_published", true)
+	return db.RowsAffected > 0, db.Error
+}
+
+func (r *gormPageRepository) Count() int {
+	var count int
+	r.db.Model(&Page{}).Count(&count)
+	return count
+}
+
+// post
+type gormPostRepository struct {
+	*gormStore
+}
+
+func (r *gormPostRepository) Create(post *Post) error {
+	post.PublishAt = utcTime(post.PublishAt)
+	return r.db.Create(post).Error
+}
+
+func (r *gormPostRepository) Update(post *Post) error {
+	return r.db.Model(post).Updates(map[string]interface{}{
+		"title":        post.Title,
+		"slug":         post.Slug,
+		"body":         post.Body,
+		"is_published": post.IsPublished,
+		"publish_at":   utcTime(post.PublishAt),
+	}).Error
+}
+
+func (r *gormPostRepository) UpdateView(post *Post) error {
+	return r.db.Model(post).Updates(map[string]interface{}{
+		"view": post.View,
+	}).Error
+}
+
+func (r *gormPostRepository) Delete(id uint) error {
+	return r.db.Delete(&Post{}, "id = ?", id).Error
+}
+
+func (r *gormPostRepository) Get(id uint) (*Post, error) {
+	var post Post
+	err := r.db.First(&post, "id = ?", id).Error
+	return &post, err
+}
+
+func (r *gormPostRepository) GetBySlug(slug string) (*Post, error) {
+	var post Post
+	err := r.db.First(&post, "slug = ?", slug).Error
+	return &post, err
+}
+
+func (r *gormPostRepository) scanPosts(rows *sql.Rows) []*Post {
+	posts := make([]*Post, 0)
+	scanRows(r.db, rows, func() interface{} {
+		post := &Post{}
+		posts = append(posts, post)
+		return post
+	})
+	return posts
+}
+
+func (r *gormPostRepository) list(tagId uint, published bool, pageIndex, pageSize int) ([]*Post, error) {
+	var posts []*Post
+	var err error
+	if tagId > 0 {
+		var rows *sql.Rows
+		if published {
+			if pageIndex > 0 {
+				rows, err = r.db.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? and p.is_published = ? and p.publish_at <= ? order by p.publish_at desc limit ? offset ?", tagId, true, utcNow(), pageSize, (pageIndex-1)*pageSize).Rows()
+			} else {
+				rows, err = r.db.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? and p.is_published = ? and p.publish_at <= ? order by p.publish_at desc", tagId, true, utcNow()).Rows()
+			}
+		} else {
+			rows, err = r.db.Raw("select p.* from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? order by created_at desc", tagId).Rows()
+		}
+		if err != nil {
+			return nil, err
+		}
+		posts = r.scanPosts(rows)
+	} else {
+		if published {
+			if pageIndex > 0 {
+				err = r.db.Where("is_published = ? and publish_at <= ?", true, utcNow()).Order("publish_at desc").Limit(pageSize).Offset((pageIndex - 1) * pageSize).Find(&posts).Error
+			} else {
+				err = r.db.Where("is_published = ? and publish_at <= ?", true, utcNow()).Order("publish_at desc").Find(&posts).Error
+			}
+		} else {
+			err = r.db.Order("created_at desc").Find(&posts).Error
+		}
+	}
+	return posts, err
+}
+
+func (r *gormPostRepository) ListPublished(tagId uint, pageIndex, pageSize int) ([]*Post, error) {
+	return r.list(tagId, true, pageIndex, pageSize)
+}
+
+func (r *gormPostRepository) ListAll(tagId uint) ([]*Post, error) {
+	return r.list(tagId, false, 0, 0)
+}
+
+func (r *gormPostRepository) ListByUserId(userId uint) (posts []*Post, err error) {
+	err = r.db.Where("user_id = ?", userId).Order("created_at desc").Find(&posts).Error
+	return
+}
+
+func (r *gormPostRepository) ListMaxRead() (posts []*Post, err error) {
+	err = r.db.Where("is_published = ? and publish_at <= ?", true, utcNow()).Order("view desc").Limit(5).Find(&posts).Error
+	return
+}
+
+func (r *gormPostRepository) ListMaxComment() ([]*Post, error) {
+	rows, err := r.db.Raw("select p.*,c.total comment_total from posts p inner join (select post_id,count(*) total from comments where status = ? group by post_id) c on p.id = c.post_id where p.is_published = ? and p.publish_at <= ? order by c.total desc limit 5", COMMENT_STATUS_APPROVED, true, utcNow()).Rows()
+	if err != nil {
+		return nil, err
+	}
+	return r.scanPosts(rows), nil
+}
+
+func (r *gormPostRepository) CountByTag(tagId uint) (count int, err error) {
+	if tagId > 0 {
+		err = r.db.Raw("select count(*) from posts p inner join post_tags pt on p.id = pt.post_id where pt.tag_id = ? and p.is_published = ? and p.publish_at <= ?", tagId, true, utcNow()).Row().Scan(&count)
+	} else {
+		err = r.db.Raw("select count(*) from posts p where p.is_published = ? and p.publish_at <= ?", true, utcNow()).Row().Scan(&count)
+	}
+	return
+}
+
+func (r *gormPostRepository) Count() int {
+	var count int
+	r.db.Model(&Post{}).Count(&count)
+	return count
+}
+
+func (r *gormPostRepository) ListArchives() ([]*QrArchive, error) {
+	var archives []*QrArchive
+	querysql := fmt.Sprintf(`select %s as month,count(*) as total from posts where is_published = ? and publish_at <= ? group by month order by month desc`, r.dialect.MonthExpr("publish_at"))
+	rows, err := r.db.Raw(querysql, true, utcNow()).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var archive QrArchive
+		var month string
+		rows.Scan(&month, &archive.Total)
+		archive.ArchiveDate, _ = time.Parse("2006-01", month)
+		archive.Year = archive.ArchiveDate.Year()
+		archive.Month = int(archive.ArchiveDate.Month())
+		archives = append(archives, &archive)
+	}
+	return archives, nil
+}
+
+func (r *gormPostRepository) ListByArchive(year, month, pageIndex, pageSize int) ([]*Post, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	condition := fmt.Sprintf("%04d-%02d", year, month)
+	monthExpr := r.dialect.MonthExpr("publish_at")
+	if pageIndex > 0 {
+		querysql := fmt.Sprintf(`select * from posts where %s = ? and is_published = ? and publish_at <= ? order by publish_at desc limit ? offset ?`, monthExpr)
+		rows, err = r.db.Raw(querysql, condition, true, utcNow(), pageSize, (pageIndex-1)*pageSize).Rows()
+	} else {
+		querysql := fmt.Sprintf(`select * from posts where %s = ? and is_published = ? and publish_at <= ? order by publish_at desc`, monthExpr)
+		rows, err = r.db.Raw(querysql, condition, true, utcNow()).Rows()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.scanPosts(rows), nil
+}
+
+func (r *gormPostRepository) CountByArchive(year, month int) (count int, err error) {
+	condition := fmt.Sprintf("%04d-%02d", year, month)
+	querysql := fmt.Sprintf(`select count(*) from posts where %s = ? and is_published = ? and publish_at <= ?`, r.dialect.MonthExpr("publish_at"))
+	err = r.db.Raw(querysql, condition, true, utcNow()).Row().Scan(&count)
+	return
+}
+
+func (r *gormPostRepository) ListDue() (posts []*Post, err error) {
+	err = r.db.Where("is_published = ? and publish_at <= ?", false, utcNow()).Order("publish_at").Find(&posts).Error
+	return
+}
+
+func (r *gormPostRepository) PublishDue(id uint) (bool, error) {
+	//条件更新，多个实例同时执行定时任务时只有一个会成功
+	db := r.db.Model(&Post{}).Where("id = ? and is_published = ? and publish_at <= ?", id, false, utcNow()).Update("is_published", true)
+	return db.RowsAffected > 0, db.Error
+}
+
+// tag
+type gormTagRepository struct {
+	*gormStore
+}
+
+func (r *gormTagRepository) Create(tag *Tag) error {
+	return r.db.FirstOrCreate(tag, "name = ?", tag.Name).Error
+}
+
+func (r *gormTagRepository) scanTags(rows *sql.Rows) []*Tag {
+	tags := make([]*Tag, 0)
+	scanRows(r.db, rows, func() interface{} {
+		tag := &Tag{}
+		tags = append(tags, tag)
+		return tag
+	})
+	return tags
+}
+
+func (r *gormTagRepository) ListPublished() ([]*Tag, error) {
+	rows, err := r.db.Raw("select t.*,count(*) total from tags t inner join post_tags pt on t.id = pt.tag_id inner join posts p on pt.post_id = p.id where p.is_published = ? and p.publish_at <= ? group by t.id", true, utcNow()).Rows()
+	if err != nil {
+		return nil, err
+	}
+	return r.scanTags(rows), nil
+}
+
+func (r *gormTagRepository) ListAll() ([]*Tag, error) {
+	var tags []*Tag
+	err := r.db.Model(&Tag{}).Find(&tags).Error
+	return tags, err
+}
+
+func (r *gormTagRepository) ListByPostId(postId uint) ([]*Tag, error) {
+	rows, err := r.db.Raw("select t.* from tags t inner join post_tags pt on t.id = pt.tag_id where pt.post_id = ?", postId).Rows()
+	if err != nil {
+		return nil, err
+	}
+	return r.scanTags(rows), nil
+}
+
+func (r *gormTagRepository) Get(id uint) (*Tag, error) {
+	var tag Tag
+	err := r.db.First(&tag, "id = ?", id).Error
+	return &tag, err
+}
+
+func (r *gormTagRepository) Update(tag *Tag) error {
+	return r.db.Model(tag).Update("name", tag.Name).Error
+}
+
+func (r *gormTagRepository) Delete(id uint) error {
+	return r.db.Delete(&Tag{}, "id = ?", id).Error
+}
+
+func (r *gormTagRepository) Count() int {
+	var count int
+	r.db.Model(&Tag{}).Count(&count)
+	return count
+}
+
+// post_tags
+type gormPostTagRepository struct {
+	*gormStore
+}
+
+func (r *gormPostTagRepository) Create(pt *PostTag) error {
+	return r.db.FirstOrCreate(pt, "post_id = ? and tag_id = ?", pt.PostId, pt.TagId).Error
+}
+
+func (r *gormPostTagRepository) DeleteByPostId(postId uint) error {
+	return r.db.Delete(&PostTag{}, "post_id = ?", postId).Error
+}
+
+func (r *gormPostTagRepository) DeleteByTagId(tagId uint) error {
+	return r.db.Delete(&PostTag{}, "tag_id = ?", tagId).Error
+}
+
+// user
+type gormUserRepository struct {
+	*gormStore
+}
+
+func (r *gormUserRepository) Create(user *User) error {
+	return r.db.Create(user).Error
+}
+
+func (r *gormUserRepository) Update(user *User) error {
+	return r.db.Save(user).Error
+}
+
+func (r *gormUserRepository) Get(id uint) (*User, error) {
+	var user User
+	err := r.db.First(&user, id).Error
+	return &user, err
+}
+
+func (r *gormUserRepository) GetByUsername(username string) (*User, error) {
+	var user User
+	err := r.db.First(&user, "email = ?", username).Error
+	return &user, err
+}
+
+func (r *gormUserRepository) IsGithubIdExists(githubId string, id uint) (*User, error) {
+	var user User
+	err := r.db.First(&user, "github_login_id = ? and id != ?", githubId, id).Error
+	return &user, err
+}
+
+func (r *gormUserRepository) UpdateProfile(user *User, avatarUrl, nickName string) error {
+	return r.db.Model(user).Update(User{AvatarUrl: avatarUrl, NickName: nickName}).Error
+}
+
+func (r *gormUserRepository) UpdateEmail(user *User, email string) error {
+	//解绑时保留验证状态，只有新邮箱需要重新验证
+	values := map[string]interface{}{"email": gorm.Expr("NULL")}
+	if len(email) > 0 {
+		values = map[string]interface{}{"email": email, "verify_state": VERIFY_STATE_UNVERIFIED}
+	}
+	err := r.db.Model(user).Update(values).Error
+	if err == nil {
+		user.Email = email
+		if len(email) > 0 {
+			user.VerifyState = VERIFY_STATE_UNVERIFIED
+		}
+	}
+	return err
+}
+
+func (r *gormUserRepository) UpdateGithubUserInfo(user *User) error {
+	var githubLoginId interface{}
+	if len(user.GithubLoginId) == 0 {
+		githubLoginId = gorm.Expr("NULL")
+	} else {
+		githubLoginId = user.GithubLoginId
+	}
+	return r.db.Model(user).Update(map[string]interface{}{
+		"github_login_id": githubLoginId,
+		"avatar_url":      user.AvatarUrl,
+		"github_url":      user.GithubUrl,
+	}).Error
+}
+
+func (r *gormUserRepository) Lock(user *User) error {
+	return r.db.Model(user).Update(map[string]interface{}{
+		"lock_state": user.LockState,
+	}).Error
+}
+
+func (r *gormUserRepository) UpdatePassword(user *User, password string) error {
+	return r.db.Model(user).Update("password", password).Error
+}
+
+func (r *gormUserRepository) UpdateVerifyState(user *User) error {
+	return r.db.Model(user).Update("verify_state", user.VerifyState).Error
+}
+
+func (r *gormUserRepository) UpdateRole(user *User) error {
+	return r.db.Model(user).Update("role", user.Role).Error
+}
+
+func (r *gormUserRepository) UpdateLoginState(user *User) error {
+	return r.db.Model(user).Updates(map[string]interface{}{
+		"failed_logins":  user.FailedLogins,
+		"last_failed_at": user.LastFailedAt,
+		"locked_until":   user.LockedUntil,
+	}).Error
+}
+
+func (r *gormUserRepository) AddFailedLogin(user *User, at time.Time) error {
+	err := r.db.Model(user).UpdateColumns(map[string]interface{}{
+		"failed_logins":  gorm.Expr("failed_logins + 1"),
+		"last_failed_at": at,
+	}).Error
+	if err != nil {
+		return err
+	}
+	var row User
+	if err = r.db.Select("failed_logins").First(&row, user.ID).Error; err != nil {
+		return err
+	}
+	user.FailedLogins = row.FailedLogins
+	user.LastFailedAt = &at
+	return nil
+}
+
+func (r *gormUserRepository) UpdateTotp(user *User) error {
+	return r.db.Model(user).Updates(map[string]interface{}{
+		"totp_secret":    user.TotpSecret,
+		"totp_enabled":   user.TotpEnabled,
+		"totp_last_step": user.TotpLastStep,
+	}).Error
+}
+
+func (r *gormUserRepository) UseTotpStep(user *User, step int64) error {
+	db := r.db.Model(&User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).
+		UpdateColumn("totp_last_step", step)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	user.TotpLastStep = step
+	return nil
+}
+
+func (r *gormUserRepository) UpdateMuteReplies(user *User) error {
+	return r.db.Model(user).UpdateColumn("mute_replies", user.MuteReplies).Error
+}
+
+func (r *gormUserRepository) List() ([]*User, error) {
+	var users []*User
+	err := r.db.Order("id").Find(&users).Error
+	return users, err
+}
+
+func (r *gormUserRepository) Count() int {
+	var count int
+	r.db.Model(&User{}).Count(&count)
+	return count
+}
+
+// 条件更新会锁住该行，并发的事务等待提交后重新判断条件，因此只有一个事务能更新成功
+func (r *gormUserRepository) ClaimOwner() (bool, error) {
+	db := r.db.Model(&Setting{}).Where("name = ? AND value = ?", SETTING_OWNER_CLAIMED, "0").UpdateColumn("value", "1")
+	return db.RowsAffected == 1, db.Error
+}
+
+// comment
+type gormCommentRepository struct {
+	*gormStore
+}
+
+func (r *gormCommentRepository) Create(comment *Comment) error {
+	return r.db.Create(comment).Error
+}
+
+func (r *gormCommentRepository) Delete(id uint) error {
+	var item Comment
+	if err := r.db.First(&item, "id = ?", id).Error; err != nil {
+		return err
+	}
+	var err error
+	for {
+		var replies int
+		if err = r.db.Model(&Comment{}).Where("parent_id = ?", item.ID).Count(&replies).Error; err != nil {
+			return err
+		}
+		if replies > 0 {
+			if item.Deleted {
+				return nil
+			}
+			return r.db.Model(&item).Updates(map[string]interface{}{"content": "", "deleted": true, "read_state": true}).Error
+		}
+		if err = r.db.Delete(&item).Error; err != nil {
+			return err
+		}
+		//已删除的上级评论没有其他回复后一起删除
+		if item.ParentID == 0 {
+			return nil
+		}
+		var parent Comment
+		err = r.db.First(&parent, "id = ?", item.ParentID).Error
+		if err == ErrNotFound || (err == nil && !parent.Deleted) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		item = parent
+	}
+}
+
+func (r *gormCommentRepository) SetRead(id uint) error {
+	return r.db.Model(&Comment{}).Where("id = ?", id).UpdateColumn("read_state", true).Error
+}
+
+func (r *gormCommentRepository) SetAllRead() error {
+	return r.db.Model(&Comment{}).Where("read_state = ?", false).Update("read_state", true).Error
+}
+
+func (r *gormCommentRepository) ListUnread() ([]*Comment, error) {
+	var comments []*Comment
+	err := r.db.Where("read_state = ?", false).Order("created_at desc").Find(&comments).Error
+	return comments, err
+}
+
+func (r *gormCommentRepository) ListByPostId(postId uint) ([]*Comment, error) {
+	rows, err := r.db.Raw("select c.*,coalesce(nullif(u.nick_name,''),u.github_login_id) nick_name,u.avatar_url,u.github_url from comments c left join users u on c.user_id = u.id where c.post_id = ? and c.status = ? and (u.id is not null or c.user_id = 0) order by created_at desc", postId, COMMENT_STATUS_APPROVED).Rows()
+	if err != nil {
+		return nil, err
+	}
+	comments := make([]*Comment, 0)
+	scanRows(r.db, rows, func() interface{} {
+		comment := &Comment{}
+		comments = append(comments, comment)
+		return comment
+	})
+	for _, comment := range comments {
+		if comment.IsGuest() {
+			comment.fillGuest()
+		}
+	}
+	return comments, nil
+}
+
+func (r *gormCommentRepository) Get(id uint) (*Comment, error) {
+	var comment Comment
+	err := r.db.First(&comment, "id = ?", id).Error
+	return &comment, err
+}
+
+func (r *gormCommentRepository) List() ([]*Comment, error) {
+	var comments []*Comment
+	err := r.db.Order("created_at desc").Find(&comments).Error
+	return comments, err
+}
+
+func (r *gormCommentRepository) Count() int {
+	var count int
+	r.db.Model(&Comment{}).Count(&count)
+	return count
+}
+
+func (r *gormCommentRepository) SetStatus(id uint, status string) error {
+	return r.db.Model(&Comment{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{"status": status, "read_state": true}).Error
+}
+
+func (r *gormCommentRepository) Search(filter *CommentFilter) ([]*Comment, error) {
+	db := r.db
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	if filter.PostID > 0 {
+		db = db.Where("post_id = ?", filter.PostID)
+	}
+	if filter.UserID > 0 {
+		db = db.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Query != "" {
+		like := "%" + strings.ToLower(filter.Query) + "%"
+		db = db.Where("lower(content) like ? or lower(guest_name) like ? or lower(guest_email) like ?", like, like, like)
+	}
+	var comments []*Comment
+	err := db.Order("created_at desc").Find(&comments).Error
+	return comments, err
+}
+
+func (r *gormCommentRepository) UpdateContent(id uint, content string) error {
+	return r.db.Model(&Comment{}).Where("id = ?", id).UpdateColumn("content", content).Error
+}
+
+func (r *gormCommentRepository) SetStatusByUserId(userId uint, status string) (int, error) {
+	db := r.db.Model(&Comment{}).Where("user_id = ? and status <> ?", userId, status).
+		UpdateColumns(map[string]interface{}{"status": status, "read_state": true})
+	return int(db.RowsAffected), db.Error
+}
+
+func (r *gormCommentRepository) CountByStatus() (map[string]int, error) {
+	var rows []struct {
+		Status string
+		Total  int
+	}
+	err := r.db.Model(&Comment{}).Select("status, count(*) total").Group("status").Scan(&rows).Error
+	counts := make(map[string]int)
+	for _, row := range rows {
+		counts[row.Status] = row.Total
+	}
+	return counts, err
+}
+
+func (r *gormCommentRepository) CountApprovedByUserId(userId uint) (int, error) {
+	var count int
+	err := r.db.Model(&Comment{}).Where("user_id = ? and status = ?", userId, COMMENT_STATUS_APPROVED).Count(&count).Error
+	return count, err
+}
+
+func (r *gormCommentRepository) ListSince(since time.Time) ([]*Comment, error) {
+	var comments []*Comment
+	err := r.db.Where("created_at >= ?", since).Order("created_at desc").Find(&comments).Error
+	return comments, err
+}
+
+// subscriber
+type gormSubscriberRepository struct {
+	*gormStore
+}
+
+func (r *gormSubscriberRepository) Create(s *Subscriber) error {
+	return r.db.FirstOrCreate(s, "email = ?", s.Email).Error
+}
+
+func (r *gormSubscriberRepository) Update(s *Subscriber) error {
+	return r.db.Model(s).Update(map[string]interface{}{
+		"verify_state":    s.VerifyState,
+		"subscribe_state": s.SubscribeState,
+		"out_time":        s.OutTime,
+		"signature":       s.Signature,
+		"secret_key":      s.SecretKey,
+	}).Error
+}
+
+func (r *gormSubscriberRepository) List(invalid bool) ([]*Subscriber, error) {
+	var subscribers []*Subscriber
+	db := r.db.Model(&Subscriber{})
+	if invalid {
+		db = db.Where("verify_state = ? and subscribe_state = ?", true, true)
+	}
+	err := db.Find(&subscribers).Error
+	return subscribers, err
+}
+
+func (r *gormSubscriberRepository) Count() (int, error) {
+	var count int
+	err := r.db.Model(&Subscriber{}).Where("verify_state = ? and subscribe_state = ?", true, true).Count(&count).Error
+	return count, err
+}
+
+func (r *gormSubscriberRepository) Get(id uint) (*Subscriber, error) {
+	var subscriber Subscriber
+	err := r.db.First(&subscriber, id).Error
+	return &subscriber, err
+}
+
+func (r *gormSubscriberRepository) GetByEmail(mail string) (*Subscriber, error) {
+	var subscriber Subscriber
+	err := r.db.First(&subscriber, "email = ?", mail).Error
+	return &subscriber, err
+}
+
+func (r *gormSubscriberRepository) GetBySignature(key string) (*Subscriber, error) {
+	var subscriber Subscriber
+	err := r.db.First(&subscriber, "signature = ?", key).Error
+	return &subscriber, err
+}
+
+func (r *gormSubscriberRepository) Delete(id uint) error {
+	return r.db.Delete(&Subscriber{}, "id = ?", id).Error
+}
+
+// link
+type gormLinkRepository struct {
+	*gormStore
+}
+
+func (r *gormLinkRepository) Create(link *Link) error {
+	return r.db.FirstOrCreate(link, "url = ?", link.Url).Error
+}
+
+func (r *gormLinkRepository) Update(link *Link) error {
+	return r.db.Save(link).Error
+}
+
+func (r *gormLinkRepository) Delete(id uint) error {
+	return r.db.Delete(&Link{}, "id = ?", id).Error
+}
+
+func (r *gormLinkRepository) Get(id uint) (*Link, error) {
+	var link Link
+	err := r.db.First(&link, "id = ?", id).Error
+	return &link, err
+}
+
+func (r *gormLinkRepository) List() ([]*Link, error) {
+	var links []*Link
+	err := r.db.Order("sort asc").Find(&links).Error
+	return links, err
+}
+
+// smms_files
+type gormSmmsFileRepository struct {
+	*gormStore
+}
+
+func (r *gormSmmsFileRepository) Create(file *SmmsFile) error {
+	return r.db.Create(file).Error
+}
+
+// session
+type gormSessionRepository struct {
+	*gormStore
+}
+
+func (r *gormSessionRepository) Create(session *Session) error {
+	return r.db.Create(session).Error
+}
+
+func (r *gormSessionRepository) Update(session *Session) error {
+	return r.db.Model(session).Updates(map[string]interface{}{
+		"user_id":      session.UserID,
+		"data":         session.Data,
+		"ip":           session.IP,
+		"last_seen_at": session.LastSeenAt,
+	}).Error
+}
+
+func (r *gormSessionRepository) Get(id string) (*Session, error) {
+	var session Session
+	err := r.db.First(&session, "id = ?", id).Error
+	return &session, err
+}
+
+func (r *gormSessionRepository) Delete(id string) error {
+	return r.db.Delete(&Session{}, "id = ?", id).Error
+}
+
+func (r *gormSessionRepository) DeleteByUserId(userId uint, exceptId string) error {
+	return r.db.Delete(&Session{}, "user_id = ? AND id <> ?", userId, exceptId).Error
+}
+
+func (r *gormSessionRepository) DeleteExpired(idleBefore, now time.Time) error {
+	return r.db.Delete(&Session{}, "last_seen_at < ? OR expires_at < ?", idleBefore, now).Error
+}
+
+func (r *gormSessionRepository) ListByUserId(userId uint) ([]*Session, error) {
+	var sessions []*Session
+	err := r.db.Where("user_id = ?", userId).Order("last_seen_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// login_attempts
+type gormLoginAttemptRepository struct {
+	*gormStore
+}
+
+func (r *gormLoginAttemptRepository) Create(attempt *LoginAttempt) error {
+	return r.db.Create(attempt).Error
+}
+
+func (r *gormLoginAttemptRepository) ListFailuresByIP(ip string, since time.Time) ([]*LoginAttempt, error) {
+	var attempts []*LoginAttempt
+	err := r.db.Where("ip = ? AND result = ? AND created_at > ?", ip, LOGIN_RESULT_FAILURE, since).Order("created_at desc").Find(&attempts).Error
+	return attempts, err
+}
+
+func (r *gormLoginAttemptRepository) ListRecent(limit int) ([]*LoginAttempt, error) {
+	var attempts []*LoginAttempt
+	err := r.db.Order("id desc").Limit(limit).Find(&attempts).Error
+	return attempts, err
+}
+
+func (r *gormLoginAttemptRepository) DeleteBefore(t time.Time) error {
+	return r.db.Delete(&LoginAttempt{}, "created_at < ?", t).Error
+}
+
+// recovery_codes
+type gormRecoveryCodeRepository struct {
+	*gormStore
+}
+
+func (r *gormRecoveryCodeRepository) Create(code *RecoveryCode) error {
+	return r.db.Create(code).Error
+}
+
+func (r *gormRecoveryCodeRepository) DeleteByUserId(userId uint) error {
+	return r.db.Delete(&RecoveryCode{}, "user_id = ?", userId).Error
+}
+
+func (r *gormRecoveryCodeRepository) Use(userId uint, codeHash string) error {
+	db := r.db.Model(&RecoveryCode{}).Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Update("used_at", time.Now())
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormRecoveryCodeRepository) CountUnused(userId uint) (int, error) {
+	var count int
+	err := r.db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userId).Count(&count).Error
+	return count, err
+}
+
+// user_identities
+type gormIdentityRepository struct {
+	*gormStore
+}
+
+func (r *gormIdentityRepository) Create(identity *UserIdentity) error {
+	return r.db.Create(identity).Error
+}
+
+func (r *gormIdentityRepository) Update(identity *UserIdentity) error {
+	return r.db.Model(identity).Updates(map[string]interface{}{
+		"login":          identity.Login,
+		"name":           identity.Name,
+		"email":          identity.Email,
+		"email_verified": identity.EmailVerified,
+		"avatar_url":     identity.AvatarUrl,
+		"profile_url":    identity.ProfileUrl,
+	}).Error
+}
+
+func (r *gormIdentityRepository) Get(provider, subject string) (*UserIdentity, error) {
+	var identity UserIdentity
+	err := r.db.First(&identity, "provider = ? AND subject = ?", provider, subject).Error
+	return &identity, err
+}
+
+func (r *gormIdentityRepository) ListByUserId(userId uint) ([]*UserIdentity, error) {
+	var identities []*UserIdentity
+	err := r.db.Where("user_id = ?", userId).Order("id").Find(&identities).Error
+	return identities, err
+}
+
+func (r *gormIdentityRepository) Delete(userId uint, provider string) error {
+	return r.db.Delete(&UserIdentity{}, "user_id = ? AND provider = ?", userId, provider).Error
+}
+
+// access_tokens
+type gormAccessTokenRepository struct {
+	*gormStore
+}
+
+func (r *gormAccessTokenRepository) Create(token *AccessToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *gormAccessTokenRepository) GetByHash(hash string) (*AccessToken, error) {
+	var token AccessToken
+	err := r.db.First(&token, "token_hash = ?", hash).Error
+	return &token, err
+}
+
+func (r *gormAccessTokenRepository) ListByUserId(userId uint) ([]*AccessToken, error) {
+	var tokens []*AccessToken
+	err := r.db.Where("user_id = ?", userId).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+func (r *gormAccessTokenRepository) UpdateLastUsed(token *AccessToken) error {
+	return r.db.Model(token).UpdateColumn("last_used_at", token.LastUsedAt).Error
+}
+
+func (r *gormAccessTokenRepository) Delete(userId, id uint) error {
+	db := r.db.Delete(&AccessToken{}, "id = ? AND user_id = ?", id, userId)
+	if db.Error != nil {
+		return db.Error
+	}
+	if db.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// slug_histories
+type gormSlugHistoryRepository struct {
+	*gormStore
+}
+
+func (r *gormSlugHistoryRepository) Create(history *SlugHistory) error {
+	if err := r.Delete(history.Kind, history.Slug); err != nil {
+		return err
+	}
+	return r.db.Create(history).Error
+}
+
+func (r *gormSlugHistoryRepository) Get(kind, slug string) (*SlugHistory, error) {
+	var history SlugHistory
+	err := r.db.First(&history, "kind = ? AND slug = ?", kind, slug).Error
+	return &history, err
+}
+
+func (r *gormSlugHistoryRepository) Delete(kind, slug string) error {
+	return r.db.Delete(&SlugHistory{}, "kind = ? AND slug = ?", kind, slug).Error
+}
+
+func (r *gormSlugHistoryRepository) DeleteByTarget(kind string, targetId uint) error {
+	return r.db.Delete(&SlugHistory{}, "kind = ? AND target_id = ?", kind, targetId).Error
+}
+
+// revisions
+type gormRevisionRepository struct {
+	*gormStore
+}
+
+func (r *gormRevisionRepository) Create(revision *Revision) error {
+	return r.db.Create(revision).Error
+}
+
+func (r *gormRevisionRepository) Get(id uint) (*Revision, error) {
+	var revision Revision
+	err := r.db.First(&revision, id).Error
+	return &revision, err
+}
+
+func (r *gormRevisionRepository) Latest(kind string, targetId uint) (*Revision, error) {
+	var revision Revision
+	err := r.db.Order("id desc").First(&revision, "kind = ? AND target_id = ?", kind, targetId).Error
+	return &revision, err
+}
+
+func (r *gormRevisionRepository) List(kind string, targetId uint) ([]*Revision, error) {
+	var revisions []*Revision
+	err := r.db.Where("kind = ? AND target_id = ?", kind, targetId).Order("id desc").Find(&revisions).Error
+	return revisions, err
+}
+
+func (r *gormRevisionRepository) Prune(kind string, targetId uint, keep int) error {
+	var ids []uint
+	err := r.db.Model(&Revision{}).Where("kind = ? AND target_id = ?", kind, targetId).Order("id desc").Pluck("id", &ids).Error
+	if err != nil || len(ids) <= keep {
+		return err
+	}
+	return r.db.Delete(&Revision{}, "id in (?)", ids[keep:]).Error
+}
+
+func (r *gormRevisionRepository) DeleteByTarget(kind string, targetId uint) error {
+	return r.db.Delete(&Revision{}, "kind = ? AND target_id = ?", kind, targetId).Error
+}
+
+// drafts
+type gormDraftRepository struct {
+	*gormStore
+}
+
+func (r *gormDraftRepository) Save(draft *Draft) error {
+	existing, err := r.Get(draft.Kind, draft.TargetID, draft.UserID)
+	if err == ErrNotFound {
+		return r.db.Create(draft).Error
+	}
+	if err != nil {
+		return err
+	}
+	draft.ID, draft.CreatedAt = existing.ID, existing.CreatedAt
+	return r.db.Model(draft).Updates(map[string]interface{}{
+		"title": draft.Title,
+		"body":  draft.Body,
+		"tags":  draft.Tags,
+	}).Error
+}
+
+func (r *gormDraftRepository) Get(kind string, targetId, userId uint) (*Draft, error) {
+	var draft Draft
+	err := r.db.First(&draft, "kind = ? AND target_id = ? AND user_id = ?", kind, targetId, userId).Error
+	return &draft, err
+}
+
+func (r *gormDraftRepository) ListByTarget(kind string, targetId uint) ([]*Draft, error) {
+	var drafts []*Draft
+	err := r.db.Where("kind = ? AND target_id = ?", kind, targetId).Order("updated_at desc").Find(&drafts).Error
+	return drafts, err
+}
+
+func (r *gormDraftRepository) Delete(kind string, targetId, userId uint) error {
+	return r.db.Delete(&Draft{}, "kind = ? AND target_id = ? AND user_id = ?", kind, targetId, userId).Error
+}
+
+func (r *gormDraftRepository) DeleteByTarget(kind string, targetId uint) error {
+	return r.db.Delete(&Draft{}, "kind = ? AND target_id = ?", kind, targetId).Error
+}
+
+type gormUserTokenRepository struct {
+	*gormStore
+}
+
+func (r *gormUserTokenRepository) Save(token *UserToken) error {
+	existing, err := r.Get(token.UserID, token.Purpose)
+	if err == ErrNotFound {
+		return r.db.Create(token).Error
+	}
+	if err != nil {
+		return err
+	}
+	token.ID, token.CreatedAt = existing.ID, existing.CreatedAt
+	return r.db.Model(token).Updates(map[string]interface{}{
+		"secret_key": token.SecretKey,
+		"expires_at": token.ExpiresAt,
+	}).Error
+}
+
+func (r *gormUserTokenRepository) Get(userId uint, purpose string) (*UserToken, error) {
+	var token UserToken
+	err := r.db.First(&token, "user_id = ? AND purpose = ?", userId, purpose).Error
+	return &token, err
+}
+
+func (r *gormUserTokenRepository) Delete(userId uint, purpose string) error {
+	return r.db.Delete(&UserToken{}, "user_id = ? AND purpose = ?", userId, purpose).Error
+}
@@ -0,0 +1,1997 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内存数据，key为主键
+type memoryData struct {
+	pages       map[uint]*Page
+	posts       map[uint]*Post
+	tags        map[uint]*Tag
+	postTags    map[uint]*PostTag
+	users       map[uint]*User
+	comments    map[uint]*Comment
+	subscribers map[uint]*Subscriber
+	links       map[uint]*Link
+	smmsFiles   map[uint]*SmmsFile
+	sessions    map[string]*Session
+	attempts    map[uint]*LoginAttempt
+	recoveries  map[uint]*RecoveryCode
+	identities  map[uint]*UserIdentity
+	tokens      map[uint]*AccessToken
+	slugs       map[uint]*SlugHistory
+	revisions   map[uint]*Revision
+	drafts      map[uint]*Draft
+	userTokens  map[uint]*UserToken
+	owner       bool //是否已有用户成为站长
+	lastId      uint
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		pages:       make(map[uint]*Page),
+		posts:       make(map[uint]*Post),
+		tags:        make(map[uint]*Tag),
+		postTags:    make(map[uint]*PostTag),
+		users:       make(map[uint]*User),
+		comments:    make(map[uint]*Comment),
+		subscribers: make(map[uint]*Subscriber),
+		links:       make(map[uint]*Link),
+		smmsFiles:   make(map[uint]*SmmsFile),
+		sessions:    make(map[string]*Session),
+		attempts:    make(map[uint]*LoginAttempt),
+		recoveries:  make(map[uint]*RecoveryCode),
+		identities:  make(map[uint]*UserIdentity),
+		tokens:      make(map[uint]*AccessToken),
+		slugs:       make(map[uint]*SlugHistory),
+		revisions:   make(map[uint]*Revision),
+		drafts:      make(map[uint]*Draft),
+		userTokens:  make(map[uint]*UserToken),
+	}
+}
+
+// 复制一份数据，用于事务回滚
+func (d *memoryData) clone() *memoryData {
+	c := newMemoryData()
+	for k, v := range d.pages {
+		item := *v
+		c.pages[k] = &item
+	}
+	for k, v := range d.posts {
+		item := *v
+		c.posts[k] = &item
+	}
+	for k, v := range d.tags {
+		item := *v
+		c.tags[k] = &item
+	}
+	for k, v := range d.postTags {
+		item := *v
+		c.postTags[k] = &item
+	}
+	for k, v := range d.users {
+		item := *v
+		c.users[k] = &item
+	}
+	for k, v := range d.comments {
+		item := *v
+		c.comments[k] = &item
+	}
+	for k, v := range d.subscribers {
+		item := *v
+		c.subscribers[k] = &item
+	}
+	for k, v := range d.links {
+		item := *v
+		c.links[k] = &item
+	}
+	for k, v := range d.smmsFiles {
+		item := *v
+		c.smmsFiles[k] = &item
+	}
+	for k, v := range d.sessions {
+		item := *v
+		c.sessions[k] = &item
+	}
+	for k, v := range d.attempts {
+		item := *v
+		c.attempts[k] = &item
+	}
+	for k, v := range d.recoveries {
+		item := *v
+		c.recoveries[k] = &item
+	}
+	for k, v := range d.identities {
+		item := *v
+		c.identities[k] = &item
+	}
+	for k, v := range d.tokens {
+		item := *v
+		c.tokens[k] = &item
+	}
+	for k, v := range d.slugs {
+		item := *v
+		c.slugs[k] = &item
+	}
+	for k, v := range d.revisions {
+		item := *v
+		c.revisions[k] = &item
+	}
+	for k, v := range d.drafts {
+		item := *v
+		c.drafts[k] = &item
+	}
+	for k, v := range d.userTokens {
+		item := *v
+		c.userTokens[k] = &item
+	}
+	c.owner = d.owner
+	c.lastId = d.lastId
+	return c
+}
+
+func (d *memoryData) nextId() uint {
+	d.lastId++
+	return d.lastId
+}
+
+// 基于内存的仓库实现，用于测试和无数据库环境
+// 事务期间其他写操作会被阻塞，回滚时恢复到事务开始前的数据
+type memoryStore struct {
+	mu   *sync.RWMutex
+	txMu *sync.Mutex
+	data **memoryData
+	inTx bool
+}
+
+func NewMemoryStore() Store {
+	data := newMemoryData()
+	return &memoryStore{
+		mu:   new(sync.RWMutex),
+		txMu: new(sync.Mutex),
+		data: &data,
+	}
+}
+
+func (s *memoryStore) Pages() PageRepository                 { return &memoryPageRepository{s} }
+func (s *memoryStore) Posts() PostRepository                 { return &memoryPostRepository{s} }
+func (s *memoryStore) Tags() TagRepository                   { return &memoryTagRepository{s} }
+func (s *memoryStore) PostTags() PostTagRepository           { return &memoryPostTagRepository{s} }
+func (s *memoryStore) Users() UserRepository                 { return &memoryUserRepository{s} }
+func (s *memoryStore) Comments() CommentRepository           { return &memoryCommentRepository{s} }
+func (s *memoryStore) Subscribers() SubscriberRepository     { return &memorySubscriberRepository{s} }
+func (s *memoryStore) Links() LinkRepository                 { return &memoryLinkRepository{s} }
+func (s *memoryStore) SmmsFiles() SmmsFileRepository         { return &memorySmmsFileRepository{s} }
+func (s *memoryStore) Sessions() SessionRepository           { return &memorySessionRepository{s} }
+func (s *memoryStore) LoginAttempts() LoginAttemptRepository { return &memoryLoginAttemptRepository{s} }
+func (s *memoryStore) RecoveryCodes() RecoveryCodeRepository { return &memoryRecoveryCodeRepository{s} }
+func (s *memoryStore) Identities() IdentityRepository        { return &memoryIdentityRepository{s} }
+func (s *memoryStore) AccessTokens() AccessTokenRepository   { return &memoryAccessTokenRepository{s} }
+func (s *memoryStore) SlugHistories() SlugHistoryRepository  { return &memorySlugHistoryRepository{s} }
+func (s *memoryStore) Revisions() RevisionRepository         { return &memoryRevisionRepository{s} }
+func (s *memoryStore) Drafts() DraftRepository               { return &memoryDraftRepository{s} }
+func (s *memoryStore) UserTokens() UserTokenRepository       { return &memoryUserTokenRepository{s} }
+
+func (s *memoryStore) Transaction(fn func(tx Store) error) (err error) {
+	if s.inTx {
+		return fn(s)
+	}
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+	s.mu.RLock()
+	snapshot := (*s.data).clone()
+	s.mu.RUnlock()
+	defer func() {
+		if r := recover(); r != nil {
+			s.restore(snapshot)
+			panic(r)
+		}
+		if err != nil {
+			s.restore(snapshot)
+		}
+	}()
+	return fn(&memoryStore{mu: s.mu, txMu: s.txMu, data: s.data, inTx: true})
+}
+
+func (s *memoryStore) restore(snapshot *memoryData) {
+	s.mu.Lock()
+	*s.data = snapshot
+	s.mu.Unlock()
+}
+
+// 读操作
+func (s *memoryStore) read(fn func(d *memoryData)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fn(*s.data)
+}
+
+// 写操作，非事务的写操作需要等待正在进行的事务结束
+func (s *memoryStore) write(fn func(d *memoryData) error) error {
+	if !s.inTx {
+		s.txMu.Lock()
+		defer s.txMu.Unlock()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(*s.data)
+}
+
+// 按分页截取
+func paginate(total, pageIndex, pageSize int) (int, int) {
+	if pageIndex <= 0 {
+		return 0, total
+	}
+	start := (pageIndex - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// page
+type memoryPageRepository struct {
+	*memoryStore
+}
+
+func (r *memoryPageRepository) Create(page *Page) error {
+	return r.write(func(d *memoryData) error {
+		if d.pageSlugExists(page.Slug, 0) {
+			return errors.New("duplicate page slug")
+		}
+		page.ID = d.nextId()
+		page.CreatedAt = time.Now()
+		page.UpdatedAt = page.CreatedAt
+		item := *page
+		d.pages[page.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryPageRepository) Update(page *Page) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.pages[page.ID]; ok {
+			if d.pageSlugExists(page.Slug, page.ID) {
+				return errors.New("duplicate page slug")
+			}
+			item.Title = page.Title
+			item.Slug = page.Slug
+			item.Body = page.Body
+			item.IsPublished = page.IsPublished
+			item.PublishAt = page.PublishAt
+			item.UpdatedAt = time.Now()
+		}
+		return nil
+	})
+}
+
+func (r *memoryPageRepository) UpdateView(page *Page) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.pages[page.ID]; ok {
+			item.View = page.View
+		}
+		return nil
+	})
+}
+
+func (r *memoryPageRepository) Delete(id uint) error {
+	return r.write(func(d *memoryData) error {
+		delete(d.pages, id)
+		return nil
+	})
+}
+
+func (r *memoryPageRepository) Get(id uint) (page *Page, err error) {
+	r.read(func(d *memoryData) {
+		if item, ok := d.pages[id]; ok {
+			p := *item
+			page = &p
+		}
+	})
+	if page == nil {
+		return &Page{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memoryPageRepository) GetBySlug(slug string) (page *Page, err error) {
+	r.read(func(d *memoryData) {
+		for _, item := range d.pages {
+			if item.Slug == slug {
+				p := *item
+				page = &p
+				return
+			}
+		}
+	})
+	if page == nil {
+		return &Page{}, ErrNotFound
+	}
+	return
+}
+
+// 除exceptId外是否有页面使用该slug
+func (d *memoryData) pageSlugExists(slug string, exceptId uint) bool {
+	for _, item := range d.pages {
+		if item.Slug == slug && item.ID != exceptId {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryPageRepository) List(published bool) ([]*Page, error) {
+	pages := make([]*Page, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.pages {
+			if published && !item.IsVisible() {
+				continue
+			}
+			p := *item
+			pages = append(pages, &p)
+		}
+	})
+	sort.Slice(pages, func(i, j int) bool { return pages[i].ID < pages[j].ID })
+	return pages, nil
+}
+
+func (r *memoryPageRepository) ListDue() ([]*Page, error) {
+	now := time.Now()
+	pages := make([]*Page, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.pages {
+			if isDue(item.IsPublished, item.PublishAt, now) {
+				p := *item
+				pages = append(pages, &p)
+			}
+		}
+	})
+	sort.Slice(pages, func(i, j int) bool { return pages[i].PublishAt.Before(*pages[j].PublishAt) })
+	return pages, nil
+}
+
+func (r *memoryPageRepository) PublishDue(id uint) (published bool, err error) {
+	err = r.write(func(d *memoryData) error {
+		if item, ok := d.pages[id]; ok && isDue(item.IsPublished, item.PublishAt, time.Now()) {
+			item.IsPublished = true
+			item.UpdatedAt = time.Now()
+			published = true
+		}
+		return nil
+	})
+	return
+}
+
+func (r *memoryPageRepository) Count() (count int) {
+	r.read(func(d *memoryData) {
+		count = len(d.pages)
+	})
+	return
+}
+
+// post
+type memoryPostRepository struct {
+	*memoryStore
+}
+
+func (r *memoryPostRepository) Create(post *Post) error {
+	return r.write(func(d *memoryData) error {
+		if d.postSlugExists(post.Slug, 0) {
+			return errors.New("duplicate post slug")
+		}
+		post.ID = d.nextId()
+		post.CreatedAt = time.Now()
+		post.UpdatedAt = post.CreatedAt
+		item := *post
+		d.posts[post.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryPostRepository) Update(post *Post) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.posts[post.ID]; ok {
+			if d.postSlugExists(post.Slug, post.ID) {
+				return errors.New("duplicate post slug")
+			}
+			item.Title = post.Title
+			item.Slug = post.Slug
+			item.Body = post.Body
+			item.IsPublished = post.IsPublished
+			item.PublishAt = post.PublishAt
+			item.UpdatedAt = time.Now()
+		}
+		return nil
+	})
+}
+
+func (r *memoryPostRepository) UpdateView(post *Post) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.posts[post.ID]; ok {
+			item.View = post.View
+		}
+		return nil
+	})
+}
+
+func (r *memoryPostRepository) Delete(id uint) error {
+	return r.write(func(d *memoryData) error {
+		delete(d.posts, id)
+		return nil
+	})
+}
+
+func (r *memoryPostRepository) Get(id uint) (post *Post, err error) {
+	r.read(func(d *memoryData) {
+		if item, ok := d.posts[id]; ok {
+			p := *item
+			post = &p
+		}
+	})
+	if post == nil {
+		return &Post{}, ErrNotFound
+	}
+	return
+}
+
+// 按条件过滤文章，按创建时间倒序
+func (r *memoryPostRepository) filter(match func(d *memoryData, post *Post) bool) []*Post {
+	posts := make([]*Post, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.posts {
+			if match(d, item) {
+				p := *item
+				posts = append(posts, &p)
+			}
+		}
+	})
+	sort.Slice(posts, func(i, j int) bool {
+		if posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].ID > posts[j].ID
+		}
+		return posts[i].CreatedAt.After(posts[j].CreatedAt)
+	})
+	return posts
+}
+
+func hasTag(d *memoryData, postId, tagId uint) bool {
+	for _, pt := range d.postTags {
+		if pt.PostId == postId && pt.TagId == tagId {
+			return true
+		}
+	}
+	return false
+}
+
+// 前台显示的文章，按发布时间倒序
+func (r *memoryPostRepository) visible(match func(d *memoryData, post *Post) bool) []*Post {
+	posts := r.filter(func(d *memoryData, post *Post) bool {
+		return post.IsVisible() && match(d, post)
+	})
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].PublishAt.After(*posts[j].PublishAt) })
+	return posts
+}
+
+func (r *memoryPostRepository) list(tagId uint, published bool, pageIndex, pageSize int) ([]*Post, error) {
+	match := func(d *memoryData, post *Post) bool {
+		return tagId == 0 || hasTag(d, post.ID, tagId)
+	}
+	var posts []*Post
+	if published {
+		posts = r.visible(match)
+	} else {
+		posts = r.filter(match)
+	}
+	start, end := paginate(len(posts), pageIndex, pageSize)
+	return posts[start:end], nil
+}
+
+func (r *memoryPostRepository) GetBySlug(slug string) (post *Post, err error) {
+	r.read(func(d *memoryData) {
+		for _, item := range d.posts {
+			if item.Slug == slug {
+				p := *item
+				post = &p
+				return
+			}
+		}
+	})
+	if post == nil {
+		return &Post{}, ErrNotFound
+	}
+	return
+}
+
+// 除exceptId外是否有文章使用该slug
+func (d *memoryData) postSlugExists(slug string, exceptId uint) bool {
+	for _, item := range d.posts {
+		if item.Slug == slug && item.ID != exceptId {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryPostRepository) ListPublished(tagId uint, pageIndex, pageSize int) ([]*Post, error) {
+	return r.list(tagId, true, pageIndex, pageSize)
+}
+
+func (r *memoryPostRepository) ListAll(tagId uint) ([]*Post, error) {
+	return r.list(tagId, false, 0, 0)
+}
+
+func (r *memoryPostRepository) ListByUserId(userId uint) ([]*Post, error) {
+	return r.filter(func(d *memoryData, post *Post) bool {
+		return post.UserID == userId
+	}), nil
+}
+
+func (r *memoryPostRepository) ListMaxRead() ([]*Post, error) {
+	posts := r.visible(func(d *memoryData, post *Post) bool {
+		return true
+	})
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].View > posts[j].View })
+	if len(posts) > 5 {
+		posts = posts[:5]
+	}
+	return posts, nil
+}
+
+func (r *memoryPostRepository) ListMaxComment() ([]*Post, error) {
+	totals := make(map[uint]int)
+	r.read(func(d *memoryData) {
+		for _, comment := range d.comments {
+			if comment.Status == COMMENT_STATUS_APPROVED {
+				totals[comment.PostID]++
+			}
+		}
+	})
+	posts := r.visible(func(d *memoryData, post *Post) bool {
+		return totals[post.ID] > 0
+	})
+	for _, post := range posts {
+		post.CommentTotal = totals[post.ID]
+	}
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].CommentTotal > posts[j].CommentTotal })
+	if len(posts) > 5 {
+		posts = posts[:5]
+	}
+	return posts, nil
+}
+
+func (r *memoryPostRepository) CountByTag(tagId uint) (int, error) {
+	posts, err := r.list(tagId, true, 0, 0)
+	return len(posts), err
+}
+
+func (r *memoryPostRepository) Count() (count int) {
+	r.read(func(d *memoryData) {
+		count = len(d.posts)
+	})
+	return
+}
+
+func (r *memoryPostRepository) ListArchives() ([]*QrArchive, error) {
+	totals := make(map[string]int)
+	//和gorm实现一致，按UTC时间的月份归档
+	for _, post := range r.visible(func(d *memoryData, post *Post) bool { return true }) {
+		totals[post.PublishAt.UTC().Format("2006-01")]++
+	}
+	archives := make([]*QrArchive, 0, len(totals))
+	for month, total := range totals {
+		archive := &QrArchive{Total: total}
+		archive.ArchiveDate, _ = time.Parse("2006-01", month)
+		archive.Year = archive.ArchiveDate.Year()
+		archive.Month = int(archive.ArchiveDate.Month())
+		archives = append(archives, archive)
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].ArchiveDate.After(archives[j].ArchiveDate) })
+	return archives, nil
+}
+
+func (r *memoryPostRepository) ListByArchive(year, month, pageIndex, pageSize int) ([]*Post, error) {
+	posts := r.visible(func(d *memoryData, post *Post) bool {
+		date := post.PublishAt.UTC()
+		return date.Year() == year && int(date.Month()) == month
+	})
+	start, end := paginate(len(posts), pageIndex, pageSize)
+	return posts[start:end], nil
+}
+
+func (r *memoryPostRepository) CountByArchive(year, month int) (int, error) {
+	posts, err := r.ListByArchive(year, month, 0, 0)
+	return len(posts), err
+}
+
+func (r *memoryPostRepository) ListDue() ([]*Post, error) {
+	now := time.Now()
+	posts := r.filter(func(d *memoryData, post *Post) bool {
+		return isDue(post.IsPublished, post.PublishAt, now)
+	})
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].PublishAt.Before(*posts[j].PublishAt) })
+	return posts, nil
+}
+
+func (r *memoryPostRepository) PublishDue(id uint) (published bool, err error) {
+	err = r.write(func(d *memoryData) error {
+		if item, ok := d.posts[id]; ok && isDue(item.IsPublished, item.PublishAt, time.Now()) {
+			item.IsPublished = true
+			item.UpdatedAt = time.Now()
+			published = true
+		}
+		return nil
+	})
+	return
+}
+
+// tag
+type memoryTagRepository struct {
+	*memoryStore
+}
+
+func (r *memoryTagRepository) Create(tag *Tag) error {
+	return r.write(func(d *memoryData) error {
+		for _, item := range d.tags {
+			if item.Name == tag.Name {
+				*tag = *item
+				return nil
+			}
+		}
+		tag.ID = d.nextId()
+		tag.CreatedAt = time.Now()
+		tag.UpdatedAt = tag.CreatedAt
+		item := *tag
+		d.tags[tag.ID] = &item
+		return nil
+	})
+}
+
+func sortTags(tags []*Tag) []*Tag {
+	sort.Slice(tags, func(i, j int) bool { return tags[i].ID < tags[j].ID })
+	return tags
+}
+
+func (r *memoryTagRepository) ListPublished() ([]*Tag, error) {
+	tags := make([]*Tag, 0)
+	r.read(func(d *memoryData) {
+		totals := make(map[uint]int)
+		for _, pt := range d.postTags {
+			if post, ok := d.posts[pt.PostId]; ok && post.IsVisible() {
+				totals[pt.TagId]++
+			}
+		}
+		for id, total := range totals {
+			if item, ok := d.tags[id]; ok {
+				tag := *item
+				tag.Total = total
+				tags = append(tags, &tag)
+			}
+		}
+	})
+	return sortTags(tags), nil
+}
+
+func (r *memoryTagRepository) ListAll() ([]*Tag, error) {
+	tags := make([]*Tag, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.tags {
+			tag := *item
+			tags = append(tags, &tag)
+		}
+	})
+	return sortTags(tags), nil
+}
+
+func (r *memoryTagRepository) ListByPostId(postId uint) ([]*Tag, error) {
+	tags := make([]*Tag, 0)
+	r.read(func(d *memoryData) {
+		for _, pt := range d.postTags {
+			if item, ok := d.tags[pt.TagId]; ok && pt.PostId == postId {
+				tag := *item
+				tags = append(tags, &tag)
+			}
+		}
+	})
+	return sortTags(tags), nil
+}
+
+func (r *memoryTagRepository) Get(id uint) (tag *Tag, err error) {
+	r.read(func(d *memoryData) {
+		if item, ok := d.tags[id]; ok {
+			t := *item
+			tag = &t
+		}
+	})
+	if tag == nil {
+		return &Tag{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memoryTagRepository) Update(tag *Tag) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.tags[tag.ID]; ok {
+			item.Name = tag.Name
+			item.UpdatedAt = time.Now()
+		}
+		return nil
+	})
+}
+
+func (r *memoryTagRepository) Delete(id uint) error {
+	return r.write(func(d *memoryData) error {
+		delete(d.tags, id)
+		return nil
+	})
+}
+
+func (r *memoryTagRepository) Count() (count int) {
+	r.read(func(d *memoryData) {
+		count = len(d.tags)
+	})
+	return
+}
+
+// post_tags
+type memoryPostTagRepository struct {
+	*memoryStore
+}
+
+func (r *memoryPostTagRepository) Create(pt *PostTag) error {
+	return r.write(func(d *memoryData) error {
+		for _, item := range d.postTags {
+			if item.PostId == pt.PostId && item.TagId == pt.TagId {
+				*pt = *item
+				return nil
+			}
+		}
+		pt.ID = d.nextId()
+		pt.CreatedAt = time.Now()
+		pt.UpdatedAt = pt.CreatedAt
+		item := *pt
+		d.postTags[pt.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryPostTagRepository) DeleteByPostId(postId uint) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.postTags {
+			if item.PostId == postId {
+				delete(d.postTags, id)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryPostTagRepository) DeleteByTagId(tagId uint) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.postTags {
+			if item.TagId == tagId {
+				delete(d.postTags, id)
+			}
+		}
+		return nil
+	})
+}
+
+// user
+type memoryUserRepository struct {
+	*memoryStore
+}
+
+// 模拟唯一索引
+func checkUserUnique(d *memoryData, user *User) error {
+	for _, item := range d.users {
+		if item.ID == user.ID {
+			continue
+		}
+		if user.Email != "" && item.Email == user.Email {
+			return errors.New("duplicate email")
+		}
+		if user.Telephone != "" && item.Telephone == user.Telephone {
+			return errors.New("duplicate telephone")
+		}
+		if user.GithubLoginId != "" && item.GithubLoginId == user.GithubLoginId {
+			return errors.New("duplicate github_login_id")
+		}
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) Create(user *User) error {
+	return r.write(func(d *memoryData) error {
+		if err := checkUserUnique(d, user); err != nil {
+			return err
+		}
+		user.ID = d.nextId()
+		user.CreatedAt = time.Now()
+		user.UpdatedAt = user.CreatedAt
+		if user.VerifyState == "" {
+			user.VerifyState = VERIFY_STATE_UNVERIFIED
+		}
+		if user.Role == "" {
+			user.Role = ROLE_COMMENTER
+		}
+		item := *user
+		d.users[user.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryUserRepository) Update(user *User) error {
+	return r.write(func(d *memoryData) error {
+		if err := checkUserUnique(d, user); err != nil {
+			return err
+		}
+		user.UpdatedAt = time.Now()
+		item := *user
+		d.users[user.ID] = &item
+		return nil
+	})
+}
+
+// 修改已存在的用户
+func (r *memoryUserRepository) modify(user *User, fn func(item *User)) error {
+	return r.write(func(d *memoryData) error {
+		item, ok := d.users[user.ID]
+		if !ok {
+			return ErrNotFound
+		}
+		updated := *item
+		fn(&updated)
+		if err := checkUserUnique(d, &updated); err != nil {
+			return err
+		}
+		updated.UpdatedAt = time.Now()
+		d.users[user.ID] = &updated
+		return nil
+	})
+}
+
+// 按条件查找第一个用户
+func (r *memoryUserRepository) find(match func(user *User) bool) (user *User, err error) {
+	r.read(func(d *memoryData) {
+		for _, item := range d.users {
+			if match(item) && (user == nil || item.ID < user.ID) {
+				u := *item
+				user = &u
+			}
+		}
+	})
+	if user == nil {
+		return &User{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memoryUserRepository) Get(id uint) (*User, error) {
+	return r.find(func(user *User) bool { return user.ID == id })
+}
+
+func (r *memoryUserRepository) GetByUsername(username string) (*User, error) {
+	return r.find(func(user *User) bool { return user.Email != "" && user.Email == username })
+}
+
+func (r *memoryUserRepository) IsGithubIdExists(githubId string, id uint) (*User, error) {
+	return r.find(func(user *User) bool { return user.GithubLoginId == githubId && user.ID != id })
+}
+
+func (r *memoryUserRepository) UpdateProfile(user *User, avatarUrl, nickName string) error {
+	return r.modify(user, func(item *User) {
+		//与gorm的struct更新一致，忽略空值
+		if avatarUrl != "" {
+			item.AvatarUrl = avatarUrl
+		}
+		if nickName != "" {
+			item.NickName = nickName
+		}
+	})
+}
+
+func (r *memoryUserRepository) UpdateEmail(user *User, email string) error {
+	err := r.modify(user, func(item *User) {
+		item.Email = email
+		if len(email) > 0 {
+			item.VerifyState = VERIFY_STATE_UNVERIFIED
+		}
+	})
+	if err == nil {
+		user.Email = email
+		if len(email) > 0 {
+			user.VerifyState = VERIFY_STATE_UNVERIFIED
+		}
+	}
+	return err
+}
+
+func (r *memoryUserRepository) UpdateGithubUserInfo(user *User) error {
+	return r.modify(user, func(item *User) {
+		item.GithubLoginId = user.GithubLoginId
+		item.AvatarUrl = user.AvatarUrl
+		item.GithubUrl = user.GithubUrl
+	})
+}
+
+func (r *memoryUserRepository) Lock(user *User) error {
+	return r.modify(user, func(item *User) {
+		item.LockState = user.LockState
+	})
+}
+
+func (r *memoryUserRepository) UpdatePassword(user *User, password string) error {
+	return r.modify(user, func(item *User) {
+		item.Password = password
+	})
+}
+
+func (r *memoryUserRepository) UpdateVerifyState(user *User) error {
+	return r.modify(user, func(item *User) {
+		item.VerifyState = user.VerifyState
+	})
+}
+
+func (r *memoryUserRepository) UpdateRole(user *User) error {
+	return r.modify(user, func(item *User) {
+		item.Role = user.Role
+	})
+}
+
+func (r *memoryUserRepository) UpdateLoginState(user *User) error {
+	return r.modify(user, func(item *User) {
+		item.FailedLogins = user.FailedLogins
+		item.LastFailedAt = user.LastFailedAt
+		item.LockedUntil = user.LockedUntil
+	})
+}
+
+func (r *memoryUserRepository) AddFailedLogin(user *User, at time.Time) error {
+	return r.modify(user, func(item *User) {
+		item.FailedLogins++
+		item.LastFailedAt = &at
+		user.FailedLogins = item.FailedLogins
+		user.LastFailedAt = &at
+	})
+}
+
+func (r *memoryUserRepository) UpdateTotp(user *User) error {
+	return r.modify(user, func(item *User) {
+		item.TotpSecret = user.TotpSecret
+		item.TotpEnabled = user.TotpEnabled
+		item.TotpLastStep = user.TotpLastStep
+	})
+}
+
+func (r *memoryUserRepository) UseTotpStep(user *User, step int64) error {
+	used := false
+	err := r.modify(user, func(item *User) {
+		if item.TotpLastStep < step {
+			item.TotpLastStep = step
+			user.TotpLastStep = step
+			used = true
+		}
+	})
+	if err == nil && !used {
+		err = ErrNotFound
+	}
+	return err
+}
+
+func (r *memoryUserRepository) UpdateMuteReplies(user *User) error {
+	return r.modify(user, func(item *User) {
+		item.MuteReplies = user.MuteReplies
+	})
+}
+
+func (r *memoryUserRepository) List() ([]*User, error) {
+	users := make([]*User, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.users {
+			u := *item
+			users = append(users, &u)
+		}
+	})
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *memoryUserRepository) Count() (count int) {
+	r.read(func(d *memoryData) {
+		count = len(d.users)
+	})
+	return
+}
+
+func (r *memoryUserRepository) ClaimOwner() (claimed bool, err error) {
+	err = r.write(func(d *memoryData) error {
+		claimed = !d.owner
+		d.owner = true
+		return nil
+	})
+	return
+}
+
+// comment
+type memoryCommentRepository struct {
+	*memoryStore
+}
+
+func (r *memoryCommentRepository) Create(comment *Comment) error {
+	return r.write(func(d *memoryData) error {
+		comment.ID = d.nextId()
+		comment.CreatedAt = time.Now()
+		comment.UpdatedAt = comment.CreatedAt
+		item := *comment
+		d.comments[comment.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryCommentRepository) Delete(id uint) error {
+	return r.write(func(d *memoryData) error {
+		item, ok := d.comments[id]
+		if !ok {
+			return ErrNotFound
+		}
+		for {
+			hasReplies := false
+			for _, reply := range d.comments {
+				if reply.ParentID == item.ID {
+					hasReplies = true
+					break
+				}
+			}
+			if hasReplies {
+				item.Content, item.Deleted, item.ReadState = "", true, true
+				return nil
+			}
+			delete(d.comments, item.ID)
+			//已删除的上级评论没有其他回复后一起删除
+			parent, ok := d.comments[item.ParentID]
+			if !ok || !parent.Deleted {
+				return nil
+			}
+			item = parent
+		}
+	})
+}
+
+func (r *memoryCommentRepository) SetRead(id uint) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.comments[id]; ok {
+			item.ReadState = true
+		}
+		return nil
+	})
+}
+
+func (r *memoryCommentRepository) SetAllRead() error {
+	return r.write(func(d *memoryData) error {
+		for _, item := range d.comments {
+			item.ReadState = true
+		}
+		return nil
+	})
+}
+
+// 按条件过滤评论，按创建时间倒序
+func (r *memoryCommentRepository) filter(match func(d *memoryData, comment *Comment) bool) []*Comment {
+	comments := make([]*Comment, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.comments {
+			if match(d, item) {
+				c := *item
+				comments = append(comments, &c)
+			}
+		}
+	})
+	sort.Slice(comments, func(i, j int) bool {
+		if comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].ID > comments[j].ID
+		}
+		return comments[i].CreatedAt.After(comments[j].CreatedAt)
+	})
+	return comments
+}
+
+func (r *memoryCommentRepository) ListUnread() ([]*Comment, error) {
+	return r.filter(func(d *memoryData, comment *Comment) bool {
+		return !comment.ReadState
+	}), nil
+}
+
+func (r *memoryCommentRepository) ListByPostId(postId uint) ([]*Comment, error) {
+	users := make(map[uint]User)
+	comments := r.filter(func(d *memoryData, comment *Comment) bool {
+		user, ok := d.users[comment.UserID]
+		if ok {
+			users[user.ID] = *user
+		}
+		return (ok || comment.IsGuest()) && comment.PostID == postId && comment.Status == COMMENT_STATUS_APPROVED
+	})
+	for _, comment := range comments {
+		if comment.IsGuest() {
+			comment.fillGuest()
+			continue
+		}
+		user := users[comment.UserID]
+		comment.NickName = user.NickName
+		if comment.NickName == "" {
+			comment.NickName = user.GithubLoginId
+		}
+		comment.AvatarUrl = user.AvatarUrl
+		comment.GithubUrl = user.GithubUrl
+	}
+	return comments, nil
+}
+
+func (r *memoryCommentRepository) Get(id uint) (*Comment, error) {
+	comments := r.filter(func(d *memoryData, comment *Comment) bool {
+		return comment.ID == id
+	})
+	if len(comments) == 0 {
+		return &Comment{}, ErrNotFound
+	}
+	return comments[0], nil
+}
+
+func (r *memoryCommentRepository) List() ([]*Comment, error) {
+	return r.filter(func(d *memoryData, comment *Comment) bool {
+		return true
+	}), nil
+}
+
+func (r *memoryCommentRepository) Count() (count int) {
+	r.read(func(d *memoryData) {
+		count = len(d.comments)
+	})
+	return
+}
+
+func (r *memoryCommentRepository) SetStatus(id uint, status string) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.comments[id]; ok {
+			item.Status, item.ReadState = status, true
+		}
+		return nil
+	})
+}
+
+func (r *memoryCommentRepository) Search(filter *CommentFilter) ([]*Comment, error) {
+	query := strings.ToLower(filter.Query)
+	return r.filter(func(d *memoryData, comment *Comment) bool {
+		if filter.Status != "" && comment.Status != filter.Status ||
+			filter.PostID > 0 && comment.PostID != filter.PostID ||
+			filter.UserID > 0 && comment.UserID != filter.UserID {
+			return false
+		}
+		return query == "" || strings.Contains(strings.ToLower(comment.Content), query) ||
+			strings.Contains(strings.ToLower(comment.GuestName), query) || strings.Contains(strings.ToLower(comment.GuestEmail), query)
+	}), nil
+}
+
+func (r *memoryCommentRepository) UpdateContent(id uint, content string) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.comments[id]; ok {
+			item.Content = content
+		}
+		return nil
+	})
+}
+
+func (r *memoryCommentRepository) SetStatusByUserId(userId uint, status string) (count int, err error) {
+	err = r.write(func(d *memoryData) error {
+		for _, item := range d.comments {
+			if item.UserID == userId && item.Status != status {
+				item.Status, item.ReadState = status, true
+				count++
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (r *memoryCommentRepository) CountByStatus() (map[string]int, error) {
+	counts := make(map[string]int)
+	r.read(func(d *memoryData) {
+		for _, item := range d.comments {
+			counts[item.Status]++
+		}
+	})
+	return counts, nil
+}
+
+func (r *memoryCommentRepository) CountApprovedByUserId(userId uint) (int, error) {
+	return len(r.filter(func(d *memoryData, comment *Comment) bool {
+		return comment.UserID == userId && comment.Status == COMMENT_STATUS_APPROVED
+	})), nil
+}
+
+func (r *memoryCommentRepository) ListSince(since time.Time) ([]*Comment, error) {
+	return r.filter(func(d *memoryData, comment *Comment) bool {
+		return !comment.CreatedAt.Before(since)
+	}), nil
+}
+
+// subscriber
+type memorySubscriberRepository struct {
+	*memoryStore
+}
+
+func (r *memorySubscriberRepository) Create(s *Subscriber) error {
+	return r.write(func(d *memoryData) error {
+		for _, item := range d.subscribers {
+			if item.Email == s.Email {
+				*s = *item
+				return nil
+			}
+		}
+		s.ID = d.nextId()
+		s.CreatedAt = time.Now()
+		s.UpdatedAt = s.CreatedAt
+		s.SubscribeState = true
+		item := *s
+		d.subscribers[s.ID] = &item
+		return nil
+	})
+}
+
+func (r *memorySubscriberRepository) Update(s *Subscriber) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.subscribers[s.ID]; ok {
+			item.VerifyState = s.VerifyState
+			item.SubscribeState = s.SubscribeState
+			item.OutTime = s.OutTime
+			item.Signature = s.Signature
+			item.SecretKey = s.SecretKey
+			item.UpdatedAt = time.Now()
+		}
+		return nil
+	})
+}
+
+func (r *memorySubscriberRepository) filter(match func(s *Subscriber) bool) []*Subscriber {
+	subscribers := make([]*Subscriber, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.subscribers {
+			if match(item) {
+				s := *item
+				subscribers = append(subscribers, &s)
+			}
+		}
+	})
+	sort.Slice(subscribers, func(i, j int) bool { return subscribers[i].ID < subscribers[j].ID })
+	return subscribers
+}
+
+func (r *memorySubscriberRepository) List(invalid bool) ([]*Subscriber, error) {
+	return r.filter(func(s *Subscriber) bool {
+		return !invalid || (s.VerifyState && s.SubscribeState)
+	}), nil
+}
+
+func (r *memorySubscriberRepository) Count() (int, error) {
+	subscribers, err := r.List(true)
+	return len(subscribers), err
+}
+
+func (r *memorySubscriberRepository) first(match func(s *Subscriber) bool) (*Subscriber, error) {
+	subscribers := r.filter(match)
+	if len(subscribers) == 0 {
+		return &Subscriber{}, ErrNotFound
+	}
+	return subscribers[0], nil
+}
+
+func (r *memorySubscriberRepository) Get(id uint) (*Subscriber, error) {
+	return r.first(func(s *Subscriber) bool { return s.ID == id })
+}
+
+func (r *memorySubscriberRepository) GetByEmail(mail string) (*Subscriber, error) {
+	return r.first(func(s *Subscriber) bool { return s.Email == mail })
+}
+
+func (r *memorySubscriberRepository) GetBySignature(key string) (*Subscriber, error) {
+	return r.first(func(s *Subscriber) bool { return s.Signature == key })
+}
+
+func (r *memorySubscriberRepository) Delete(id uint) error {
+	return r.write(func(d *memoryData) error {
+		delete(d.subscribers, id)
+		return nil
+	})
+}
+
+// link
+type memoryLinkRepository struct {
+	*memoryStore
+}
+
+func (r *memoryLinkRepository) Create(link *Link) error {
+	return r.write(func(d *memoryData) error {
+		for _, item := range d.links {
+			if item.Url == link.Url {
+				*link = *item
+				return nil
+			}
+		}
+		link.ID = d.nextId()
+		link.CreatedAt = time.Now()
+		link.UpdatedAt = link.CreatedAt
+		item := *link
+		d.links[link.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryLinkRepository) Update(link *Link) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.links[link.ID]; ok {
+			link.CreatedAt = item.CreatedAt
+		} else {
+			link.CreatedAt = time.Now()
+		}
+		link.UpdatedAt = time.Now()
+		item := *link
+		d.links[link.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryLinkRepository) Delete(id uint) error {
+	return r.write(func(d *memoryData) error {
+		delete(d.links, id)
+		return nil
+	})
+}
+
+func (r *memoryLinkRepository) Get(id uint) (link *Link, err error) {
+	r.read(func(d *memoryData) {
+		if item, ok := d.links[id]; ok {
+			l := *item
+			link = &l
+		}
+	})
+	if link == nil {
+		return &Link{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memoryLinkRepository) List() ([]*Link, error) {
+	links := make([]*Link, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.links {
+			l := *item
+			links = append(links, &l)
+		}
+	})
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Sort == links[j].Sort {
+			return links[i].ID < links[j].ID
+		}
+		return links[i].Sort < links[j].Sort
+	})
+	return links, nil
+}
+
+// smms_files
+type memorySmmsFileRepository struct {
+	*memoryStore
+}
+
+func (r *memorySmmsFileRepository) Create(file *SmmsFile) error {
+	return r.write(func(d *memoryData) error {
+		file.ID = d.nextId()
+		file.CreatedAt = time.Now()
+		file.UpdatedAt = file.CreatedAt
+		item := *file
+		d.smmsFiles[file.ID] = &item
+		return nil
+	})
+}
+
+// session
+type memorySessionRepository struct {
+	*memoryStore
+}
+
+func (r *memorySessionRepository) Create(session *Session) error {
+	return r.write(func(d *memoryData) error {
+		if _, ok := d.sessions[session.ID]; ok {
+			return errors.New("session already exists")
+		}
+		item := *session
+		d.sessions[session.ID] = &item
+		return nil
+	})
+}
+
+func (r *memorySessionRepository) Update(session *Session) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.sessions[session.ID]; ok {
+			item.UserID = session.UserID
+			item.Data = session.Data
+			item.IP = session.IP
+			item.LastSeenAt = session.LastSeenAt
+		}
+		return nil
+	})
+}
+
+func (r *memorySessionRepository) Get(id string) (session *Session, err error) {
+	r.read(func(d *memoryData) {
+		if item, ok := d.sessions[id]; ok {
+			s := *item
+			session = &s
+		}
+	})
+	if session == nil {
+		return &Session{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memorySessionRepository) Delete(id string) error {
+	return r.write(func(d *memoryData) error {
+		delete(d.sessions, id)
+		return nil
+	})
+}
+
+func (r *memorySessionRepository) DeleteByUserId(userId uint, exceptId string) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.sessions {
+			if item.UserID == userId && id != exceptId {
+				delete(d.sessions, id)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memorySessionRepository) DeleteExpired(idleBefore, now time.Time) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.sessions {
+			if item.LastSeenAt.Before(idleBefore) || item.ExpiresAt.Before(now) {
+				delete(d.sessions, id)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memorySessionRepository) ListByUserId(userId uint) ([]*Session, error) {
+	sessions := make([]*Session, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.sessions {
+			if item.UserID == userId {
+				s := *item
+				sessions = append(sessions, &s)
+			}
+		}
+	})
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+// login_attempts
+type memoryLoginAttemptRepository struct {
+	*memoryStore
+}
+
+func (r *memoryLoginAttemptRepository) Create(attempt *LoginAttempt) error {
+	return r.write(func(d *memoryData) error {
+		attempt.ID = d.nextId()
+		if attempt.CreatedAt.IsZero() {
+			attempt.CreatedAt = time.Now()
+		}
+		item := *attempt
+		d.attempts[attempt.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryLoginAttemptRepository) ListFailuresByIP(ip string, since time.Time) ([]*LoginAttempt, error) {
+	attempts := make([]*LoginAttempt, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.attempts {
+			if item.IP == ip && item.Result == LOGIN_RESULT_FAILURE && item.CreatedAt.After(since) {
+				a := *item
+				attempts = append(attempts, &a)
+			}
+		}
+	})
+	sort.Slice(attempts, func(i, j int) bool { return attempts[i].CreatedAt.After(attempts[j].CreatedAt) })
+	return attempts, nil
+}
+
+func (r *memoryLoginAttemptRepository) ListRecent(limit int) ([]*LoginAttempt, error) {
+	attempts := make([]*LoginAttempt, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.attempts {
+			a := *item
+			attempts = append(attempts, &a)
+		}
+	})
+	sort.Slice(attempts, func(i, j int) bool { return attempts[i].ID > attempts[j].ID })
+	if len(attempts) > limit {
+		attempts = attempts[:limit]
+	}
+	return attempts, nil
+}
+
+func (r *memoryLoginAttemptRepository) DeleteBefore(t time.Time) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.attempts {
+			if item.CreatedAt.Before(t) {
+				delete(d.attempts, id)
+			}
+		}
+		return nil
+	})
+}
+
+// recovery_codes
+type memoryRecoveryCodeRepository struct {
+	*memoryStore
+}
+
+func (r *memoryRecoveryCodeRepository) Create(code *RecoveryCode) error {
+	return r.write(func(d *memoryData) error {
+		code.ID = d.nextId()
+		code.CreatedAt = time.Now()
+		item := *code
+		d.recoveries[code.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryRecoveryCodeRepository) DeleteByUserId(userId uint) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.recoveries {
+			if item.UserID == userId {
+				delete(d.recoveries, id)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryRecoveryCodeRepository) Use(userId uint, codeHash string) error {
+	return r.write(func(d *memoryData) error {
+		for _, item := range d.recoveries {
+			if item.UserID == userId && item.CodeHash == codeHash && item.UsedAt == nil {
+				now := time.Now()
+				item.UsedAt = &now
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+func (r *memoryRecoveryCodeRepository) CountUnused(userId uint) (count int, err error) {
+	r.read(func(d *memoryData) {
+		for _, item := range d.recoveries {
+			if item.UserID == userId && item.UsedAt == nil {
+				count++
+			}
+		}
+	})
+	return
+}
+
+// user_identities
+type memoryIdentityRepository struct {
+	*memoryStore
+}
+
+func (r *memoryIdentityRepository) Create(identity *UserIdentity) error {
+	return r.write(func(d *memoryData) error {
+		for _, item := range d.identities {
+			if item.Provider == identity.Provider && (item.Subject == identity.Subject || item.UserID == identity.UserID) {
+				return errors.New("duplicate user identity")
+			}
+		}
+		identity.ID = d.nextId()
+		identity.CreatedAt = time.Now()
+		identity.UpdatedAt = identity.CreatedAt
+		item := *identity
+		d.identities[identity.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryIdentityRepository) Update(identity *UserIdentity) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.identities[identity.ID]; ok {
+			item.Login = identity.Login
+			item.Name = identity.Name
+			item.Email = identity.Email
+			item.EmailVerified = identity.EmailVerified
+			item.AvatarUrl = identity.AvatarUrl
+			item.ProfileUrl = identity.ProfileUrl
+			item.UpdatedAt = time.Now()
+		}
+		return nil
+	})
+}
+
+func (r *memoryIdentityRepository) Get(provider, subject string) (identity *UserIdentity, err error) {
+	r.read(func(d *memoryData) {
+		for _, item := range d.identities {
+			if item.Provider == provider && item.Subject == subject {
+				i := *item
+				identity = &i
+				return
+			}
+		}
+	})
+	if identity == nil {
+		return &UserIdentity{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memoryIdentityRepository) ListByUserId(userId uint) ([]*UserIdentity, error) {
+	var identities []*UserIdentity
+	r.read(func(d *memoryData) {
+		for _, item := range d.identities {
+			if item.UserID == userId {
+				i := *item
+				identities = append(identities, &i)
+			}
+		}
+	})
+	sort.Slice(identities, func(i, j int) bool { return identities[i].ID < identities[j].ID })
+	return identities, nil
+}
+
+func (r *memoryIdentityRepository) Delete(userId uint, provider string) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.identities {
+			if item.UserID == userId && item.Provider == provider {
+				delete(d.identities, id)
+			}
+		}
+		return nil
+	})
+}
+
+// access_tokens
+type memoryAccessTokenRepository struct {
+	*memoryStore
+}
+
+func (r *memoryAccessTokenRepository) Create(token *AccessToken) error {
+	return r.write(func(d *memoryData) error {
+		for _, item := range d.tokens {
+			if item.TokenHash == token.TokenHash {
+				return errors.New("duplicate access token")
+			}
+		}
+		token.ID = d.nextId()
+		token.CreatedAt = time.Now()
+		item := *token
+		d.tokens[token.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryAccessTokenRepository) GetByHash(hash string) (token *AccessToken, err error) {
+	r.read(func(d *memoryData) {
+		for _, item := range d.tokens {
+			if item.TokenHash == hash {
+				t := *item
+				token = &t
+				return
+			}
+		}
+	})
+	if token == nil {
+		return &AccessToken{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memoryAccessTokenRepository) ListByUserId(userId uint) ([]*AccessToken, error) {
+	tokens := make([]*AccessToken, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.tokens {
+			if item.UserID == userId {
+				t := *item
+				tokens = append(tokens, &t)
+			}
+		}
+	})
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID > tokens[j].ID })
+	return tokens, nil
+}
+
+func (r *memoryAccessTokenRepository) UpdateLastUsed(token *AccessToken) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.tokens[token.ID]; ok {
+			item.LastUsedAt = token.LastUsedAt
+		}
+		return nil
+	})
+}
+
+func (r *memoryAccessTokenRepository) Delete(userId, id uint) error {
+	return r.write(func(d *memoryData) error {
+		if item, ok := d.tokens[id]; ok && item.UserID == userId {
+			delete(d.tokens, id)
+			return nil
+		}
+		return ErrNotFound
+	})
+}
+
+// slug_histories
+type memorySlugHistoryRepository struct {
+	*memoryStore
+}
+
+func (r *memorySlugHistoryRepository) Create(history *SlugHistory) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.slugs {
+			if item.Kind == history.Kind && item.Slug == history.Slug {
+				delete(d.slugs, id)
+			}
+		}
+		history.ID = d.nextId()
+		history.CreatedAt = time.Now()
+		item := *history
+		d.slugs[history.ID] = &item
+		return nil
+	})
+}
+
+func (r *memorySlugHistoryRepository) Get(kind, slug string) (history *SlugHistory, err error) {
+	r.read(func(d *memoryData) {
+		for _, item := range d.slugs {
+			if item.Kind == kind && item.Slug == slug {
+				h := *item
+				history = &h
+				return
+			}
+		}
+	})
+	if history == nil {
+		return &SlugHistory{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memorySlugHistoryRepository) Delete(kind, slug string) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.slugs {
+			if item.Kind == kind && item.Slug == slug {
+				delete(d.slugs, id)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memorySlugHistoryRepository) DeleteByTarget(kind string, targetId uint) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.slugs {
+			if item.Kind == kind && item.TargetID == targetId {
+				delete(d.slugs, id)
+			}
+		}
+		return nil
+	})
+}
+
+// revisions
+type memoryRevisionRepository struct {
+	*memoryStore
+}
+
+func (r *memoryRevisionRepository) Create(revision *Revision) error {
+	return r.write(func(d *memoryData) error {
+		revision.ID = d.nextId()
+		if revision.CreatedAt.IsZero() {
+			revision.CreatedAt = time.Now()
+		}
+		item := *revision
+		d.revisions[revision.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryRevisionRepository) Get(id uint) (revision *Revision, err error) {
+	r.read(func(d *memoryData) {
+		if item, ok := d.revisions[id]; ok {
+			v := *item
+			revision = &v
+		}
+	})
+	if revision == nil {
+		return &Revision{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memoryRevisionRepository) Latest(kind string, targetId uint) (*Revision, error) {
+	revisions, _ := r.List(kind, targetId)
+	if len(revisions) == 0 {
+		return &Revision{}, ErrNotFound
+	}
+	return revisions[0], nil
+}
+
+func (r *memoryRevisionRepository) List(kind string, targetId uint) ([]*Revision, error) {
+	revisions := make([]*Revision, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.revisions {
+			if item.Kind == kind && item.TargetID == targetId {
+				v := *item
+				revisions = append(revisions, &v)
+			}
+		}
+	})
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].ID > revisions[j].ID })
+	return revisions, nil
+}
+
+func (r *memoryRevisionRepository) Prune(kind string, targetId uint, keep int) error {
+	revisions, _ := r.List(kind, targetId)
+	if len(revisions) <= keep {
+		return nil
+	}
+	return r.write(func(d *memoryData) error {
+		for _, item := range revisions[keep:] {
+			delete(d.revisions, item.ID)
+		}
+		return nil
+	})
+}
+
+func (r *memoryRevisionRepository) DeleteByTarget(kind string, targetId uint) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.revisions {
+			if item.Kind == kind && item.TargetID == targetId {
+				delete(d.revisions, id)
+			}
+		}
+		return nil
+	})
+}
+
+// drafts
+type memoryDraftRepository struct {
+	*memoryStore
+}
+
+func (r *memoryDraftRepository) Save(draft *Draft) error {
+	return r.write(func(d *memoryData) error {
+		now := time.Now()
+		for _, item := range d.drafts {
+			if item.Kind == draft.Kind && item.TargetID == draft.TargetID && item.UserID == draft.UserID {
+				item.Title, item.Body, item.Tags, item.UpdatedAt = draft.Title, draft.Body, draft.Tags, now
+				*draft = *item
+				return nil
+			}
+		}
+		draft.ID = d.nextId()
+		draft.CreatedAt, draft.UpdatedAt = now, now
+		item := *draft
+		d.drafts[draft.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryDraftRepository) Get(kind string, targetId, userId uint) (draft *Draft, err error) {
+	r.read(func(d *memoryData) {
+		for _, item := range d.drafts {
+			if item.Kind == kind && item.TargetID == targetId && item.UserID == userId {
+				v := *item
+				draft = &v
+				return
+			}
+		}
+	})
+	if draft == nil {
+		return &Draft{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memoryDraftRepository) ListByTarget(kind string, targetId uint) ([]*Draft, error) {
+	drafts := make([]*Draft, 0)
+	r.read(func(d *memoryData) {
+		for _, item := range d.drafts {
+			if item.Kind == kind && item.TargetID == targetId {
+				v := *item
+				drafts = append(drafts, &v)
+			}
+		}
+	})
+	sort.Slice(drafts, func(i, j int) bool { return drafts[i].UpdatedAt.After(drafts[j].UpdatedAt) })
+	return drafts, nil
+}
+
+func (r *memoryDraftRepository) Delete(kind string, targetId, userId uint) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.drafts {
+			if item.Kind == kind && item.TargetID == targetId && item.UserID == userId {
+				delete(d.drafts, id)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *memoryDraftRepository) DeleteByTarget(kind string, targetId uint) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.drafts {
+			if item.Kind == kind && item.TargetID == targetId {
+				delete(d.drafts, id)
+			}
+		}
+		return nil
+	})
+}
+
+type memoryUserTokenRepository struct {
+	*memoryStore
+}
+
+func (r *memoryUserTokenRepository) Save(token *UserToken) error {
+	return r.write(func(d *memoryData) error {
+		for _, item := range d.userTokens {
+			if item.UserID == token.UserID && item.Purpose == token.Purpose {
+				item.SecretKey, item.ExpiresAt = token.SecretKey, token.ExpiresAt
+				*token = *item
+				return nil
+			}
+		}
+		token.ID = d.nextId()
+		token.CreatedAt = time.Now()
+		item := *token
+		d.userTokens[token.ID] = &item
+		return nil
+	})
+}
+
+func (r *memoryUserTokenRepository) Get(userId uint, purpose string) (token *UserToken, err error) {
+	r.read(func(d *memoryData) {
+		for _, item := range d.userTokens {
+			if item.UserID == userId && item.Purpose == purpose {
+				v := *item
+				token = &v
+				return
+			}
+		}
+	})
+	if token == nil {
+		return &UserToken{}, ErrNotFound
+	}
+	return
+}
+
+func (r *memoryUserTokenRepository) Delete(userId uint, purpose string) error {
+	return r.write(func(d *memoryData) error {
+		for id, item := range d.userTokens {
+			if item.UserID == userId && item.Purpose == purpose {
+				delete(d.userTokens, id)
+			}
+		}
+		return nil
+	})
+}
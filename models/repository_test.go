@@ -0,0 +1,153 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// 执行过所有迁移的sqlite仓库
+func openTestStore(t *testing.T) (Store, *gorm.DB) {
+	t.Helper()
+	db := openTestDB(t)
+	if err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewGormStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, db
+}
+
+// gorm实现和内存实现都要测试的用例
+func testStores(t *testing.T, fn func(t *testing.T, store Store)) {
+	t.Run("gorm", func(t *testing.T) {
+		store, db := openTestStore(t)
+		defer db.Close()
+		fn(t, store)
+	})
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemoryStore())
+	})
+}
+
+func TestTransactionRollback(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		errRollback := errors.New("rollback")
+		var postId uint
+		err := store.Transaction(func(tx Store) error {
+			post := &Post{Title: "post"}
+			if err := tx.Posts().Create(post); err != nil {
+				return err
+			}
+			postId = post.ID
+			//嵌套的事务复用外层事务
+			err := tx.Transaction(func(tx Store) error {
+				return tx.Tags().Create(&Tag{Name: "go"})
+			})
+			if err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if err != errRollback {
+			t.Fatalf("Transaction returned %v", err)
+		}
+		if _, err := store.Posts().Get(postId); err != ErrNotFound {
+			t.Errorf("post not rolled back: %v", err)
+		}
+		if n := store.Tags().Count(); n != 0 {
+			t.Errorf("got %d tags after rollback, want 0", n)
+		}
+
+		err = store.Transaction(func(tx Store) error {
+			return tx.Posts().Create(&Post{Title: "post"})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := store.Posts().Count(); n != 1 {
+			t.Errorf("got %d posts after commit, want 1", n)
+		}
+	})
+}
+
+func TestUserUpdateEmail(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		user := &User{Email: "user@example.com", VerifyState: VERIFY_STATE_VERIFIED}
+		if err := store.Users().Create(user); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Users().UpdateEmail(user, "new@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		saved, err := store.Users().Get(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Email != "new@example.com" || saved.IsVerified() || user.IsVerified() {
+			t.Errorf("changed email should need verification again: saved = %+v", saved)
+		}
+
+		user.VerifyState = VERIFY_STATE_VERIFIED
+		if err = store.Users().UpdateVerifyState(user); err != nil {
+			t.Fatal(err)
+		}
+		if saved, _ = store.Users().Get(user.ID); !saved.IsVerified() {
+			t.Error("verify state not saved")
+		}
+
+		//解绑邮箱不改变验证状态
+		if err = store.Users().UpdateEmail(user, ""); err != nil {
+			t.Fatal(err)
+		}
+		saved, _ = store.Users().Get(user.ID)
+		if saved.Email != "" || saved.VerifyState != VERIFY_STATE_VERIFIED || user.VerifyState != VERIFY_STATE_VERIFIED {
+			t.Errorf("unbound email: saved = %+v", saved)
+		}
+	})
+}
+
+func TestSessionRepository(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		repo := store.Sessions()
+		now := time.Now()
+		sessions := []*Session{
+			{ID: "idle", UserID: 1, LastSeenAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(time.Hour)},
+			{ID: "expired", UserID: 1, LastSeenAt: now, ExpiresAt: now.Add(-time.Second)},
+			{ID: "active", UserID: 1, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)},
+			{ID: "other", UserID: 2, LastSeenAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)},
+		}
+		for _, session := range sessions {
+			if err := repo.Create(session); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := repo.DeleteExpired(now.Add(-time.Hour), now); err != nil {
+			t.Fatal(err)
+		}
+		list, err := repo.ListByUserId(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].ID != "active" {
+			t.Fatalf("sessions of user 1 = %+v", list)
+		}
+
+		if err = repo.DeleteByUserId(2, "other"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = repo.Get("other"); err != nil {
+			t.Errorf("excepted session deleted: %v", err)
+		}
+		if err = repo.DeleteByUserId(1, ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = repo.Get("active"); err != ErrNotFound {
+			t.Errorf("session not deleted: %v", err)
+		}
+	})
+}
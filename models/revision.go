@@ -0,0 +1,28 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// 版本中的标签名称排序后以逗号分隔保存，标签改名或删除后版本中的名称不变
+func JoinTagNames(tags []*Tag) string {
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (revision *Revision) TagNames() []string {
+	if revision.Tags == "" {
+		return nil
+	}
+	return strings.Split(revision.Tags, ",")
+}
+
+// 标题、内容和标签都相同，保存时没有修改则不产生新版本
+func (revision *Revision) SameContent(other *Revision) bool {
+	return revision.Title == other.Title && revision.Body == other.Body && revision.Tags == other.Tags
+}
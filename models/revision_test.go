@@ -0,0 +1,67 @@
+package models
+
+import "testing"
+
+func TestRevisionTags(t *testing.T) {
+	if names := JoinTagNames([]*Tag{{Name: "go"}, {Name: "gin"}}); names != "gin,go" {
+		t.Errorf("JoinTagNames = %q", names)
+	}
+	if names := (&Revision{}).TagNames(); len(names) != 0 {
+		t.Errorf("TagNames = %v", names)
+	}
+	if names := (&Revision{Tags: "gin,go"}).TagNames(); len(names) != 2 || names[1] != "go" {
+		t.Errorf("TagNames = %v", names)
+	}
+	a := &Revision{Title: "t", Body: "b", Tags: "go", UserID: 1}
+	if !a.SameContent(&Revision{Title: "t", Body: "b", Tags: "go", UserID: 2}) {
+		t.Error("revisions by different users have the same content")
+	}
+	if a.SameContent(&Revision{Title: "t", Body: "b"}) {
+		t.Error("tags differ")
+	}
+}
+
+func TestRevisionRepository(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		revisions := store.Revisions()
+		if _, err := revisions.Latest(SLUG_KIND_POST, 1); err != ErrNotFound {
+			t.Fatalf("Latest without revisions = %v", err)
+		}
+		for _, body := range []string{"a", "b", "c"} {
+			if err := revisions.Create(&Revision{Kind: SLUG_KIND_POST, TargetID: 1, Body: body}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := revisions.Create(&Revision{Kind: SLUG_KIND_PAGE, TargetID: 1, Body: "page"}); err != nil {
+			t.Fatal(err)
+		}
+		latest, err := revisions.Latest(SLUG_KIND_POST, 1)
+		if err != nil || latest.Body != "c" {
+			t.Fatalf("Latest = %+v, %v", latest, err)
+		}
+		if r, err := revisions.Get(latest.ID); err != nil || r.Body != "c" {
+			t.Errorf("Get = %+v, %v", r, err)
+		}
+		list, _ := revisions.List(SLUG_KIND_POST, 1)
+		if len(list) != 3 || list[0].Body != "c" || list[2].Body != "a" {
+			t.Fatalf("List = %+v", list)
+		}
+
+		if err = revisions.Prune(SLUG_KIND_POST, 1, 2); err != nil {
+			t.Fatal(err)
+		}
+		if list, _ = revisions.List(SLUG_KIND_POST, 1); len(list) != 2 || list[1].Body != "b" {
+			t.Errorf("after Prune = %+v", list)
+		}
+		if err = revisions.DeleteByTarget(SLUG_KIND_POST, 1); err != nil {
+			t.Fatal(err)
+		}
+		if list, _ = revisions.List(SLUG_KIND_POST, 1); len(list) != 0 {
+			t.Errorf("after DeleteByTarget = %+v", list)
+		}
+		//其他类型的版本不受影响
+		if list, _ = revisions.List(SLUG_KIND_PAGE, 1); len(list) != 1 {
+			t.Errorf("page revisions = %+v", list)
+		}
+	})
+}
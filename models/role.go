@@ -0,0 +1,63 @@
+package models
+
+const (
+	ROLE_OWNER     = "owner"     // 站长，拥有所有权限
+	ROLE_EDITOR    = "editor"    // 编辑，管理所有文章、页面、标签、评论和友情链接
+	ROLE_AUTHOR    = "author"    // 作者，只能管理自己的文章
+	ROLE_COMMENTER = "commenter" // 评论者，不能进入后台
+)
+
+// 后台权限
+type Permission string
+
+const (
+	PERM_DASHBOARD   Permission = "dashboard"   // 后台首页
+	PERM_POST        Permission = "post"        // 撰写、编辑自己的文章，上传文件
+	PERM_POST_OTHERS Permission = "post_others" // 编辑他人的文章
+	PERM_PAGE        Permission = "page"
+	PERM_TAG         Permission = "tag"
+	PERM_COMMENT     Permission = "comment"
+	PERM_LINK        Permission = "link"
+	PERM_USER        Permission = "user"   // 用户管理和角色分配
+	PERM_BACKUP      Permission = "backup" // 备份和恢复
+	PERM_MAIL        Permission = "mail"   // 订阅者管理和群发邮件
+)
+
+// 所有角色，按权限从高到低排列
+var Roles = []string{ROLE_OWNER, ROLE_EDITOR, ROLE_AUTHOR, ROLE_COMMENTER}
+
+var rolePermissions = map[string][]Permission{
+	ROLE_OWNER:     {PERM_DASHBOARD, PERM_POST, PERM_POST_OTHERS, PERM_PAGE, PERM_TAG, PERM_COMMENT, PERM_LINK, PERM_USER, PERM_BACKUP, PERM_MAIL},
+	ROLE_EDITOR:    {PERM_DASHBOARD, PERM_POST, PERM_POST_OTHERS, PERM_PAGE, PERM_TAG, PERM_COMMENT, PERM_LINK},
+	ROLE_AUTHOR:    {PERM_DASHBOARD, PERM_POST, PERM_TAG},
+	ROLE_COMMENTER: {},
+}
+
+// 是否为有效的角色
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// 用户是否拥有权限
+func (user *User) HasPermission(perm Permission) bool {
+	for _, p := range rolePermissions[user.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否可以进入后台
+func (user *User) IsAdmin() bool {
+	return user.HasPermission(PERM_DASHBOARD)
+}
+
+// 是否可以编辑文章，作者只能编辑自己的文章
+func (user *User) CanEditPost(post *Post) bool {
+	if user.HasPermission(PERM_POST_OTHERS) {
+		return true
+	}
+	return user.HasPermission(PERM_POST) && post.UserID == user.ID
+}
@@ -0,0 +1,43 @@
+package models
+
+import "testing"
+
+func TestRolePermissions(t *testing.T) {
+	for _, role := range Roles {
+		if !IsValidRole(role) {
+			t.Errorf("%s is not a valid role", role)
+		}
+	}
+	if IsValidRole("admin") {
+		t.Error("unknown role accepted")
+	}
+	if (&User{Role: ROLE_COMMENTER}).IsAdmin() || (&User{}).IsAdmin() {
+		t.Error("commenters can't enter the dashboard")
+	}
+	if !(&User{Role: ROLE_AUTHOR}).IsAdmin() {
+		t.Error("authors can enter the dashboard")
+	}
+	if (&User{Role: ROLE_EDITOR}).HasPermission(PERM_USER) || !(&User{Role: ROLE_OWNER}).HasPermission(PERM_USER) {
+		t.Error("only owners manage users")
+	}
+}
+
+func TestCanEditPost(t *testing.T) {
+	author := &User{Role: ROLE_AUTHOR}
+	author.ID = 1
+	post := &Post{UserID: 1}
+	other := &Post{UserID: 2}
+	if !author.CanEditPost(post) || author.CanEditPost(other) {
+		t.Error("authors can only edit their own posts")
+	}
+	editor := &User{Role: ROLE_EDITOR}
+	editor.ID = 3
+	if !editor.CanEditPost(other) {
+		t.Error("editors can edit other authors' posts")
+	}
+	commenter := &User{Role: ROLE_COMMENTER}
+	commenter.ID = 2
+	if commenter.CanEditPost(other) {
+		t.Error("commenters can't edit posts, even their own")
+	}
+}
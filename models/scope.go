@@ -0,0 +1,89 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// 个人访问令牌的权限范围，使用时还要求用户的角色拥有对应的后台权限
+type Scope string
+
+const (
+	SCOPE_POSTS_READ        Scope = "posts:read"
+	SCOPE_POSTS_WRITE       Scope = "posts:write"
+	SCOPE_PAGES_READ        Scope = "pages:read"
+	SCOPE_PAGES_WRITE       Scope = "pages:write"
+	SCOPE_TAGS_READ         Scope = "tags:read"
+	SCOPE_TAGS_WRITE        Scope = "tags:write"
+	SCOPE_LINKS_READ        Scope = "links:read"
+	SCOPE_LINKS_WRITE       Scope = "links:write"
+	SCOPE_COMMENTS_READ     Scope = "comments:read"
+	SCOPE_COMMENTS_WRITE    Scope = "comments:write"
+	SCOPE_SUBSCRIBERS_READ  Scope = "subscribers:read"
+	SCOPE_SUBSCRIBERS_WRITE Scope = "subscribers:write"
+)
+
+// 所有权限范围
+var Scopes = []Scope{
+	SCOPE_POSTS_READ, SCOPE_POSTS_WRITE,
+	SCOPE_PAGES_READ, SCOPE_PAGES_WRITE,
+	SCOPE_TAGS_READ, SCOPE_TAGS_WRITE,
+	SCOPE_LINKS_READ, SCOPE_LINKS_WRITE,
+	SCOPE_COMMENTS_READ, SCOPE_COMMENTS_WRITE,
+	SCOPE_SUBSCRIBERS_READ, SCOPE_SUBSCRIBERS_WRITE,
+}
+
+var scopePermissions = map[Scope]Permission{
+	SCOPE_POSTS_READ:        PERM_POST,
+	SCOPE_POSTS_WRITE:       PERM_POST,
+	SCOPE_PAGES_READ:        PERM_PAGE,
+	SCOPE_PAGES_WRITE:       PERM_PAGE,
+	SCOPE_TAGS_READ:         PERM_TAG,
+	SCOPE_TAGS_WRITE:        PERM_TAG,
+	SCOPE_LINKS_READ:        PERM_LINK,
+	SCOPE_LINKS_WRITE:       PERM_LINK,
+	SCOPE_COMMENTS_READ:     PERM_COMMENT,
+	SCOPE_COMMENTS_WRITE:    PERM_COMMENT,
+	SCOPE_SUBSCRIBERS_READ:  PERM_MAIL,
+	SCOPE_SUBSCRIBERS_WRITE: PERM_MAIL,
+}
+
+// 用户的角色是否拥有该权限范围对应的后台权限
+func (user *User) CanUseScope(scope Scope) bool {
+	perm, ok := scopePermissions[scope]
+	return ok && user.HasPermission(perm)
+}
+
+// 用户可以授予令牌的权限范围
+func (user *User) GrantableScopes() []Scope {
+	scopes := make([]Scope, 0, len(Scopes))
+	for _, scope := range Scopes {
+		if user.CanUseScope(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+func (token *AccessToken) ScopeList() []Scope {
+	scopes := make([]Scope, 0)
+	for _, scope := range strings.Split(token.Scopes, ",") {
+		if scope != "" {
+			scopes = append(scopes, Scope(scope))
+		}
+	}
+	return scopes
+}
+
+func (token *AccessToken) HasScope(scope Scope) bool {
+	for _, s := range token.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (token *AccessToken) IsExpired() bool {
+	return token.ExpiresAt != nil && !time.Now().Before(*token.ExpiresAt)
+}
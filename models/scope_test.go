@@ -0,0 +1,55 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserScopes(t *testing.T) {
+	author := &User{Role: ROLE_AUTHOR}
+	if !author.CanUseScope(SCOPE_POSTS_WRITE) || !author.CanUseScope(SCOPE_TAGS_READ) {
+		t.Error("authors can use the post and tag scopes")
+	}
+	if author.CanUseScope(SCOPE_PAGES_READ) || author.CanUseScope(SCOPE_SUBSCRIBERS_READ) {
+		t.Error("authors can't use the page or subscriber scopes")
+	}
+	if author.CanUseScope(Scope("admin")) {
+		t.Error("unknown scope accepted")
+	}
+	if scopes := (&User{Role: ROLE_COMMENTER}).GrantableScopes(); len(scopes) != 0 {
+		t.Errorf("commenter grantable scopes = %v", scopes)
+	}
+	if scopes := (&User{Role: ROLE_OWNER}).GrantableScopes(); len(scopes) != len(Scopes) {
+		t.Errorf("owner grantable scopes = %v", scopes)
+	}
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	token := &AccessToken{Scopes: "posts:read,tags:write"}
+	if scopes := token.ScopeList(); len(scopes) != 2 {
+		t.Fatalf("ScopeList = %v", scopes)
+	}
+	if !token.HasScope(SCOPE_POSTS_READ) || !token.HasScope(SCOPE_TAGS_WRITE) {
+		t.Error("token should have posts:read and tags:write")
+	}
+	if token.HasScope(SCOPE_POSTS_WRITE) {
+		t.Error("posts:read doesn't grant posts:write")
+	}
+	if scopes := (&AccessToken{}).ScopeList(); len(scopes) != 0 {
+		t.Errorf("empty token scopes = %v", scopes)
+	}
+
+	if token.IsExpired() {
+		t.Error("token without expiration never expires")
+	}
+	past := time.Now().Add(-time.Minute)
+	token.ExpiresAt = &past
+	if !token.IsExpired() {
+		t.Error("token should be expired")
+	}
+	future := time.Now().Add(time.Hour)
+	token.ExpiresAt = &future
+	if token.IsExpired() {
+		t.Error("token shouldn't be expired yet")
+	}
+}
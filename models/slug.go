@@ -0,0 +1,67 @@
+package models
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mozillazg/go-pinyin"
+)
+
+const (
+	SLUG_KIND_POST = "post"
+	SLUG_KIND_PAGE = "page"
+
+	SLUG_MAX_LENGTH = 80
+)
+
+// 根据标题生成slug，英文和数字转为小写，汉字转为不带声调的拼音，其余字符作为分隔符
+// 例如"Go语言入门"生成"go-yu-yan-ru-men"，结果可能为空
+func Slugify(title string) string {
+	args := pinyin.NewArgs()
+	words := make([]string, 0)
+	word := make([]rune, 0)
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range title {
+		switch {
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			word = append(word, unicode.ToLower(r))
+		case unicode.Is(unicode.Han, r):
+			flush()
+			words = append(words, pinyin.LazyPinyin(string(r), args)...)
+		default:
+			flush()
+		}
+	}
+	flush()
+	//按单词截断，避免链接过长
+	slug := ""
+	for _, w := range words {
+		next := w
+		if slug != "" {
+			next = slug + "-" + w
+		}
+		if len(next) > SLUG_MAX_LENGTH {
+			if slug == "" {
+				slug = w[:SLUG_MAX_LENGTH]
+			}
+			break
+		}
+		slug = next
+	}
+	return slug
+}
+
+// 纯数字的slug会和/post/:id冲突
+func IsNumericSlug(slug string) bool {
+	for _, r := range slug {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return slug != ""
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Hello World":        "hello-world",
+		"  Go 1.13 -- Gin! ": "go-1-13-gin",
+		"Go语言入门":             "go-yu-yan-ru-men",
+		"你好,World":           "ni-hao-world",
+		"!!!":                "",
+		"Ünïcode":            "n-code",
+	}
+	for title, want := range cases {
+		if got := Slugify(title); got != want {
+			t.Errorf("Slugify(%q) = %q, want %q", title, got, want)
+		}
+	}
+	//按单词截断
+	long := strings.Repeat("word ", 30)
+	if slug := Slugify(long); len(slug) > SLUG_MAX_LENGTH || strings.HasSuffix(slug, "-") {
+		t.Errorf("Slugify(long) = %q", slug)
+	}
+	if slug := Slugify(strings.Repeat("a", 100)); len(slug) != SLUG_MAX_LENGTH {
+		t.Errorf("single long word = %q", slug)
+	}
+}
+
+func TestIsNumericSlug(t *testing.T) {
+	for slug, want := range map[string]bool{"123": true, "": false, "post-1": false, "1a": false} {
+		if IsNumericSlug(slug) != want {
+			t.Errorf("IsNumericSlug(%q) = %v", slug, !want)
+		}
+	}
+}
+
+func TestSlugRepositories(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		post := &Post{Title: "Hello", Slug: "hello"}
+		if err := store.Posts().Create(post); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := store.Posts().GetBySlug("hello"); err != nil || p.ID != post.ID {
+			t.Fatalf("GetBySlug = %+v, %v", p, err)
+		}
+		if _, err := store.Posts().GetBySlug("missing"); err != ErrNotFound {
+			t.Errorf("GetBySlug(missing) = %v", err)
+		}
+		page := &Page{Title: "About", Slug: "about"}
+		if err := store.Pages().Create(page); err != nil {
+			t.Fatal(err)
+		}
+		if p, err := store.Pages().GetBySlug("about"); err != nil || p.ID != page.ID {
+			t.Fatalf("page GetBySlug = %+v, %v", p, err)
+		}
+
+		histories := store.SlugHistories()
+		if err := histories.Create(&SlugHistory{Kind: SLUG_KIND_POST, TargetID: post.ID, Slug: "old"}); err != nil {
+			t.Fatal(err)
+		}
+		//同类型的旧slug改为指向新的目标
+		if err := histories.Create(&SlugHistory{Kind: SLUG_KIND_POST, TargetID: post.ID + 100, Slug: "old"}); err != nil {
+			t.Fatal(err)
+		}
+		if h, err := histories.Get(SLUG_KIND_POST, "old"); err != nil || h.TargetID != post.ID+100 {
+			t.Errorf("history = %+v, %v", h, err)
+		}
+		if _, err := histories.Get(SLUG_KIND_PAGE, "old"); err != ErrNotFound {
+			t.Errorf("page history = %v", err)
+		}
+		if err := histories.Delete(SLUG_KIND_POST, "old"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := histories.Get(SLUG_KIND_POST, "old"); err != ErrNotFound {
+			t.Errorf("deleted history = %v", err)
+		}
+		histories.Create(&SlugHistory{Kind: SLUG_KIND_PAGE, TargetID: page.ID, Slug: "a"})
+		histories.Create(&SlugHistory{Kind: SLUG_KIND_PAGE, TargetID: page.ID, Slug: "b"})
+		if err := histories.DeleteByTarget(SLUG_KIND_PAGE, page.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := histories.Get(SLUG_KIND_PAGE, "b"); err != ErrNotFound {
+			t.Errorf("history of a deleted page = %v", err)
+		}
+	})
+}
+
+// 迁移为已有的文章生成slug
+func TestMigrateBackfillSlugs(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+	if err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	var m *Migration
+	for _, migration := range migrations {
+		if migration.Name == "add_slugs" {
+			m = migration
+		}
+	}
+	if err := m.Down(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"Hello World", "Hello World", "2020", "", "Taken"} {
+		if err := db.Create(&Post{Title: title}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Model(&Post{}).Where("title = ?", "Taken").UpdateColumn("slug", "hello-world-3")
+	if err := m.Up(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var posts []*Post
+	db.Order("id").Find(&posts)
+	slugs := make([]string, 0, len(posts))
+	for _, post := range posts {
+		slugs = append(slugs, post.Slug)
+	}
+	if got := strings.Join(slugs, ","); got != "hello-world,hello-world-2,post-2020,post,hello-world-3" {
+		t.Errorf("slugs = %s", got)
+	}
+	if !db.Dialect().HasIndex("posts", "uk_posts_slug") {
+		t.Error("unique index not restored")
+	}
+}
+
+// 迁移9使用固定的slug规则，和当前的Slugify相互独立
+func TestSlugify0009(t *testing.T) {
+	for _, title := range []string{"Hello World", "Go语言入门", "你好,World", "!!!", "Ünïcode", strings.Repeat("word ", 30)} {
+		if got, want := slugify0009(title), Slugify(title); got != want {
+			t.Errorf("slugify0009(%q) = %q, want %q", title, got, want)
+		}
+	}
+	if slug := slugify0009(strings.Repeat("a", 100)); len(slug) != slugMaxLength0009 {
+		t.Errorf("single long word = %q", slug)
+	}
+}
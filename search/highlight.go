@@ -0,0 +1,89 @@
+package search
+
+import (
+	"html/template"
+	"strings"
+	"unicode"
+)
+
+// 截取text中第一个命中查询词的位置附近size个字作为摘要，命中的词用<mark>标出
+// 没有命中时截取开头，text为纯文本，返回转义后的html
+func Highlight(text, query string, size int) template.HTML {
+	runes := []rune(text)
+	marked := markTerms(runes, QueryTerms(query))
+	first := -1
+	for i, m := range marked {
+		if m {
+			first = i
+			break
+		}
+	}
+	start := 0
+	if first > size/4 {
+		start = first - size/4
+	}
+	end := start + size
+	if end > len(runes) {
+		end = len(runes)
+		//命中位置靠近结尾时向前补足长度
+		if start = end - size; start < 0 {
+			start = 0
+		}
+	}
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("...")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		if marked[i] {
+			b.WriteString("<mark>")
+		}
+		b.WriteString(template.HTMLEscapeString(string(runes[i:j])))
+		if marked[i] {
+			b.WriteString("</mark>")
+		}
+		i = j
+	}
+	if end < len(runes) {
+		b.WriteString("...")
+	}
+	return template.HTML(b.String())
+}
+
+// 标出命中查询词的字，英文单词需要完整匹配
+func markTerms(runes []rune, terms []string) []bool {
+	marked := make([]bool, len(runes))
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	for _, term := range terms {
+		t := []rune(term)
+		word := isWordRune(t[0])
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if !hasPrefix(lower[i:], t) {
+				continue
+			}
+			if word && (i > 0 && isWordRune(lower[i-1]) || i+len(t) < len(lower) && isWordRune(lower[i+len(t)])) {
+				continue
+			}
+			for k := i; k < i+len(t); k++ {
+				marked[k] = true
+			}
+		}
+	}
+	return marked
+}
+
+func hasPrefix(s, prefix []rune) bool {
+	for i, r := range prefix {
+		if s[i] != r {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// 各字段的权重，标题命中比标签和正文更相关
+const (
+	WEIGHT_TITLE = 3
+	WEIGHT_TAGS  = 2
+	WEIGHT_BODY  = 1
+
+	//BM25参数
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// 被索引的文档，Kind和ID确定一个文档，Body为去掉标记后的纯文本
+type Document struct {
+	Kind  string
+	ID    uint
+	Title string
+	Body  string
+	Tags  []string
+}
+
+// 搜索结果，按Score倒序
+type Hit struct {
+	Kind  string
+	ID    uint
+	Score float64
+}
+
+type docKey struct {
+	kind string
+	id   uint
+}
+
+type docEntry struct {
+	terms  map[string]float64 //按字段权重累加的词频
+	length float64            //按字段权重累加的词数
+}
+
+// 内存中的倒排索引，可以并发使用
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[docKey]*docEntry
+	postings map[string]map[docKey]float64
+	length   float64 //所有文档的词数之和
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     make(map[docKey]*docEntry),
+		postings: make(map[string]map[docKey]float64),
+	}
+}
+
+func newDocEntry(doc *Document) *docEntry {
+	entry := &docEntry{terms: make(map[string]float64)}
+	add := func(text string, weight float64) {
+		for _, token := range Tokenize(text) {
+			entry.terms[token] += weight
+			entry.length += weight
+		}
+	}
+	add(doc.Title, WEIGHT_TITLE)
+	for _, tag := range doc.Tags {
+		add(tag, WEIGHT_TAGS)
+	}
+	add(doc.Body, WEIGHT_BODY)
+	return entry
+}
+
+// 添加或替换文档
+func (idx *Index) Add(doc *Document) {
+	key := docKey{doc.Kind, doc.ID}
+	entry := newDocEntry(doc)
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(key)
+	idx.docs[key] = entry
+	idx.length += entry.length
+	for term, tf := range entry.terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[docKey]float64)
+		}
+		idx.postings[term][key] = tf
+	}
+}
+
+// 删除文档，文档不存在时忽略
+func (idx *Index) Remove(kind string, id uint) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(docKey{kind, id})
+}
+
+func (idx *Index) remove(key docKey) {
+	entry, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+	for term := range entry.terms {
+		delete(idx.postings[term], key)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.length -= entry.length
+	delete(idx.docs, key)
+}
+
+// 用docs替换索引中的所有文档
+func (idx *Index) Reset(docs []*Document) {
+	rebuilt := NewIndex()
+	for _, doc := range docs {
+		rebuilt.Add(doc)
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.docs, idx.postings, idx.length = rebuilt.docs, rebuilt.postings, rebuilt.length
+}
+
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// 搜索包含所有查询词的文档，按BM25相关度倒序，相关度相同时新文档在前
+func (idx *Index) Search(query string) []Hit {
+	terms := QueryTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	//从文档最少的词开始求交集
+	sort.Slice(terms, func(i, j int) bool {
+		return len(idx.postings[terms[i]]) < len(idx.postings[terms[j]])
+	})
+	scores := make(map[docKey]float64)
+	for key := range idx.postings[terms[0]] {
+		scores[key] = 0
+	}
+	n := float64(len(idx.docs))
+	avg := idx.length / math.Max(n, 1)
+	for _, term := range terms {
+		postings := idx.postings[term]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for key := range scores {
+			tf, ok := postings[key]
+			if !ok {
+				delete(scores, key)
+				continue
+			}
+			norm := 1 - bm25B + bm25B*idx.docs[key].length/math.Max(avg, 1)
+			scores[key] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	hits := make([]Hit, 0, len(scores))
+	for key, score := range scores {
+		hits = append(hits, Hit{Kind: key.kind, ID: key.id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].ID != hits[j].ID {
+			return hits[i].ID > hits[j].ID
+		}
+		return hits[i].Kind < hits[j].Kind
+	})
+	return hits
+}
@@ -0,0 +1,116 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	cases := map[string][]string{
+		"Hello, Gin-Web 2020!": {"hello", "gin", "web", "2020"},
+		"Go语言":                 {"go", "语", "语言", "言"},
+		"中文 検索":                {"中", "中文", "文", "検", "検索", "索"},
+		"":                     {},
+	}
+	for text, want := range cases {
+		if got := Tokenize(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	cases := map[string][]string{
+		"Go go GO": {"go"},
+		"语言":       {"语言"},
+		"编程语言":     {"编程", "程语", "语言"},
+		"语 gin":    {"语", "gin"},
+		"!!":       {},
+	}
+	for query, want := range cases {
+		if got := QueryTerms(query); !reflect.DeepEqual(got, want) {
+			t.Errorf("QueryTerms(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	cases := []struct {
+		text, query string
+		size        int
+		want        string
+	}{
+		{"Learn Go and gin", "go", 100, "Learn <mark>Go</mark> and gin"},
+		//英文单词需要完整匹配
+		{"Going to go", "go", 100, "Going to <mark>go</mark>"},
+		{"学习Go语言编程", "语言", 100, "学习Go<mark>语言</mark>编程"},
+		{"a <b> & go", "go", 100, "a &lt;b&gt; &amp; <mark>go</mark>"},
+		{"0123456789abcdefghij go", "go", 8, "...fghij <mark>go</mark>"},
+		{"go 0123456789", "go", 8, "<mark>go</mark> 01234..."},
+		{"no match here", "gin", 5, "no ma..."},
+	}
+	for _, tc := range cases {
+		if got := string(Highlight(tc.text, tc.query, tc.size)); got != tc.want {
+			t.Errorf("Highlight(%q, %q, %d) = %q, want %q", tc.text, tc.query, tc.size, got, tc.want)
+		}
+	}
+}
+
+func hitIds(hits []Hit) string {
+	ids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.Kind+string(rune('0'+hit.ID)))
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(&Document{Kind: "post", ID: 1, Title: "Gin middleware", Body: "writing middleware for the web framework"})
+	idx.Add(&Document{Kind: "post", ID: 2, Title: "Notes", Body: "gin is a web framework written in go", Tags: []string{"go"}})
+	idx.Add(&Document{Kind: "page", ID: 1, Title: "About", Body: "关于我，喜欢Go语言"})
+	if idx.Len() != 3 {
+		t.Fatalf("Len = %d", idx.Len())
+	}
+
+	//标题命中排在正文命中之前
+	if got := hitIds(idx.Search("gin")); got != "post1,post2" {
+		t.Errorf("Search(gin) = %s", got)
+	}
+	//所有查询词都要命中
+	if got := hitIds(idx.Search("gin go")); got != "post2" {
+		t.Errorf("Search(gin go) = %s", got)
+	}
+	if got := hitIds(idx.Search("语言")); got != "page1" {
+		t.Errorf("Search(语言) = %s", got)
+	}
+	if got := hitIds(idx.Search("语")); got != "page1" {
+		t.Errorf("Search(语) = %s", got)
+	}
+	if hits := idx.Search("python"); len(hits) != 0 {
+		t.Errorf("Search(python) = %v", hits)
+	}
+	if hits := idx.Search("  "); hits != nil {
+		t.Errorf("empty query = %v", hits)
+	}
+
+	//替换文档后旧内容不再命中
+	idx.Add(&Document{Kind: "post", ID: 1, Title: "Echo", Body: "another framework"})
+	if got := hitIds(idx.Search("gin")); got != "post2" {
+		t.Errorf("Search(gin) after replace = %s", got)
+	}
+	idx.Remove("post", 2)
+	idx.Remove("post", 9)
+	if hits := idx.Search("gin"); len(hits) != 0 {
+		t.Errorf("Search(gin) after remove = %v", hits)
+	}
+	if got := hitIds(idx.Search("framework")); got != "post1" {
+		t.Errorf("Search(framework) = %s", got)
+	}
+
+	idx.Reset([]*Document{{Kind: "page", ID: 2, Title: "Gin"}})
+	if idx.Len() != 1 || hitIds(idx.Search("gin")) != "page2" || len(idx.Search("framework")) != 0 {
+		t.Errorf("after Reset: %d docs", idx.Len())
+	}
+}
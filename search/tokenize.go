@@ -0,0 +1,80 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 中日韩文字没有空格分词，按单字和相邻两字建立索引
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// 字母和数字组成的单词，不包括中日韩文字
+func isWordRune(r rune) bool {
+	return (unicode.IsLetter(r) || unicode.IsDigit(r)) && !isCJK(r)
+}
+
+// 把文本切分为词，英文和数字按单词转为小写，中日韩文字连续的部分交给cjk处理
+func split(text string, word func(string), cjk func([]rune)) {
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case isCJK(r):
+			j := i
+			for j < len(runes) && isCJK(runes[j]) {
+				j++
+			}
+			cjk(runes[i:j])
+			i = j
+		case isWordRune(r):
+			j := i
+			for j < len(runes) && isWordRune(runes[j]) {
+				j++
+			}
+			word(strings.ToLower(string(runes[i:j])))
+			i = j
+		default:
+			i++
+		}
+	}
+}
+
+// 建立索引时的分词，中日韩文字同时输出单字和相邻两字，单字查询和多字查询都能命中
+func Tokenize(text string) []string {
+	tokens := make([]string, 0)
+	split(text, func(w string) {
+		tokens = append(tokens, w)
+	}, func(run []rune) {
+		for i := range run {
+			tokens = append(tokens, string(run[i]))
+			if i+1 < len(run) {
+				tokens = append(tokens, string(run[i:i+2]))
+			}
+		}
+	})
+	return tokens
+}
+
+// 查询时的分词，两个字以上的中日韩文字只使用相邻两字，结果去重
+func QueryTerms(query string) []string {
+	terms := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(term string) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	split(query, add, func(run []rune) {
+		if len(run) == 1 {
+			add(string(run))
+			return
+		}
+		for i := 0; i+1 < len(run); i++ {
+			add(string(run[i : i+2]))
+		}
+	})
+	return terms
+}
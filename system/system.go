@@ -2,6 +2,9 @@ package system
 
 import (
 	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
 	"github.com/go-yaml/yaml"
 )
 
@@ -25,14 +28,102 @@ type Configuration struct {
 	Public             string `yaml:"public"`         //public
 	Addr               string `yaml:"addr"`           //addr
 	BackupKey          string `yaml:"backup_key"`     //backup_key
+	Driver             string `yaml:"driver"`         //database driver: mysql, sqlite3, postgres
 	DSN                string `yaml:"dsn"`            //database dsn
 	NotifyEmails       string `yaml:"notify_emails"`  //notify_emails
 	PageSize           int    `yaml:"page_size"`      //page_size
 	SmmsFileServer     string `yaml:"smms_fileserver"`
+	// password hash algorithm: bcrypt, argon2id
+	PasswordAlgorithm string `yaml:"password_algorithm"`
+	// bcrypt cost or argon2id iterations
+	PasswordCost int `yaml:"password_cost"`
+	// session backend: database, memory
+	SessionBackend string `yaml:"session_backend"`
+	// session expires after being idle for this duration, e.g. 72h
+	SessionIdleTimeout time.Duration `yaml:"session_idle_timeout"`
+	// session expires this duration after sign in regardless of activity, e.g. 168h
+	SessionAbsoluteTimeout time.Duration `yaml:"session_absolute_timeout"`
+	// lock the account temporarily after this many consecutive failed sign in attempts
+	LoginMaxFailures int `yaml:"login_max_failures"`
+	// require captcha after this many failed attempts from the account or ip
+	LoginCaptchaAfter int `yaml:"login_captcha_after"`
+	// temporary lock duration, also the window of counting failed attempts per ip, e.g. 15m
+	LoginLockDuration time.Duration `yaml:"login_lock_duration"`
+	// reverse proxies whose X-Forwarded-For and X-Real-Ip headers are trusted, ips or CIDRs, e.g. 127.0.0.1
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// admins must enable two-factor authentication before using the admin area
+	TwoFactorRequired bool `yaml:"two_factor_required"`
+	// oauth providers used to sign in, the github_* settings are used when empty
+	OAuthProviders []OAuthProviderConfig `yaml:"oauth_providers"`
+	// permalink pattern of posts, variables: :year :month :day :slug :id, e.g. /:year/:month/:slug
+	PostPermalink string `yaml:"post_permalink"`
+	// permalink pattern of pages
+	PagePermalink string `yaml:"page_permalink"`
+	// revisions kept per post or page, older ones are deleted on save, negative keeps all
+	RevisionLimit int `yaml:"revision_limit"`
+	// nesting levels of comment replies on the post page, deeper replies are shown at the last level
+	CommentMaxDepth int `yaml:"comment_max_depth"`
+	// users can delete their own comments within this duration after posting, e.g. 15m
+	CommentEditWindow time.Duration `yaml:"comment_edit_window"`
+	// visitors can comment without signing in by entering a name and email, guest comments are always moderated
+	GuestComments bool `yaml:"guest_comments"`
+	// heuristic spam filtering of comments from users without moderation permission
+	Spam SpamConfig `yaml:"spam"`
+}
+
+type SpamConfig struct {
+	MaxLinks        int           `yaml:"max_links"`        // comments with more links are spam, negative disables the check
+	Blocklist       []string      `yaml:"blocklist"`        // comments containing any of these words are spam, case insensitive
+	DuplicateWindow time.Duration `yaml:"duplicate_window"` // repeated content within this duration is spam, e.g. 24h
+	RateLimit       int           `yaml:"rate_limit"`       // comments allowed per user within rate_window, negative disables the check
+	RateWindow      time.Duration `yaml:"rate_window"`      // e.g. 10m
+}
+
+type OAuthProviderConfig struct {
+	Name         string   `yaml:"name"`         // used in /auth/:name and user_identities, defaults to type
+	Type         string   `yaml:"type"`         // github, gitlab, gitea, oidc
+	DisplayName  string   `yaml:"display_name"` // text of the sign in button
+	ClientId     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"` // defaults to <domain>/oauth2callback/<name>
+	Scopes       []string `yaml:"scopes"`
+	BaseURL      string   `yaml:"base_url"`     // gitlab, gitea or github enterprise server
+	Issuer       string   `yaml:"issuer"`       // oidc issuer, endpoints are discovered from it
+	AuthURL      string   `yaml:"auth_url"`     // override the authorization endpoint
+	TokenURL     string   `yaml:"token_url"`    // override the token endpoint
+	UserInfoURL  string   `yaml:"userinfo_url"` // override the profile endpoint
 }
 
 const (
 	DEFAULT_PAGESIZE = 10
+
+	SESSION_BACKEND_DATABASE = "database"
+	SESSION_BACKEND_MEMORY   = "memory"
+
+	DEFAULT_SESSION_IDLE_TIMEOUT     = 72 * time.Hour
+	DEFAULT_SESSION_ABSOLUTE_TIMEOUT = 7 * 24 * time.Hour
+
+	DEFAULT_LOGIN_MAX_FAILURES  = 5
+	DEFAULT_LOGIN_CAPTCHA_AFTER = 3
+	DEFAULT_LOGIN_LOCK_DURATION = 15 * time.Minute
+
+	OAUTH_PROVIDER_GITHUB = "github"
+	OAUTH_PROVIDER_GITLAB = "gitlab"
+	OAUTH_PROVIDER_GITEA  = "gitea"
+	OAUTH_PROVIDER_OIDC   = "oidc"
+
+	DEFAULT_POST_PERMALINK = "/post/:slug"
+	DEFAULT_PAGE_PERMALINK = "/page/:slug"
+
+	DEFAULT_REVISION_LIMIT = 50
+
+	DEFAULT_COMMENT_MAX_DEPTH   = 3
+	DEFAULT_COMMENT_EDIT_WINDOW = 15 * time.Minute
+
+	DEFAULT_SPAM_MAX_LINKS        = 2
+	DEFAULT_SPAM_DUPLICATE_WINDOW = 24 * time.Hour
+	DEFAULT_SPAM_RATE_LIMIT       = 5
+	DEFAULT_SPAM_RATE_WINDOW      = 10 * time.Minute
 )
 
 var configuration *Configuration
@@ -52,11 +143,80 @@ func LoadConfiguration(path string) error {
 	if config.PageSize <= 0 {
 		config.PageSize = DEFAULT_PAGESIZE
 	}
+	if config.SessionBackend == "" {
+		config.SessionBackend = SESSION_BACKEND_DATABASE
+	}
+	if config.SessionIdleTimeout <= 0 {
+		config.SessionIdleTimeout = DEFAULT_SESSION_IDLE_TIMEOUT
+	}
+	if config.SessionAbsoluteTimeout <= 0 {
+		config.SessionAbsoluteTimeout = DEFAULT_SESSION_ABSOLUTE_TIMEOUT
+	}
+	if config.LoginMaxFailures <= 0 {
+		config.LoginMaxFailures = DEFAULT_LOGIN_MAX_FAILURES
+	}
+	if config.LoginCaptchaAfter <= 0 {
+		config.LoginCaptchaAfter = DEFAULT_LOGIN_CAPTCHA_AFTER
+	}
+	if config.LoginLockDuration <= 0 {
+		config.LoginLockDuration = DEFAULT_LOGIN_LOCK_DURATION
+	}
+	if config.PostPermalink == "" {
+		config.PostPermalink = DEFAULT_POST_PERMALINK
+	}
+	if config.PagePermalink == "" {
+		config.PagePermalink = DEFAULT_PAGE_PERMALINK
+	}
+	if config.RevisionLimit == 0 {
+		config.RevisionLimit = DEFAULT_REVISION_LIMIT
+	}
+	if config.CommentMaxDepth <= 0 {
+		config.CommentMaxDepth = DEFAULT_COMMENT_MAX_DEPTH
+	}
+	if config.CommentEditWindow <= 0 {
+		config.CommentEditWindow = DEFAULT_COMMENT_EDIT_WINDOW
+	}
+	if config.Spam.MaxLinks == 0 {
+		config.Spam.MaxLinks = DEFAULT_SPAM_MAX_LINKS
+	}
+	if config.Spam.DuplicateWindow <= 0 {
+		config.Spam.DuplicateWindow = DEFAULT_SPAM_DUPLICATE_WINDOW
+	}
+	if config.Spam.RateLimit == 0 {
+		config.Spam.RateLimit = DEFAULT_SPAM_RATE_LIMIT
+	}
+	if config.Spam.RateWindow <= 0 {
+		config.Spam.RateWindow = DEFAULT_SPAM_RATE_WINDOW
+	}
+	if len(config.OAuthProviders) == 0 && config.GithubClientId != "" {
+		config.OAuthProviders = []OAuthProviderConfig{legacyGithubProvider(&config)}
+	}
 	//为下面的GetConfiguration做准备，但是这样写合适吗
 	configuration = &config
 	return err
 }
 
+//兼容旧的github_*配置，github_authurl形如https://github.com/login/oauth/authorize?client_id=%s&scope=user:email&state=%s
+func legacyGithubProvider(config *Configuration) OAuthProviderConfig {
+	provider := OAuthProviderConfig{
+		Name:         OAUTH_PROVIDER_GITHUB,
+		Type:         OAUTH_PROVIDER_GITHUB,
+		ClientId:     config.GithubClientId,
+		ClientSecret: config.GithubClientSecret,
+		RedirectURL:  config.GithubRedirectURL,
+		TokenURL:     config.GithubTokenUrl,
+		Scopes:       strings.Fields(strings.Replace(config.GithubScope, ",", " ", -1)),
+	}
+	if u, err := url.Parse(config.GithubAuthUrl); err == nil && u.Host != "" {
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = strings.Fields(strings.Replace(u.Query().Get("scope"), ",", " ", -1))
+		}
+		u.RawQuery = ""
+		provider.AuthURL = u.String()
+	}
+	return provider
+}
+
 func GetConfiguration() *Configuration {
 	return configuration
 